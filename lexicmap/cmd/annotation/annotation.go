@@ -0,0 +1,497 @@
+// Copyright © 2023-2026 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package annotation
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/shenwei356/LexicMap/lexicmap/cmd/util"
+)
+
+var be = binary.BigEndian
+
+// Magic number for checking file format
+var Magic = [8]byte{'.', 'a', 'n', 'n', 'o', 't', 'a', 't'}
+
+// Magic number for the index file
+var MagicIdx = [8]byte{'.', 'a', 'n', 'n', 'i', 'd', 'e', 'x'}
+
+// AnnotationsIndexFileExt is the file extension of the annotation index file.
+var AnnotationsIndexFileExt = ".idx"
+
+// MainVersion is use for checking compatibility
+var MainVersion uint8 = 0
+
+// MinorVersion is less important
+var MinorVersion uint8 = 1
+
+// BufferSize is size of reading and writing buffer
+var BufferSize = 65536 // os.Getpagesize()
+
+// ErrInvalidFileFormat means invalid file format.
+var ErrInvalidFileFormat = errors.New("annotation data: invalid binary format")
+
+// ErrBrokenFile means the file is not complete.
+var ErrBrokenFile = errors.New("annotation data: broken file")
+
+// ErrVersionMismatch means version mismatch between files and program
+var ErrVersionMismatch = errors.New("annotation data: version mismatch")
+
+// Feature is a genomic feature, e.g., a CDS or a RNA gene.
+type Feature struct {
+	Start  uint32 // 1-based
+	End    uint32 // 1-based, closed interval
+	Strand byte   // '+', '-', or '.'
+
+	Type     string
+	ID       string
+	LocusTag string
+	Product  string
+}
+
+// String returns a brief summary of the feature.
+func (f *Feature) String() string {
+	return fmt.Sprintf("%s %s:%d-%d:%c", f.Type, f.ID, f.Start, f.End, f.Strand)
+}
+
+// Writer is used for writing features of genomes.
+//
+// Data file format:
+//
+//	magic number (8 bytes)
+//	versions (8 bytes)
+//	# genome 1
+//	    n_seqs (4 bytes)
+//	    # for each sequence
+//	        n_features (4 bytes), data length (4 bytes)
+//	    # features of each sequence
+//	        start (4 bytes), end (4 bytes), strand (1 byte),
+//	        len(type) (2 bytes), type (X bytes),
+//	        len(id) (2 bytes), id (X bytes),
+//	        len(locus_tag) (2 bytes), locus_tag (X bytes),
+//	        len(product) (2 bytes), product (X bytes)
+//	# genome 2
+//	...
+//
+// Index file format:
+//
+//	magic number (8 bytes)
+//	versions (8 bytes)
+//	batch (4 bytes), the number of genomes (4 bytes)
+//	offset of genome 1 (8 bytes)
+//	offset of genome 2 (8 bytes)
+//	...
+type Writer struct {
+	batch uint32
+	file  string
+	fh    *os.File
+	w     *bufio.Writer
+
+	bBuf   bytes.Buffer
+	bBuf2  bytes.Buffer
+	buf    []byte
+	offset int
+
+	// offsets
+	index []int
+}
+
+// NewWriter creates a writer.
+func NewWriter(file string, batch uint32) (*Writer, error) {
+	w := &Writer{
+		batch: batch,
+		file:  file,
+		index: make([]int, 0, 1024),
+	}
+	var err error
+	w.fh, err = os.Create(file)
+	if err != nil {
+		return nil, err
+	}
+	w.w = bufio.NewWriterSize(w.fh, BufferSize)
+
+	w.buf = make([]byte, 16)
+
+	// 8-byte magic number
+	err = binary.Write(w.w, be, Magic)
+	if err != nil {
+		return nil, err
+	}
+	w.offset += 8
+
+	// 8-byte meta info
+	// actually, only 2 bytes used and the left 6 bytes is preserved.
+	err = binary.Write(w.w, be, [8]uint8{MainVersion, MinorVersion})
+	if err != nil {
+		return nil, err
+	}
+	w.offset += 8
+	return w, nil
+}
+
+// Write writes features of all sequences of a genome.
+// Features of a sequence should be sorted by start positions.
+func (w *Writer) Write(seqs [][]*Feature) error {
+	w.index = append(w.index, w.offset)
+
+	buf := w.buf
+	buf0 := &w.bBuf // header
+	buf1 := &w.bBuf2
+	buf0.Reset()
+	buf1.Reset()
+
+	// the number of sequences
+	be.PutUint32(buf[:4], uint32(len(seqs)))
+	buf0.Write(buf[:4])
+
+	var pre int
+	for _, features := range seqs {
+		pre = buf1.Len()
+		for _, f := range features {
+			be.PutUint32(buf[:4], f.Start)
+			be.PutUint32(buf[4:8], f.End)
+			buf[8] = f.Strand
+			buf1.Write(buf[:9])
+
+			writeString(buf1, buf, f.Type)
+			writeString(buf1, buf, f.ID)
+			writeString(buf1, buf, f.LocusTag)
+			writeString(buf1, buf, f.Product)
+		}
+
+		be.PutUint32(buf[:4], uint32(len(features)))
+		be.PutUint32(buf[4:8], uint32(buf1.Len()-pre))
+		buf0.Write(buf[:8])
+	}
+
+	// ------------------------------------------------
+	// write data to file
+	_, err := w.w.Write(buf0.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = w.w.Write(buf1.Bytes())
+	if err != nil {
+		return err
+	}
+	w.offset += buf0.Len() + buf1.Len()
+
+	return nil
+}
+
+func writeString(bw *bytes.Buffer, buf []byte, s string) {
+	if len(s) > 65535 {
+		s = s[:65535]
+	}
+	be.PutUint16(buf[:2], uint16(len(s)))
+	bw.Write(buf[:2])
+	bw.WriteString(s)
+}
+
+// Close closes the writer and writes the index file.
+func (w *Writer) Close() error {
+	err := w.w.Flush()
+	if err != nil {
+		return err
+	}
+
+	err = w.fh.Close()
+	if err != nil {
+		return err
+	}
+
+	// ------------------------------------------------
+	// write the index
+
+	fh, err := os.Create(filepath.Clean(w.file) + AnnotationsIndexFileExt)
+	if err != nil {
+		return err
+	}
+	wtr := bufio.NewWriterSize(fh, BufferSize)
+
+	// magic
+	err = binary.Write(wtr, be, MagicIdx)
+	if err != nil {
+		return err
+	}
+
+	// versions
+	// actually, only 2 bytes used and the left 6 bytes is preserved.
+	err = binary.Write(wtr, be, [8]uint8{MainVersion, MinorVersion})
+	if err != nil {
+		return err
+	}
+
+	buf := w.buf
+
+	// batch number and the number of records
+	be.PutUint32(buf[:4], w.batch)
+	be.PutUint32(buf[4:8], uint32(len(w.index)))
+	_, err = wtr.Write(buf[:8])
+	if err != nil {
+		return err
+	}
+
+	for _, offset := range w.index {
+		be.PutUint64(buf[:8], uint64(offset))
+		_, err = wtr.Write(buf[:8])
+		if err != nil {
+			return err
+		}
+	}
+
+	err = wtr.Flush()
+	if err != nil {
+		return err
+	}
+
+	return fh.Close()
+}
+
+// Reader is for reading features of genomes.
+// A Reader can not be used by multiple goroutines concurrently.
+type Reader struct {
+	batch   uint32
+	offsets []int64 // offsets of genome records
+
+	f util.File
+
+	buf  []byte
+	data []byte
+}
+
+var poolReader = &sync.Pool{New: func() interface{} {
+	return &Reader{
+		buf:  make([]byte, 16),
+		data: make([]byte, 0, 4096),
+	}
+}}
+
+// NewReader returns a reader from an annotation file.
+// The reader is recycled after calling Close().
+func NewReader(file string) (*Reader, error) {
+	if strings.HasSuffix(file, AnnotationsIndexFileExt) {
+		return nil, fmt.Errorf("annotation file, not the index file should be given")
+	}
+
+	// ------------  index file ----------------
+
+	f, err := util.OpenFile(filepath.Clean(file) + AnnotationsIndexFileExt)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fh := util.NewFileReader(f)
+
+	r := poolReader.Get().(*Reader)
+	buf := r.buf
+
+	// magic number and versions
+	n, err := io.ReadFull(fh, buf[:16])
+	if err != nil || n < 16 {
+		poolReader.Put(r)
+		return nil, ErrBrokenFile
+	}
+	if !bytes.Equal(MagicIdx[:], buf[:8]) {
+		poolReader.Put(r)
+		return nil, ErrInvalidFileFormat
+	}
+	if MainVersion != buf[8] {
+		poolReader.Put(r)
+		return nil, ErrVersionMismatch
+	}
+
+	// batch number and the number of records
+	n, err = io.ReadFull(fh, buf[:8])
+	if err != nil || n < 8 {
+		poolReader.Put(r)
+		return nil, ErrBrokenFile
+	}
+	r.batch = be.Uint32(buf[:4])
+	nRecords := int(be.Uint32(buf[4:8]))
+
+	r.offsets = r.offsets[:0]
+	for i := 0; i < nRecords; i++ {
+		n, err = io.ReadFull(fh, buf[:8])
+		if err != nil || n < 8 {
+			poolReader.Put(r)
+			return nil, ErrBrokenFile
+		}
+		r.offsets = append(r.offsets, int64(be.Uint64(buf[:8])))
+	}
+
+	// ------------ data file ----------------
+
+	r.f, err = util.OpenFile(file)
+	if err != nil {
+		poolReader.Put(r)
+		return nil, err
+	}
+
+	n, err = r.f.ReadAt(buf[:16], 0)
+	if err != nil || n < 16 {
+		r.f.Close()
+		poolReader.Put(r)
+		return nil, ErrBrokenFile
+	}
+	if !bytes.Equal(Magic[:], buf[:8]) {
+		r.f.Close()
+		poolReader.Put(r)
+		return nil, ErrInvalidFileFormat
+	}
+
+	return r, nil
+}
+
+// Batch returns the batch number.
+func (r *Reader) Batch() uint32 {
+	return r.batch
+}
+
+// Genomes returns the number of genomes.
+func (r *Reader) Genomes() int {
+	return len(r.offsets)
+}
+
+// Close closes and recycles the reader.
+func (r *Reader) Close() error {
+	err := r.f.Close()
+	poolReader.Put(r)
+	return err
+}
+
+// Features returns features of the sequence with an index of seqIdx (0-based)
+// in the genome with an index of idx (0-based).
+// Features are appended to the given slice.
+func (r *Reader) Features(idx int, seqIdx int, features []*Feature) ([]*Feature, error) {
+	if idx < 0 || idx >= len(r.offsets) {
+		return features, fmt.Errorf("genome index (%d) out of range: [0, %d]", idx, len(r.offsets)-1)
+	}
+
+	buf := r.buf
+	offset := r.offsets[idx]
+
+	// the number of sequences
+	n, err := r.f.ReadAt(buf[:4], offset)
+	if n < 4 {
+		if err == nil {
+			err = ErrBrokenFile
+		}
+		return features, err
+	}
+	nSeqs := int(be.Uint32(buf[:4]))
+	if seqIdx < 0 || seqIdx >= nSeqs {
+		return features, nil
+	}
+
+	// the header
+	header := r.data[:0]
+	if cap(header) < nSeqs<<3 {
+		header = make([]byte, nSeqs<<3)
+	} else {
+		header = header[:nSeqs<<3]
+	}
+	n, err = r.f.ReadAt(header, offset+4)
+	if n < len(header) {
+		if err == nil {
+			err = ErrBrokenFile
+		}
+		return features, err
+	}
+	var dataOffset int64 = offset + 4 + int64(len(header))
+	for i := 0; i < seqIdx; i++ {
+		dataOffset += int64(be.Uint32(header[(i<<3)+4 : (i<<3)+8]))
+	}
+	nFeatures := int(be.Uint32(header[seqIdx<<3 : (seqIdx<<3)+4]))
+	size := int(be.Uint32(header[(seqIdx<<3)+4 : (seqIdx<<3)+8]))
+	if nFeatures == 0 {
+		r.data = header
+		return features, nil
+	}
+
+	// the data
+	data := header[:0]
+	if cap(data) < size {
+		data = make([]byte, size)
+	} else {
+		data = data[:size]
+	}
+	r.data = data
+	n, err = r.f.ReadAt(data, dataOffset)
+	if n < size {
+		if err == nil {
+			err = ErrBrokenFile
+		}
+		return features, err
+	}
+
+	var i, l int
+	readString := func() (string, error) {
+		if i+2 > len(data) {
+			return "", ErrBrokenFile
+		}
+		l = int(be.Uint16(data[i : i+2]))
+		i += 2
+		if i+l > len(data) {
+			return "", ErrBrokenFile
+		}
+		s := string(data[i : i+l])
+		i += l
+		return s, nil
+	}
+	for j := 0; j < nFeatures; j++ {
+		if i+9 > len(data) {
+			return features, ErrBrokenFile
+		}
+		f := &Feature{
+			Start:  be.Uint32(data[i : i+4]),
+			End:    be.Uint32(data[i+4 : i+8]),
+			Strand: data[i+8],
+		}
+		i += 9
+
+		if f.Type, err = readString(); err != nil {
+			return features, err
+		}
+		if f.ID, err = readString(); err != nil {
+			return features, err
+		}
+		if f.LocusTag, err = readString(); err != nil {
+			return features, err
+		}
+		if f.Product, err = readString(); err != nil {
+			return features, err
+		}
+
+		features = append(features, f)
+	}
+
+	return features, nil
+}
@@ -0,0 +1,250 @@
+// Copyright © 2023-2026 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package annotation
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAnnotations(t *testing.T) {
+	genomes := [][][]*Feature{
+		{}, // no sequences
+		{ // two sequences
+			{
+				{Start: 1, End: 300, Strand: '+', Type: "CDS", ID: "cds-1", LocusTag: "A_0001", Product: "DNA polymerase"},
+				{Start: 500, End: 1000, Strand: '-', Type: "tRNA", ID: "rna-1", LocusTag: "A_0002", Product: "tRNA-Ala"},
+			},
+			{},
+		},
+		{ // a sequence without features, and one with a feature
+			{},
+			{
+				{Start: 20, End: 40, Strand: '.', Type: "CDS"},
+			},
+		},
+	}
+
+	file := filepath.Join(t.TempDir(), "annotations.bin")
+
+	wtr, err := NewWriter(file, 3)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	for i, g := range genomes {
+		err = wtr.Write(g)
+		if err != nil {
+			t.Errorf("write #%d data: %s", i+1, err)
+			return
+		}
+	}
+	err = wtr.Close()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	rdr, err := NewReader(file)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer rdr.Close()
+
+	if rdr.Batch() != 3 {
+		t.Errorf("batch: expected %d, returned %d", 3, rdr.Batch())
+	}
+	if rdr.Genomes() != len(genomes) {
+		t.Errorf("genomes: expected %d, returned %d", len(genomes), rdr.Genomes())
+	}
+
+	var features []*Feature
+	for i, g := range genomes {
+		for j := 0; j <= len(g); j++ { // the last one is out of range
+			features, err = rdr.Features(i, j, features[:0])
+			if err != nil {
+				t.Errorf("read genome #%d, seq #%d: %s", i, j, err)
+				return
+			}
+			if j == len(g) {
+				if len(features) != 0 {
+					t.Errorf("genome #%d, seq #%d: no features expected", i, j)
+				}
+				continue
+			}
+			if len(features) != len(g[j]) {
+				t.Errorf("genome #%d, seq #%d: expected %d features, returned %d", i, j, len(g[j]), len(features))
+				continue
+			}
+			for k, f := range features {
+				if *f != *g[j][k] {
+					t.Errorf("genome #%d, seq #%d: expected %s, returned %s", i, j, g[j][k], f)
+				}
+			}
+		}
+	}
+
+	_, err = rdr.Features(len(genomes), 0, nil)
+	if err == nil {
+		t.Errorf("an error expected for a genome index out of range")
+	}
+}
+
+func TestReadGFF3(t *testing.T) {
+	data := `##gff-version 3
+##sequence-region NZ_CP000001.1 1 5000
+NZ_CP000001.1	RefSeq	region	1	5000	.	+	.	ID=NZ_CP000001.1:1..5000
+NZ_CP000001.1	RefSeq	gene	1200	2100	.	-	.	ID=gene-A_0002;locus_tag=A_0002
+NZ_CP000001.1	Protein Homology	CDS	1200	2100	.	-	0	ID=cds-WP_002.1;Parent=gene-A_0002;locus_tag=A_0002;product=ABC transporter%2C ATP-binding protein%3B putative
+NZ_CP000001.1	Protein Homology	CDS	100	1000	.	+	0	ID=cds-WP_001.1;locus_tag=A_0001;product=DnaA
+plasmid1	tRNAscan-SE	tRNA	10	85	.	+	.	ID=rna-1;product=tRNA-Ala
+##FASTA
+>NZ_CP000001.1
+ACGT
+`
+	file := filepath.Join(t.TempDir(), "test.gff")
+	if err := os.WriteFile(file, []byte(data), 0644); err != nil {
+		t.Error(err)
+		return
+	}
+
+	m, err := ReadGFF3(file, map[string]struct{}{"CDS": {}, "tRNA": {}})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	if len(m) != 2 {
+		t.Errorf("expected %d sequences, returned %d", 2, len(m))
+	}
+
+	features := m["NZ_CP000001.1"]
+	if len(features) != 2 {
+		t.Errorf("expected %d features, returned %d", 2, len(features))
+		return
+	}
+	expected := []Feature{
+		{Start: 100, End: 1000, Strand: '+', Type: "CDS", ID: "cds-WP_001.1", LocusTag: "A_0001", Product: "DnaA"},
+		{Start: 1200, End: 2100, Strand: '-', Type: "CDS", ID: "cds-WP_002.1", LocusTag: "A_0002", Product: "ABC transporter, ATP-binding protein, putative"},
+	}
+	for i, f := range features {
+		if *f != expected[i] {
+			t.Errorf("expected %+v, returned %+v", expected[i], *f)
+		}
+	}
+
+	if len(m["plasmid1"]) != 1 || m["plasmid1"][0].Product != "tRNA-Ala" {
+		t.Errorf("unexpected features of plasmid1: %v", m["plasmid1"])
+	}
+}
+
+func TestGenBankReader(t *testing.T) {
+	data := `LOCUS       NZ_CP000001             120 bp    DNA     circular CON 01-JAN-2024
+DEFINITION  Escherichia coli strain X chromosome, complete
+            genome.
+ACCESSION   NZ_CP000001
+VERSION     NZ_CP000001.1
+FEATURES             Location/Qualifiers
+     source          1..120
+                     /organism="Escherichia coli"
+     gene            complement(<10..>60)
+                     /locus_tag="A_0001"
+     CDS             complement(<10..>60)
+                     /locus_tag="A_0001"
+                     /product="hypothetical
+                     protein"
+                     /protein_id="WP_001.1"
+     CDS             join(70..90,
+                     100..110)
+                     /locus_tag="A_0002"
+ORIGIN
+        1 acgtacgtac gtacgtacgt acgtacgtac gtacgtacgt acgtacgtac gtacgtacgt
+       61 acgtacgtac gtacgtacgt acgtacgtac gtacgtacgt acgtacgtac gtacgtacgt
+//
+LOCUS       plasmid1                 8 bp    DNA     circular
+DEFINITION  plasmid.
+FEATURES             Location/Qualifiers
+     CDS             1..8
+                     /gene="xyz"
+                     /product="X"
+ORIGIN
+        1 aaaacccc
+//
+`
+	file := filepath.Join(t.TempDir(), "test.gbk")
+	if err := os.WriteFile(file, []byte(data), 0644); err != nil {
+		t.Error(err)
+		return
+	}
+
+	rdr, err := NewGenBankReader(file, map[string]struct{}{"CDS": {}})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	defer rdr.Close()
+
+	var records []*GenBankRecord
+	var record *GenBankRecord
+	for {
+		record, err = rdr.Read()
+		if err != nil {
+			break
+		}
+		records = append(records, record)
+	}
+	if len(records) != 2 {
+		t.Errorf("expected %d records, returned %d: %v", 2, len(records), err)
+		return
+	}
+
+	record = records[0]
+	if string(record.ID) != "NZ_CP000001.1" {
+		t.Errorf("unexpected id: %s", record.ID)
+	}
+	if string(record.Desc) != "Escherichia coli strain X chromosome, complete genome." {
+		t.Errorf("unexpected definition: %s", record.Desc)
+	}
+	if len(record.Seq) != 120 {
+		t.Errorf("expected sequence length %d, returned %d", 120, len(record.Seq))
+	}
+	expected := []Feature{
+		{Start: 10, End: 60, Strand: '-', Type: "CDS", ID: "WP_001.1", LocusTag: "A_0001", Product: "hypothetical protein"},
+		{Start: 70, End: 110, Strand: '+', Type: "CDS", ID: "A_0002", LocusTag: "A_0002"},
+	}
+	if len(record.Features) != len(expected) {
+		t.Errorf("expected %d features, returned %d", len(expected), len(record.Features))
+		return
+	}
+	for i, f := range record.Features {
+		if *f != expected[i] {
+			t.Errorf("expected %+v, returned %+v", expected[i], *f)
+		}
+	}
+
+	record = records[1]
+	if string(record.ID) != "plasmid1" || string(record.Seq) != "aaaacccc" ||
+		len(record.Features) != 1 || record.Features[0].ID != "xyz" {
+		t.Errorf("unexpected record: %s %s %v", record.ID, record.Seq, record.Features)
+	}
+}
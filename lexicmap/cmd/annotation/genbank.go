@@ -0,0 +1,308 @@
+// Copyright © 2023-2026 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package annotation
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/shenwei356/xopen"
+)
+
+// GenBankRecord is a sequence record in GenBank format.
+type GenBankRecord struct {
+	ID       []byte // accession.version, or the locus name if not available
+	Desc     []byte // definition
+	Seq      []byte
+	Features []*Feature // sorted by start positions
+}
+
+// GenBankReader reads sequences and features from a GenBank file.
+type GenBankReader struct {
+	file  string
+	fh    *xopen.Reader
+	r     *bufio.Reader
+	types map[string]struct{}
+
+	nLine int
+}
+
+// NewGenBankReader creates a GenBankReader. Only features of the given types
+// are kept, and all features are kept if types is empty.
+func NewGenBankReader(file string, types map[string]struct{}) (*GenBankReader, error) {
+	fh, err := xopen.Ropen(file)
+	if err != nil {
+		return nil, err
+	}
+	return &GenBankReader{
+		file:  file,
+		fh:    fh,
+		r:     bufio.NewReaderSize(fh, BufferSize),
+		types: types,
+	}, nil
+}
+
+// Close closes the reader.
+func (r *GenBankReader) Close() error {
+	return r.fh.Close()
+}
+
+// readLine reads a line without the line break.
+func (r *GenBankReader) readLine() ([]byte, error) {
+	line, err := r.r.ReadBytes('\n')
+	if len(line) == 0 && err != nil {
+		return nil, err
+	}
+	r.nLine++
+	return bytes.TrimRight(line, "\r\n"), nil
+}
+
+// Read reads a record, io.EOF is returned if there are no more records.
+func (r *GenBankReader) Read() (*GenBankRecord, error) {
+	var line []byte
+	var err error
+
+	// the LOCUS line
+	for {
+		line, err = r.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if bytes.HasPrefix(line, []byte("LOCUS")) {
+			break
+		}
+		if len(bytes.TrimSpace(line)) > 0 {
+			return nil, fmt.Errorf("%s: line %d: LOCUS line expected", r.file, r.nLine)
+		}
+	}
+
+	record := &GenBankRecord{}
+	fields := bytes.Fields(line)
+	if len(fields) > 1 {
+		record.ID = append(record.ID, fields[1]...)
+	}
+
+	var accession, version []byte
+	var section string // keyword of the current section
+	var f *gbFeature
+	features := make([]*Feature, 0, 1024)
+	seq := make([]byte, 0, 1<<20)
+
+	finishFeature := func() error {
+		if f == nil {
+			return nil
+		}
+		feature, err := f.Feature(r.types)
+		if err != nil {
+			return fmt.Errorf("%s: %s", r.file, err)
+		}
+		if feature != nil {
+			features = append(features, feature)
+		}
+		f = nil
+		return nil
+	}
+
+	for {
+		line, err = r.readLine()
+		if err != nil {
+			if err == io.EOF {
+				return nil, fmt.Errorf("%s: unexpected end of file, '//' expected", r.file)
+			}
+			return nil, err
+		}
+
+		if bytes.HasPrefix(line, []byte("//")) { // the end of a record
+			break
+		}
+
+		if len(line) > 0 && line[0] != ' ' { // a new section
+			section = string(bytes.Fields(line)[0])
+
+			switch section {
+			case "DEFINITION":
+				record.Desc = append(record.Desc, bytes.TrimSpace(line[10:])...)
+			case "ACCESSION":
+				if fields = bytes.Fields(line); len(fields) > 1 {
+					accession = fields[1]
+				}
+			case "VERSION":
+				if fields = bytes.Fields(line); len(fields) > 1 {
+					version = fields[1]
+				}
+			}
+			continue
+		}
+
+		switch section {
+		case "DEFINITION":
+			record.Desc = append(record.Desc, ' ')
+			record.Desc = append(record.Desc, bytes.TrimSpace(line)...)
+		case "FEATURES":
+			if len(line) < 22 {
+				continue
+			}
+			if line[5] != ' ' { // a new feature
+				if err = finishFeature(); err != nil {
+					return nil, err
+				}
+				f = &gbFeature{
+					key:      string(bytes.TrimSpace(line[5:21])),
+					location: string(bytes.TrimSpace(line[21:])),
+				}
+				continue
+			}
+			if f != nil {
+				f.Add(bytes.TrimSpace(line[21:]))
+			}
+		case "ORIGIN":
+			for _, b := range line {
+				if (b >= 'a' && b <= 'z') || (b >= 'A' && b <= 'Z') {
+					seq = append(seq, b)
+				}
+			}
+		}
+	}
+	if err = finishFeature(); err != nil {
+		return nil, err
+	}
+
+	if len(version) > 0 {
+		record.ID = append(record.ID[:0], version...)
+	} else if len(accession) > 0 {
+		record.ID = append(record.ID[:0], accession...)
+	}
+	record.Seq = seq
+	SortFeatures(features)
+	record.Features = features
+
+	return record, nil
+}
+
+// gbFeature is a feature being parsed.
+type gbFeature struct {
+	key      string
+	location string
+
+	qualifiers [][2]string
+	inQual     bool
+}
+
+// Add adds a line of the location or qualifiers.
+func (f *gbFeature) Add(line []byte) {
+	if len(line) > 0 && line[0] == '/' { // a new qualifier
+		k, v, _ := strings.Cut(string(line[1:]), "=")
+		f.qualifiers = append(f.qualifiers, [2]string{k, v})
+		f.inQual = true
+		return
+	}
+	if !f.inQual { // multiple-line location
+		f.location += string(line)
+		return
+	}
+	q := &f.qualifiers[len(f.qualifiers)-1]
+	q[1] += " " + string(line)
+}
+
+// Qualifier returns the value of a qualifier.
+func (f *gbFeature) Qualifier(key string) string {
+	for _, q := range f.qualifiers {
+		if q[0] == key {
+			return CleanValue(strings.Trim(q[1], `"`))
+		}
+	}
+	return ""
+}
+
+// Feature converts it to a Feature, nil is returned for unwanted types
+// or features with locations in other records.
+func (f *gbFeature) Feature(types map[string]struct{}) (*Feature, error) {
+	if len(types) > 0 {
+		if _, ok := types[f.key]; !ok {
+			return nil, nil
+		}
+	}
+	if strings.IndexByte(f.location, ':') >= 0 {
+		return nil, nil
+	}
+
+	start, end, strand, err := parseGenBankLocation(f.location)
+	if err != nil {
+		return nil, err
+	}
+
+	feature := &Feature{
+		Start:    start,
+		End:      end,
+		Strand:   strand,
+		Type:     f.key,
+		LocusTag: f.Qualifier("locus_tag"),
+		Product:  f.Qualifier("product"),
+	}
+	for _, k := range []string{"protein_id", "locus_tag", "gene"} {
+		if feature.ID = f.Qualifier(k); feature.ID != "" {
+			break
+		}
+	}
+	return feature, nil
+}
+
+// parseGenBankLocation returns the span of a location, e.g.,
+// "complement(join(100..200,300..>400))" -> 100, 400, '-'.
+func parseGenBankLocation(location string) (uint32, uint32, byte, error) {
+	strand := byte('+')
+	if strings.Contains(location, "complement(") {
+		strand = '-'
+	}
+
+	s := location
+	for _, op := range []string{"complement(", "join(", "order(", "<", ">", ")"} {
+		s = strings.ReplaceAll(s, op, "")
+	}
+
+	var start, end uint32 = 0, 0
+	var a, b string
+	var ok bool
+	for _, r := range strings.Split(s, ",") {
+		if a, b, ok = strings.Cut(r, ".."); !ok {
+			if a, b, ok = strings.Cut(r, "^"); !ok {
+				b = a
+			}
+		}
+		for _, p := range []string{a, b} {
+			v, err := strconv.ParseUint(strings.TrimSpace(p), 10, 32)
+			if err != nil || v == 0 {
+				return 0, 0, 0, fmt.Errorf("invalid location: %s", location)
+			}
+			if start == 0 || uint32(v) < start {
+				start = uint32(v)
+			}
+			if uint32(v) > end {
+				end = uint32(v)
+			}
+		}
+	}
+	return start, end, strand, nil
+}
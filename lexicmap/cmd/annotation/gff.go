@@ -0,0 +1,160 @@
+// Copyright © 2023-2026 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package annotation
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/shenwei356/xopen"
+)
+
+// ReadGFF3 reads features of the given types from a GFF3 file,
+// and returns features of each sequence, sorted by start positions.
+// All features are returned if types is empty.
+func ReadGFF3(file string, types map[string]struct{}) (map[string][]*Feature, error) {
+	fh, err := xopen.Ropen(file)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	m := make(map[string][]*Feature, 8)
+
+	r := bufio.NewReaderSize(fh, BufferSize)
+	var line string
+	var items []string
+	var start, end int
+	var ok bool
+	var nLine int
+	for {
+		line, err = r.ReadString('\n')
+		if line == "" && err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		nLine++
+
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			continue
+		}
+		if line[0] == '#' {
+			if strings.HasPrefix(line, "##FASTA") { // the end of features
+				break
+			}
+			continue
+		}
+
+		items = strings.Split(line, "\t")
+		if len(items) < 9 {
+			return nil, fmt.Errorf("%s: line %d: 9 columns expected, %d given", file, nLine, len(items))
+		}
+
+		if len(types) > 0 {
+			if _, ok = types[items[2]]; !ok {
+				continue
+			}
+		}
+
+		start, err = strconv.Atoi(items[3])
+		if err != nil || start < 1 {
+			return nil, fmt.Errorf("%s: line %d: invalid start position: %s", file, nLine, items[3])
+		}
+		end, err = strconv.Atoi(items[4])
+		if err != nil || end < start {
+			return nil, fmt.Errorf("%s: line %d: invalid end position: %s", file, nLine, items[4])
+		}
+
+		f := &Feature{
+			Start:  uint32(start),
+			End:    uint32(end),
+			Strand: '.',
+			Type:   items[2],
+		}
+		if items[6] == "+" || items[6] == "-" {
+			f.Strand = items[6][0]
+		}
+
+		attrs := parseGFFAttributes(items[8])
+		if f.ID, ok = attrs["ID"]; !ok {
+			f.ID = attrs["Name"]
+		}
+		f.LocusTag = attrs["locus_tag"]
+		f.Product = attrs["product"]
+
+		m[items[0]] = append(m[items[0]], f)
+	}
+
+	for _, features := range m {
+		SortFeatures(features)
+	}
+
+	return m, nil
+}
+
+// parseGFFAttributes parses the attributes column of GFF3,
+// with escaped characters decoded.
+func parseGFFAttributes(s string) map[string]string {
+	attrs := make(map[string]string, 8)
+	var k, v, v2 string
+	var ok bool
+	var err error
+	for _, kv := range strings.Split(s, ";") {
+		kv = strings.TrimSpace(kv)
+		if k, v, ok = strings.Cut(kv, "="); !ok {
+			continue
+		}
+		if strings.IndexByte(v, '%') >= 0 {
+			if v2, err = url.PathUnescape(v); err == nil {
+				v = v2
+			}
+		}
+		attrs[k] = CleanValue(v)
+	}
+	return attrs
+}
+
+// CleanValue replaces tabs, line breaks, and semicolons in a value,
+// which are used as separators in outputs.
+func CleanValue(s string) string {
+	if strings.ContainsAny(s, "\t\r\n;") {
+		return strings.NewReplacer("\t", " ", "\r", " ", "\n", " ", ";", ",").Replace(s)
+	}
+	return s
+}
+
+// SortFeatures sorts features by start and end positions.
+func SortFeatures(features []*Feature) {
+	slices.SortStableFunc(features, func(a, b *Feature) int {
+		if a.Start == b.Start {
+			return int(a.End) - int(b.End)
+		}
+		return int(a.Start) - int(b.Start)
+	})
+}
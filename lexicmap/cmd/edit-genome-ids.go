@@ -193,6 +193,11 @@ Tips:
 			if err != nil {
 				checkError(fmt.Errorf("failed to update %s: %s", fileGenomeIndex0, err))
 			}
+
+			err = updateIndexManifest(dbDir, []string{FileGenomeIndex}, 1)
+			if err != nil {
+				checkError(fmt.Errorf("failed to update manifest file: %s", err))
+			}
 		}
 
 		log.Infof("%d of %d genome IDs are changed", _n, N)
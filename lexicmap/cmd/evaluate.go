@@ -0,0 +1,321 @@
+// Copyright © 2023-2026 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var evaluateCmd = &cobra.Command{
+	Use:   "evaluate",
+	Short: "Evaluate search results of simulated queries",
+	Long: `Evaluate search results of simulated queries
+
+Input:
+  - Output file(s) of 'lexicmap search' with queries simulated by 'lexicmap utils simulate-queries'.
+  - The truth file of simulated queries (-t/--truth-file).
+
+How:
+  1. HSPs can be filtered by -c/--min-qcov-per-hsp and -i/--min-pident, and only the top
+     -n/--top-n-genomes genomes of each query are used, which is useful for choosing
+     thresholds without repeating the search.
+  2. Genome level: a query is found if its source genome is hit.
+       recall    = queries with the source genome hit / all queries
+       precision = hits of source genomes / all genome hits
+  3. Locus level: an HSP is correct if it's on the source sequence and strand, and
+     at least -O/--min-overlap of the HSP (in the subject) overlaps with the source region.
+       recall    = queries with at least one correct HSP / all queries
+       precision = correct HSPs / all HSPs
+  4. Queries are stratified by divergence (percentage of mutated bases, --div-bins) and
+     query length (--len-bins). Queries without hits are counted in all strata.
+
+Output (tab-delimited):
+  1.  strata,           all, divergence, or length.
+  2.  bin,              Range of the bin, e.g., [1,3).
+  3.  queries,          The number of queries.
+  4.  genome_found,     The number of queries with the source genome hit.
+  5.  genome_hits,      The number of genome hits.
+  6.  genome_recall,    Recall at the genome level.
+  7.  genome_precision, Precision at the genome level, "-" for no hits.
+  8.  locus_found,      The number of queries with at least one correct HSP.
+  9.  hsps,             The number of HSPs.
+  10. hsps_correct,     The number of correct HSPs.
+  11. locus_recall,     Recall at the locus level.
+  12. locus_precision,  Precision at the locus level, "-" for no hits.
+
+  Optional results of each query (-D/--details), with 8 columns:
+    query, qlen, divergence, genome_hits, genome_found, hsps, hsps_correct, locus_found.
+
+Attention:
+  1. Genome-level precision is lower than the true value for indexes with highly similar genomes,
+     e.g., strains of the same species, as hits of other genomes are all counted as false ones.
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		opt := getOptions(cmd)
+
+		outputLog := opt.Verbose || opt.Log2File
+
+		fileTruth := getFlagString(cmd, "truth-file")
+		if fileTruth == "" {
+			checkError(fmt.Errorf("flag -t/--truth-file needed"))
+		}
+		outFile := getFlagString(cmd, "out-file")
+		fileDetails := getFlagString(cmd, "details")
+
+		bufferSizeS := getFlagString(cmd, "buffer-size")
+		if bufferSizeS == "" {
+			checkError(fmt.Errorf("value of buffer size. supported unit: K, M, G"))
+		}
+		bufferSize, err := ParseByteSize(bufferSizeS)
+		if err != nil {
+			checkError(fmt.Errorf("invalid value of buffer size. supported unit: K, M, G"))
+		}
+
+		minOverlap := getFlagNonNegativeFloat64(cmd, "min-overlap")
+		if minOverlap > 1 {
+			checkError(fmt.Errorf("the value of -O/--min-overlap should be in the range of [0, 1]"))
+		}
+		minQcovHSP := getFlagNonNegativeFloat64(cmd, "min-qcov-per-hsp")
+		minPident := getFlagNonNegativeFloat64(cmd, "min-pident")
+		topN := getFlagNonNegativeInt(cmd, "top-n-genomes")
+
+		divBreaks := getFlagCommaSeparatedFloat64s(cmd, "div-bins")
+		lenBreaks := getFlagCommaSeparatedFloat64s(cmd, "len-bins")
+		for _, breaks := range [][]float64{divBreaks, lenBreaks} {
+			if !slices.IsSorted(breaks) {
+				checkError(fmt.Errorf("values of --div-bins and --len-bins should be in ascending order"))
+			}
+		}
+
+		timeStart := time.Now()
+		defer func() {
+			if outputLog {
+				log.Info()
+				log.Infof("elapsed time: %s", time.Since(timeStart))
+				log.Info()
+			}
+		}()
+
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+
+		// ---------------------------------------------------------------
+		// truth
+
+		truths, err := readSimTruth(fileTruth)
+		if err != nil {
+			checkError(fmt.Errorf("failed to read the truth file: %s", err))
+		}
+		if outputLog {
+			log.Infof("%d queries loaded from the truth file: %s", len(truths), fileTruth)
+		}
+
+		evals := make([]*SimEvalQuery, len(truths))
+		query2eval := make(map[string]*SimEvalQuery, len(truths))
+		for i, t := range truths {
+			evals[i] = &SimEvalQuery{Truth: t}
+			query2eval[t.Query] = evals[i]
+		}
+
+		// ---------------------------------------------------------------
+		// search results
+
+		var rGnm *SearchResultOfAGenome
+		var rSeq *SearchResultOfASequence
+		var pident, qcovHSP float64
+		var start, end int
+		var q *SimEvalQuery
+		var nHSPs int
+		var ok bool
+		unknown := make(map[string]struct{}, 8)
+		genomes := make(map[string]map[string]struct{}, len(truths)) // genomes hits of each query
+
+		for _, file := range files {
+			reader, err := NewSearchResultReader(file, "", bufferSize)
+			checkError(err)
+
+			for {
+				rGnm = reader.Next()
+				if rGnm == nil {
+					break
+				}
+
+				if q, ok = query2eval[rGnm.Query]; !ok {
+					unknown[rGnm.Query] = struct{}{}
+					RecycleSearchResultOfAGenome(rGnm)
+					continue
+				}
+
+				// HSPs of a genome might not be adjacent in the mapping mode
+				seen := genomes[rGnm.Query]
+				if seen == nil {
+					seen = make(map[string]struct{}, 8)
+					genomes[rGnm.Query] = seen
+				}
+				if _, ok = seen[rGnm.Sgenome]; !ok && topN > 0 && len(seen) >= topN {
+					RecycleSearchResultOfAGenome(rGnm)
+					continue
+				}
+
+				nHSPs = 0
+				for _, rSeq = range rGnm.Records {
+					pident, _ = strconv.ParseFloat(rSeq.Pident, 64)
+					qcovHSP, _ = strconv.ParseFloat(rSeq.QcovHSP, 64)
+					if pident < minPident || qcovHSP < minQcovHSP {
+						continue
+					}
+					nHSPs++
+
+					if start, err = strconv.Atoi(rSeq.Sstart); err != nil {
+						checkError(fmt.Errorf("failed to parse sstart: %s", rSeq.Sstart))
+					}
+					if end, err = strconv.Atoi(rSeq.Send); err != nil {
+						checkError(fmt.Errorf("failed to parse send: %s", rSeq.Send))
+					}
+					if q.Truth.matchLocus(rGnm.Sgenome, rSeq.Sseqid, rSeq.Sstr, start, end, minOverlap) {
+						q.HSPsCorrect++
+					}
+				}
+				q.HSPs += nHSPs
+
+				if nHSPs > 0 {
+					if _, ok = seen[rGnm.Sgenome]; !ok {
+						seen[rGnm.Sgenome] = struct{}{}
+						q.Genomes++
+						if rGnm.Sgenome == q.Truth.Genome {
+							q.GenomeFound = true
+						}
+					}
+				}
+
+				RecycleSearchResultOfAGenome(rGnm)
+			}
+		}
+
+		if outputLog && len(unknown) > 0 {
+			log.Warningf("%d queries in search results are not found in the truth file", len(unknown))
+		}
+
+		// ---------------------------------------------------------------
+		// stratify
+
+		all := &SimEvalStratum{Strata: "all", Bin: "all"}
+		divBins := simBins("divergence", divBreaks)
+		lenBins := simBins("length", lenBreaks)
+		for _, q := range evals {
+			all.Add(q)
+			divBins[simBinIndex(divBreaks, q.Truth.Divergence())].Add(q)
+			lenBins[simBinIndex(lenBreaks, float64(q.Truth.Qlen))].Add(q)
+		}
+
+		outfh, gw, w, err := outStream(outFile, strings.HasSuffix(outFile, ".gz"), opt.CompressionLevel)
+		checkError(err)
+
+		fmt.Fprintln(outfh, SimEvalHeader)
+		all.Write(outfh)
+		for _, s := range divBins {
+			s.Write(outfh)
+		}
+		for _, s := range lenBins {
+			s.Write(outfh)
+		}
+
+		outfh.Flush()
+		if gw != nil {
+			gw.Close()
+		}
+		w.Close()
+
+		if outputLog {
+			log.Infof("genome-level recall: %d/%d, locus-level recall: %d/%d", all.GenomeFound, all.Queries, all.LocusFound, all.Queries)
+		}
+
+		if fileDetails != "" {
+			dfh, dgw, dw, err := outStream(fileDetails, strings.HasSuffix(fileDetails, ".gz"), opt.CompressionLevel)
+			checkError(err)
+
+			fmt.Fprintf(dfh, "query\tqlen\tdivergence\tgenome_hits\tgenome_found\thsps\thsps_correct\tlocus_found\n")
+			for _, q := range evals {
+				fmt.Fprintf(dfh, "%s\t%d\t%.3f\t%d\t%v\t%d\t%d\t%v\n",
+					q.Truth.Query, q.Truth.Qlen, q.Truth.Divergence(),
+					q.Genomes, q.GenomeFound, q.HSPs, q.HSPsCorrect, q.HSPsCorrect > 0)
+			}
+
+			dfh.Flush()
+			if dgw != nil {
+				dgw.Close()
+			}
+			dw.Close()
+
+			if outputLog {
+				log.Infof("results of %d queries saved to: %s", len(evals), fileDetails)
+			}
+		}
+	},
+}
+
+func init() {
+	utilsCmd.AddCommand(evaluateCmd)
+
+	evaluateCmd.Flags().StringP("truth-file", "t", "",
+		formatFlagUsage(`Truth file of simulated queries created by "lexicmap utils simulate-queries".`))
+
+	evaluateCmd.Flags().StringP("out-file", "o", "-",
+		formatFlagUsage(`Out file, supports the ".gz" suffix ("-" for stdout).`))
+
+	evaluateCmd.Flags().StringP("details", "D", "",
+		formatFlagUsage(`Output results of each query to this file.`))
+
+	evaluateCmd.Flags().StringP("buffer-size", "b", "20M",
+		formatFlagUsage(`Size of buffer, supported unit: K, M, G. You need increase the value when "bufio.Scanner: token too long" error reported`))
+
+	// -------------------------------------------------------
+	// hits
+
+	evaluateCmd.Flags().Float64P("min-qcov-per-hsp", "c", 0,
+		formatFlagUsage(`Minimum query coverage (percentage) per HSP.`))
+
+	evaluateCmd.Flags().Float64P("min-pident", "i", 0,
+		formatFlagUsage(`Minimum base identity (percentage) of an HSP.`))
+
+	evaluateCmd.Flags().IntP("top-n-genomes", "n", 0,
+		formatFlagUsage(`Only use the top N genomes of each query (0 for all).`))
+
+	evaluateCmd.Flags().Float64P("min-overlap", "O", 0.5,
+		formatFlagUsage(`Minimum fraction of an HSP (in the subject) overlapping with the source region to be a correct one.`))
+
+	// -------------------------------------------------------
+	// strata
+
+	evaluateCmd.Flags().StringP("div-bins", "", "1,3,5,10",
+		formatFlagUsage(`Comma-separated breaks of divergence (percentage) bins in ascending order.`))
+
+	evaluateCmd.Flags().StringP("len-bins", "", "1000,2000,5000",
+		formatFlagUsage(`Comma-separated breaks of query length bins in ascending order.`))
+
+	evaluateCmd.SetUsageTemplate(usageTemplate(""))
+}
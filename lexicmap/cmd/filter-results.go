@@ -0,0 +1,434 @@
+// Copyright © 2023-2026 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var filterResultsCmd = &cobra.Command{
+	Use:   "filter-results",
+	Short: "Filter, re-rank and renumber search results",
+	Long: `Filter, re-rank and renumber search results
+
+Input:
+  - Output file of 'lexicmap search', both the default 20- and 24-column formats are supported.
+  - Results of multiple queries are supported.
+
+How:
+  1. HSPs are filtered by pident, qcovHSP, evalue, bitscore, alenHSP, and genome lists.
+  2. For each genome with remaining HSPs, qcovGnm is recomputed from the merged query regions
+     of all HSPs, and genomes are filtered by -Q/--min-qcov-per-genome.
+  3. Results are re-sorted following the same ordering in 'lexicmap search':
+     For a HSP cluster, SimilarityScore = max(bitscore*pident)
+       1. Within each HSP cluster, HSPs are sorted by sstart.
+       2. Within each subject genome, HSP clusters are sorted in descending order by SimilarityScore.
+       3. Results of multiple subject genomes are sorted by the highest SimilarityScore of HSP clusters.
+  4. Column hits, cls and hsp are renumbered.
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		opt := getOptions(cmd)
+
+		outFile := getFlagString(cmd, "out-file")
+		query := getFlagString(cmd, "query")
+
+		bufferSizeS := getFlagString(cmd, "buffer-size")
+		if bufferSizeS == "" {
+			checkError(fmt.Errorf("value of buffer size. supported unit: K, M, G"))
+		}
+		bufferSize, err := ParseByteSize(bufferSizeS)
+		if err != nil {
+			checkError(fmt.Errorf("invalid value of buffer size. supported unit: K, M, G"))
+		}
+
+		f := &SearchResultFilter{
+			MinPident:        getFlagNonNegativeFloat64(cmd, "min-pident"),
+			MinQcovHSP:       getFlagNonNegativeFloat64(cmd, "min-qcov-per-hsp"),
+			MinQcovGenome:    getFlagNonNegativeFloat64(cmd, "min-qcov-per-genome"),
+			MaxEvalue:        getFlagNonNegativeFloat64(cmd, "max-evalue"),
+			MinBitscore:      getFlagNonNegativeInt(cmd, "min-bitscore"),
+			MinAlenHSP:       getFlagNonNegativeInt(cmd, "min-alen-per-hsp"),
+			TopNGenomes:      getFlagNonNegativeInt(cmd, "top-n-genomes"),
+			TopNHSPsInGenome: getFlagNonNegativeInt(cmd, "top-n-clusters"),
+		}
+		if f.MinPident > 100 {
+			checkError(fmt.Errorf("the value of flag -i/--min-pident (%f) should be in range of [0, 100]", f.MinPident))
+		}
+		if f.MinQcovHSP > 100 {
+			checkError(fmt.Errorf("the value of flag -q/--min-qcov-per-hsp (%f) should be in range of [0, 100]", f.MinQcovHSP))
+		}
+		if f.MinQcovGenome > 100 {
+			checkError(fmt.Errorf("the value of flag -Q/--min-qcov-per-genome (%f) should be in range of [0, 100]", f.MinQcovGenome))
+		}
+
+		genomeFile := getFlagString(cmd, "genome-file")
+		genomeExcludeFile := getFlagString(cmd, "genome-exclude-file")
+		if genomeFile != "" {
+			f.Genomes, err = readGenomeIDs(genomeFile)
+			checkError(err)
+		}
+		if genomeExcludeFile != "" {
+			f.ExcludedGenomes, err = readGenomeIDs(genomeExcludeFile)
+			checkError(err)
+		}
+
+		timeStart := time.Now()
+		defer func() {
+			if opt.Verbose {
+				log.Info()
+				log.Infof("elapsed time: %s", time.Since(timeStart))
+				log.Info()
+			}
+		}()
+
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+
+		// ---------------------------------------------------------------
+
+		outfh, gw, w, err := outStream(outFile, strings.HasSuffix(outFile, ".gz"), opt.CompressionLevel)
+		checkError(err)
+		defer func() {
+			outfh.Flush()
+			if gw != nil {
+				gw.Close()
+			}
+			w.Close()
+		}()
+
+		var rGnm *SearchResultOfAGenome
+		var queryPre string
+		var nQueries, nGenomes, nGenomesKept int
+		checkColumns := true
+		var moreColumns bool
+		rGnms := make([]*SearchResultOfAGenome, 0, 1024)
+
+		flush := func() {
+			if len(rGnms) == 0 {
+				return
+			}
+			rGnms = f.Filter(rGnms)
+			nGenomesKept += len(rGnms)
+			writeSearchResults(outfh, rGnms, moreColumns)
+
+			for _, rGnm := range rGnms {
+				RecycleSearchResultOfAGenome(rGnm)
+			}
+			rGnms = rGnms[:0]
+		}
+
+		for _, file := range files {
+			reader, err := NewSearchResultReader(file, query, bufferSize)
+			checkError(err)
+
+			for {
+				rGnm = reader.Next()
+				if rGnm == nil {
+					break
+				}
+
+				if checkColumns { // for once
+					checkColumns = false
+
+					moreColumns = rGnm.Records[0].Extra != ""
+					writeSearchResultsHeader(outfh, moreColumns)
+				}
+
+				if rGnm.Query != queryPre { // a new query
+					flush()
+
+					queryPre = rGnm.Query
+					nQueries++
+				}
+				nGenomes++
+
+				rGnms = append(rGnms, rGnm)
+			}
+		}
+		flush()
+
+		if opt.Verbose {
+			log.Infof("%d of %d genome hits of %d queries kept", nGenomesKept, nGenomes, nQueries)
+		}
+	},
+}
+
+func init() {
+	utilsCmd.AddCommand(filterResultsCmd)
+
+	filterResultsCmd.Flags().StringP("out-file", "o", "-",
+		formatFlagUsage(`Out file, supports the ".gz" suffix ("-" for stdout).`))
+
+	filterResultsCmd.Flags().StringP("query", "", "",
+		formatFlagUsage(`Only keep results of this query.`))
+
+	filterResultsCmd.Flags().StringP("buffer-size", "b", "20M",
+		formatFlagUsage(`Size of buffer, supported unit: K, M, G. You need increase the value when "bufio.Scanner: token too long" error reported`))
+
+	filterResultsCmd.Flags().Float64P("min-pident", "i", 0,
+		formatFlagUsage(`Minimum base identity (percentage) in a HSP.`))
+
+	filterResultsCmd.Flags().Float64P("min-qcov-per-hsp", "q", 0,
+		formatFlagUsage(`Minimum query coverage (percentage) per HSP.`))
+
+	filterResultsCmd.Flags().Float64P("min-qcov-per-genome", "Q", 0,
+		formatFlagUsage(`Minimum query coverage (percentage) per genome, which is recomputed after filtering HSPs.`))
+
+	filterResultsCmd.Flags().Float64P("max-evalue", "e", 10,
+		formatFlagUsage(`Maximum evalue of a HSP.`))
+
+	filterResultsCmd.Flags().IntP("min-bitscore", "s", 0,
+		formatFlagUsage(`Minimum bit score of a HSP.`))
+
+	filterResultsCmd.Flags().IntP("min-alen-per-hsp", "l", 0,
+		formatFlagUsage(`Minimum aligned length of a HSP.`))
+
+	filterResultsCmd.Flags().StringP("genome-file", "g", "",
+		formatFlagUsage(`File of genome IDs to keep (one ID per line).`))
+
+	filterResultsCmd.Flags().StringP("genome-exclude-file", "G", "",
+		formatFlagUsage(`File of genome IDs to exclude (one ID per line).`))
+
+	filterResultsCmd.Flags().IntP("top-n-genomes", "n", 0,
+		formatFlagUsage(`Keep the top N genomes for a query after re-ranking (0 for all).`))
+
+	filterResultsCmd.Flags().IntP("top-n-clusters", "N", 0,
+		formatFlagUsage(`Keep the top N HSP clusters in a genome after re-ranking (0 for all).`))
+
+	filterResultsCmd.SetUsageTemplate(usageTemplate(""))
+}
+
+// SearchResultFilter filters search results of a query, and recomputes
+// qcovGnm, hits, cls and hsp.
+type SearchResultFilter struct {
+	MinPident     float64
+	MinQcovHSP    float64
+	MinQcovGenome float64
+	MaxEvalue     float64
+	MinBitscore   int
+	MinAlenHSP    int
+
+	Genomes         map[string]struct{} // white list, nil for all
+	ExcludedGenomes map[string]struct{} // black list
+
+	TopNGenomes      int
+	TopNHSPsInGenome int // the number of HSP clusters
+}
+
+type searchResultCluster struct {
+	score   float64
+	records []*SearchResultOfASequence
+}
+
+// Filter filters and re-ranks results of a query.
+// Records of discarded genomes are recycled.
+func (f *SearchResultFilter) Filter(rGnms []*SearchResultOfAGenome) []*SearchResultOfAGenome {
+	var ok bool
+	var qlen, qstart, qend, bitscore, alen, cls int
+	var pident, qcovHSP, evalue, score float64
+	var err error
+	clusters := make([]*searchResultCluster, 0, 16)
+	regions := make([][3]int, 0, 128)
+
+	var j int
+	for _, rGnm := range rGnms {
+		if f.Genomes != nil {
+			if _, ok = f.Genomes[rGnm.Sgenome]; !ok {
+				RecycleSearchResultOfAGenome(rGnm)
+				continue
+			}
+		}
+		if f.ExcludedGenomes != nil {
+			if _, ok = f.ExcludedGenomes[rGnm.Sgenome]; ok {
+				RecycleSearchResultOfAGenome(rGnm)
+				continue
+			}
+		}
+
+		qlen, err = strconv.Atoi(rGnm.Qlen)
+		if err != nil {
+			checkError(fmt.Errorf("failed to parse qlen: %s", rGnm.Qlen))
+		}
+
+		// HSPs, grouped in clusters
+		clusters = clusters[:0]
+		regions = regions[:0]
+		cls = -1
+		var c *searchResultCluster
+		for _, rSeq := range rGnm.Records {
+			pident, _ = strconv.ParseFloat(rSeq.Pident, 64)
+			qcovHSP, _ = strconv.ParseFloat(rSeq.QcovHSP, 64)
+			evalue, _ = strconv.ParseFloat(rSeq.Evalue, 64)
+			bitscore, _ = strconv.Atoi(rSeq.Bitscore)
+			alen, _ = strconv.Atoi(rSeq.AlenHSP)
+
+			if pident < f.MinPident || qcovHSP < f.MinQcovHSP || evalue > f.MaxEvalue ||
+				bitscore < f.MinBitscore || alen < f.MinAlenHSP {
+				continue
+			}
+
+			if i, _ := strconv.Atoi(rSeq.Cls); i != cls || c == nil { // a new cluster
+				c = &searchResultCluster{records: make([]*SearchResultOfASequence, 0, 4)}
+				clusters = append(clusters, c)
+				cls = i
+			}
+			c.records = append(c.records, rSeq)
+
+			score = float64(bitscore) * pident
+			if score > c.score {
+				c.score = score
+			}
+
+			qstart, _ = strconv.Atoi(rSeq.Qstart)
+			qend, _ = strconv.Atoi(rSeq.Qend)
+			regions = append(regions, [3]int{qstart - 1, qend, 1})
+		}
+		if len(clusters) == 0 {
+			RecycleSearchResultOfAGenome(rGnm)
+			continue
+		}
+
+		slices.SortStableFunc(clusters, func(a, b *searchResultCluster) int {
+			return cmp.Compare(b.score, a.score)
+		})
+		if f.TopNHSPsInGenome > 0 && len(clusters) > f.TopNHSPsInGenome {
+			clusters = clusters[:f.TopNHSPsInGenome]
+
+			regions = regions[:0]
+			for _, c = range clusters {
+				for _, rSeq := range c.records {
+					qstart, _ = strconv.Atoi(rSeq.Qstart)
+					qend, _ = strconv.Atoi(rSeq.Qend)
+					regions = append(regions, [3]int{qstart - 1, qend, 1})
+				}
+			}
+		}
+
+		// qcovGnm
+		var covered int
+		for _, r := range mergeQueryRegions(regions, 0) {
+			covered += r[1] - r[0]
+		}
+		qcovGnm := min(float64(covered)/float64(qlen)*100, 100)
+		if qcovGnm < f.MinQcovGenome {
+			RecycleSearchResultOfAGenome(rGnm)
+			continue
+		}
+		rGnm.QcovGnm = strconv.FormatFloat(qcovGnm, 'f', 3, 64)
+
+		// renumber
+		rGnm.Records = rGnm.Records[:0]
+		var hsp int
+		for i, c := range clusters {
+			for _, rSeq := range c.records {
+				hsp++
+				rSeq.Cls = strconv.Itoa(i + 1)
+				rSeq.Hsp = strconv.Itoa(hsp)
+				rGnm.Records = append(rGnm.Records, rSeq)
+			}
+		}
+		rGnm.Score = clusters[0].score
+
+		rGnms[j] = rGnm
+		j++
+	}
+	rGnms = rGnms[:j]
+
+	slices.SortStableFunc(rGnms, func(a, b *SearchResultOfAGenome) int {
+		return cmp.Compare(b.Score, a.Score)
+	})
+	if f.TopNGenomes > 0 && len(rGnms) > f.TopNGenomes {
+		for _, rGnm := range rGnms[f.TopNGenomes:] {
+			RecycleSearchResultOfAGenome(rGnm)
+		}
+		rGnms = rGnms[:f.TopNGenomes]
+	}
+
+	for _, rGnm := range rGnms {
+		rGnm.Hits = len(rGnms)
+	}
+
+	return rGnms
+}
+
+// writeSearchResultsHeader writes the header row of search results.
+func writeSearchResultsHeader(outfh *bufio.Writer, moreColumns bool) {
+	fmt.Fprintf(outfh, "query\tqlen\thits\tsgenome\tsseqid\tqcovGnm\tcls\thsp\tqcovHSP\talenHSP\tpident\tgaps\tqstart\tqend\tsstart\tsend\tsstr\tslen\tevalue\tbitscore")
+	if moreColumns {
+		fmt.Fprintf(outfh, "\tcigar\tqseq\tsseq\talign")
+	}
+	fmt.Fprintln(outfh)
+}
+
+// writeSearchResults writes search results of genomes.
+func writeSearchResults(outfh *bufio.Writer, rGnms []*SearchResultOfAGenome, moreColumns bool) {
+	for _, rGnm := range rGnms {
+		for _, rSeq := range rGnm.Records {
+			fmt.Fprintf(outfh, "%s\t%s\t%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s",
+				rGnm.Query,
+				rGnm.Qlen,
+				rGnm.Hits,
+				rGnm.Sgenome,
+				rSeq.Sseqid,
+				rGnm.QcovGnm,
+				rSeq.Cls,
+				rSeq.Hsp,
+				rSeq.QcovHSP,
+				rSeq.AlenHSP,
+				rSeq.Pident,
+				rSeq.Gaps,
+				rSeq.Qstart,
+				rSeq.Qend,
+				rSeq.Sstart,
+				rSeq.Send,
+				rSeq.Sstr,
+				rSeq.Slen,
+				rSeq.Evalue,
+				rSeq.Bitscore,
+			)
+			if moreColumns {
+				fmt.Fprintf(outfh, "\t%s", rSeq.Extra)
+			}
+			fmt.Fprintln(outfh)
+		}
+	}
+}
+
+// readGenomeIDs reads genome IDs from a file, one ID per line.
+func readGenomeIDs(file string) (map[string]struct{}, error) {
+	ids, err := getFileListFromFile(file, false)
+	if err != nil {
+		return nil, err
+	}
+	m := make(map[string]struct{}, len(ids))
+	for _, id := range ids {
+		m[id] = struct{}{}
+	}
+	return m, nil
+}
@@ -179,6 +179,10 @@ func extractGenomeDetails(opt *Options, dbDir string, saveSeqIDs bool) error {
 	if info.MainVersion != MainVersion {
 		return fmt.Errorf("index main versions do not match: %d (index) != %d (tool). please re-create the index", info.MainVersion, MainVersion)
 	}
+	layout, err := NewIndexLayout(dbDir, info)
+	if err != nil {
+		return err
+	}
 
 	// ---------------------------------------------------------------
 	// genome readers
@@ -200,7 +204,7 @@ func extractGenomeDetails(opt *Options, dbDir string, saveSeqIDs bool) error {
 			tokens <- 1
 			wg.Add(1)
 			go func(i int) {
-				fileGenomes := filepath.Join(dbDir, DirGenomes, batchDir(i), FileGenomes)
+				fileGenomes := layout.GenomeFile(i)
 				rdr, err := genome.NewReader(fileGenomes)
 				if err != nil {
 					checkError(fmt.Errorf("failed to create genome reader: %s", err))
@@ -74,6 +74,8 @@ Attention:
 		if info.MainVersion != MainVersion {
 			checkError(fmt.Errorf("index main versions do not match: %d (index) != %d (tool). please re-create the index", info.MainVersion, MainVersion))
 		}
+		layout, err := NewIndexLayout(dbDir, info)
+		checkError(err)
 
 		// genomes.map file for mapping index to genome id
 		m, err := readGenomeMapName2Idx(filepath.Join(dbDir, FileGenomeIndex))
@@ -116,7 +118,7 @@ Attention:
 			genomeBatch = int(batchIDAndRefID >> BITS_GENOME_IDX)
 			genomeIdx = int(batchIDAndRefID & MASK_GENOME_IDX)
 
-			fileGenome = filepath.Join(dbDir, DirGenomes, batchDir(genomeBatch), FileGenomes)
+			fileGenome = layout.GenomeFile(genomeBatch)
 			rdr, err = genome.NewReader(fileGenome)
 			if err != nil {
 				checkError(fmt.Errorf("failed to read genome data file: %s", err))
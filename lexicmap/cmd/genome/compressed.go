@@ -0,0 +1,462 @@
+// Copyright © 2023-2026 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package genome
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// MagicCompressed is the magic number of the block-compressed genome data file.
+var MagicCompressed = [8]byte{'.', 'g', 'e', 'n', 'o', 'm', 'e', 'z'}
+
+// DefaultBlockSize is the default size of uncompressed blocks in the block-compressed genome data file.
+var DefaultBlockSize = 16 << 10
+
+// MaxDictSize is the maximum size of the data of the first genome used as the dictionary.
+var MaxDictSize = 16 << 20
+
+// dictID is the ID of the dictionary in zstd frames.
+const dictID = 1
+
+// MaxBlockSize is the maximum size of uncompressed blocks.
+var MaxBlockSize = 1 << 30
+
+// ErrInvalidBlockSize means the block size is out of range.
+var ErrInvalidBlockSize = errors.New("genome data: invalid block size")
+
+// A block-compressed genome data file stores exactly the same byte stream as
+// the plain format, but cut into blocks of a fixed size, with each block compressed
+// with zstd independently. So the offsets in the genome index file are kept unchanged,
+// and only blocks covering a queried region need to be decompressed.
+//
+// A block alone contains few repeats, so the data of the first genome (at most MaxDictSize bytes)
+// is used as a raw zstd dictionary of all blocks after it, where sequences similar to
+// the first genome are compressed as matches to it. Genomes in a batch dissimilar to the
+// first one are barely compressed.
+//
+//	header: magic (8 bytes), versions (8 bytes, only 2 bytes used)
+//	blocks: zstd frames, blocks starting after the dictionary are compressed with it
+//	block index: offsets of the nBlocks blocks and the end of the last block, uint64 each
+//	footer: blockSize (uint32), nBlocks (uint32), size of uncompressed data (uint64),
+//	        size of the dictionary (uint64), magic (8 bytes)
+const compressedFooterSize = 32
+
+var zstdEncoder, zstdDecoder = newZstdCoders()
+
+func newZstdCoders() (*zstd.Encoder, *zstd.Decoder) {
+	enc, err := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+	if err != nil {
+		panic(err)
+	}
+	dec, err := zstd.NewReader(nil, zstd.WithDecoderConcurrency(0))
+	if err != nil {
+		panic(err)
+	}
+	return enc, dec
+}
+
+// blockWriter splits the data into blocks and writes compressed blocks to the file.
+type blockWriter struct {
+	fh        *os.File
+	blockSize int
+
+	buf     []byte // uncompressed data of the current block
+	zbuf    []byte // compressed data
+	offset  int64  // current offset in the file
+	size    int64  // size of uncompressed data
+	offsets []uint64
+
+	dict     []byte        // data of the first genome
+	dictDone bool          // whether the dictionary is decided
+	dictEnc  *zstd.Encoder // encoder for blocks after the dictionary
+}
+
+func newBlockWriter(fh *os.File, blockSize int) (*blockWriter, error) {
+	w := &blockWriter{
+		fh:        fh,
+		blockSize: blockSize,
+		buf:       make([]byte, 0, blockSize),
+		offsets:   make([]uint64, 0, 1024),
+	}
+
+	buf := make([]byte, 16)
+	copy(buf[:8], MagicCompressed[:])
+	buf[8], buf[9] = MainVersion, MinorVersion
+	_, err := fh.Write(buf)
+	if err != nil {
+		return nil, err
+	}
+	w.offset = 16
+	return w, nil
+}
+
+// Write buffers the data and writes full blocks.
+func (w *blockWriter) Write(p []byte) (int, error) {
+	if !w.dictDone && len(w.dict) < MaxDictSize {
+		w.dict = append(w.dict, p[:min(MaxDictSize-len(w.dict), len(p))]...)
+	}
+
+	var n, m int
+	var err error
+	for len(p) > 0 {
+		m = min(w.blockSize-len(w.buf), len(p))
+		w.buf = append(w.buf, p[:m]...)
+		p = p[m:]
+		n += m
+
+		if len(w.buf) == w.blockSize {
+			if err = w.flushBlock(); err != nil {
+				return n, err
+			}
+		}
+	}
+	return n, nil
+}
+
+// setDict uses the data written so far, i.e., the first genome, as the dictionary
+// of the following blocks.
+func (w *blockWriter) setDict() error {
+	w.dictDone = true
+	if len(w.dict) == 0 {
+		return nil
+	}
+
+	// matches could be anywhere in the dictionary
+	window := 1 << 20
+	for window < len(w.dict)+w.blockSize {
+		window <<= 1
+	}
+	var err error
+	w.dictEnc, err = zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1),
+		zstd.WithWindowSize(window), zstd.WithEncoderDictRaw(dictID, w.dict),
+		zstd.WithEncoderLevel(zstd.SpeedBetterCompression))
+	return err
+}
+
+func (w *blockWriter) flushBlock() error {
+	if len(w.buf) == 0 {
+		return nil
+	}
+	enc := zstdEncoder
+	if w.dictEnc != nil && w.size >= int64(len(w.dict)) {
+		enc = w.dictEnc
+	}
+	w.zbuf = enc.EncodeAll(w.buf, w.zbuf[:0])
+	_, err := w.fh.Write(w.zbuf)
+	if err != nil {
+		return err
+	}
+	w.offsets = append(w.offsets, uint64(w.offset))
+	w.offset += int64(len(w.zbuf))
+	w.size += int64(len(w.buf))
+	w.buf = w.buf[:0]
+	return nil
+}
+
+// Close writes the last block, the block index, and the footer.
+// It does not close the file.
+func (w *blockWriter) Close() error {
+	err := w.flushBlock()
+	if err != nil {
+		return err
+	}
+	var dictSize int
+	if w.dictEnc != nil {
+		dictSize = len(w.dict)
+		w.dictEnc.Close()
+	}
+
+	buf := make([]byte, (len(w.offsets)+1)<<3+compressedFooterSize)
+	for i, offset := range w.offsets {
+		be.PutUint64(buf[i<<3:], offset)
+	}
+	be.PutUint64(buf[len(w.offsets)<<3:], uint64(w.offset))
+
+	footer := buf[(len(w.offsets)+1)<<3:]
+	be.PutUint32(footer[:4], uint32(w.blockSize))
+	be.PutUint32(footer[4:8], uint32(len(w.offsets)))
+	be.PutUint64(footer[8:16], uint64(w.size))
+	be.PutUint64(footer[16:24], uint64(dictSize))
+	copy(footer[24:32], MagicCompressed[:])
+
+	_, err = w.fh.Write(buf)
+	return err
+}
+
+// blockIndex is the block index of a block-compressed genome data file.
+type blockIndex struct {
+	blockSize int
+	size      int64    // size of uncompressed data
+	offsets   []uint64 // offsets of blocks, with an extra one for the end of the last block
+
+	dictSize int64 // size of the dictionary, 0 for none
+	dictOnce sync.Once
+	dec      *zstd.Decoder // decoder with the dictionary
+	dictErr  error
+
+	key  string // key in blockIndexes, empty for indexes not shared
+	refs int    // the number of readers using it
+}
+
+// decoder returns the decoder of the block.
+// The dictionary is decompressed from the first blocks when it's needed for the first time.
+func (idx *blockIndex) decoder(r io.ReaderAt, block int) (*zstd.Decoder, error) {
+	if int64(block)*int64(idx.blockSize) < idx.dictSize || idx.dictSize == 0 {
+		return zstdDecoder, nil
+	}
+
+	idx.dictOnce.Do(func() {
+		dict := make([]byte, 0, idx.dictSize+int64(idx.blockSize))
+		var zbuf []byte
+		for i := 0; int64(len(dict)) < idx.dictSize; i++ {
+			start, end := idx.offsets[i], idx.offsets[i+1]
+			zbuf = resizeByteSlice(zbuf, int(end-start))
+			if _, idx.dictErr = r.ReadAt(zbuf, int64(start)); idx.dictErr != nil {
+				return
+			}
+			if dict, idx.dictErr = zstdDecoder.DecodeAll(zbuf, dict); idx.dictErr != nil {
+				idx.dictErr = fmt.Errorf("genome data: failed to decompress block %d: %s", i, idx.dictErr)
+				return
+			}
+		}
+		idx.dec, idx.dictErr = zstd.NewReader(nil, zstd.WithDecoderConcurrency(0),
+			zstd.WithDecoderDictRaw(dictID, dict[:idx.dictSize]))
+	})
+	return idx.dec, idx.dictErr
+}
+
+// close releases the decoder.
+func (idx *blockIndex) close() {
+	if idx.dec != nil {
+		idx.dec.Close()
+	}
+}
+
+// blockIndexes are block indexes of opened files, which are shared by readers of the same file,
+// so the dictionary is only decompressed and stored once.
+var blockIndexes = struct {
+	sync.Mutex
+	m map[string]*blockIndex
+}{m: make(map[string]*blockIndex)}
+
+// openBlockIndex returns the shared block index of a file.
+// Please call releaseBlockIndex after using it.
+func openBlockIndex(file string, r io.ReaderAt, fileSize int64) (*blockIndex, error) {
+	key := fmt.Sprintf("%s\t%d", file, fileSize)
+
+	blockIndexes.Lock()
+	idx, ok := blockIndexes.m[key]
+	if ok {
+		idx.refs++
+		blockIndexes.Unlock()
+		return idx, nil
+	}
+	blockIndexes.Unlock()
+
+	idx, err := readBlockIndex(r, fileSize)
+	if err != nil {
+		return nil, err
+	}
+
+	blockIndexes.Lock()
+	defer blockIndexes.Unlock()
+	if idx0, ok := blockIndexes.m[key]; ok { // opened by another reader in the meantime
+		idx0.refs++
+		return idx0, nil
+	}
+	idx.key, idx.refs = key, 1
+	blockIndexes.m[key] = idx
+	return idx, nil
+}
+
+// releaseBlockIndex releases a block index returned by openBlockIndex.
+func releaseBlockIndex(idx *blockIndex) {
+	blockIndexes.Lock()
+	defer blockIndexes.Unlock()
+	idx.refs--
+	if idx.refs == 0 {
+		delete(blockIndexes.m, idx.key)
+		idx.close()
+	}
+}
+
+// isCompressed checks if the file starts with the magic number of the block-compressed format.
+func isCompressed(r io.ReaderAt) (bool, error) {
+	buf := make([]byte, 8)
+	_, err := r.ReadAt(buf, 0)
+	if err != nil {
+		if err == io.EOF {
+			return false, ErrBrokenFile
+		}
+		return false, err
+	}
+	return [8]byte(buf) == MagicCompressed, nil
+}
+
+// readBlockIndex reads the block index from the end of a block-compressed genome data file.
+func readBlockIndex(r io.ReaderAt, fileSize int64) (*blockIndex, error) {
+	if fileSize < 16+compressedFooterSize+8 {
+		return nil, ErrBrokenFile
+	}
+
+	footer := make([]byte, compressedFooterSize)
+	_, err := r.ReadAt(footer, fileSize-compressedFooterSize)
+	if err != nil {
+		return nil, err
+	}
+	if [8]byte(footer[24:32]) != MagicCompressed {
+		return nil, ErrBrokenFile
+	}
+
+	idx := &blockIndex{
+		blockSize: int(be.Uint32(footer[:4])),
+		size:      int64(be.Uint64(footer[8:16])),
+		dictSize:  int64(be.Uint64(footer[16:24])),
+	}
+	nBlocks := int64(be.Uint32(footer[4:8]))
+	if idx.blockSize == 0 || nBlocks != (idx.size+int64(idx.blockSize)-1)/int64(idx.blockSize) ||
+		idx.dictSize > idx.size {
+		return nil, ErrBrokenFile
+	}
+
+	n := (nBlocks + 1) << 3
+	if 16+n+compressedFooterSize > fileSize {
+		return nil, ErrBrokenFile
+	}
+	buf := make([]byte, n)
+	_, err = r.ReadAt(buf, fileSize-compressedFooterSize-n)
+	if err != nil {
+		return nil, err
+	}
+	idx.offsets = make([]uint64, nBlocks+1)
+	var pre uint64 = 16
+	for i := range idx.offsets {
+		idx.offsets[i] = be.Uint64(buf[i<<3:])
+		if idx.offsets[i] < pre {
+			return nil, ErrBrokenFile
+		}
+		pre = idx.offsets[i]
+	}
+	if int64(pre) != fileSize-compressedFooterSize-n {
+		return nil, ErrBrokenFile
+	}
+
+	return idx, nil
+}
+
+// blockReader reads uncompressed data from a block-compressed genome data file,
+// only the blocks covering the requested range are decompressed.
+// The last decompressed block is cached, so it is not safe for concurrent use.
+type blockReader struct {
+	r   io.ReaderAt
+	idx *blockIndex
+
+	block int    // id of the cached block
+	data  []byte // uncompressed data of the cached block
+	zbuf  []byte // compressed data
+}
+
+var poolBlockReader = &sync.Pool{New: func() interface{} {
+	return &blockReader{}
+}}
+
+func newBlockReader(r io.ReaderAt, idx *blockIndex) *blockReader {
+	br := poolBlockReader.Get().(*blockReader)
+	br.r = r
+	br.idx = idx
+	br.block = -1
+	return br
+}
+
+// recycle puts the blockReader back to the pool.
+func (br *blockReader) recycle() {
+	br.r, br.idx = nil, nil
+	if cap(br.data) > TwentyMB {
+		br.data = nil
+	}
+	if cap(br.zbuf) > TwentyMB {
+		br.zbuf = nil
+	}
+	poolBlockReader.Put(br)
+}
+
+// Size returns the size of uncompressed data.
+func (br *blockReader) Size() int64 {
+	return br.idx.size
+}
+
+func (br *blockReader) loadBlock(block int) error {
+	if block == br.block {
+		return nil
+	}
+	start, end := br.idx.offsets[block], br.idx.offsets[block+1]
+	br.zbuf = resizeByteSlice(br.zbuf, int(end-start))
+	_, err := br.r.ReadAt(br.zbuf, int64(start))
+	if err != nil {
+		return err
+	}
+
+	dec, err := br.idx.decoder(br.r, block)
+	if err != nil {
+		return err
+	}
+
+	br.block = -1
+	br.data, err = dec.DecodeAll(br.zbuf, br.data[:0])
+	if err != nil {
+		return fmt.Errorf("genome data: failed to decompress block %d: %s", block, err)
+	}
+	br.block = block
+	return nil
+}
+
+// ReadAt reads uncompressed data starting at offset off.
+func (br *blockReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, ErrBrokenFile
+	}
+	var n, m, i int
+	var err error
+	blockSize := int64(br.idx.blockSize)
+	for len(p) > 0 && off < br.idx.size {
+		if err = br.loadBlock(int(off / blockSize)); err != nil {
+			return n, err
+		}
+		i = int(off % blockSize)
+		if i >= len(br.data) {
+			return n, ErrBrokenFile
+		}
+		m = copy(p, br.data[i:])
+		p = p[m:]
+		n += m
+		off += int64(m)
+	}
+	if len(p) > 0 {
+		return n, io.EOF
+	}
+	return n, nil
+}
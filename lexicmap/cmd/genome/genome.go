@@ -33,6 +33,8 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/shenwei356/LexicMap/lexicmap/cmd/util"
 )
 
 var be = binary.BigEndian
@@ -170,6 +172,7 @@ type Writer struct {
 	file  string
 	fh    *os.File
 	w     *bufio.Writer
+	bw    *blockWriter // only for the block-compressed format
 
 	bBuf   bytes.Buffer
 	buf    []byte // 24 bytes buffer
@@ -182,6 +185,20 @@ type Writer struct {
 // NewWriter creates a new Writer.
 // Batch is the batch id for this data file.
 func NewWriter(file string, batch uint32) (*Writer, error) {
+	return newWriter(file, batch, 0)
+}
+
+// NewCompressedWriter creates a new Writer saving data in the block-compressed format,
+// where the data are split into blocks of blockSize bytes, and each block is compressed with zstd.
+// Readers returned by NewReader() read both formats.
+func NewCompressedWriter(file string, batch uint32, blockSize int) (*Writer, error) {
+	if blockSize <= 0 || blockSize > MaxBlockSize {
+		return nil, ErrInvalidBlockSize
+	}
+	return newWriter(file, batch, blockSize)
+}
+
+func newWriter(file string, batch uint32, blockSize int) (*Writer, error) {
 	w := &Writer{
 		batch: batch,
 		file:  file,
@@ -192,7 +209,15 @@ func NewWriter(file string, batch uint32) (*Writer, error) {
 	if err != nil {
 		return nil, err
 	}
-	w.w = bufio.NewWriterSize(w.fh, BufferSize)
+	if blockSize > 0 {
+		w.bw, err = newBlockWriter(w.fh, blockSize)
+		if err != nil {
+			return nil, err
+		}
+		w.w = bufio.NewWriterSize(w.bw, BufferSize)
+	} else {
+		w.w = bufio.NewWriterSize(w.fh, BufferSize)
+	}
 
 	w.buf = make([]byte, 24)
 
@@ -288,6 +313,16 @@ func (w *Writer) Write(s *Genome) error {
 	}
 	w.offset += buf0.Len() + nbytes
 
+	// the first genome is used as the dictionary for compressing following blocks
+	if w.bw != nil && !w.bw.dictDone {
+		if err = w.w.Flush(); err != nil {
+			return err
+		}
+		if err = w.bw.setDict(); err != nil {
+			return err
+		}
+	}
+
 	if newTwoBit {
 		poolTwoBit.Put(b2)
 	}
@@ -301,6 +336,13 @@ func (w *Writer) Close() error {
 		return err
 	}
 
+	if w.bw != nil {
+		err = w.bw.Close()
+		if err != nil {
+			return err
+		}
+	}
+
 	err = w.fh.Close()
 	if err != nil {
 		return err
@@ -357,6 +399,47 @@ func (w *Writer) Close() error {
 	return fh.Close()
 }
 
+// ReadDataHeader reads and checks the header of a genome data file,
+// and returns the main and minor versions.
+func ReadDataHeader(file string) (uint8, uint8, error) {
+	f, err := util.OpenFile(file)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	fh := util.NewFileReader(f)
+
+	buf := make([]byte, 8)
+	var n int
+
+	// check the magic number
+	n, err = io.ReadFull(fh, buf)
+	if err != nil {
+		return 0, 0, err
+	}
+	if n < 8 {
+		return 0, 0, ErrBrokenFile
+	}
+	if [8]byte(buf) != Magic && [8]byte(buf) != MagicCompressed {
+		return 0, 0, ErrInvalidFileFormat
+	}
+
+	// read version information
+	n, err = io.ReadFull(fh, buf)
+	if err != nil {
+		return 0, 0, err
+	}
+	if n < 8 {
+		return 0, 0, ErrBrokenFile
+	}
+	// check compatibility
+	if MainVersion != buf[0] {
+		return buf[0], buf[1], ErrVersionMismatch
+	}
+
+	return buf[0], buf[1], nil
+}
+
 // Reader is for fast extracting of subsequence of any sequence in the data file.
 type Reader struct {
 	batch uint32
@@ -366,7 +449,9 @@ type Reader struct {
 
 	buf []byte
 
-	fhData    *os.File
+	fh        util.File     // nil for readers created from MmapData
+	zr        *blockReader  // only for the block-compressed format
+	fhData    io.ReadSeeker // the file, or a reader of the memory-mapped data, or a reader of decompressed data
 	bufReader *bufio.Reader
 }
 
@@ -392,25 +477,140 @@ func NewReader(file string) (*Reader, error) {
 
 	// ------------ genome index file ----------------
 
-	fileIndex := filepath.Clean(file) + GenomeIndexFileExt
-	var err error
 	r := poolReader.Get().(*Reader)
+	err := r.readIndex(filepath.Clean(file) + GenomeIndexFileExt)
+	if err != nil {
+		return nil, err
+	}
+
+	// ------------ genome data file ----------------
 
-	fh, err := os.Open(fileIndex)
+	r.fh, err = util.OpenFile(file)
 	if err != nil {
 		return nil, err
 	}
-	bfh := bufio.NewReader(fh)
 
+	compressed, err := isCompressed(r.fh)
+	if err != nil {
+		r.fh.Close()
+		return nil, err
+	}
+	if compressed {
+		bidx, err := openBlockIndex(filepath.Clean(file), r.fh, r.fh.Size())
+		if err != nil {
+			r.fh.Close()
+			return nil, err
+		}
+		r.zr = newBlockReader(r.fh, bidx)
+		r.fhData = io.NewSectionReader(r.zr, 0, bidx.size)
+	} else {
+		r.zr = nil
+		r.fhData = util.NewFileReader(r.fh)
+	}
+
+	r.bufReader = bufio.NewReaderSize(nil, 4096)
+
+	return r, nil
+}
+
+// MmapData is a genome data file mapped into memory in read-only mode, along with its index data.
+// It can be shared by any number of Readers created with NewReader(), which have no file handlers
+// and use positional reads on the shared mapping.
+type MmapData struct {
+	batch uint32
+	nSeqs uint32
+	index []uint64
+
+	data   *util.MmapFile
+	blocks *blockIndex // only for the block-compressed format
+}
+
+// NewMmapData maps a genome data file into memory.
+func NewMmapData(file string) (*MmapData, error) {
+	if strings.HasSuffix(file, GenomeIndexFileExt) {
+		return nil, fmt.Errorf("genome file, not the index file should be given")
+	}
+
+	r := poolReader.Get().(*Reader)
+	defer func() {
+		r.Index = nil
+		poolReader.Put(r)
+	}()
+	err := r.readIndex(filepath.Clean(file) + GenomeIndexFileExt)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := util.OpenMmap(file)
+	if err != nil {
+		return nil, err
+	}
+	m := &MmapData{batch: r.batch, nSeqs: r.nSeqs, index: r.Index, data: data}
+
+	compressed, err := isCompressed(data)
+	if err != nil {
+		data.Close()
+		return nil, err
+	}
+	if compressed {
+		m.blocks, err = readBlockIndex(data, int64(data.Len()))
+		if err != nil {
+			data.Close()
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+// NewReader returns a reader of the memory-mapped data.
+// The reader is recycled after calling Close(), which does not unmap the data.
+func (m *MmapData) NewReader() *Reader {
+	r := poolReader.Get().(*Reader)
+	r.batch = m.batch
+	r.nSeqs = m.nSeqs
+	r.Index = m.index // read-only
+	r.fh = nil
+	if m.blocks != nil {
+		// each reader has its own cache of the decompressed block
+		r.zr = newBlockReader(m.data, m.blocks)
+		r.fhData = io.NewSectionReader(r.zr, 0, m.blocks.size)
+	} else {
+		r.zr = nil
+		r.fhData = io.NewSectionReader(m.data, 0, int64(m.data.Len()))
+	}
+	if r.bufReader == nil {
+		r.bufReader = bufio.NewReaderSize(nil, 4096)
+	}
+	return r
+}
+
+// Close unmaps the data. Readers created from it should not be used anymore.
+func (m *MmapData) Close() error {
+	if m.blocks != nil {
+		m.blocks.close()
+	}
+	return m.data.Close()
+}
+
+// readIndex reads the genome index file.
+func (r *Reader) readIndex(fileIndex string) error {
+	fh, err := util.OpenFile(fileIndex)
+	if err != nil {
+		return err
+	}
+	bfh := bufio.NewReader(util.NewFileReader(fh))
+
+	r.buf = resizeByteSlice(r.buf, 12) // it might be shrunk by a previous use of the pooled reader
 	buf := r.buf
 
 	// check the magic number
 	n, err := io.ReadFull(bfh, buf[:8])
 	if err != nil {
-		return nil, err
+		return err
 	}
 	if n < 8 {
-		return nil, ErrBrokenFile
+		return ErrBrokenFile
 	}
 	same := true
 	for i := 0; i < 8; i++ {
@@ -420,24 +620,24 @@ func NewReader(file string) (*Reader, error) {
 		}
 	}
 	if !same {
-		return nil, ErrInvalidFileFormat
+		return ErrInvalidFileFormat
 	}
 
 	// read metadata
 	n, _ = io.ReadFull(bfh, buf[:8])
 	if n < 8 {
-		return nil, ErrBrokenFile
+		return ErrBrokenFile
 	}
 
 	// check compatibility
 	if MainVersion != buf[0] {
-		return nil, ErrVersionMismatch
+		return ErrVersionMismatch
 	}
 
 	// batch number and the number seqs
 	n, _ = io.ReadFull(bfh, buf[:8])
 	if n < 8 {
-		return nil, ErrBrokenFile
+		return ErrBrokenFile
 	}
 
 	r.batch = be.Uint32(buf[:4])
@@ -450,27 +650,23 @@ func NewReader(file string) (*Reader, error) {
 		// offset in the data file and bases
 		n, _ = io.ReadFull(bfh, buf[:12])
 		if n < 12 {
-			return nil, ErrBrokenFile
+			return ErrBrokenFile
 		}
 		i2 = i << 1
 		r.Index[i2] = be.Uint64(buf[:8])
 		r.Index[i2+1] = uint64(be.Uint32(buf[8:12]))
 	}
-	err = fh.Close()
-	if err != nil {
-		return r, err
-	}
-
-	// ------------ genome data file ----------------
-
-	r.fhData, err = os.Open(file)
-	if err != nil {
-		return nil, err
-	}
+	return fh.Close()
+}
 
-	r.bufReader = bufio.NewReaderSize(nil, 4096)
+// Batch returns the batch id of the genome data file.
+func (r *Reader) Batch() uint32 {
+	return r.batch
+}
 
-	return r, nil
+// NumGenomes returns the number of genomes in the genome data file.
+func (r *Reader) NumGenomes() int {
+	return int(r.nSeqs)
 }
 
 // Close closes and recycles the reader.
@@ -481,10 +677,23 @@ func (r *Reader) Close() error {
 	// 	return err
 	// }
 
-	err := r.fhData.Close()
-	if err != nil {
-		poolReader.Put(r)
-		return err
+	if r.zr != nil {
+		if r.fh != nil { // block indexes of memory-mapped data are not shared
+			releaseBlockIndex(r.zr.idx)
+		}
+		r.zr.recycle()
+		r.zr = nil
+	}
+
+	if r.fh != nil {
+		err := r.fh.Close()
+		r.fh, r.fhData = nil, nil
+		if err != nil {
+			poolReader.Put(r)
+			return err
+		}
+	} else {
+		r.fhData = nil
 	}
 
 	// Reset buf if it grew too large to prevent memory bloat in the pool
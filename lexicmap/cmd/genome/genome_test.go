@@ -23,7 +23,10 @@ package genome
 import (
 	"bytes"
 	"fmt"
+	"math/rand"
 	"os"
+	"path/filepath"
+	"sync"
 	"testing"
 )
 
@@ -49,11 +52,26 @@ func TestGenomeWritingAndSeqExtraction(t *testing.T) {
 }
 
 func TestReadAndWrite(t *testing.T) {
-	file := "t.2bit"
+	testReadAndWrite(t, "t.2bit", 0)
+}
+
+func TestReadAndWriteCompressed(t *testing.T) {
+	for _, blockSize := range []int{16, 100, 1024} {
+		testReadAndWrite(t, "t.2bit.z", blockSize)
+	}
+}
 
+// testReadAndWrite writes and reads sequences, blockSize > 0 for the block-compressed format.
+func testReadAndWrite(t *testing.T, file string, blockSize int) {
 	// ----------------------- write --------------
 
-	w, err := NewWriter(file, 1)
+	var w *Writer
+	var err error
+	if blockSize > 0 {
+		w, err = NewCompressedWriter(file, 1, blockSize)
+	} else {
+		w, err = NewWriter(file, 1)
+	}
 	if err != nil {
 		t.Error(err)
 		return
@@ -106,11 +124,25 @@ func TestReadAndWrite(t *testing.T) {
 
 	// ----------------------- read --------------
 
+	mainVersion, minorVersion, err := ReadDataHeader(file)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	if mainVersion != MainVersion || minorVersion != MinorVersion {
+		t.Errorf("unexpected versions: %d.%d", mainVersion, minorVersion)
+		return
+	}
+
 	r, err := NewReader(file)
 	if err != nil {
 		t.Error(err)
 		return
 	}
+	if r.Batch() != 1 || r.NumGenomes() != len(_seqs) {
+		t.Errorf("unexpected batch id (%d) or number of genomes (%d)", r.Batch(), r.NumGenomes())
+		return
+	}
 
 	var start, end int
 	var s1 []byte
@@ -148,6 +180,50 @@ func TestReadAndWrite(t *testing.T) {
 
 	r.Close()
 
+	// ----------------------- read with mmap --------------
+
+	m, err := NewMmapData(file)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
+	var wg sync.WaitGroup
+	for j := 0; j < 4; j++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			r := m.NewReader()
+			defer r.Close()
+
+			for i, s := range _seqs {
+				for start := 0; start < len(s); start++ {
+					for end := start; end < len(s); end++ {
+						s2, err := r.SubSeq(i, start, end)
+						if err != nil {
+							t.Error(err)
+							return
+						}
+						if !bytes.Equal(s[start:end+1], s2.Seq) {
+							t.Errorf("mmap, idx: %d:%d-%d, expected: %s, results: %s",
+								i, start, end, s[start:end+1], s2.Seq)
+							return
+						}
+						RecycleGenome(s2)
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	err = m.Close()
+	if err != nil {
+		t.Error(err)
+		return
+	}
+
 	// clean up
 
 	err = os.RemoveAll(file)
@@ -162,3 +238,191 @@ func TestReadAndWrite(t *testing.T) {
 		return
 	}
 }
+
+func TestCompressedWithDict(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	bases := []byte("ACGT")
+	seqs := make([][]byte, 4)
+	seqs[0] = make([]byte, 200000)
+	for i := range seqs[0] {
+		seqs[0][i] = bases[r.Intn(4)]
+	}
+	for j := 1; j < len(seqs); j++ { // mutated copies
+		seqs[j] = append([]byte{}, seqs[0]...)
+		for i := 0; i < len(seqs[j])/100; i++ {
+			seqs[j][r.Intn(len(seqs[j]))] = bases[r.Intn(4)]
+		}
+	}
+
+	file := filepath.Join(t.TempDir(), "genomes.bin")
+	w, err := NewCompressedWriter(file, 0, 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, s := range seqs {
+		g := PoolGenome.Get().(*Genome)
+		g.Reset()
+		g.ID = append(g.ID, fmt.Sprintf("g%d", i)...)
+		g.Seq = append(g.Seq, s...)
+		g.GenomeSize = len(s)
+		g.Len = len(s)
+		g.NumSeqs = 1
+		g.SeqSizes = append(g.SeqSizes, len(s))
+		seqid := []byte("chr")
+		g.SeqIDs = append(g.SeqIDs, &seqid)
+		if err = w.Write(g); err != nil {
+			t.Fatal(err)
+		}
+		RecycleGenome(g)
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the mutated copies are compressed with the first genome as the dictionary
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plain := int64(len(seqs) * len(seqs[0]) / 4); info.Size() > plain/2 {
+		t.Errorf("genome data not compressed: %d bytes, %d bytes for the plain format", info.Size(), plain)
+	}
+
+	// readers of the same file share the block index
+	rdr1, err := NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rdr2, err := NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rdr1.zr.idx != rdr2.zr.idx || rdr1.zr.idx.refs != 2 {
+		t.Errorf("block index not shared by readers of the same file")
+	}
+
+	for i, s := range seqs {
+		for _, rdr := range []*Reader{rdr1, rdr2} {
+			start := r.Intn(len(s) - 1000)
+			g, err := rdr.SubSeq(i, start, start+999)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(g.Seq, s[start:start+1000]) {
+				t.Errorf("unexpected subsequence of genome %d at %d", i, start)
+			}
+			RecycleGenome(g)
+		}
+	}
+
+	if err = rdr1.Close(); err != nil {
+		t.Error(err)
+	}
+	if err = rdr2.Close(); err != nil {
+		t.Error(err)
+	}
+	blockIndexes.Lock()
+	if len(blockIndexes.m) != 0 {
+		t.Errorf("block indexes not released: %d", len(blockIndexes.m))
+	}
+	blockIndexes.Unlock()
+}
+
+// benchmark data: 2 clusters of 4 genomes of 5 Mb (about the size of a bacterial genome),
+// in each cluster, the last three genomes are mutated copies of the first one.
+// Only genomes of the first cluster are compressed, as they are similar to the first genome.
+var benchGenomes [][]byte
+var benchGenomesOnce sync.Once
+
+func genBenchGenomes() {
+	r := rand.New(rand.NewSource(1))
+	bases := []byte("ACGT")
+	for c := 0; c < 2; c++ {
+		s := make([]byte, 5000000)
+		for i := range s {
+			s[i] = bases[r.Intn(4)]
+		}
+		benchGenomes = append(benchGenomes, s)
+		for j := 1; j < 4; j++ {
+			s2 := make([]byte, len(s))
+			copy(s2, s)
+			for i := 0; i < len(s2)/100; i++ { // 1% SNPs
+				s2[r.Intn(len(s2))] = bases[r.Intn(4)]
+			}
+			benchGenomes = append(benchGenomes, s2)
+		}
+	}
+}
+
+// BenchmarkSubSeq compares the sizes of genome data files and the latencies of
+// extracting 1-kb subsequences, between the plain format and block-compressed formats
+// with different block sizes.
+func BenchmarkSubSeq(b *testing.B) {
+	benchGenomesOnce.Do(genBenchGenomes)
+
+	for _, blockSize := range []int{0, 4 << 10, 16 << 10, 64 << 10, 256 << 10, 1 << 20} {
+		name := "plain"
+		if blockSize > 0 {
+			name = fmt.Sprintf("zstd-%dKB", blockSize>>10)
+		}
+		b.Run(name, func(b *testing.B) {
+			file := filepath.Join(b.TempDir(), "genomes.bin")
+
+			var w *Writer
+			var err error
+			if blockSize > 0 {
+				w, err = NewCompressedWriter(file, 0, blockSize)
+			} else {
+				w, err = NewWriter(file, 0)
+			}
+			if err != nil {
+				b.Fatal(err)
+			}
+			for i, s := range benchGenomes {
+				g := PoolGenome.Get().(*Genome)
+				g.Reset()
+				g.ID = append(g.ID, fmt.Sprintf("g%d", i)...)
+				g.Seq = append(g.Seq, s...)
+				g.GenomeSize = len(s)
+				g.Len = len(s)
+				g.NumSeqs = 1
+				g.SeqSizes = append(g.SeqSizes, len(s))
+				seqid := []byte("chr")
+				g.SeqIDs = append(g.SeqIDs, &seqid)
+				if err = w.Write(g); err != nil {
+					b.Fatal(err)
+				}
+				RecycleGenome(g)
+			}
+			if err = w.Close(); err != nil {
+				b.Fatal(err)
+			}
+
+			info, err := os.Stat(file)
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			rdr, err := NewReader(file)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer rdr.Close()
+
+			r := rand.New(rand.NewSource(1))
+			n := len(benchGenomes)
+			size := len(benchGenomes[0]) - 1000
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				start := r.Intn(size)
+				g, err := rdr.SubSeq(r.Intn(n), start, start+999)
+				if err != nil {
+					b.Fatal(err)
+				}
+				RecycleGenome(g)
+			}
+			b.ReportMetric(float64(info.Size()), "file-bytes")
+		})
+	}
+}
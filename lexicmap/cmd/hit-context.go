@@ -0,0 +1,769 @@
+// Copyright © 2023-2026 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shenwei356/LexicMap/lexicmap/cmd/genome"
+	"github.com/shenwei356/bio/seq"
+	"github.com/spf13/cobra"
+)
+
+var hitContextCmd = &cobra.Command{
+	Use:   "hit-context",
+	Short: "Extract and cluster flanking sequences of hits to reveal genetic contexts",
+	Long: `Extract and cluster flanking sequences of hits to reveal genetic contexts
+
+Input:
+  - Output file(s) of 'lexicmap search' with the same index given by -d/--index.
+  - Search results should come from the same ONE query.
+    If not, please specify one query with the flag -q/--query.
+
+How:
+  1. For every HSP (or only the best one of each genome with -B/--best-hsp),
+     the upstream (-U/--upstream) and downstream (-D/--downstream) flanks are
+     extracted from the index, and oriented to the strand of the query.
+     So the upstream flank is always on the 5' end of the query.
+  2. Flanks shorter than -m/--min-flank-len, e.g., hits at the ends of contigs,
+     are not clustered and marked as "-".
+  3. Upstream and downstream flanks are clustered separately in a greedy way:
+     flanks are sorted by length in descending order, and each one is assigned
+     to the most similar representative, or becomes a new representative if the
+     similarity is lower than -s/--min-similarity.
+     The similarity is the fraction of shared k-mers in the smaller k-mer set,
+     so a flank truncated by a contig end can still join its full-length context.
+  4. A genetic context is a combination of an upstream and a downstream cluster.
+
+Output:
+  - A table of contexts (-o/--out-file), ordered by the number of genomes, with 6 columns:
+      1. context,    context ID.
+      2. upstream,   upstream cluster ID.
+      3. downstream, downstream cluster ID.
+      4. genomes,    number of genomes with the context.
+      5. hits,       number of HSPs with the context.
+      6. members,    comma-separated genome IDs.
+  - Optional table of all HSPs (-H/--hits), with 12 columns:
+      query, sgenome, sseqid, sstart, send, sstr, slen,
+      upstream_len, downstream_len, upstream, downstream, context.
+  - Optional representative flanking sequences (-r/--rep-seqs) in FASTA format,
+    with sequence IDs of cluster IDs, e.g., U1 and D1.
+
+Attention:
+  1. All degenerate bases in reference genomes were converted to the lexicographic first bases.
+     E.g., N was converted to A. Therefore, consecutive A's in flanks might be N's in the genomes.
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		opt := getOptions(cmd)
+		seq.ValidateSeq = false
+
+		outputLog := opt.Verbose || opt.Log2File
+
+		dbDir := getFlagString(cmd, "index")
+		if dbDir == "" {
+			checkError(fmt.Errorf("flag -d/--index needed"))
+		}
+
+		outFile := getFlagString(cmd, "out-file")
+		query := getFlagString(cmd, "query")
+
+		bufferSizeS := getFlagString(cmd, "buffer-size")
+		if bufferSizeS == "" {
+			checkError(fmt.Errorf("value of buffer size. supported unit: K, M, G"))
+		}
+		bufferSize, err := ParseByteSize(bufferSizeS)
+		if err != nil {
+			checkError(fmt.Errorf("invalid value of buffer size. supported unit: K, M, G"))
+		}
+
+		upstream := getFlagNonNegativeInt(cmd, "upstream")
+		downstream := getFlagNonNegativeInt(cmd, "downstream")
+		if upstream == 0 && downstream == 0 {
+			checkError(fmt.Errorf("at least one of -U/--upstream and -D/--downstream should be positive"))
+		}
+		minFlankLen := getFlagPositiveInt(cmd, "min-flank-len")
+		k := getFlagPositiveInt(cmd, "kmer")
+		if k > 32 {
+			checkError(fmt.Errorf("the value of -k/--kmer should be in the range of [1, 32]"))
+		}
+		if minFlankLen < k {
+			checkError(fmt.Errorf("the value of -m/--min-flank-len (%d) should not be smaller than -k/--kmer (%d)", minFlankLen, k))
+		}
+		minSim := getFlagNonNegativeFloat64(cmd, "min-similarity")
+		if minSim > 1 {
+			checkError(fmt.Errorf("the value of -s/--min-similarity should be in the range of [0, 1]"))
+		}
+
+		bestHSP := getFlagBool(cmd, "best-hsp")
+		minQcovHSP := getFlagNonNegativeFloat64(cmd, "min-qcov-per-hsp")
+		minPident := getFlagNonNegativeFloat64(cmd, "min-pident")
+		maxOpenFiles := getFlagPositiveInt(cmd, "max-open-files")
+		ignoreErr := getFlagBool(cmd, "ignore-err")
+
+		fileHits := getFlagString(cmd, "hits")
+		fileRepSeqs := getFlagString(cmd, "rep-seqs")
+		lineWidth := getFlagNonNegativeInt(cmd, "line-width")
+
+		timeStart := time.Now()
+		defer func() {
+			if outputLog {
+				log.Info()
+				log.Infof("elapsed time: %s", time.Since(timeStart))
+				log.Info()
+			}
+		}()
+
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+
+		// ---------------------------------------------------------------
+		// read hits
+
+		hits := make([]*ContextHit, 0, 1024)
+
+		var rGnm *SearchResultOfAGenome
+		var rSeq *SearchResultOfASequence
+		var pident, qcovHSP float64
+		var nSkipped int
+		checkQuery := query == ""
+
+		for _, file := range files {
+			reader, err := NewSearchResultReader(file, query, bufferSize)
+			checkError(err)
+
+			for {
+				rGnm = reader.Next()
+				if rGnm == nil {
+					break
+				}
+
+				if query == "" {
+					query = rGnm.Query
+				} else if checkQuery && query != rGnm.Query {
+					checkError(fmt.Errorf("inconsistent queries: '%s' and '%s' in file '%s'. Please specify one query with flag -q/--query",
+						query, rGnm.Query, file))
+				}
+
+				for _, rSeq = range rGnm.Records {
+					pident, _ = strconv.ParseFloat(rSeq.Pident, 64)
+					qcovHSP, _ = strconv.ParseFloat(rSeq.QcovHSP, 64)
+					if pident < minPident || qcovHSP < minQcovHSP {
+						nSkipped++
+						continue
+					}
+
+					h := &ContextHit{Genome: rGnm.Sgenome, SeqID: rSeq.Sseqid, Strand: rSeq.Sstr}
+					if h.Start, err = strconv.Atoi(rSeq.Sstart); err != nil {
+						checkError(fmt.Errorf("failed to parse sstart: %s", rSeq.Sstart))
+					}
+					if h.End, err = strconv.Atoi(rSeq.Send); err != nil {
+						checkError(fmt.Errorf("failed to parse send: %s", rSeq.Send))
+					}
+					if h.SeqLen, err = strconv.Atoi(rSeq.Slen); err != nil {
+						checkError(fmt.Errorf("failed to parse slen: %s", rSeq.Slen))
+					}
+					hits = append(hits, h)
+
+					if bestHSP { // HSPs of a genome are sorted, the first one is the best
+						break
+					}
+				}
+
+				RecycleSearchResultOfAGenome(rGnm)
+			}
+		}
+
+		if len(hits) == 0 {
+			if outputLog {
+				log.Warningf("no valid HSPs found")
+			}
+			return
+		}
+		if outputLog {
+			log.Infof("%d HSPs loaded for query: %s", len(hits), query)
+			if nSkipped > 0 {
+				log.Infof("  %d HSPs filtered out", nSkipped)
+			}
+		}
+
+		// ---------------------------------------------------------------
+		// index and genome readers
+
+		if outputLog {
+			log.Infof("loading index: %s", dbDir)
+		}
+
+		info, err := readIndexInfo(filepath.Join(dbDir, FileInfo))
+		if err != nil {
+			checkError(fmt.Errorf("failed to read info file: %s", err))
+		}
+		if info.MainVersion != MainVersion {
+			checkError(fmt.Errorf("index main versions do not match: %d (index) != %d (tool). please re-create the index", info.MainVersion, MainVersion))
+		}
+		layout, err := NewIndexLayout(dbDir, info)
+		checkError(err)
+
+		if maxOpenFiles < info.GenomeBatches {
+			log.Warningf("the value of --max-open-files (%d) should be larger than the number of genome batches (%d)", maxOpenFiles, info.GenomeBatches)
+		}
+
+		refname2idx, err := readGenomeMapName2Idx(filepath.Join(dbDir, FileGenomeIndex))
+		if err != nil {
+			checkError(fmt.Errorf("failed to read genomes index mapping file: %s", err))
+		}
+
+		nRdr := maxOpenFiles / info.GenomeBatches
+		if nRdr > opt.NumCPUs {
+			nRdr = opt.NumCPUs
+		}
+		if nRdr < 1 {
+			nRdr = 1
+		}
+		readers := make([]chan *genome.Reader, info.GenomeBatches)
+		for i := 0; i < info.GenomeBatches; i++ {
+			readers[i] = make(chan *genome.Reader, nRdr)
+		}
+
+		var wg sync.WaitGroup
+		tokens := make(chan int, opt.NumCPUs)
+		for i := 0; i < info.GenomeBatches; i++ {
+			for j := 0; j < nRdr; j++ {
+				tokens <- 1
+				wg.Add(1)
+				go func(i int) {
+					rdr, err := genome.NewReader(layout.GenomeFile(i))
+					if err != nil {
+						checkError(fmt.Errorf("failed to create genome reader: %s", err))
+					}
+
+					readers[i] <- rdr
+
+					wg.Done()
+					<-tokens
+				}(i)
+			}
+		}
+		wg.Wait()
+
+		// ---------------------------------------------------------------
+		// extract flanks
+
+		if outputLog {
+			log.Infof("extracting flanking sequences: %d bp upstream, %d bp downstream ...", upstream, downstream)
+		}
+
+		var nFailed int
+		var mu sync.Mutex
+		for _, h := range hits {
+			tokens <- 1
+			wg.Add(1)
+			go func(h *ContextHit) {
+				defer func() {
+					wg.Done()
+					<-tokens
+				}()
+
+				batchIDAndRefIDs, ok := refname2idx[h.Genome]
+				if !ok {
+					if ignoreErr {
+						mu.Lock()
+						nFailed++
+						mu.Unlock()
+						return
+					}
+					checkError(fmt.Errorf("reference name not found: %s. Please switch on -e/--ignore-err if search results are merged from multiple indexes", h.Genome))
+				}
+
+				err := extractHitFlanks(h, *batchIDAndRefIDs, readers, upstream, downstream)
+				if err != nil {
+					if ignoreErr {
+						mu.Lock()
+						nFailed++
+						mu.Unlock()
+						return
+					}
+					checkError(fmt.Errorf("failed to extract flanks of %s|%s:%d-%d:%s: %s. Please switch on -e/--ignore-err if search results are merged from multiple indexes",
+						h.Genome, h.SeqID, h.Start, h.End, h.Strand, err))
+				}
+			}(h)
+		}
+		wg.Wait()
+
+		for _, rdrs := range readers {
+			close(rdrs)
+			for rdr := range rdrs {
+				checkError(rdr.Close())
+			}
+		}
+
+		if outputLog && nFailed > 0 {
+			log.Warningf("  failed to extract flanks of %d HSPs", nFailed)
+		}
+
+		// ---------------------------------------------------------------
+		// cluster
+
+		ups := make([][]byte, len(hits))
+		downs := make([][]byte, len(hits))
+		for i, h := range hits {
+			ups[i] = h.Upstream
+			downs[i] = h.Downstream
+		}
+
+		clsUp, repsUp := clusterFlanks(ups, k, minFlankLen, minSim)
+		clsDown, repsDown := clusterFlanks(downs, k, minFlankLen, minSim)
+		for i, h := range hits {
+			h.UpCluster = clsUp[i]
+			h.DownCluster = clsDown[i]
+		}
+
+		if outputLog {
+			log.Infof("%d upstream clusters and %d downstream clusters found", len(repsUp), len(repsDown))
+		}
+
+		contexts := hitContexts(hits)
+
+		if outputLog {
+			log.Infof("%d genetic contexts found", len(contexts))
+		}
+
+		// ---------------------------------------------------------------
+		// output
+
+		outfh, gw, w, err := outStream(outFile, strings.HasSuffix(outFile, ".gz"), opt.CompressionLevel)
+		checkError(err)
+
+		fmt.Fprintf(outfh, "context\tupstream\tdownstream\tgenomes\thits\tmembers\n")
+		for _, c := range contexts {
+			fmt.Fprintf(outfh, "C%d\t%s\t%s\t%d\t%d\t%s\n", c.ID,
+				flankClusterName('U', c.UpCluster), flankClusterName('D', c.DownCluster),
+				len(c.Genomes), c.Hits, strings.Join(c.Genomes, ","))
+		}
+
+		outfh.Flush()
+		if gw != nil {
+			gw.Close()
+		}
+		w.Close()
+
+		if fileHits != "" {
+			hfh, hgw, hw, err := outStream(fileHits, strings.HasSuffix(fileHits, ".gz"), opt.CompressionLevel)
+			checkError(err)
+
+			fmt.Fprintf(hfh, "query\tsgenome\tsseqid\tsstart\tsend\tsstr\tslen\tupstream_len\tdownstream_len\tupstream\tdownstream\tcontext\n")
+			for _, h := range hits {
+				fmt.Fprintf(hfh, "%s\t%s\t%s\t%d\t%d\t%s\t%d\t%d\t%d\t%s\t%s\tC%d\n",
+					query, h.Genome, h.SeqID, h.Start, h.End, h.Strand, h.SeqLen,
+					len(h.Upstream), len(h.Downstream),
+					flankClusterName('U', h.UpCluster), flankClusterName('D', h.DownCluster), h.Context)
+			}
+
+			hfh.Flush()
+			if hgw != nil {
+				hgw.Close()
+			}
+			hw.Close()
+
+			if outputLog {
+				log.Infof("contexts of %d HSPs saved to: %s", len(hits), fileHits)
+			}
+		}
+
+		if fileRepSeqs != "" {
+			rfh, rgw, rw, err := outStream(fileRepSeqs, strings.HasSuffix(fileRepSeqs, ".gz"), opt.CompressionLevel)
+			checkError(err)
+
+			var buffer *bytes.Buffer
+			var text []byte
+			writeReps := func(prefix byte, reps []*FlankCluster, up bool) {
+				var h *ContextHit
+				var s []byte
+				for _, c := range reps {
+					h = hits[c.Rep]
+					if up {
+						s = h.Upstream
+					} else {
+						s = h.Downstream
+					}
+					fmt.Fprintf(rfh, ">%s members=%d rep=%s|%s:%d-%d:%s len=%d\n", flankClusterName(prefix, c.ID), c.Members,
+						h.Genome, h.SeqID, h.Start, h.End, h.Strand, len(s))
+					text, buffer = wrapByteSlice(s, lineWidth, buffer)
+					rfh.Write(text)
+					rfh.WriteByte('\n')
+				}
+			}
+			writeReps('U', repsUp, true)
+			writeReps('D', repsDown, false)
+
+			rfh.Flush()
+			if rgw != nil {
+				rgw.Close()
+			}
+			rw.Close()
+
+			if outputLog {
+				log.Infof("%d representative flanking sequences saved to: %s", len(repsUp)+len(repsDown), fileRepSeqs)
+			}
+		}
+	},
+}
+
+func init() {
+	utilsCmd.AddCommand(hitContextCmd)
+
+	hitContextCmd.Flags().StringP("index", "d", "",
+		formatFlagUsage(`Index directory created by "lexicmap index".`))
+
+	hitContextCmd.Flags().StringP("out-file", "o", "-",
+		formatFlagUsage(`Out file of contexts, supports the ".gz" suffix ("-" for stdout).`))
+
+	hitContextCmd.Flags().StringP("query", "q", "",
+		formatFlagUsage(`Query ID to use.`))
+
+	hitContextCmd.Flags().StringP("buffer-size", "b", "20M",
+		formatFlagUsage(`Size of buffer, supported unit: K, M, G. You need increase the value when "bufio.Scanner: token too long" error reported`))
+
+	hitContextCmd.Flags().IntP("max-open-files", "", 1024,
+		formatFlagUsage(`Maximum opened files, used for extracting flanking sequences.`))
+
+	hitContextCmd.Flags().BoolP("ignore-err", "e", false,
+		formatFlagUsage(`Ignore errors such as 'reference name not found' or 'failed to extract subsequence'. Switch on this flag if search results are merged from multiple indexes.`))
+
+	// -------------------------------------------------------
+	// hits
+
+	hitContextCmd.Flags().BoolP("best-hsp", "B", false,
+		formatFlagUsage(`Only use the best HSP (the first one) of each genome.`))
+
+	hitContextCmd.Flags().Float64P("min-qcov-per-hsp", "c", 0,
+		formatFlagUsage(`Minimum query coverage (percentage) per HSP.`))
+
+	hitContextCmd.Flags().Float64P("min-pident", "i", 0,
+		formatFlagUsage(`Minimum base identity (percentage) of an HSP.`))
+
+	// -------------------------------------------------------
+	// flanks and clustering
+
+	hitContextCmd.Flags().IntP("upstream", "U", 1000,
+		formatFlagUsage(`Length of the upstream flank (on the 5' end of the query).`))
+
+	hitContextCmd.Flags().IntP("downstream", "D", 1000,
+		formatFlagUsage(`Length of the downstream flank (on the 3' end of the query).`))
+
+	hitContextCmd.Flags().IntP("min-flank-len", "m", 100,
+		formatFlagUsage(`Minimum length of a flank to cluster. Shorter ones are marked as "-".`))
+
+	hitContextCmd.Flags().IntP("kmer", "k", 21,
+		formatFlagUsage(`K-mer size for computing similarities between flanks, in the range of [1, 32].`))
+
+	hitContextCmd.Flags().Float64P("min-similarity", "s", 0.8,
+		formatFlagUsage(`Minimum similarity, i.e., fraction of shared k-mers in the smaller k-mer set, for assigning a flank to a cluster.`))
+
+	// -------------------------------------------------------
+	// other outputs
+
+	hitContextCmd.Flags().StringP("hits", "H", "",
+		formatFlagUsage(`Output the contexts of all HSPs to this file.`))
+
+	hitContextCmd.Flags().StringP("rep-seqs", "r", "",
+		formatFlagUsage(`Output representative flanking sequences of clusters to this FASTA file.`))
+
+	hitContextCmd.Flags().IntP("line-width", "w", 60,
+		formatFlagUsage("Line width of representative sequences (0 for no wrap)."))
+
+	hitContextCmd.SetUsageTemplate(usageTemplate(""))
+}
+
+// ContextHit is an HSP with its flanking sequences.
+type ContextHit struct {
+	Genome string
+	SeqID  string
+	Start  int // 1-based
+	End    int // 1-based
+	Strand string
+	SeqLen int
+
+	// flanks oriented to the query strand
+	Upstream   []byte
+	Downstream []byte
+
+	UpCluster   int // 0 for unclustered
+	DownCluster int // 0 for unclustered
+	Context     int
+}
+
+// extractHitFlanks extracts the region covering both flanks of a hit in one call,
+// and splits it into upstream and downstream flanks in the query orientation.
+func extractHitFlanks(h *ContextHit, batchIDAndRefIDs []uint64,
+	readers []chan *genome.Reader, upstream, downstream int) error {
+
+	// flanks on the positive strand of the reference
+	left, right := upstream, downstream
+	if h.Strand == "-" {
+		left, right = downstream, upstream
+	}
+
+	start := max(h.Start-left, 1)
+	end := min(h.End+right, h.SeqLen)
+
+	seqid := []byte(h.SeqID)
+	var tSeq *genome.Genome
+	var err error
+	var rdr *genome.Reader
+	for _, batchIDAndRefID := range batchIDAndRefIDs {
+		genomeBatch := int(batchIDAndRefID >> BITS_GENOME_IDX)
+		genomeIdx := int(batchIDAndRefID & MASK_GENOME_IDX)
+
+		rdr = <-readers[genomeBatch]
+		tSeq, _, err = rdr.SubSeq2(genomeIdx, seqid, start-1, end-1)
+		readers[genomeBatch] <- rdr
+
+		if err == nil && tSeq != nil {
+			break
+		}
+		// the sequence might not be in this genome chunk
+	}
+	if err != nil {
+		return err
+	}
+	if tSeq == nil {
+		return fmt.Errorf("sequence not found")
+	}
+	defer genome.RecycleGenome(tSeq)
+
+	if len(tSeq.Seq) < end-start+1 {
+		return fmt.Errorf("unexpected sequence length: %d < %d", len(tSeq.Seq), end-start+1)
+	}
+
+	l := h.Start - start                // length of the left flank
+	r := end - h.End                    // length of the right flank
+	sLeft := slices.Clone(tSeq.Seq[:l]) //
+	sRight := slices.Clone(tSeq.Seq[end-start+1-r : end-start+1])
+
+	if h.Strand == "-" {
+		h.Upstream = revComFlank(sRight)
+		h.Downstream = revComFlank(sLeft)
+	} else {
+		h.Upstream = sLeft
+		h.Downstream = sRight
+	}
+	return nil
+}
+
+func revComFlank(s []byte) []byte {
+	if len(s) == 0 {
+		return s
+	}
+	_s, err := seq.NewSeq(seq.DNAredundant, s)
+	checkError(err)
+	_s.RevComInplace()
+	return _s.Seq
+}
+
+// FlankCluster is a cluster of flanking sequences.
+type FlankCluster struct {
+	ID      int // 1-based, ordered by the number of members
+	Rep     int // index of the representative
+	Members int
+}
+
+func flankClusterName(prefix byte, id int) string {
+	if id == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%c%d", prefix, id)
+}
+
+// clusterFlanks greedily clusters flanking sequences, and returns the cluster IDs
+// (0 for the ones shorter than minLen) of all sequences and the clusters.
+// Sequences are visited from the longest, and each one is assigned to the most
+// similar representative if the similarity, i.e., the fraction of shared k-mers
+// in the smaller k-mer set, is >= minSim, or it becomes a new representative.
+func clusterFlanks(seqs [][]byte, k int, minLen int, minSim float64) ([]int, []*FlankCluster) {
+	ids := make([]int, len(seqs))
+
+	order := make([]int, 0, len(seqs))
+	for i, s := range seqs {
+		if len(s) >= minLen && len(s) >= k {
+			order = append(order, i)
+		}
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		return len(seqs[b]) - len(seqs[a])
+	})
+
+	type rep struct {
+		idx     int
+		kmers   map[uint64]struct{}
+		members int
+	}
+	reps := make([]*rep, 0, 8)
+
+	var kmers map[uint64]struct{}
+	var best int
+	var sim, bestSim float64
+	var shared, n int
+	for _, i := range order {
+		kmers = flankKmers(seqs[i], k)
+
+		best, bestSim = -1, -1
+		for j, r := range reps {
+			shared = 0
+			for code := range kmers {
+				if _, ok := r.kmers[code]; ok {
+					shared++
+				}
+			}
+			n = min(len(kmers), len(r.kmers))
+			if n == 0 {
+				continue
+			}
+			sim = float64(shared) / float64(n)
+			if sim >= minSim && sim > bestSim {
+				best, bestSim = j, sim
+			}
+		}
+
+		if best < 0 {
+			reps = append(reps, &rep{idx: i, kmers: kmers, members: 1})
+			ids[i] = len(reps) // temporary ID
+		} else {
+			reps[best].members++
+			ids[i] = best + 1
+		}
+	}
+
+	// renumber clusters by the number of members
+	clusters := make([]*FlankCluster, len(reps))
+	for j, r := range reps {
+		clusters[j] = &FlankCluster{ID: j + 1, Rep: r.idx, Members: r.members}
+	}
+	slices.SortStableFunc(clusters, func(a, b *FlankCluster) int {
+		return b.Members - a.Members
+	})
+	newIDs := make([]int, len(clusters)+1)
+	for j, c := range clusters {
+		newIDs[c.ID] = j + 1
+		c.ID = j + 1
+	}
+	for i, id := range ids {
+		ids[i] = newIDs[id]
+	}
+
+	return ids, clusters
+}
+
+// flankKmers returns the set of k-mers (k <= 32) of a sequence on the given strand only,
+// as flanks are oriented to the query and the orientation of neighbouring elements matters.
+func flankKmers(s []byte, k int) map[uint64]struct{} {
+	kmers := make(map[uint64]struct{}, len(s))
+	if len(s) < k {
+		return kmers
+	}
+	var mask uint64
+	if k == 32 {
+		mask = ^uint64(0)
+	} else {
+		mask = (uint64(1) << uint(k<<1)) - 1
+	}
+
+	var code uint64
+	var n int // number of valid bases in the current k-mer
+	for _, b := range s {
+		switch b {
+		case 'A', 'a':
+			code = code << 2
+		case 'C', 'c':
+			code = code<<2 | 1
+		case 'G', 'g':
+			code = code<<2 | 2
+		case 'T', 't':
+			code = code<<2 | 3
+		default:
+			n = 0
+			continue
+		}
+		code &= mask
+		n++
+		if n >= k {
+			kmers[code] = struct{}{}
+		}
+	}
+	return kmers
+}
+
+// HitContext is a genetic context, i.e., a combination of upstream and downstream clusters.
+type HitContext struct {
+	ID          int
+	UpCluster   int
+	DownCluster int
+	Genomes     []string
+	Hits        int
+}
+
+// hitContexts groups hits by their upstream and downstream clusters, assigns
+// context IDs to hits, and returns contexts ordered by the number of genomes.
+func hitContexts(hits []*ContextHit) []*HitContext {
+	m := make(map[[2]int]*HitContext, 8)
+	contexts := make([]*HitContext, 0, 8)
+	genomes := make(map[[2]int]map[string]struct{}, 8)
+
+	var key [2]int
+	var c *HitContext
+	var ok bool
+	for _, h := range hits {
+		key = [2]int{h.UpCluster, h.DownCluster}
+		if c, ok = m[key]; !ok {
+			c = &HitContext{UpCluster: h.UpCluster, DownCluster: h.DownCluster}
+			m[key] = c
+			contexts = append(contexts, c)
+			genomes[key] = make(map[string]struct{}, 8)
+		}
+		c.Hits++
+		if _, ok = genomes[key][h.Genome]; !ok {
+			genomes[key][h.Genome] = struct{}{}
+			c.Genomes = append(c.Genomes, h.Genome)
+		}
+	}
+
+	slices.SortStableFunc(contexts, func(a, b *HitContext) int {
+		if len(a.Genomes) != len(b.Genomes) {
+			return len(b.Genomes) - len(a.Genomes)
+		}
+		return b.Hits - a.Hits
+	})
+	for i, c := range contexts {
+		c.ID = i + 1
+		m[[2]int{c.UpCluster, c.DownCluster}] = c
+	}
+	for _, h := range hits {
+		h.Context = m[[2]int{h.UpCluster, h.DownCluster}].ID
+	}
+
+	return contexts
+}
@@ -0,0 +1,514 @@
+// Copyright © 2023-2026 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var hits2msaCmd = &cobra.Command{
+	Use:   "hits2msa",
+	Short: "Build a query-anchored multiple sequence alignment from search results",
+	Long: `Build a query-anchored multiple sequence alignment from search results
+
+Input:
+  - Output file of 'lexicmap search' with the flag -a/--all.
+  - Search results should come from the same ONE query.
+    If not, please specify one query with the flag -q/--query.
+
+How:
+  1. The pairwise alignments (qseq and sseq) between the query and all HSPs
+     are anchored on query positions.
+  2. Insertions relative to the query are kept as padded columns,
+     i.e., the longest insertion after each query position decides
+     the number of extra columns, and shorter ones are padded with gaps.
+  3. Regions of the query not covered by an HSP are filled with gaps.
+     The query row is rebuilt from all HSPs, with uncovered bases shown as N's.
+
+Output:
+  - FASTA (default) or Clustal format.
+    The first record is the query, followed by HSPs in the input order,
+    with sequence IDs in the format of "sgenome|sseqid:sstart-send:sstr".
+  - Optional haplotype table (-H/--haplotypes), where identical aligned
+    sequences are deduplicated, with 5 columns:
+      1. haplotype, haplotype ID, ordered by the number of genomes.
+      2. genomes,   number of genomes carrying the haplotype.
+      3. hsps,      number of HSPs with the haplotype.
+      4. members,   comma-separated genome IDs.
+      5. seq,       aligned sequence.
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		opt := getOptions(cmd)
+
+		outFile := getFlagString(cmd, "out-file")
+		query := getFlagString(cmd, "query")
+
+		bufferSizeS := getFlagString(cmd, "buffer-size")
+		if bufferSizeS == "" {
+			checkError(fmt.Errorf("value of buffer size. supported unit: K, M, G"))
+		}
+		bufferSize, err := ParseByteSize(bufferSizeS)
+		if err != nil {
+			checkError(fmt.Errorf("invalid value of buffer size. supported unit: K, M, G"))
+		}
+
+		outFormat := strings.ToLower(getFlagString(cmd, "out-format"))
+		switch outFormat {
+		case "fasta", "clustal":
+		default:
+			checkError(fmt.Errorf("unsupported output format: %s. available: fasta, clustal", outFormat))
+		}
+		lineWidth := getFlagNonNegativeInt(cmd, "line-width")
+		bestHSP := getFlagBool(cmd, "best-hsp")
+		minQcovHSP := getFlagNonNegativeFloat64(cmd, "min-qcov-per-hsp")
+		minPident := getFlagNonNegativeFloat64(cmd, "min-pident")
+		fileHaplotypes := getFlagString(cmd, "haplotypes")
+
+		timeStart := time.Now()
+		defer func() {
+			if opt.Verbose {
+				log.Info()
+				log.Infof("elapsed time: %s", time.Since(timeStart))
+				log.Info()
+			}
+		}()
+
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+
+		// ---------------------------------------------------------------
+		// read alignments
+
+		msa := NewQueryAnchoredMSA()
+
+		var rGnm *SearchResultOfAGenome
+		var rSeq *SearchResultOfASequence
+		var qlen, qstart int
+		var pident, qcovHSP float64
+		var qseq, sseq string
+		var nHSPs, nSkipped int
+		var extra []string
+		var iQseq, iSseq int
+		checkQuery := query == ""
+
+		for _, file := range files {
+			reader, err := NewSearchResultReader(file, query, bufferSize)
+			checkError(err)
+
+			// extra columns might also contain feature columns of --annotations
+			iQseq = slices.Index(reader.ExtraColumns, "qseq")
+			iSseq = slices.Index(reader.ExtraColumns, "sseq")
+			if iQseq < 0 || iSseq < 0 {
+				checkError(fmt.Errorf("columns qseq and sseq not found in file %s, did you forget to add -a/--all for 'lexicmap search'?", file))
+			}
+
+			for {
+				rGnm = reader.Next()
+				if rGnm == nil {
+					break
+				}
+
+				if query == "" {
+					query = rGnm.Query
+				} else if checkQuery && query != rGnm.Query {
+					checkError(fmt.Errorf("inconsistent queries: '%s' and '%s' in file '%s'. Please specify one query with flag -q/--query",
+						query, rGnm.Query, file))
+				}
+
+				if msa.QueryLen == 0 {
+					qlen, err = strconv.Atoi(rGnm.Qlen)
+					if err != nil {
+						checkError(fmt.Errorf("failed to parse qlen: %s", rGnm.Qlen))
+					}
+					msa.SetQueryLen(qlen)
+				}
+
+				for _, rSeq = range rGnm.Records {
+					extra = strings.Split(rSeq.Extra, "\t")
+					if len(extra) != len(reader.ExtraColumns) {
+						checkError(fmt.Errorf("%s: unexpected number of columns: %d, expected: %d", file, len(extra)+20, len(reader.ExtraColumns)+20))
+					}
+					qseq, sseq = extra[iQseq], extra[iSseq]
+
+					pident, _ = strconv.ParseFloat(rSeq.Pident, 64)
+					qcovHSP, _ = strconv.ParseFloat(rSeq.QcovHSP, 64)
+					if pident < minPident || qcovHSP < minQcovHSP {
+						nSkipped++
+						continue
+					}
+
+					qstart, err = strconv.Atoi(rSeq.Qstart)
+					if err != nil {
+						checkError(fmt.Errorf("failed to parse qstart: %s", rSeq.Qstart))
+					}
+
+					err = msa.Add(rGnm.Sgenome,
+						fmt.Sprintf("%s|%s:%s-%s:%s", rGnm.Sgenome, rSeq.Sseqid, rSeq.Sstart, rSeq.Send, rSeq.Sstr),
+						qstart, []byte(qseq), []byte(sseq))
+					if err != nil {
+						checkError(fmt.Errorf("%s: %s", file, err))
+					}
+					nHSPs++
+
+					if bestHSP { // HSPs of a genome are sorted, the first one is the best
+						break
+					}
+				}
+
+				RecycleSearchResultOfAGenome(rGnm)
+			}
+		}
+
+		if nHSPs == 0 {
+			if opt.Verbose {
+				log.Warningf("no valid HSPs found")
+			}
+			return
+		}
+		if opt.Verbose {
+			log.Infof("%d HSPs loaded for query: %s", nHSPs, query)
+			if nSkipped > 0 {
+				log.Infof("  %d HSPs filtered out", nSkipped)
+			}
+		}
+
+		// ---------------------------------------------------------------
+		// output
+
+		rows := msa.Build(query)
+		if opt.Verbose {
+			log.Infof("alignment length: %d", len(rows[0].Seq))
+		}
+
+		outfh, gw, w, err := outStream(outFile, strings.HasSuffix(outFile, ".gz"), opt.CompressionLevel)
+		checkError(err)
+		defer func() {
+			outfh.Flush()
+			if gw != nil {
+				gw.Close()
+			}
+			w.Close()
+		}()
+
+		switch outFormat {
+		case "fasta":
+			writeMSAInFasta(outfh, rows, lineWidth)
+		case "clustal":
+			writeMSAInClustal(outfh, rows, lineWidth)
+		}
+
+		if fileHaplotypes != "" {
+			haps := msaHaplotypes(rows[1:])
+
+			hfh, hgw, hw, err := outStream(fileHaplotypes, strings.HasSuffix(fileHaplotypes, ".gz"), opt.CompressionLevel)
+			checkError(err)
+
+			fmt.Fprintf(hfh, "haplotype\tgenomes\thsps\tmembers\tseq\n")
+			for i, h := range haps {
+				fmt.Fprintf(hfh, "hap%d\t%d\t%d\t%s\t%s\n", i+1, len(h.Genomes), h.HSPs, strings.Join(h.Genomes, ","), h.Seq)
+			}
+
+			hfh.Flush()
+			if hgw != nil {
+				hgw.Close()
+			}
+			hw.Close()
+
+			if opt.Verbose {
+				log.Infof("%d haplotypes saved to: %s", len(haps), fileHaplotypes)
+			}
+		}
+	},
+}
+
+func init() {
+	utilsCmd.AddCommand(hits2msaCmd)
+
+	hits2msaCmd.Flags().StringP("out-file", "o", "-",
+		formatFlagUsage(`Out file, supports the ".gz" suffix ("-" for stdout).`))
+
+	hits2msaCmd.Flags().StringP("query", "q", "",
+		formatFlagUsage(`Query ID to use.`))
+
+	hits2msaCmd.Flags().StringP("buffer-size", "b", "20M",
+		formatFlagUsage(`Size of buffer, supported unit: K, M, G. You need increase the value when "bufio.Scanner: token too long" error reported`))
+
+	hits2msaCmd.Flags().StringP("out-format", "f", "fasta",
+		formatFlagUsage(`Output format, available values: fasta, clustal.`))
+
+	hits2msaCmd.Flags().IntP("line-width", "w", 60,
+		formatFlagUsage("Line width of sequence (0 for no wrap). For Clustal format, it's the block width and 0 is treated as 60."))
+
+	hits2msaCmd.Flags().BoolP("best-hsp", "B", false,
+		formatFlagUsage(`Only use the best HSP (the first one) of each genome.`))
+
+	hits2msaCmd.Flags().Float64P("min-qcov-per-hsp", "c", 0,
+		formatFlagUsage(`Minimum query coverage (percentage) per HSP.`))
+
+	hits2msaCmd.Flags().Float64P("min-pident", "i", 0,
+		formatFlagUsage(`Minimum base identity (percentage) of an HSP.`))
+
+	hits2msaCmd.Flags().StringP("haplotypes", "H", "",
+		formatFlagUsage(`Output a table of deduplicated aligned sequences (haplotypes) with genome counts to this file.`))
+
+	hits2msaCmd.SetUsageTemplate(usageTemplate(""))
+}
+
+// MSARow is a row of a multiple sequence alignment.
+type MSARow struct {
+	Genome string
+	ID     string
+	Seq    []byte
+}
+
+// QueryAnchoredMSA builds a multiple sequence alignment from pairwise
+// alignments between a query and its hits, where all columns are anchored
+// on query positions.
+type QueryAnchoredMSA struct {
+	QueryLen int
+
+	// query bases rebuilt from pairwise alignments, 0 for unknown.
+	query []byte
+	// maxIns[i] is the longest insertion after the query position i (1-based),
+	// maxIns[0] is for the insertion before the first base.
+	maxIns []int
+
+	hsps []*msaHSP
+}
+
+type msaHSP struct {
+	genome string
+	id     string
+	qstart int // 1-based
+	qseq   []byte
+	sseq   []byte
+}
+
+// NewQueryAnchoredMSA creates a new QueryAnchoredMSA.
+func NewQueryAnchoredMSA() *QueryAnchoredMSA {
+	return &QueryAnchoredMSA{hsps: make([]*msaHSP, 0, 1024)}
+}
+
+// SetQueryLen sets the query length.
+func (m *QueryAnchoredMSA) SetQueryLen(qlen int) {
+	m.QueryLen = qlen
+	m.query = make([]byte, qlen)
+	m.maxIns = make([]int, qlen+1)
+}
+
+// Add adds a pairwise alignment, where qseq and sseq are the aligned
+// sequences with gaps ('-'), and qstart is the 1-based start position
+// of the alignment in the query.
+func (m *QueryAnchoredMSA) Add(genome, id string, qstart int, qseq, sseq []byte) error {
+	if len(qseq) != len(sseq) {
+		return fmt.Errorf("unequal lengths of qseq (%d) and sseq (%d) for %s", len(qseq), len(sseq), id)
+	}
+	if qstart < 1 {
+		return fmt.Errorf("invalid qstart: %d", qstart)
+	}
+
+	qpos := qstart - 1 // 1-based query position of the last non-gap query base
+	var ins int
+	for _, b := range qseq {
+		if b == '-' {
+			ins++
+			continue
+		}
+		if ins > m.maxIns[qpos] {
+			m.maxIns[qpos] = ins
+		}
+		ins = 0
+
+		qpos++
+		if qpos > m.QueryLen {
+			return fmt.Errorf("alignment of %s exceeds the query length: %d", id, m.QueryLen)
+		}
+		m.query[qpos-1] = b
+	}
+	if ins > m.maxIns[qpos] {
+		m.maxIns[qpos] = ins
+	}
+
+	m.hsps = append(m.hsps, &msaHSP{genome: genome, id: id, qstart: qstart, qseq: qseq, sseq: sseq})
+	return nil
+}
+
+// Build builds the alignment, the first row is the query.
+func (m *QueryAnchoredMSA) Build(queryID string) []*MSARow {
+	// offsets[i] is the 0-based column of query position i (1-based),
+	// offsets[0] is the column of the insertion before the first base.
+	offsets := make([]int, m.QueryLen+2)
+	var col int
+	for i := 0; i <= m.QueryLen; i++ {
+		if i > 0 {
+			offsets[i] = col
+			col++
+		}
+		col += m.maxIns[i]
+	}
+	offsets[m.QueryLen+1] = col
+	width := col
+
+	rows := make([]*MSARow, 0, len(m.hsps)+1)
+
+	// query
+	s := bytes.Repeat([]byte{'-'}, width)
+	for i, b := range m.query {
+		if b == 0 {
+			b = 'N'
+		}
+		s[offsets[i+1]] = b
+	}
+	rows = append(rows, &MSARow{ID: queryID, Seq: s})
+
+	// hits
+	var qpos, ins, c int
+	for _, h := range m.hsps {
+		s = bytes.Repeat([]byte{'-'}, width)
+
+		qpos = h.qstart - 1
+		ins = 0
+		for i, b := range h.qseq {
+			if b == '-' { // insertion in the subject
+				if qpos == 0 {
+					c = offsets[0] + ins
+				} else {
+					c = offsets[qpos] + 1 + ins
+				}
+				s[c] = h.sseq[i]
+				ins++
+				continue
+			}
+			ins = 0
+			qpos++
+			s[offsets[qpos]] = h.sseq[i]
+		}
+
+		rows = append(rows, &MSARow{Genome: h.genome, ID: h.id, Seq: s})
+	}
+
+	return rows
+}
+
+func writeMSAInFasta(outfh *bufio.Writer, rows []*MSARow, lineWidth int) {
+	var buffer *bytes.Buffer
+	var text []byte
+	for _, r := range rows {
+		text, buffer = wrapByteSlice(r.Seq, lineWidth, buffer)
+		fmt.Fprintf(outfh, ">%s\n%s\n", r.ID, text)
+	}
+}
+
+func writeMSAInClustal(outfh *bufio.Writer, rows []*MSARow, lineWidth int) {
+	if lineWidth <= 0 {
+		lineWidth = 60
+	}
+	var maxLen int
+	for _, r := range rows {
+		if len(r.ID) > maxLen {
+			maxLen = len(r.ID)
+		}
+	}
+	maxLen += 4
+	width := len(rows[0].Seq)
+
+	fmt.Fprintf(outfh, "CLUSTAL W multiple sequence alignment (LexicMap v%s)\n\n\n", VERSION)
+
+	cons := make([]byte, lineWidth)
+	var end int
+	var b byte
+	var conserved bool
+	for start := 0; start < width; start += lineWidth {
+		end = min(start+lineWidth, width)
+
+		for _, r := range rows {
+			fmt.Fprintf(outfh, "%-*s%s\n", maxLen, r.ID, r.Seq[start:end])
+		}
+
+		// conservation line, only hits are considered
+		cons = cons[:end-start]
+		for i := start; i < end; i++ {
+			b = rows[len(rows)-1].Seq[i]
+			conserved = b != '-'
+			for _, r := range rows[1:] {
+				if r.Seq[i] != b {
+					conserved = false
+					break
+				}
+			}
+			if conserved {
+				cons[i-start] = '*'
+			} else {
+				cons[i-start] = ' '
+			}
+		}
+		fmt.Fprintf(outfh, "%s%s\n\n", strings.Repeat(" ", maxLen), cons)
+	}
+}
+
+// MSAHaplotype is a group of identical aligned sequences.
+type MSAHaplotype struct {
+	Seq     []byte
+	HSPs    int
+	Genomes []string
+}
+
+// msaHaplotypes groups identical rows, and sorts them in descending order
+// of genome number.
+func msaHaplotypes(rows []*MSARow) []*MSAHaplotype {
+	m := make(map[string]*MSAHaplotype, 128)
+	haps := make([]*MSAHaplotype, 0, 128)
+	var h *MSAHaplotype
+	var ok bool
+	for _, r := range rows {
+		if h, ok = m[string(r.Seq)]; !ok {
+			h = &MSAHaplotype{Seq: r.Seq, Genomes: make([]string, 0, 8)}
+			m[string(r.Seq)] = h
+			haps = append(haps, h)
+		}
+		h.HSPs++
+		if len(h.Genomes) == 0 || h.Genomes[len(h.Genomes)-1] != r.Genome {
+			h.Genomes = append(h.Genomes, r.Genome)
+		}
+	}
+
+	for _, h = range haps {
+		slices.Sort(h.Genomes)
+		h.Genomes = slices.Compact(h.Genomes)
+	}
+
+	slices.SortStableFunc(haps, func(a, b *MSAHaplotype) int {
+		if len(a.Genomes) != len(b.Genomes) {
+			return len(b.Genomes) - len(a.Genomes)
+		}
+		return b.HSPs - a.HSPs
+	})
+
+	return haps
+}
@@ -0,0 +1,166 @@
+// Copyright © 2023-2026 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/shenwei356/bio/seq"
+	"github.com/spf13/cobra"
+)
+
+var indexAssembleCmd = &cobra.Command{
+	Use:   "assemble",
+	Short: "Assemble indexes of genome batches into the final index",
+	Long: `Assemble indexes of genome batches into the final index
+
+This command merges indexes of genome batches created by "lexicmap index build-batch"
+on one or more hosts into the final index.
+
+Input:
+  Batch directories given via positional arguments or the flag -X/--infile-list.
+  The order does not matter, as they are sorted by the batch index.
+
+Checks before merging:
+  1. All batches are completed, with sizes of files matching the manifest (manifest.tsv).
+     Checksums are not computed, please use "lexicmap utils verify-index" for full verification.
+  2. All batches share the same masks and parameters (build.toml).
+  3. All genome batches (0 to --batches - 1) are given, without duplication.
+
+Attention:
+  1. Genome data and masks are hard-linked from the batch directories into the final index
+     to avoid copying large files, or they are copied if the batch directories are not on the
+     same file system of the output directory. So the batch directories are left intact,
+     and they can be deleted after the final index is checked (e.g., "lexicmap utils verify-index"),
+     or with the flag --remove-batches after the final index is saved.
+  2. If there are >100 batches, please increase the value of --max-open-files and set
+     a bigger "ulimit -n" in shell.
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		opt := getOptions(cmd)
+		seq.ValidateSeq = false
+
+		var fhLog *os.File
+		if opt.Log2File {
+			fhLog = addLog(opt.LogFile, opt.Verbose)
+		}
+		timeStart := time.Now()
+		defer func() {
+			if opt.Verbose || opt.Log2File {
+				log.Info()
+				log.Infof("elapsed time: %s", time.Since(timeStart))
+				log.Info()
+			}
+			if opt.Log2File {
+				fhLog.Close()
+			}
+		}()
+
+		// ---------------------------------------------------------------
+
+		outDir := getFlagString(cmd, "out-dir")
+		force := getFlagBool(cmd, "force")
+		removeBatches := getFlagBool(cmd, "remove-batches")
+		if outDir == "" {
+			checkError(fmt.Errorf("flag -O/--out-dir is needed"))
+		}
+		outDir = filepath.Clean(outDir)
+
+		mergeThreads := getFlagPositiveInt(cmd, "seed-data-threads")
+		maxOpenFiles := getFlagPositiveInt(cmd, "max-open-files")
+
+		dirs := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+		if len(dirs) == 1 && isStdin(dirs[0]) {
+			checkError(fmt.Errorf("directories of genome batches needed"))
+		}
+		for _, dir := range dirs {
+			if filepath.Clean(dir) == outDir {
+				checkError(fmt.Errorf("intput and output paths should not be the same: %s", outDir))
+			}
+		}
+
+		bopt := &IndexBuildingOptions{
+			// general
+			NumCPUs:      opt.NumCPUs,
+			Verbose:      opt.Verbose,
+			Log2File:     opt.Log2File,
+			Force:        force,
+			MaxOpenFiles: maxOpenFiles,
+			MergeThreads: mergeThreads,
+			Checksums:    !getFlagBool(cmd, "no-checksums"),
+		}
+
+		makeOutDir(outDir, force, "out-dir", opt.Verbose || opt.Log2File)
+
+		// ---------------------------------------------------------------
+
+		err := AssembleIndex(outDir, dirs, bopt)
+		if err != nil {
+			checkError(fmt.Errorf("failed to assemble the index: %s", err))
+		}
+
+		if removeBatches {
+			if opt.Verbose || opt.Log2File {
+				log.Infof("removing %d genome batch directories...", len(dirs))
+			}
+			for _, dir := range dirs {
+				err = os.RemoveAll(dir)
+				if err != nil {
+					checkError(fmt.Errorf("failed to remove genome batch directory: %s", err))
+				}
+			}
+		}
+
+		if opt.Verbose || opt.Log2File {
+			log.Info()
+			log.Infof("finished assembling LexicMap index from %d genome batches in %s", len(dirs), time.Since(timeStart))
+			log.Infof("LexicMap index saved: %s", outDir)
+		}
+	},
+}
+
+func init() {
+	indexCmd.AddCommand(indexAssembleCmd)
+
+	indexAssembleCmd.Flags().StringP("out-dir", "O", "",
+		formatFlagUsage(`Output LexicMap index directory.`))
+
+	indexAssembleCmd.Flags().BoolP("force", "", false,
+		formatFlagUsage(`Overwrite existing output directory.`))
+
+	indexAssembleCmd.Flags().BoolP("remove-batches", "", false,
+		formatFlagUsage(`Remove the genome batch directories after the final index is saved.`))
+
+	indexAssembleCmd.Flags().IntP("seed-data-threads", "J", 8,
+		formatFlagUsage(`Number of threads for merging seed chunks from all batches, the value should be in range of [1, -c/--chunks]. If there are >100 batches, please also increase the value of --max-open-files and set a bigger "ulimit -n" in shell.`))
+
+	indexAssembleCmd.Flags().IntP("max-open-files", "", 1024,
+		formatFlagUsage(`Maximum opened files, used in merging indexes. If there are >100 batches, please increase this value and set a bigger "ulimit -n" in shell.`))
+
+	indexAssembleCmd.Flags().BoolP("no-checksums", "", false,
+		formatFlagUsage(`Do not compute SHA-256 checksums of index files in the manifest file (manifest.tsv), only file sizes are recorded. Checksums are checked by "lexicmap utils verify-index" to detect corrupted files, and computing them takes a few minutes for big indexes.`))
+
+	indexAssembleCmd.SetUsageTemplate(usageTemplate("-O <index.lmi> <batch dir> [<batch dir> ...]"))
+}
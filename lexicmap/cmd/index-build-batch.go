@@ -0,0 +1,181 @@
+// Copyright © 2023-2026 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/shenwei356/bio/seq"
+	"github.com/spf13/cobra"
+)
+
+var indexBuildBatchCmd = &cobra.Command{
+	Use:   "build-batch",
+	Short: "Build the index of a genome batch for distributed indexing",
+	Long: `Build the index of a genome batch for distributed indexing
+
+"lexicmap index" builds indexes of all genome batches (-b/--batch-size) on one machine,
+which might be limited by the memory and CPU. Instead, genome batches can be built
+independently on different hosts via a job scheduler, and then be merged with
+"lexicmap index assemble".
+
+Steps:
+  1. Prepare a mask file shared by all batches, e.g., masks.bin of an existing index,
+     or a text file generated by "lexicmap utils masks".
+  2. Split the input file list into slices, e.g., of 5000 files (the value of -b/--batch-size
+     in "lexicmap index"), and build an index for each slice with this command.
+     Each slice is assigned a unique 0-based batch index (--batch-id), and all jobs
+     should use the same total number of batches (--batches), the mask file, and other
+     parameters for seeds and genome data.
+  3. Gather all batch directories, preferably to the same file system of the final index
+     so genome data can be hard-linked rather than copied, and run "lexicmap index assemble".
+
+Output:
+  A self-contained batch directory with the same structure of an index, along with
+  a build manifest (build.toml) recording the parameters, and a manifest of file
+  sizes (manifest.tsv) which is written in the end to mark the batch as completed.
+
+Attention:
+  1. Genome identifiers are not checked for duplication across batches.
+  2. Please check "lexicmap index -h" for details of the input and parameters.
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		opt := getOptions(cmd)
+		seq.ValidateSeq = false
+
+		var fhLog *os.File
+		if opt.Log2File {
+			fhLog = addLog(opt.LogFile, opt.Verbose)
+		}
+		timeStart := time.Now()
+		defer func() {
+			if opt.Verbose || opt.Log2File {
+				log.Info()
+				log.Infof("elapsed time: %s", time.Since(timeStart))
+				log.Info()
+			}
+			if opt.Log2File {
+				fhLog.Close()
+			}
+		}()
+
+		// ---------------------------------------------------------------
+		// basic flags
+
+		batch := getFlagNonNegativeInt(cmd, "batch-id")
+		nBatches := getFlagPositiveInt(cmd, "batches")
+		if batch >= nBatches {
+			checkError(fmt.Errorf("the value of --batch-id (%d) should be smaller than --batches (%d)", batch, nBatches))
+		}
+		if nBatches > 1<<BITS_BATCH_IDX {
+			checkError(fmt.Errorf("at most %d batches supported, given: %d", 1<<BITS_BATCH_IDX, nBatches))
+		}
+
+		outDir := getFlagString(cmd, "out-dir")
+		force := getFlagBool(cmd, "force")
+
+		if outDir == "" {
+			checkError(fmt.Errorf("flag -O/--out-dir is needed"))
+		}
+		outDir = filepath.Clean(outDir)
+
+		if getFlagString(cmd, "mask-file") == "" {
+			checkError(fmt.Errorf("flag -M/--mask-file is needed, all genome batches should share the same masks"))
+		}
+
+		// ---------------------------------------------------------------
+		// options for building index
+
+		bopt := getIndexBuildingOptions(cmd, opt)
+		bopt.Force = force
+		bopt.MaxOpenFiles = bopt.Chunks + 2 // not used in building one batch
+
+		// ---------------------------------------------------------------
+		// out dir
+
+		makeOutDir(outDir, force, "out-dir", opt.Verbose || opt.Log2File)
+
+		// ---------------------------------------------------------------
+		// input files
+
+		if opt.Verbose || opt.Log2File {
+			log.Infof("LexicMap v%s", VERSION)
+			log.Info("  https://github.com/shenwei356/LexicMap")
+			log.Info()
+		}
+
+		files := getIndexInputFiles(cmd, args, opt, outDir)
+		if len(files) > 1<<BITS_GENOME_IDX {
+			checkError(fmt.Errorf("at most %d files supported in a genome batch, given: %d", 1<<BITS_GENOME_IDX, len(files)))
+		}
+
+		bopt.GenomeBatchSize = len(files) // just for this batch
+		err := CheckIndexBuildingOptions(bopt)
+		checkError(err)
+
+		// ---------------------------------------------------------------
+		// log
+
+		if opt.Verbose || opt.Log2File {
+			logIndexBuildingOptions(cmd, bopt, outDir)
+			log.Info("general:")
+			log.Infof("  genome batch: %d (0-based), total batches: %d", batch, nBatches)
+			log.Infof("  threads: %d", opt.NumCPUs)
+			log.Infof("  seed data threads: %d", bopt.MergeThreads)
+			log.Info()
+		}
+
+		// ---------------------------------------------------------------
+
+		err = BuildIndexBatch(outDir, files, batch, nBatches, bopt)
+		if err != nil {
+			checkError(fmt.Errorf("failed to build the index of genome batch %d: %s", batch, err))
+		}
+
+		if opt.Verbose || opt.Log2File {
+			log.Info()
+			log.Infof("finished building the index of genome batch %d from %d files with %d masks in %s",
+				batch, len(files), bopt.Masks, time.Since(timeStart))
+			log.Infof("index of the genome batch saved: %s", outDir)
+		}
+	},
+}
+
+func init() {
+	indexCmd.AddCommand(indexBuildBatchCmd)
+
+	addIndexBuildingFlags(indexBuildBatchCmd)
+
+	indexBuildBatchCmd.Flags().BoolP("force", "", false,
+		formatFlagUsage(`Overwrite existing output directory.`))
+
+	indexBuildBatchCmd.Flags().IntP("batch-id", "", 0,
+		formatFlagUsage(`0-based index of the genome batch, which should be unique among all batches and smaller than --batches.`))
+
+	indexBuildBatchCmd.Flags().IntP("batches", "", 1,
+		formatFlagUsage(`Total number of genome batches, which should be the same for all batches.`))
+
+	indexBuildBatchCmd.SetUsageTemplate(usageTemplate("-M <masks.bin> --batch-id <id> --batches <n> {-I <seqs dir> | [-S] -X <file list>} -O <batch dir>"))
+}
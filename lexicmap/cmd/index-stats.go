@@ -0,0 +1,701 @@
+// Copyright © 2023-2026 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/shenwei356/LexicMap/lexicmap/cmd/genome"
+	"github.com/shenwei356/LexicMap/lexicmap/cmd/kv"
+	"github.com/spf13/cobra"
+)
+
+var indexStatsCmd = &cobra.Command{
+	Use:   "index-stats",
+	Short: "Detailed statistics of an index",
+	Long: `Detailed statistics of an index
+
+Statistics:
+  1. Bytes of each component: masks, seed data, seed indexes, genome data, genome indexes, etc.
+  2. Seeds: the number of k-mers captured by each mask, read from seed data headers and indexes.
+     With -f/--kmer-freq, all seed data are scanned to compute the k-mer frequency distribution,
+     i.e., the number of locations of each k-mer, which is slow for big indexes.
+     Note that k-mers include the reversed ones saved for suffix matching.
+  3. Genome batches: the number of genomes and bases in each batch.
+  4. Genomes: distributions of genome sizes and the numbers of sequences (contigs),
+     where chunks of big and fragmented genomes are merged back to input genomes,
+     and the fraction of genomes split into chunks.
+
+Output:
+  - A human-readable summary (-o/--out-file).
+  - Optional machine-readable statistics in JSON format (-J/--json), including
+    values of each mask, each genome batch, and the k-mer frequency histogram.
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		opt := getOptions(cmd)
+
+		dbDir := getFlagString(cmd, "index")
+		if dbDir == "" {
+			checkError(fmt.Errorf("flag -d/--index needed"))
+		}
+		outFile := getFlagString(cmd, "out-file")
+		jsonFile := getFlagString(cmd, "json")
+		kmerFreq := getFlagBool(cmd, "kmer-freq")
+
+		timeStart := time.Now()
+		defer func() {
+			if opt.Verbose {
+				log.Info()
+				log.Infof("elapsed time: %s", time.Since(timeStart))
+				log.Info()
+			}
+		}()
+
+		// ---------------------------------------------------------------
+
+		info, err := readIndexInfo(filepath.Join(dbDir, FileInfo))
+		if err != nil {
+			checkError(fmt.Errorf("failed to read info file: %s", err))
+		}
+		if info.MainVersion != MainVersion {
+			checkError(fmt.Errorf("index main versions do not match: %d (index) != %d (tool). please re-create the index", info.MainVersion, MainVersion))
+		}
+
+		layout, err := NewIndexLayout(dbDir, info)
+		checkError(err)
+
+		stats := &IndexStats{
+			Index:         dbDir,
+			K:             int(info.K),
+			Masks:         info.Masks,
+			Chunks:        info.Chunks,
+			GenomeBatches: info.GenomeBatches,
+			InputGenomes:  info.InputGenomes,
+			Genomes:       info.Genomes,
+		}
+
+		if opt.Verbose {
+			log.Infof("computing bytes of index files...")
+		}
+		checkError(stats.countBytes(layout))
+
+		if opt.Verbose {
+			log.Infof("reading seed data of %d chunks...", info.Chunks)
+		}
+		checkError(stats.countSeeds(layout, opt.NumCPUs, kmerFreq))
+
+		if opt.Verbose {
+			log.Infof("reading genome data of %d batches...", info.GenomeBatches)
+		}
+		checkError(stats.countGenomes(layout, opt.NumCPUs))
+
+		// ---------------------------------------------------------------
+
+		outfh, gw, w, err := outStream(outFile, strings.HasSuffix(outFile, ".gz"), opt.CompressionLevel)
+		checkError(err)
+		defer func() {
+			outfh.Flush()
+			if gw != nil {
+				gw.Close()
+			}
+			w.Close()
+		}()
+
+		stats.WriteSummary(outfh)
+
+		if jsonFile != "" {
+			jfh, jgw, jw, err := outStream(jsonFile, strings.HasSuffix(jsonFile, ".gz"), opt.CompressionLevel)
+			checkError(err)
+
+			enc := json.NewEncoder(jfh)
+			enc.SetIndent("", "  ")
+			checkError(enc.Encode(stats))
+
+			jfh.Flush()
+			if jgw != nil {
+				jgw.Close()
+			}
+			jw.Close()
+		}
+	},
+}
+
+func init() {
+	utilsCmd.AddCommand(indexStatsCmd)
+
+	indexStatsCmd.Flags().StringP("index", "d", "",
+		formatFlagUsage(`Index directory created by "lexicmap index".`))
+
+	indexStatsCmd.Flags().StringP("out-file", "o", "-",
+		formatFlagUsage(`Out file of the human-readable summary, supports the ".gz" suffix ("-" for stdout).`))
+
+	indexStatsCmd.Flags().StringP("json", "J", "",
+		formatFlagUsage(`Out file of statistics in JSON format, supports the ".gz" suffix ("-" for stdout).`))
+
+	indexStatsCmd.Flags().BoolP("kmer-freq", "f", false,
+		formatFlagUsage(`Scan all seed data to compute the k-mer frequency distribution. It's slow for big indexes.`))
+
+	indexStatsCmd.SetUsageTemplate(usageTemplate("-d <index path> [-o stats.txt] [-J stats.json]"))
+}
+
+// IndexStats contains detailed statistics of an index.
+type IndexStats struct {
+	Index         string `json:"index"`
+	K             int    `json:"k"`
+	Masks         int    `json:"masks"`
+	Chunks        int    `json:"chunks"`
+	GenomeBatches int    `json:"genome_batches"`
+	InputGenomes  int    `json:"input_genomes"`
+	Genomes       int    `json:"genomes"`
+
+	TotalBytes int64             `json:"total_bytes"`
+	Components []*ComponentBytes `json:"components"`
+
+	Seeds *SeedStats `json:"seeds"`
+
+	Batches []*GenomeBatchStats `json:"batches"`
+
+	ChunkedGenomes  int          `json:"chunked_genomes"`
+	GenomeChunks    int          `json:"genome_chunks"`
+	FractionChunked float64      `json:"fraction_chunked"`
+	GenomeSizes     *DistSummary `json:"genome_sizes"`
+	SeqsPerGenome   *DistSummary `json:"seqs_per_genome"`
+	TotalBases      int64        `json:"total_bases"`
+	GenomesPerBatch *DistSummary `json:"genomes_per_batch"`
+}
+
+// ComponentBytes is the number of files and bytes of a type of index files.
+type ComponentBytes struct {
+	Component string `json:"component"`
+	Files     int    `json:"files"`
+	Bytes     int64  `json:"bytes"`
+}
+
+// SeedStats contains statistics of seeds.
+type SeedStats struct {
+	Kmers         int64        `json:"kmers"`
+	EmptyMasks    int          `json:"empty_masks"`
+	KmersPerMask  []int64      `json:"kmers_per_mask"`
+	KmersPerMaskS *DistSummary `json:"kmers_per_mask_summary"`
+
+	// only with -f/--kmer-freq
+	Locations     int64        `json:"locations,omitempty"`
+	KmerFreqHist  []*FreqCount `json:"kmer_freq_hist,omitempty"`
+	KmerFreqS     *DistSummary `json:"kmer_freq_summary,omitempty"`
+	kmerFreqCount map[int]int64
+}
+
+// FreqCount is a bin of the k-mer frequency histogram.
+type FreqCount struct {
+	Freq  int   `json:"freq"`
+	Kmers int64 `json:"kmers"`
+}
+
+// GenomeBatchStats contains statistics of a genome batch.
+type GenomeBatchStats struct {
+	Batch   int   `json:"batch"`
+	Genomes int   `json:"genomes"`
+	Bases   int64 `json:"bases"`
+	Bytes   int64 `json:"bytes"`
+}
+
+// DistSummary summarizes the distribution of a list of values.
+type DistSummary struct {
+	N      int     `json:"n"`
+	Min    float64 `json:"min"`
+	Q1     float64 `json:"q1"`
+	Median float64 `json:"median"`
+	Q3     float64 `json:"q3"`
+	Max    float64 `json:"max"`
+	Mean   float64 `json:"mean"`
+	Stdev  float64 `json:"stdev"`
+}
+
+// NewDistSummary summarizes a list of values, which will be sorted.
+func NewDistSummary(vals []float64) *DistSummary {
+	s := &DistSummary{N: len(vals)}
+	if len(vals) == 0 {
+		return s
+	}
+	slices.Sort(vals)
+	s.Min, s.Max = vals[0], vals[len(vals)-1]
+	s.Q1 = getPercentile(0.25, vals)
+	s.Median = getPercentile(0.5, vals)
+	s.Q3 = getPercentile(0.75, vals)
+	s.Mean, s.Stdev = MeanStdev(vals)
+	return s
+}
+
+// newDistSummaryFromHist summarizes values in a histogram (value -> count).
+func newDistSummaryFromHist(hist []*FreqCount) *DistSummary {
+	s := &DistSummary{}
+	if len(hist) == 0 {
+		return s
+	}
+	var n int64
+	var sum float64
+	for _, b := range hist {
+		n += b.Kmers
+		sum += float64(b.Freq) * float64(b.Kmers)
+	}
+	s.N = int(n)
+	s.Min, s.Max = float64(hist[0].Freq), float64(hist[len(hist)-1].Freq)
+	s.Mean = sum / float64(n)
+
+	var variance float64
+	for _, b := range hist {
+		variance += (float64(b.Freq) - s.Mean) * (float64(b.Freq) - s.Mean) * float64(b.Kmers)
+	}
+	s.Stdev = math.Sqrt(variance / float64(n))
+
+	// quantiles
+	quantile := func(p float64) float64 {
+		target := int64(p * float64(n))
+		if target >= n {
+			target = n - 1
+		}
+		var cum int64
+		for _, b := range hist {
+			cum += b.Kmers
+			if cum > target {
+				return float64(b.Freq)
+			}
+		}
+		return s.Max
+	}
+	s.Q1, s.Median, s.Q3 = quantile(0.25), quantile(0.5), quantile(0.75)
+	return s
+}
+
+// component of a file, the path is relative to the index directory.
+func indexFileComponent(file string) string {
+	base := path.Base(file)
+	switch {
+	case file == FileMasks:
+		return "masks"
+	case file == FileInfo:
+		return "info"
+	case file == FileManifest:
+		return "manifest"
+	case file == FileGenomeIndex:
+		return "genome map"
+	case file == FileGenomeChunks:
+		return "genome chunks"
+	case file == FileGenomeDetails:
+		return "genome details"
+	case strings.HasPrefix(file, DirSeeds+"/"):
+		if strings.HasSuffix(file, kv.KVIndexFileExt) {
+			return "seed indexes"
+		}
+		return "seed data"
+	case strings.HasPrefix(file, DirGenomes+"/"):
+		if strings.HasPrefix(base, FileSeedPositions) {
+			return "seed positions"
+		}
+		if strings.HasPrefix(base, FileAnnotations) {
+			return "annotations"
+		}
+		if strings.HasSuffix(file, genome.GenomeIndexFileExt) {
+			return "genome indexes"
+		}
+		return "genome data"
+	}
+	return "others"
+}
+
+var indexComponents = []string{"masks", "seed data", "seed indexes", "genome data", "genome indexes",
+	"seed positions", "annotations", "genome map", "genome chunks", "genome details", "info", "manifest", "others"}
+
+// countBytes computes bytes of each type of index files.
+func (s *IndexStats) countBytes(layout *IndexLayout) error {
+	m := make(map[string]*ComponentBytes, len(indexComponents))
+	for _, c := range indexComponents {
+		m[c] = &ComponentBytes{Component: c}
+	}
+
+	err := layout.Walk(func(p string, _ string, d fs.DirEntry) error {
+		fi, err := d.Info()
+		if err != nil {
+			return err
+		}
+		c := m[indexFileComponent(p)]
+		c.Files++
+		c.Bytes += fi.Size()
+		s.TotalBytes += fi.Size()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	s.Components = make([]*ComponentBytes, 0, len(indexComponents))
+	for _, c := range indexComponents {
+		if m[c].Files > 0 {
+			s.Components = append(s.Components, m[c])
+		}
+	}
+	return nil
+}
+
+// countSeeds reads the numbers of k-mers of all masks from seed data files,
+// and optionally scans all seed data to compute the k-mer frequency distribution.
+func (s *IndexStats) countSeeds(layout *IndexLayout, threads int, kmerFreq bool) error {
+	seeds := &SeedStats{KmersPerMask: make([]int64, s.Masks)}
+	if kmerFreq {
+		seeds.kmerFreqCount = make(map[int]int64, 1024)
+	}
+	s.Seeds = seeds
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	tokens := make(chan int, max(1, threads))
+	errs := make([]error, s.Chunks)
+	for chunk := 0; chunk < s.Chunks; chunk++ {
+		wg.Add(1)
+		tokens <- 1
+		go func(chunk int) {
+			defer func() {
+				wg.Done()
+				<-tokens
+			}()
+
+			file := layout.SeedFile(chunk)
+			freq, locs, err := seeds.countSeedsOfAChunk(file, kmerFreq)
+			if err != nil {
+				errs[chunk] = fmt.Errorf("%s: %s", file, err)
+				return
+			}
+			if kmerFreq {
+				mu.Lock()
+				for f, n := range freq {
+					seeds.kmerFreqCount[f] += n
+				}
+				seeds.Locations += locs
+				mu.Unlock()
+			}
+		}(chunk)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	vals := make([]float64, len(seeds.KmersPerMask))
+	for i, n := range seeds.KmersPerMask {
+		seeds.Kmers += n
+		if n == 0 {
+			seeds.EmptyMasks++
+		}
+		vals[i] = float64(n)
+	}
+	seeds.KmersPerMaskS = NewDistSummary(vals)
+
+	if kmerFreq {
+		seeds.KmerFreqHist = make([]*FreqCount, 0, len(seeds.kmerFreqCount))
+		for f, n := range seeds.kmerFreqCount {
+			seeds.KmerFreqHist = append(seeds.KmerFreqHist, &FreqCount{Freq: f, Kmers: n})
+		}
+		slices.SortFunc(seeds.KmerFreqHist, func(a, b *FreqCount) int { return a.Freq - b.Freq })
+		seeds.KmerFreqS = newDistSummaryFromHist(seeds.KmerFreqHist)
+	}
+	return nil
+}
+
+// countSeedsOfAChunk fills the numbers of k-mers of masks in a seed data file,
+// and returns the k-mer frequency histogram and the number of locations if needed.
+func (seeds *SeedStats) countSeedsOfAChunk(file string, kmerFreq bool) (map[int]int64, int64, error) {
+	_, iFirstMask, nMasks, _, _, err := kv.ReadKVIndexInfo(filepath.Clean(file) + kv.KVIndexFileExt)
+	if err != nil {
+		return nil, 0, err
+	}
+	if iFirstMask+nMasks > len(seeds.KmersPerMask) {
+		return nil, 0, fmt.Errorf("mask index out of range: %d", iFirstMask+nMasks)
+	}
+
+	// offsets of data of all masks
+	starts, err := kv.ReadKVIndexStarts(filepath.Clean(file) + kv.KVIndexFileExt)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	fh, err := os.Open(file)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer fh.Close()
+
+	// the number of k-mers is saved in the 8 bytes before the first k-mer of each mask
+	buf := make([]byte, 8)
+	var offset int64
+	for i, start := range starts {
+		if start[1] == 0 { // no k-mers
+			continue
+		}
+		offset = int64(start[1]>>1) - 8
+		if _, err = fh.ReadAt(buf, offset); err != nil {
+			return nil, 0, err
+		}
+		seeds.KmersPerMask[iFirstMask+i] = int64(be.Uint64(buf))
+	}
+
+	if !kmerFreq {
+		return nil, 0, nil
+	}
+
+	// scan all data
+	rdr, err := kv.NewReader(file)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rdr.Close()
+
+	freq := make(map[int]int64, 1024)
+	var locs int64
+	var data []uint64
+	var kmer, kmerPre uint64
+	var n, i int
+	for iMask := 0; iMask < rdr.ChunkSize; iMask++ {
+		data, err = rdr.ReadDataOfAMaskAsList()
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(data) == 0 {
+			continue
+		}
+
+		// k-mers are sorted, and each k-mer-value pair is saved
+		locs += int64(len(data) >> 1)
+		n = 0
+		kmerPre = data[0]
+		for i = 0; i < len(data); i += 2 {
+			kmer = data[i]
+			if kmer != kmerPre {
+				freq[n]++
+				n = 0
+				kmerPre = kmer
+			}
+			n++
+		}
+		freq[n]++
+	}
+
+	return freq, locs, nil
+}
+
+// countGenomes reads genome information from all genome batches.
+func (s *IndexStats) countGenomes(layout *IndexLayout, threads int) error {
+	s.Batches = make([]*GenomeBatchStats, s.GenomeBatches)
+
+	// sizes and the numbers of sequences of genome chunks in each batch
+	sizes := make([][]int, s.GenomeBatches)
+	nSeqs := make([][]int, s.GenomeBatches)
+
+	var wg sync.WaitGroup
+	tokens := make(chan int, max(1, threads))
+	errs := make([]error, s.GenomeBatches)
+	for batch := 0; batch < s.GenomeBatches; batch++ {
+		wg.Add(1)
+		tokens <- 1
+		go func(batch int) {
+			defer func() {
+				wg.Done()
+				<-tokens
+			}()
+
+			file := layout.GenomeFile(batch)
+			bs := &GenomeBatchStats{Batch: batch}
+			s.Batches[batch] = bs
+
+			fi, err := os.Stat(file)
+			if err != nil {
+				errs[batch] = err
+				return
+			}
+			bs.Bytes = fi.Size()
+
+			rdr, err := genome.NewReader(file)
+			if err != nil {
+				errs[batch] = fmt.Errorf("%s: %s", file, err)
+				return
+			}
+			defer rdr.Close()
+
+			bs.Genomes = rdr.NumGenomes()
+			sizes[batch] = make([]int, bs.Genomes)
+			nSeqs[batch] = make([]int, bs.Genomes)
+			var g *genome.Genome
+			for i := 0; i < bs.Genomes; i++ {
+				g, err = rdr.GenomeInfo(i)
+				if err != nil {
+					errs[batch] = fmt.Errorf("%s: %s", file, err)
+					return
+				}
+				sizes[batch][i] = g.GenomeSize
+				nSeqs[batch][i] = g.NumSeqs
+				bs.Bases += int64(g.GenomeSize)
+				genome.RecycleGenome(g)
+			}
+		}(batch)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+
+	// genome chunks
+	genomeChunks, err := readGenomeChunksLists(filepath.Join(layout.Dir, FileGenomeChunks))
+	if err != nil {
+		return fmt.Errorf("failed to read genome chunk file: %s", err)
+	}
+	chunked := make(map[uint64]struct{}, len(genomeChunks)*4)
+
+	gsizes := make([]float64, 0, s.InputGenomes)
+	gseqs := make([]float64, 0, s.InputGenomes)
+	var size, n, batch, idx int
+	for _, idxs := range genomeChunks {
+		size, n = 0, 0
+		for _, i := range idxs {
+			chunked[i] = struct{}{}
+			batch, idx = int(i>>BITS_GENOME_IDX), int(i&MASK_GENOME_IDX)
+			if batch >= len(sizes) || idx >= len(sizes[batch]) {
+				return fmt.Errorf("genome chunk out of range: batch %d, genome %d", batch, idx)
+			}
+			size += sizes[batch][idx]
+			n += nSeqs[batch][idx]
+		}
+		gsizes = append(gsizes, float64(size))
+		gseqs = append(gseqs, float64(n))
+		s.GenomeChunks += len(idxs)
+	}
+	s.ChunkedGenomes = len(genomeChunks)
+
+	var ok bool
+	nGenomesPerBatch := make([]float64, s.GenomeBatches)
+	for batch, bs := range s.Batches {
+		nGenomesPerBatch[batch] = float64(bs.Genomes)
+		s.TotalBases += bs.Bases
+		for idx = range sizes[batch] {
+			if _, ok = chunked[uint64(batch)<<BITS_GENOME_IDX|uint64(idx)]; ok {
+				continue
+			}
+			gsizes = append(gsizes, float64(sizes[batch][idx]))
+			gseqs = append(gseqs, float64(nSeqs[batch][idx]))
+		}
+	}
+	if len(gsizes) > 0 {
+		s.FractionChunked = float64(s.ChunkedGenomes) / float64(len(gsizes))
+	}
+
+	s.GenomeSizes = NewDistSummary(gsizes)
+	s.SeqsPerGenome = NewDistSummary(gseqs)
+	s.GenomesPerBatch = NewDistSummary(nGenomesPerBatch)
+	return nil
+}
+
+// WriteSummary outputs a human-readable summary.
+func (s *IndexStats) WriteSummary(outfh *bufio.Writer) {
+	fmt.Fprintf(outfh, "Index: %s\n", s.Index)
+	fmt.Fprintf(outfh, "  k-mer size: %d, masks: %d, seed chunks: %d, genome batches: %d\n",
+		s.K, s.Masks, s.Chunks, s.GenomeBatches)
+	fmt.Fprintf(outfh, "  input genomes: %s, genomes (including chunks): %s\n",
+		humanize.Comma(int64(s.InputGenomes)), humanize.Comma(int64(s.Genomes)))
+
+	fmt.Fprintf(outfh, "\nBytes: %s (%s)\n", humanize.IBytes(uint64(s.TotalBytes)), humanize.Comma(s.TotalBytes))
+	for _, c := range s.Components {
+		fmt.Fprintf(outfh, "  %-15s %10s %6.2f%%  (%s files)\n", c.Component+":", humanize.IBytes(uint64(c.Bytes)),
+			percent(c.Bytes, s.TotalBytes), humanize.Comma(int64(c.Files)))
+	}
+
+	seeds := s.Seeds
+	fmt.Fprintf(outfh, "\nSeeds:\n")
+	fmt.Fprintf(outfh, "  k-mers: %s, masks without k-mers: %d\n", humanize.Comma(seeds.Kmers), seeds.EmptyMasks)
+	fmt.Fprintf(outfh, "  k-mers per mask: %s\n", seeds.KmersPerMaskS.String())
+	if seeds.KmerFreqS != nil {
+		fmt.Fprintf(outfh, "  locations: %s\n", humanize.Comma(seeds.Locations))
+		fmt.Fprintf(outfh, "  k-mer frequency: %s\n", seeds.KmerFreqS.String())
+		bins := [][2]int{{1, 1}, {2, 10}, {11, 100}, {101, 1000}, {1001, -1}}
+		counts := make([]int64, len(bins))
+		for _, b := range seeds.KmerFreqHist {
+			for j, r := range bins {
+				if b.Freq >= r[0] && (r[1] < 0 || b.Freq <= r[1]) {
+					counts[j] += b.Kmers
+					break
+				}
+			}
+		}
+		for j, r := range bins {
+			var label string
+			switch {
+			case r[0] == r[1]:
+				label = fmt.Sprintf("%d", r[0])
+			case r[1] < 0:
+				label = fmt.Sprintf(">%d", r[0]-1)
+			default:
+				label = fmt.Sprintf("%d-%d", r[0], r[1])
+			}
+			fmt.Fprintf(outfh, "    %-10s %15s %6.2f%%\n", label+":", humanize.Comma(counts[j]), percent(counts[j], seeds.Kmers))
+		}
+	}
+
+	fmt.Fprintf(outfh, "\nGenome batches:\n")
+	fmt.Fprintf(outfh, "  genomes per batch: %s\n", s.GenomesPerBatch.String())
+
+	fmt.Fprintf(outfh, "\nGenomes:\n")
+	fmt.Fprintf(outfh, "  total bases: %s\n", humanize.Comma(s.TotalBases))
+	fmt.Fprintf(outfh, "  genome size: %s\n", s.GenomeSizes.String())
+	fmt.Fprintf(outfh, "  sequences per genome: %s\n", s.SeqsPerGenome.String())
+	fmt.Fprintf(outfh, "  genomes split into chunks: %s (%.4f%%), with %s chunks\n",
+		humanize.Comma(int64(s.ChunkedGenomes)), s.FractionChunked*100, humanize.Comma(int64(s.GenomeChunks)))
+}
+
+// String returns a one-line summary.
+func (s *DistSummary) String() string {
+	if s.N == 0 {
+		return "n=0"
+	}
+	return fmt.Sprintf("min=%s, q1=%s, median=%s, q3=%s, max=%s, mean=%.2f, stdev=%.2f",
+		humanize.Ftoa(s.Min), humanize.Ftoa(s.Q1), humanize.Ftoa(s.Median), humanize.Ftoa(s.Q3),
+		humanize.Ftoa(s.Max), s.Mean, s.Stdev)
+}
+
+func percent(a, b int64) float64 {
+	if b == 0 {
+		return 0
+	}
+	return float64(a) / float64(b) * 100
+}
@@ -26,9 +26,11 @@ import (
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"strings"
 	"time"
 
 	"github.com/pkg/errors"
+	"github.com/shenwei356/LexicMap/lexicmap/cmd/genome"
 	"github.com/shenwei356/bio/seq"
 	"github.com/shenwei356/util/pathutil"
 	"github.com/spf13/cobra"
@@ -61,6 +63,11 @@ Input:
      1000-bp intervals of N’s to reduce the sequence scale to index.
   6. A flag -l/--min-seq-len can filter out sequences shorter than the threshold (default is the k value).
   7. Soft-masked sequences are supported with --soft-masking.
+  8. GenBank files (.gb, .gbk, .gbff) are also supported as input, please set a proper -r/--file-regexp
+     when using -I/--in-dir, e.g., '\.gbff(\.gz)?$'.
+     Genome annotations can be saved with --save-annotations, for reporting features overlapping with
+     hits in "lexicmap search" (--annotations). Features are read from GenBank files, or GFF3 files
+     alongside FASTA/Q files with the same prefix, e.g., X.gff.gz (or .gff3) for X.fna.gz.
 
   Attention:
    *1) ► You can rename the sequence files for convenience, e.g., GCF_000017205.1.fa.gz, because the genome
@@ -162,194 +169,42 @@ Important parameters:
 		// ---------------------------------------------------------------
 		// basic flags
 
-		k := getFlagPositiveInt(cmd, "kmer")
-		if k < minK || k > 32 {
-			checkError(fmt.Errorf("the value of flag -k/--kmer should be in range of [%d, 32]", minK))
-		}
-		minSeqLen := getFlagInt(cmd, "min-seq-len")
-		if minSeqLen < k {
-			minSeqLen = -1
-			// checkError(fmt.Errorf("the value (%d) of flag -l/--min-seq-len should be >= k (%d)", minSeqLen, k))
-		}
-		if minSeqLen <= 0 {
-			minSeqLen = k
-		}
-		minSeqLen = max(minSeqLen, k)
-
-		nMasks := getFlagPositiveInt(cmd, "masks")
-		seed := getFlagPositiveInt(cmd, "rand-seed")
-		maskFile := getFlagString(cmd, "mask-file")
-
-		chunks := opt.NumCPUs // the default value is equal to -j/--threads
-		_chunks := getFlagPositiveInt(cmd, "chunks")
-		if chunks != _chunks && cmd.Flags().Lookup("chunks").Changed {
-			chunks = _chunks
-		}
-		if chunks > 128 {
-			chunks = 128
-		}
-
-		mergeThreads := getFlagPositiveInt(cmd, "seed-data-threads")
-		if mergeThreads > chunks {
-			mergeThreads = chunks
-		}
-		partitions := getFlagPositiveInt(cmd, "partitions")
 		batchSize := getFlagPositiveInt(cmd, "batch-size")
 		maxOpenFiles := getFlagPositiveInt(cmd, "max-open-files")
 
-		maxGenomeSize := getFlagNonNegativeInt(cmd, "max-genome")
-		if maxGenomeSize > MAX_GENOME_SIZE {
-			checkError(fmt.Errorf("value of -g/--max-genome (%d) should not be greater than the maximum supported genome size (%d)", maxGenomeSize, MAX_GENOME_SIZE))
-		}
-		fileBigGenomes := getFlagString(cmd, "big-genomes")
-
-		// minPrefix := getFlagNonNegativeInt(cmd, "seed-min-prefix")
-		// if minPrefix > 32 || minPrefix < 5 {
-		// 	checkError(fmt.Errorf("the value of flag -p/--seed-min-prefix (%d) should be in the range of [5, 32]", minPrefix))
-		// }
-		maxDesert := getFlagPositiveInt(cmd, "seed-max-desert")
-		seedInDesertDist := getFlagPositiveInt(cmd, "seed-in-desert-dist")
-		if seedInDesertDist > maxDesert/2 {
-			checkError(fmt.Errorf("value of --seed-in-desert-dist should be smaller than 0.5 * --seed-max-desert"))
-		}
-		noDesertFilling := getFlagBool(cmd, "no-desert-filling")
-
-		// topN := getFlagPositiveInt(cmd, "top-n")
-		// prefixExt := getFlagPositiveInt(cmd, "prefix-ext")
-
 		outDir := getFlagString(cmd, "out-dir")
 		force := getFlagBool(cmd, "force")
+		resume := getFlagBool(cmd, "resume")
 
 		if outDir == "" {
 			checkError(fmt.Errorf("flag -O/--out-dir is needed"))
 		}
-
-		var err error
-
-		inDir := getFlagString(cmd, "in-dir")
-		skipFileCheck := getFlagBool(cmd, "skip-file-check")
-
-		outDir = filepath.Clean(outDir)
-
-		if filepath.Clean(inDir) == outDir {
-			checkError(fmt.Errorf("intput and output paths should not be the same: %s", outDir))
-		}
-
-		readFromDir := inDir != ""
-		if readFromDir {
-			var isDir bool
-			isDir, err = pathutil.IsDir(inDir)
-			if err != nil {
-				checkError(errors.Wrapf(err, "checking -I/--in-dir"))
-			}
-			if !isDir {
-				checkError(fmt.Errorf("value of -I/--in-dir should be a directory: %s", inDir))
-			}
+		if force && resume {
+			checkError(fmt.Errorf("flags --force and --resume are incompatible"))
 		}
 
-		reFileStr := getFlagString(cmd, "file-regexp")
-		var reFile *regexp.Regexp
-		if reFileStr != "" {
-			if !reIgnoreCase.MatchString(reFileStr) {
-				reFileStr = reIgnoreCaseStr + reFileStr
-			}
-			reFile, err = regexp.Compile(reFileStr)
-			checkError(errors.Wrapf(err, "failed to parse regular expression for matching file: %s", reFileStr))
-		}
-
-		reRefNameStr := getFlagString(cmd, "ref-name-regexp")
-		var reRefName *regexp.Regexp
-		if reRefNameStr != "" {
-			if !regexp.MustCompile(`\(.+\)`).MatchString(reRefNameStr) {
-				checkError(fmt.Errorf(`value of --ref-name-regexp must contains "(" and ")" to capture the ref name from file name`))
-			}
-			if !reIgnoreCase.MatchString(reRefNameStr) {
-				reRefNameStr = reIgnoreCaseStr + reRefNameStr
-			}
-
-			reRefName, err = regexp.Compile(reRefNameStr)
-			if err != nil {
-				checkError(errors.Wrapf(err, "failed to parse regular expression for matching sequence header: %s", reRefName))
-			}
-		}
+		outDir = filepath.Clean(outDir)
 
-		reSeqNameStrs := getFlagStringSlice(cmd, "seq-name-filter")
-		reSeqNames := make([]*regexp.Regexp, 0, len(reSeqNameStrs))
-		for _, kw := range reSeqNameStrs {
-			if !reIgnoreCase.MatchString(kw) {
-				kw = reIgnoreCaseStr + kw
-			}
-			re, err := regexp.Compile(kw)
-			if err != nil {
-				checkError(errors.Wrapf(err, "failed to parse regular expression for matching sequence header: %s", kw))
+		if resume { // do not overwrite a completed index
+			completedIndex, err := pathutil.Exists(filepath.Join(outDir, FileManifest))
+			checkError(err)
+			hasTmpDir, err := pathutil.DirExists(outDir + ExtTmpDir)
+			checkError(err)
+			if completedIndex && !hasTmpDir {
+				checkError(fmt.Errorf("the index is already completed: %s", outDir))
 			}
-			reSeqNames = append(reSeqNames, re)
-		}
-
-		contigInterval := getFlagPositiveInt(cmd, "contig-interval")
-		if contigInterval < maxDesert {
-			checkError(fmt.Errorf("the value of --contig-interval (%d) should be >= -D/--seed-max-desert (%d)", contigInterval, maxDesert))
 		}
 
-		// refNameStr := getFlagString(cmd, "ref-name-info")
-		// var name2info map[string]string
-
 		// ---------------------------------------------------------------
 		// options for building index
-		bopt := &IndexBuildingOptions{
-			// general
-			NumCPUs:      opt.NumCPUs,
-			Verbose:      opt.Verbose,
-			Log2File:     opt.Log2File,
-			Force:        force,
-			MaxOpenFiles: maxOpenFiles,
-			MergeThreads: mergeThreads,
-
-			MinSeqLen: minSeqLen,
-
-			// skip extremely large genomes
-			MaxGenomeSize: maxGenomeSize,
-			BigGenomeFile: fileBigGenomes,
-
-			// LexicHash
-			MaskFile:    maskFile,
-			K:           k,
-			Masks:       nMasks,
-			RandSeed:    int64(seed),
-			SoftMasking: getFlagBool(cmd, "soft-masking"),
-			MaxKmerFreq: getFlagNonNegativeInt(cmd, "max-kmer-freq"),
-
-			// randomly generating
-			// Prefix: minPrefix,
-
-			// filling sketching deserts
-			DisableDesertFilling:   noDesertFilling,      // disable desert filling (just for analysis index)
-			DesertMaxLen:           uint32(maxDesert),    // maxi length of sketching deserts
-			DesertExpectedSeedDist: seedInDesertDist,     // expected distance between seeds
-			DesertSeedPosRange:     seedInDesertDist / 2, // the upstream and down stream region for adding a seeds
-
-			// generate masks
-			// TopN:      topN,
-			// PrefixExt: prefixExt,
-
-			// k-mer-value data
-			Chunks:     chunks,
-			Partitions: partitions,
-
-			// genome batches
-			GenomeBatchSize: batchSize,
-
-			// genome
-			ReRefName:    reRefName,
-			ReSeqExclude: reSeqNames,
-
-			ContigInterval: contigInterval,
-
-			SaveSeedPositions: getFlagBool(cmd, "save-seed-pos"),
-
-			Debug: getFlagBool(cmd, "debug"),
-		}
-		err = CheckIndexBuildingOptions(bopt)
+
+		bopt := getIndexBuildingOptions(cmd, opt)
+		bopt.Force = force
+		bopt.Resume = resume
+		bopt.MaxOpenFiles = maxOpenFiles
+		bopt.GenomeBatchSize = batchSize // genome batches
+
+		err := CheckIndexBuildingOptions(bopt)
 		checkError(err)
 
 		// ---------------------------------------------------------------
@@ -357,7 +212,9 @@ Important parameters:
 
 		outputDir := outDir != ""
 		if outputDir {
-			makeOutDir(outDir, force, "out-dir", opt.Verbose || opt.Log2File)
+			// for resuming, completed genome batches are saved in the temporary directory,
+			// while the output directory is only written in the final merging step.
+			makeOutDir(outDir, force || resume, "out-dir", opt.Verbose || opt.Log2File)
 		}
 
 		// ---------------------------------------------------------------
@@ -370,128 +227,17 @@ Important parameters:
 
 		}
 
-		// if refNameStr != "" {
-		// 	name2info, err = readKVs(refNameStr, false)
-		// 	checkError(err)
-		// 	if opt.Verbose || opt.Log2File {
-		// 		log.Infof("%d reference name information records loaded", len(name2info))
-		// 	}
-		// }
-
-		if opt.Verbose || opt.Log2File {
-			log.Info("checking input files ...")
-		}
-
-		var files []string
-		if readFromDir {
-			if opt.Verbose || opt.Log2File {
-				log.Infof("  scanning files from directory: %s", inDir)
-			}
-			files, err = getFileListFromDir(inDir, reFile, opt.NumCPUs)
-			if err != nil {
-				checkError(errors.Wrapf(err, "walking dir: %s", inDir))
-			}
-			if len(files) == 0 {
-				log.Warningf("  no files matching regular expression: %s", reFileStr)
-			}
-		} else {
-			if opt.Verbose || opt.Log2File {
-				log.Info("  checking files from command-line argument or/and file list ...")
-			}
-			files = getFileListFromArgsAndFile(cmd, args, !skipFileCheck, "infile-list", !skipFileCheck)
-			if opt.Verbose || opt.Log2File {
-				if len(files) == 1 && isStdin(files[0]) {
-					log.Info("  no files given, reading from stdin")
-				}
-			}
-		}
-		if len(files) < 1 {
-			checkError(fmt.Errorf("FASTA/Q files needed"))
-		} else if len(files) > 1<<BITS_IDX { // 1<< 34
-			checkError(fmt.Errorf("at most %d files supported, given: %d", 1<<BITS_IDX, len(files)))
-		} else if opt.Verbose || opt.Log2File {
-			log.Infof("  %d input file(s) given", len(files))
-		}
-
-		// sort files according to taxonomic information
-		// if len(name2info) > 0 {
-		// 	if opt.Verbose || opt.Log2File {
-		// 		log.Info("sorting input files according to reference name information...")
-		// 	}
-		// 	file2info := make([][2]string, len(files))
-
-		// 	var baseFile, genomeID string
-		// 	for i, file := range files {
-		// 		baseFile = filepath.Base(file)
-		// 		if reRefName.MatchString(baseFile) {
-		// 			genomeID = reRefName.FindAllStringSubmatch(baseFile, 1)[0][1]
-		// 		} else {
-		// 			genomeID, _, _ = filepathTrimExtension(baseFile, nil)
-		// 		}
-
-		// 		file2info[i] = [2]string{file, name2info[genomeID]}
-		// 	}
-		// 	sort.Slice(file2info, func(i, j int) bool {
-		// 		a, b := file2info[i][1], file2info[j][1]
-		// 		if a == b {
-		// 			return strings.Compare(file2info[i][0], file2info[j][0]) < 0
-		// 		}
-		// 		return strings.Compare(a, b) < 0
-		// 	})
-		// 	for i := range file2info {
-		// 		files[i] = file2info[i][0]
-		// 		// fmt.Printf("%s, %s\n", files[i], file2info[i][1])
-		// 	}
-		// 	if opt.Verbose || opt.Log2File {
-		// 		log.Info("  input files sorted")
-		// 	}
-		// }
+		files := getIndexInputFiles(cmd, args, opt, outDir)
 
 		// ---------------------------------------------------------------
 		// log
 
 		if opt.Verbose || opt.Log2File {
-			log.Info()
-			log.Infof("--------------------- [ main parameters ] ---------------------")
-			log.Info()
-			log.Info("input and output:")
-			log.Infof("  input directory: %s", inDir)
-			log.Infof("    regular expression of input files: %s", reFileStr)
-			log.Infof("    *regular expression for extracting reference name from file name: %s", reRefNameStr)
-			log.Infof("    *regular expressions for filtering out sequences: %s", reSeqNameStrs)
-			log.Infof("  min sequence length: %d", minSeqLen)
-			log.Infof("  max genome size: %d", maxGenomeSize)
-			log.Infof("  output directory: %s", outDir)
-			if fileBigGenomes != "" {
-				log.Infof("  output file of skipped genomes: %s", fileBigGenomes)
-			}
-			log.Info()
-
-			log.Info("mask generation:")
-			if maskFile != "" {
-				log.Infof("  custom mask file: %s", maskFile)
-			} else {
-				log.Infof("  k-mer size: %d", k)
-				log.Infof("  number of masks: %d", nMasks)
-				log.Infof("  rand seed: %d", seed)
-				// log.Infof("  prefix length for checking low-complexity in mask generation: %d", minPrefix)
-			}
-
-			log.Info()
-			log.Info("seed data:")
-			if noDesertFilling {
-				log.Infof("  disable desert filling: %v", noDesertFilling)
-			} else {
-				log.Infof("  maximum sketching desert length: %d", maxDesert)
-				log.Infof("  distance of k-mers to fill deserts: %d", seedInDesertDist)
-			}
-			log.Infof("  seeds data chunks: %d", chunks)
-			log.Infof("  seeds data indexing partitions: %d", partitions)
-			log.Info()
+			logIndexBuildingOptions(cmd, bopt, outDir)
 			log.Info("general:")
 			log.Infof("  genome batch size: %d", batchSize)
 			log.Infof("  threads: %d", opt.NumCPUs)
-			log.Infof("  batch merge threads: %d", mergeThreads)
+			log.Infof("  batch merge threads: %d", bopt.MergeThreads)
 			log.Info()
 		}
 
@@ -506,7 +252,7 @@ Important parameters:
 		if opt.Verbose || opt.Log2File {
 			log.Info()
 			log.Infof("finished building LexicMap index from %d files with %d masks in %s",
-				len(files), nMasks, time.Since(timeStart))
+				len(files), bopt.Masks, time.Since(timeStart))
 			log.Infof("LexicMap index saved: %s", outDir)
 		}
 	},
@@ -515,81 +261,99 @@ Important parameters:
 func init() {
 	RootCmd.AddCommand(indexCmd)
 
+	addIndexBuildingFlags(indexCmd)
+
+	indexCmd.Flags().BoolP("force", "", false,
+		formatFlagUsage(`Overwrite existing output directory.`))
+
+	indexCmd.Flags().BoolP("resume", "", false,
+		formatFlagUsage(`Resume an interrupted job with the same input files and parameters. Completed genome batches in the temporary directory ($outdir.tmp) are validated with file sizes and skipped, incomplete ones are rebuilt, and then all batches are merged. It only works for indexes with more than one genome batch (-b/--batch-size).`))
+
+	indexCmd.Flags().IntP("max-open-files", "", 1024,
+		formatFlagUsage(`Maximum opened files, used in merging indexes. If there are >100 batches, please increase this value and set a bigger "ulimit -n" in shell.`))
+
+	// -----------------------------  genome batches   -----------------------------
+
+	indexCmd.Flags().IntP("batch-size", "b", 5000,
+		formatFlagUsage(fmt.Sprintf(`Maximum number of genomes in each batch (maximum value: %d)`, 1<<BITS_GENOME_IDX)))
+
+	indexCmd.SetUsageTemplate(usageTemplate("[-k <k>] [-m <masks>] {-I <seqs dir> | [-S] -X <file list>} -O <index.lmi>"))
+}
+
+// addIndexBuildingFlags adds flags shared by "lexicmap index" and "lexicmap index build-batch".
+func addIndexBuildingFlags(cmd *cobra.Command) {
 	// -----------------------------  input  -----------------------------
 
-	indexCmd.Flags().StringP("in-dir", "I", "",
+	cmd.Flags().StringP("in-dir", "I", "",
 		formatFlagUsage(`Input directory containing FASTA/Q files. Directory and file symlinks are followed.`))
 
-	indexCmd.Flags().StringP("file-regexp", "r", `\.(f[aq](st[aq])?|fna)(\.gz|\.xz|\.zst|\.bz2)?$`,
+	cmd.Flags().StringP("file-regexp", "r", `\.(f[aq](st[aq])?|fna)(\.gz|\.xz|\.zst|\.bz2)?$`,
 		formatFlagUsage(`Regular expression for matching sequence files in -I/--in-dir, case ignored. Attention: use double quotation marks for patterns containing commas, e.g., -p '"A{2,}"'.`))
 
-	indexCmd.Flags().StringP("ref-name-regexp", "N", `(?i)(.+)\.(f[aq](st[aq])?|fna)(\.gz|\.xz|\.zst|\.bz2)?$`,
+	cmd.Flags().StringP("ref-name-regexp", "N", `(?i)(.+)\.(f[aq](st[aq])?|fna)(\.gz|\.xz|\.zst|\.bz2)?$`,
 		formatFlagUsage(`Regular expression (must contains "(" and ")") for extracting the reference name from the filename. Attention: use double quotation marks for patterns containing commas, e.g., -p '"A{2,}"'.`))
 
-	indexCmd.Flags().StringSliceP("seq-name-filter", "B", []string{},
+	cmd.Flags().StringSliceP("seq-name-filter", "B", []string{},
 		formatFlagUsage(`List of regular expressions for filtering out sequences by contents in FASTA/Q header/name, case ignored.`))
 
-	indexCmd.Flags().BoolP("skip-file-check", "S", false,
+	cmd.Flags().BoolP("skip-file-check", "S", false,
 		formatFlagUsage(`Skip input file checking when given files or a file list.`))
 
-	indexCmd.Flags().IntP("min-seq-len", "l", -1,
+	cmd.Flags().IntP("min-seq-len", "l", -1,
 		formatFlagUsage(`Maximum sequence length to index. The value would be k for values <= 0.`))
 
-	indexCmd.Flags().IntP("max-genome", "g", 20000000,
+	cmd.Flags().IntP("max-genome", "g", 20000000,
 		formatFlagUsage(fmt.Sprintf(`Maximum genome size. Genomes with any single contig larger than the threshold will be skipped, while fragmented (with many contigs) genomes larger than the threshold will be split into chunks and alignments from these chunks will be merged in "lexicmap search". The value needs to be smaller than the maximum supported genome size: %d.`, MAX_GENOME_SIZE)))
 
-	// indexCmd.Flags().StringP("ref-name-info", "", ``,
+	// cmd.Flags().StringP("ref-name-info", "", ``,
 	// 	formatFlagUsage(`A two-column tab-delimted file for mapping reference names (extracted by --ref-name-regexp) to taxonomic information such as species names. It helps to reduce memory usage.`))
 
 	// -----------------------------  output  -----------------------------
 
-	indexCmd.Flags().StringP("out-dir", "O", "",
+	cmd.Flags().StringP("out-dir", "O", "",
 		formatFlagUsage(`Output LexicMap index directory.`))
 
-	indexCmd.Flags().StringP("big-genomes", "G", "",
+	cmd.Flags().StringP("big-genomes", "G", "",
 		formatFlagUsage(`Out file of skipped files with $total_bases + ($num_contigs - 1) * $contig_interval >= -g/--max-genome. The second column is one of the skip types: no_valid_seqs, too_large_genome, too_many_seqs.`))
 
-	indexCmd.Flags().BoolP("force", "", false,
-		formatFlagUsage(`Overwrite existing output directory.`))
-
 	// -----------------------------  lexichash masks   -----------------------------
 
-	indexCmd.Flags().IntP("kmer", "k", 31,
+	cmd.Flags().IntP("kmer", "k", 31,
 		formatFlagUsage(`Maximum k-mer size. K needs to be <= 32.`))
 
-	indexCmd.Flags().IntP("masks", "m", 20000,
+	cmd.Flags().IntP("masks", "m", 20000,
 		formatFlagUsage(`Number of LexicHash masks.`))
 
-	indexCmd.Flags().IntP("rand-seed", "s", 1,
+	cmd.Flags().IntP("rand-seed", "s", 1,
 		formatFlagUsage(`Rand seed for generating random masks.`))
 
-	indexCmd.Flags().StringP("mask-file", "M", "",
-		formatFlagUsage(`File of custom masks. This flag oversides -k/--kmer, -m/--masks, -s/--rand-seed etc.`))
+	cmd.Flags().StringP("mask-file", "M", "",
+		formatFlagUsage(`File of custom masks. This flag oversides -k/--kmer, -m/--masks, -s/--rand-seed etc. Files with the extension ".bin" are read as binary mask files (masks.bin) of existing indexes, others are read as text files generated by "lexicmap utils masks".`))
 	// formatFlagUsage(`File of custom masks. This flag oversides -k/--kmer, -m/--masks, -s/--rand-seed, -p/--seed-min-prefix, etc.`))
 
-	indexCmd.Flags().BoolP("soft-masking", "", false,
+	cmd.Flags().BoolP("soft-masking", "", false,
 		formatFlagUsage(`Support soft-masked genomes. Lowercase bases in soft-masked low-complexity regions will be treated as A's, and won't be seeded.`))
 
-	indexCmd.Flags().IntP("max-kmer-freq", "", 0,
+	cmd.Flags().IntP("max-kmer-freq", "", 0,
 		formatFlagUsage(`If a mask captures the same k-mer at more than N positions of a genome, only the first N positions will be retained. This option may reduce search sensitivity, but it's useful when simply checking whether a query matches any position in a genome that contains many tandem repeat sequences. (0 for no filtering)`))
 
 	// ------  generate masks randomly
 
-	indexCmd.Flags().BoolP("no-desert-filling", "", false,
+	cmd.Flags().BoolP("no-desert-filling", "", false,
 		formatFlagUsage(`Disable sketching desert filling (only for debug).`))
-	// indexCmd.Flags().IntP("seed-min-prefix", "p", 15,
+	// cmd.Flags().IntP("seed-min-prefix", "p", 15,
 	// 	formatFlagUsage(`Minimum length of shared substrings (anchors) in searching. Here, this value is used to remove low-complexity masks and choose k-mers to fill sketching deserts.`))
-	indexCmd.Flags().IntP("seed-max-desert", "D", 100,
+	cmd.Flags().IntP("seed-max-desert", "D", 100,
 		formatFlagUsage(`Maximum length of sketching deserts, or maximum seed distance. Deserts with seed distance larger than this value will be filled by choosing k-mers roughly every --seed-in-desert-dist bases.`))
-	indexCmd.Flags().IntP("seed-in-desert-dist", "d", 50,
+	cmd.Flags().IntP("seed-in-desert-dist", "d", 50,
 		formatFlagUsage(`Distance of k-mers to fill deserts.`))
 
 	// ------  generate mask from the top N biggest genomes
 
-	// indexCmd.Flags().IntP("top-n", "n", 20,
+	// cmd.Flags().IntP("top-n", "n", 20,
 	// 	formatFlagUsage(`Select the top N largest genomes for generating masks.`))
 
-	// indexCmd.Flags().IntP("prefix-ext", "P", 8,
+	// cmd.Flags().IntP("prefix-ext", "P", 8,
 	// 	formatFlagUsage(`Extension length of prefixes, higher values -> smaller maximum seed distances.`))
 
 	// -----------------------------  kmer-value data   -----------------------------
@@ -598,33 +362,370 @@ func init() {
 	if defaultChunks > 128 {
 		defaultChunks = 128
 	}
-	indexCmd.Flags().IntP("chunks", "c", defaultChunks,
+	cmd.Flags().IntP("chunks", "c", defaultChunks,
 		formatFlagUsage(`Number of chunks for storing seeds (k-mer-value data) files. Max: 128. Default: the value of -j/--threads.`))
-	indexCmd.Flags().IntP("partitions", "", 4096,
+	cmd.Flags().IntP("partitions", "", 4096,
 		formatFlagUsage(`Number of partitions for indexing seeds (k-mer-value data) files. The value needs to be the power of 4.`))
-	indexCmd.Flags().IntP("max-open-files", "", 1024,
-		formatFlagUsage(`Maximum opened files, used in merging indexes. If there are >100 batches, please increase this value and set a bigger "ulimit -n" in shell.`))
 
-	indexCmd.Flags().BoolP("save-seed-pos", "", false,
+	cmd.Flags().BoolP("save-seed-pos", "", false,
 		formatFlagUsage(`Save seed positions, which can be inspected with "lexicmap utils seed-pos".`))
 
-	// -----------------------------  genome batches   -----------------------------
-
-	indexCmd.Flags().IntP("batch-size", "b", 5000,
-		formatFlagUsage(fmt.Sprintf(`Maximum number of genomes in each batch (maximum value: %d)`, 1<<BITS_GENOME_IDX)))
-
-	indexCmd.Flags().IntP("seed-data-threads", "J", 8,
+	cmd.Flags().IntP("seed-data-threads", "J", 8,
 		formatFlagUsage(`Number of threads for writing seed data and merging seed chunks from all batches, the value should be in range of [1, -c/--chunks]. If there are >100 batches, please also increase the value of --max-open-files and set a bigger "ulimit -n" in shell.`))
 
-	indexCmd.Flags().IntP("contig-interval", "", 1000,
+	// -----------------------------  genome   -----------------------------
+
+	cmd.Flags().IntP("contig-interval", "", 1000,
 		formatFlagUsage(`Length of interval (N's) between contigs in a genome. It can't be too small (<1000) or some alignments might be fragmented`))
 
+	cmd.Flags().BoolP("compress-genomes", "", false,
+		formatFlagUsage(`Save genome data in a block-compressed format (zstd), which is read transparently in searching and other commands. The first genome of each genome batch is used as the compression dictionary, so only genomes highly similar to it are compressed, e.g., strains of the same species placed together in the input, at the cost of slower sequence extraction.`))
+	cmd.Flags().StringP("genome-block-size", "", fmt.Sprintf("%dK", genome.DefaultBlockSize>>10),
+		formatFlagUsage(`Size of uncompressed blocks for --compress-genomes. Only blocks covering an extracted region are decompressed, so bigger blocks give slower sequence extraction, while the compression ratio barely changes. Supported units: B, K, M.`))
+
+	cmd.Flags().BoolP("save-annotations", "", false,
+		formatFlagUsage(`Save genome annotations from GenBank input files or GFF3 files alongside FASTA/Q files with the same prefix (e.g., X.gff.gz for X.fna.gz), for reporting features overlapping with hits via "lexicmap search --annotations".`))
+	cmd.Flags().StringSliceP("annotation-types", "", []string{"CDS", "rRNA", "tRNA", "tmRNA", "ncRNA"},
+		formatFlagUsage(`Feature types to save for --save-annotations. Use "" for all types.`))
+
 	// ----------------------------------------------------------
 
-	indexCmd.Flags().BoolP("debug", "", false,
+	cmd.Flags().BoolP("no-checksums", "", false,
+		formatFlagUsage(`Do not compute SHA-256 checksums of index files in the manifest file (manifest.tsv), only file sizes are recorded. Checksums are checked by "lexicmap utils verify-index" to detect corrupted files, and computing them takes a few minutes for big indexes.`))
+
+	cmd.Flags().BoolP("debug", "", false,
 		formatFlagUsage(`Print debug information.`))
+}
 
-	indexCmd.SetUsageTemplate(usageTemplate("[-k <k>] [-m <masks>] {-I <seqs dir> | [-S] -X <file list>} -O <index.lmi>"))
+// getIndexBuildingOptions parses flags added by addIndexBuildingFlags,
+// the values of general options, MaxOpenFiles and GenomeBatchSize are set by the callers.
+func getIndexBuildingOptions(cmd *cobra.Command, opt *Options) *IndexBuildingOptions {
+	k := getFlagPositiveInt(cmd, "kmer")
+	if k < minK || k > 32 {
+		checkError(fmt.Errorf("the value of flag -k/--kmer should be in range of [%d, 32]", minK))
+	}
+	minSeqLen := getFlagInt(cmd, "min-seq-len")
+	if minSeqLen < k {
+		minSeqLen = -1
+		// checkError(fmt.Errorf("the value (%d) of flag -l/--min-seq-len should be >= k (%d)", minSeqLen, k))
+	}
+	if minSeqLen <= 0 {
+		minSeqLen = k
+	}
+	minSeqLen = max(minSeqLen, k)
+
+	nMasks := getFlagPositiveInt(cmd, "masks")
+	seed := getFlagPositiveInt(cmd, "rand-seed")
+	maskFile := getFlagString(cmd, "mask-file")
+
+	chunks := opt.NumCPUs // the default value is equal to -j/--threads
+	_chunks := getFlagPositiveInt(cmd, "chunks")
+	if chunks != _chunks && cmd.Flags().Lookup("chunks").Changed {
+		chunks = _chunks
+	}
+	if chunks > 128 {
+		chunks = 128
+	}
+
+	mergeThreads := getFlagPositiveInt(cmd, "seed-data-threads")
+	if mergeThreads > chunks {
+		mergeThreads = chunks
+	}
+	partitions := getFlagPositiveInt(cmd, "partitions")
+
+	maxGenomeSize := getFlagNonNegativeInt(cmd, "max-genome")
+	if maxGenomeSize > MAX_GENOME_SIZE {
+		checkError(fmt.Errorf("value of -g/--max-genome (%d) should not be greater than the maximum supported genome size (%d)", maxGenomeSize, MAX_GENOME_SIZE))
+	}
+	fileBigGenomes := getFlagString(cmd, "big-genomes")
+
+	// minPrefix := getFlagNonNegativeInt(cmd, "seed-min-prefix")
+	// if minPrefix > 32 || minPrefix < 5 {
+	// 	checkError(fmt.Errorf("the value of flag -p/--seed-min-prefix (%d) should be in the range of [5, 32]", minPrefix))
+	// }
+	maxDesert := getFlagPositiveInt(cmd, "seed-max-desert")
+	seedInDesertDist := getFlagPositiveInt(cmd, "seed-in-desert-dist")
+	if seedInDesertDist > maxDesert/2 {
+		checkError(fmt.Errorf("value of --seed-in-desert-dist should be smaller than 0.5 * --seed-max-desert"))
+	}
+	noDesertFilling := getFlagBool(cmd, "no-desert-filling")
+
+	// topN := getFlagPositiveInt(cmd, "top-n")
+	// prefixExt := getFlagPositiveInt(cmd, "prefix-ext")
+
+	var err error
+
+	reRefNameStr := getFlagString(cmd, "ref-name-regexp")
+	var reRefName *regexp.Regexp
+	if reRefNameStr != "" {
+		if !regexp.MustCompile(`\(.+\)`).MatchString(reRefNameStr) {
+			checkError(fmt.Errorf(`value of --ref-name-regexp must contains "(" and ")" to capture the ref name from file name`))
+		}
+		if !reIgnoreCase.MatchString(reRefNameStr) {
+			reRefNameStr = reIgnoreCaseStr + reRefNameStr
+		}
+
+		reRefName, err = regexp.Compile(reRefNameStr)
+		if err != nil {
+			checkError(errors.Wrapf(err, "failed to parse regular expression for matching sequence header: %s", reRefName))
+		}
+	}
+
+	reSeqNameStrs := getFlagStringSlice(cmd, "seq-name-filter")
+	reSeqNames := make([]*regexp.Regexp, 0, len(reSeqNameStrs))
+	for _, kw := range reSeqNameStrs {
+		if !reIgnoreCase.MatchString(kw) {
+			kw = reIgnoreCaseStr + kw
+		}
+		re, err := regexp.Compile(kw)
+		if err != nil {
+			checkError(errors.Wrapf(err, "failed to parse regular expression for matching sequence header: %s", kw))
+		}
+		reSeqNames = append(reSeqNames, re)
+	}
+
+	contigInterval := getFlagPositiveInt(cmd, "contig-interval")
+	if contigInterval < maxDesert {
+		checkError(fmt.Errorf("the value of --contig-interval (%d) should be >= -D/--seed-max-desert (%d)", contigInterval, maxDesert))
+	}
+
+	var genomeBlockSize int
+	if getFlagBool(cmd, "compress-genomes") {
+		blockSize, err := ParseByteSize(getFlagString(cmd, "genome-block-size"))
+		if err != nil {
+			checkError(fmt.Errorf("invalid value of --genome-block-size: %s", err))
+		}
+		if blockSize < 4096 || blockSize > 1<<30 {
+			checkError(fmt.Errorf("the value of --genome-block-size should be in the range of [4KB, 1GB]"))
+		}
+		genomeBlockSize = int(blockSize)
+	}
+
+	annotationTypes := make([]string, 0, 8)
+	for _, t := range getFlagStringSlice(cmd, "annotation-types") {
+		if t = strings.TrimSpace(t); t != "" {
+			annotationTypes = append(annotationTypes, t)
+		}
+	}
+
+	// refNameStr := getFlagString(cmd, "ref-name-info")
+	// var name2info map[string]string
+
+	return &IndexBuildingOptions{
+		// general
+		NumCPUs:      opt.NumCPUs,
+		Verbose:      opt.Verbose,
+		Log2File:     opt.Log2File,
+		MergeThreads: mergeThreads,
+
+		MinSeqLen: minSeqLen,
+
+		// skip extremely large genomes
+		MaxGenomeSize: maxGenomeSize,
+		BigGenomeFile: fileBigGenomes,
+
+		// LexicHash
+		MaskFile:    maskFile,
+		K:           k,
+		Masks:       nMasks,
+		RandSeed:    int64(seed),
+		SoftMasking: getFlagBool(cmd, "soft-masking"),
+		MaxKmerFreq: getFlagNonNegativeInt(cmd, "max-kmer-freq"),
+
+		// randomly generating
+		// Prefix: minPrefix,
+
+		// filling sketching deserts
+		DisableDesertFilling:   noDesertFilling,      // disable desert filling (just for analysis index)
+		DesertMaxLen:           uint32(maxDesert),    // maxi length of sketching deserts
+		DesertExpectedSeedDist: seedInDesertDist,     // expected distance between seeds
+		DesertSeedPosRange:     seedInDesertDist / 2, // the upstream and down stream region for adding a seeds
+
+		// generate masks
+		// TopN:      topN,
+		// PrefixExt: prefixExt,
+
+		// k-mer-value data
+		Chunks:     chunks,
+		Partitions: partitions,
+
+		// genome
+		ReRefName:    reRefName,
+		ReSeqExclude: reSeqNames,
+
+		ContigInterval:  contigInterval,
+		GenomeBlockSize: genomeBlockSize,
+
+		SaveSeedPositions: getFlagBool(cmd, "save-seed-pos"),
+
+		SaveAnnotations: getFlagBool(cmd, "save-annotations"),
+		AnnotationTypes: annotationTypes,
+
+		Checksums: !getFlagBool(cmd, "no-checksums"),
+
+		Debug: getFlagBool(cmd, "debug"),
+	}
+}
+
+// getIndexInputFiles returns the list of input files from the positional arguments,
+// the file list (-X/--infile-list), or the input directory (-I/--in-dir).
+func getIndexInputFiles(cmd *cobra.Command, args []string, opt *Options, outDir string) []string {
+	var err error
+
+	inDir := getFlagString(cmd, "in-dir")
+	skipFileCheck := getFlagBool(cmd, "skip-file-check")
+
+	if filepath.Clean(inDir) == outDir {
+		checkError(fmt.Errorf("intput and output paths should not be the same: %s", outDir))
+	}
+
+	readFromDir := inDir != ""
+	if readFromDir {
+		var isDir bool
+		isDir, err = pathutil.IsDir(inDir)
+		if err != nil {
+			checkError(errors.Wrapf(err, "checking -I/--in-dir"))
+		}
+		if !isDir {
+			checkError(fmt.Errorf("value of -I/--in-dir should be a directory: %s", inDir))
+		}
+	}
+
+	reFileStr := getFlagString(cmd, "file-regexp")
+	var reFile *regexp.Regexp
+	if reFileStr != "" {
+		if !reIgnoreCase.MatchString(reFileStr) {
+			reFileStr = reIgnoreCaseStr + reFileStr
+		}
+		reFile, err = regexp.Compile(reFileStr)
+		checkError(errors.Wrapf(err, "failed to parse regular expression for matching file: %s", reFileStr))
+	}
+
+	// if refNameStr != "" {
+	// 	name2info, err = readKVs(refNameStr, false)
+	// 	checkError(err)
+	// 	if opt.Verbose || opt.Log2File {
+	// 		log.Infof("%d reference name information records loaded", len(name2info))
+	// 	}
+	// }
+
+	if opt.Verbose || opt.Log2File {
+		log.Info("checking input files ...")
+	}
+
+	var files []string
+	if readFromDir {
+		if opt.Verbose || opt.Log2File {
+			log.Infof("  scanning files from directory: %s", inDir)
+		}
+		files, err = getFileListFromDir(inDir, reFile, opt.NumCPUs)
+		if err != nil {
+			checkError(errors.Wrapf(err, "walking dir: %s", inDir))
+		}
+		if len(files) == 0 {
+			log.Warningf("  no files matching regular expression: %s", reFileStr)
+		}
+	} else {
+		if opt.Verbose || opt.Log2File {
+			log.Info("  checking files from command-line argument or/and file list ...")
+		}
+		files = getFileListFromArgsAndFile(cmd, args, !skipFileCheck, "infile-list", !skipFileCheck)
+		if opt.Verbose || opt.Log2File {
+			if len(files) == 1 && isStdin(files[0]) {
+				log.Info("  no files given, reading from stdin")
+			}
+		}
+	}
+	if len(files) < 1 {
+		checkError(fmt.Errorf("FASTA/Q files needed"))
+	} else if len(files) > 1<<BITS_IDX { // 1<< 34
+		checkError(fmt.Errorf("at most %d files supported, given: %d", 1<<BITS_IDX, len(files)))
+	} else if opt.Verbose || opt.Log2File {
+		log.Infof("  %d input file(s) given", len(files))
+	}
+
+	// sort files according to taxonomic information
+	// if len(name2info) > 0 {
+	// 	if opt.Verbose || opt.Log2File {
+	// 		log.Info("sorting input files according to reference name information...")
+	// 	}
+	// 	file2info := make([][2]string, len(files))
+
+	// 	var baseFile, genomeID string
+	// 	for i, file := range files {
+	// 		baseFile = filepath.Base(file)
+	// 		if reRefName.MatchString(baseFile) {
+	// 			genomeID = reRefName.FindAllStringSubmatch(baseFile, 1)[0][1]
+	// 		} else {
+	// 			genomeID, _, _ = filepathTrimExtension(baseFile, nil)
+	// 		}
+
+	// 		file2info[i] = [2]string{file, name2info[genomeID]}
+	// 	}
+	// 	sort.Slice(file2info, func(i, j int) bool {
+	// 		a, b := file2info[i][1], file2info[j][1]
+	// 		if a == b {
+	// 			return strings.Compare(file2info[i][0], file2info[j][0]) < 0
+	// 		}
+	// 		return strings.Compare(a, b) < 0
+	// 	})
+	// 	for i := range file2info {
+	// 		files[i] = file2info[i][0]
+	// 		// fmt.Printf("%s, %s\n", files[i], file2info[i][1])
+	// 	}
+	// 	if opt.Verbose || opt.Log2File {
+	// 		log.Info("  input files sorted")
+	// 	}
+	// }
+	return files
+}
+
+// logIndexBuildingOptions logs main parameters of input, output, mask generation, and seed data.
+func logIndexBuildingOptions(cmd *cobra.Command, opt *IndexBuildingOptions, outDir string) {
+	log.Info()
+	log.Infof("--------------------- [ main parameters ] ---------------------")
+	log.Info()
+	log.Info("input and output:")
+	log.Infof("  input directory: %s", getFlagString(cmd, "in-dir"))
+	log.Infof("    regular expression of input files: %s", getFlagString(cmd, "file-regexp"))
+	log.Infof("    *regular expression for extracting reference name from file name: %s", getFlagString(cmd, "ref-name-regexp"))
+	log.Infof("    *regular expressions for filtering out sequences: %s", getFlagStringSlice(cmd, "seq-name-filter"))
+	log.Infof("  min sequence length: %d", opt.MinSeqLen)
+	log.Infof("  max genome size: %d", opt.MaxGenomeSize)
+	log.Infof("  output directory: %s", outDir)
+	if opt.BigGenomeFile != "" {
+		log.Infof("  output file of skipped genomes: %s", opt.BigGenomeFile)
+	}
+	if opt.SaveAnnotations {
+		if len(opt.AnnotationTypes) > 0 {
+			log.Infof("  save annotations of feature types: %s", strings.Join(opt.AnnotationTypes, ", "))
+		} else {
+			log.Infof("  save annotations of all feature types")
+		}
+	}
+	log.Info()
+
+	log.Info("mask generation:")
+	if opt.MaskFile != "" {
+		log.Infof("  custom mask file: %s", opt.MaskFile)
+	} else {
+		log.Infof("  k-mer size: %d", opt.K)
+		log.Infof("  number of masks: %d", opt.Masks)
+		log.Infof("  rand seed: %d", opt.RandSeed)
+		// log.Infof("  prefix length for checking low-complexity in mask generation: %d", minPrefix)
+	}
+
+	log.Info()
+	log.Info("seed data:")
+	if opt.DisableDesertFilling {
+		log.Infof("  disable desert filling: %v", opt.DisableDesertFilling)
+	} else {
+		log.Infof("  maximum sketching desert length: %d", opt.DesertMaxLen)
+		log.Infof("  distance of k-mers to fill deserts: %d", opt.DesertExpectedSeedDist)
+	}
+	log.Infof("  seeds data chunks: %d", opt.Chunks)
+	log.Infof("  seeds data indexing partitions: %d", opt.Partitions)
+	log.Info()
 }
 
 var defaultChunks int
@@ -114,6 +114,8 @@ Attention:
 		if err != nil {
 			checkError(fmt.Errorf("failed to read info file: %s", err))
 		}
+		layout, err := NewIndexLayout(dbDir, info)
+		checkError(err)
 
 		if outputLog {
 			log.Infof("  checking passed")
@@ -227,7 +229,7 @@ Attention:
 			chunk = (mask - 1) / chunkSize
 			iMask = (mask - 1) % chunkSize
 
-			fileSeeds = filepath.Join(dbDir, DirSeeds, chunkFile(chunk))
+			fileSeeds = layout.SeedFile(chunk)
 
 			// kv-data index file
 			if chunk != preChunk {
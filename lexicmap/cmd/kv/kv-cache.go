@@ -0,0 +1,486 @@
+// Copyright © 2023-2026 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package kv
+
+import (
+	"container/list"
+	"io"
+	"math/bits"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/shenwei356/LexicMap/lexicmap/cmd/util"
+)
+
+// SeedCache is a size-bounded and concurrency-safe LRU cache of decoded seed data,
+// which can be shared by Searchers of all seed chunks.
+// Data are cached in the unit of anchor blocks, i.e., all k-mers and values
+// sharing the same anchor in a mask, keyed by (chunk, mask, anchor),
+// where the chunk is identified by the index of its first mask.
+//
+// It's a middle ground between searching on disk and searching with
+// all seed data loaded in memory (InMemorySearcher), and it benefits
+// batches of related queries which read the same anchor blocks repeatedly.
+type SeedCache struct {
+	shards []*seedCacheShard
+
+	maxBytes int64
+
+	hits   atomic.Uint64
+	misses atomic.Uint64
+}
+
+type seedCacheKey struct {
+	chunk  uint32
+	mask   uint32
+	anchor uint64
+}
+
+// seedBlock is the decoded data of an anchor block.
+type seedBlock struct {
+	kmers  []uint64 // sorted k-mers
+	starts []int    // start indexes of values of k-mers, with an extra one for the end
+	values []uint64
+
+	partial bool // only k-mers in the searched range, for blocks too big to cache
+}
+
+// size returns the approximate memory occupation in bytes.
+func (b *seedBlock) size() int64 {
+	return int64(len(b.kmers)+len(b.starts)+len(b.values))<<3 + 128
+}
+
+// trim removes k-mers smaller than leftBound and their values.
+func (b *seedBlock) trim(leftBound uint64) {
+	j := sort.Search(len(b.kmers), func(x int) bool { return b.kmers[x] >= leftBound })
+	if j == 0 {
+		return
+	}
+	off := b.starts[j]
+	b.kmers = append(b.kmers[:0], b.kmers[j:]...)
+	b.values = append(b.values[:0], b.values[off:]...)
+	starts := b.starts[:0]
+	for _, s := range b.starts[j:] {
+		starts = append(starts, s-off)
+	}
+	b.starts = starts
+}
+
+type seedCacheEntry struct {
+	key   seedCacheKey
+	block *seedBlock
+}
+
+type seedCacheShard struct {
+	mu       sync.Mutex
+	maxBytes int64
+	bytes    int64
+	ll       *list.List
+	items    map[seedCacheKey]*list.Element
+}
+
+// seedCacheShards is the maximum number of shards for reducing lock contention.
+const seedCacheShards = 64
+
+// minSeedCacheShardBytes is the minimum size of a shard, which is also the
+// maximum size of blocks that can be cached. So small caches have fewer shards.
+const minSeedCacheShardBytes = 16 << 20
+
+// NewSeedCache creates a SeedCache with a maximum memory occupation of maxBytes.
+func NewSeedCache(maxBytes int64) *SeedCache {
+	nShards := int(min(max(maxBytes/minSeedCacheShardBytes, 1), seedCacheShards))
+	c := &SeedCache{
+		shards:   make([]*seedCacheShard, nShards),
+		maxBytes: maxBytes,
+	}
+	for i := range c.shards {
+		c.shards[i] = &seedCacheShard{
+			maxBytes: maxBytes / int64(nShards),
+			ll:       list.New(),
+			items:    make(map[seedCacheKey]*list.Element, 1024),
+		}
+	}
+	return c
+}
+
+func (c *SeedCache) shard(key seedCacheKey) *seedCacheShard {
+	h := (uint64(key.chunk)*0x9E3779B1 + uint64(key.mask)) * 0x9E3779B97F4A7C15
+	h ^= key.anchor * 0xC2B2AE3D27D4EB4F
+	return c.shards[(h>>32)%uint64(len(c.shards))]
+}
+
+// maxBlockBytes returns the maximum size of blocks that can be cached.
+func (c *SeedCache) maxBlockBytes() int64 {
+	return c.shards[0].maxBytes
+}
+
+// get returns a cached block and moves it to the front.
+func (c *SeedCache) get(key seedCacheKey) (*seedBlock, bool) {
+	s := c.shard(key)
+	s.mu.Lock()
+	e, ok := s.items[key]
+	if !ok {
+		s.mu.Unlock()
+		c.misses.Add(1)
+		return nil, false
+	}
+	s.ll.MoveToFront(e)
+	b := e.Value.(*seedCacheEntry).block
+	s.mu.Unlock()
+	c.hits.Add(1)
+	return b, true
+}
+
+// add adds a block, and evicts least recently used blocks if the size exceeds the limit.
+// Partial blocks and blocks bigger than the limit of a shard are not cached.
+func (c *SeedCache) add(key seedCacheKey, b *seedBlock) {
+	s := c.shard(key)
+	size := b.size()
+	if b.partial || size > s.maxBytes {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.items[key]; ok { // added by another goroutine
+		return
+	}
+	s.items[key] = s.ll.PushFront(&seedCacheEntry{key: key, block: b})
+	s.bytes += size
+
+	var e *list.Element
+	var entry *seedCacheEntry
+	for s.bytes > s.maxBytes {
+		e = s.ll.Back()
+		entry = e.Value.(*seedCacheEntry)
+		s.ll.Remove(e)
+		delete(s.items, entry.key)
+		s.bytes -= entry.block.size()
+	}
+}
+
+// SeedCacheStats contains statistics of a SeedCache.
+type SeedCacheStats struct {
+	Hits     uint64
+	Misses   uint64
+	Blocks   int   // the number of cached blocks
+	Bytes    int64 // approximate memory occupation of cached blocks
+	MaxBytes int64
+}
+
+// HitRate returns the proportion of lookups served by the cache.
+func (s SeedCacheStats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// Stats returns the statistics of the cache.
+func (c *SeedCache) Stats() SeedCacheStats {
+	st := SeedCacheStats{
+		Hits:     c.hits.Load(),
+		Misses:   c.misses.Load(),
+		MaxBytes: c.maxBytes,
+	}
+	for _, s := range c.shards {
+		s.mu.Lock()
+		st.Blocks += len(s.items)
+		st.Bytes += s.bytes
+		s.mu.Unlock()
+	}
+	return st
+}
+
+// SetCache sets a SeedCache for the Searcher, which can be shared by multiple Searchers.
+// With a cache, Search() and Search2() read and decode the whole anchor block of a query k-mer,
+// and reuse cached blocks in later searches. Blocks too big to cache are read like
+// the searching without a cache, i.e., only k-mers in the searched range are decoded.
+func (scr *Searcher) SetCache(c *SeedCache) {
+	scr.cache = c
+}
+
+// seedBlock returns the decoded data of the i-th anchor (i is the position in the index)
+// of a mask, from the cache or the kv-data file.
+// For blocks too big to cache, only k-mers in [leftBound, rightBound] are returned.
+func (scr *Searcher) seedBlock(spack *SearchKit, iQ int, index []uint64, i int, anchor uint64, leftBound, rightBound uint64) (*seedBlock, error) {
+	key := seedCacheKey{chunk: uint32(scr.ChunkIndex), mask: uint32(iQ), anchor: anchor}
+	if b, ok := scr.cache.get(key); ok {
+		return b, nil
+	}
+
+	b, err := scr.readSeedBlock(spack, index, i, anchor, leftBound, rightBound, scr.cache.maxBlockBytes())
+	if err != nil {
+		return nil, err
+	}
+	scr.cache.add(key, b)
+	return b, nil
+}
+
+// readSeedBlock reads and decodes all k-mers and values of an anchor block.
+// Once the decoded data is bigger than maxBytes, the block is marked as partial,
+// and only k-mers in [leftBound, rightBound] are kept, with values of others skipped.
+func (scr *Searcher) readSeedBlock(spack *SearchKit, index []uint64, i int, anchor uint64, leftBound, rightBound uint64, maxBytes int64) (*seedBlock, error) {
+	b := &seedBlock{starts: []int{0}}
+
+	offset := index[i+1]
+	is2ndKmer := offset&1 == 1
+	offset >>= 1
+
+	var nSeedPosBytes uint64 = 8
+	fUint64 := be.Uint64
+	if scr.Use3BytesForSeedPos {
+		nSeedPosBytes = 7
+		fUint64 = Uint64ThreeBytes
+	}
+
+	buf := spack.buf
+	r := spack.r
+	_, err := spack.fh.Seek(int64(offset), 0)
+	if err != nil {
+		return nil, err
+	}
+	r.Reset(spack.fh)
+
+	getAnchor := scr.getAnchor
+
+	readValues := func(n uint64) error {
+		var nBytes uint64
+		for n > 0 {
+			nBytes = min(n, seedPosBatchSize) * nSeedPosBytes
+			_, err := io.ReadFull(r, spack.buf2048[:nBytes])
+			if err != nil {
+				return ErrBrokenFile
+			}
+			for j := uint64(0); j < nBytes; j += nSeedPosBytes {
+				b.values = append(b.values, fUint64(spack.buf2048[j:j+nSeedPosBytes]))
+			}
+			n -= nBytes / nSeedPosBytes
+		}
+		b.starts = append(b.starts, len(b.values))
+		return nil
+	}
+
+	// addKmer adds a k-mer and its n values, it returns true if the reading should stop.
+	addKmer := func(kmer, n uint64) (bool, error) {
+		if getAnchor(kmer) != anchor || (b.partial && kmer > rightBound) {
+			return true, nil
+		}
+		if b.partial && kmer < leftBound {
+			if _, err := r.Discard(int(n * nSeedPosBytes)); err != nil {
+				return false, ErrBrokenFile
+			}
+			return false, nil
+		}
+		b.kmers = append(b.kmers, kmer)
+		if err := readValues(n); err != nil {
+			return false, err
+		}
+		if !b.partial && b.size() > maxBytes {
+			b.trim(leftBound)
+			b.partial = true
+		}
+		return false, nil
+	}
+
+	var ctrlByte byte
+	var nBytes int
+	var lastPair, hasKmer2, stop bool
+	var v1, v2, kmer1, kmer2, _offset, lenVal1, lenVal2 uint64
+	first := true
+	for {
+		// k-mer pair
+		_, err = io.ReadFull(r, buf[:1])
+		if err != nil {
+			return nil, err
+		}
+		ctrlByte = buf[0]
+		lastPair = ctrlByte&128 > 0
+		hasKmer2 = ctrlByte&64 == 0
+		ctrlByte &= 63
+		nBytes = util.CtrlByte2ByteLengthsUint64(ctrlByte)
+		_, err = io.ReadFull(r, buf[:nBytes])
+		if err != nil {
+			return nil, ErrBrokenFile
+		}
+		v1, v2, _ = util.Uint64s(ctrlByte, buf[:nBytes])
+
+		if first {
+			if !is2ndKmer {
+				kmer1 = index[i]
+				kmer2 = kmer1 + v2
+			} else {
+				kmer1 = 0
+				kmer2 = index[i]
+			}
+		} else {
+			kmer1 = v1 + _offset
+			kmer2 = kmer1 + v2
+		}
+		_offset = kmer2
+
+		// lengths of values
+		_, err = io.ReadFull(r, buf[:1])
+		if err != nil {
+			return nil, err
+		}
+		ctrlByte = buf[0]
+		nBytes = util.CtrlByte2ByteLengthsUint64(ctrlByte)
+		_, err = io.ReadFull(r, buf[:nBytes])
+		if err != nil {
+			return nil, ErrBrokenFile
+		}
+		lenVal1, lenVal2, _ = util.Uint64s(ctrlByte, buf[:nBytes])
+
+		// values of k-mer 1
+		if first && is2ndKmer { // k-mer 1 belongs to the previous anchor
+			_, err = r.Discard(int(lenVal1 * nSeedPosBytes))
+			if err != nil {
+				return nil, ErrBrokenFile
+			}
+		} else {
+			if stop, err = addKmer(kmer1, lenVal1); err != nil {
+				return nil, err
+			} else if stop {
+				break
+			}
+		}
+		first = false
+
+		if lastPair && !hasKmer2 {
+			break
+		}
+
+		// values of k-mer 2
+		if stop, err = addKmer(kmer2, lenVal2); err != nil {
+			return nil, err
+		} else if stop {
+			break
+		}
+
+		if lastPair {
+			break
+		}
+	}
+
+	return b, nil
+}
+
+// searchWithCache is the version of Search() and Search2() using the seed cache.
+// Either kmers or kmers2 is given.
+func (scr *Searcher) searchWithCache(kmers []uint64, kmers2 []*[]uint64, p uint8, checkFlag bool, reversedKmer bool) (*[]*SearchResult, error) {
+	k := scr.K
+	shift := k - 32
+
+	var rvflag uint64
+	if reversedKmer {
+		rvflag = MASK_REVERSE
+	}
+
+	spack := <-scr.searchKits
+	defer func() {
+		scr.searchKits <- spack
+	}()
+
+	results := poolSearchResults.Get().(*[]*SearchResult)
+	*results = (*results)[:0]
+
+	prefixSearch := p < k
+	suffix2 := (k - p) << 1
+	mask := uint64(1<<suffix2) - 1
+	getAnchor := scr.getAnchor
+	chunkIndex := scr.ChunkIndex
+
+	var qkmers []uint64
+	single := make([]uint64, 1)
+	var leftBound, rightBound, anchor, lastAnchor uint64
+	var i, j, e int
+	var vals []uint64
+	var b *seedBlock
+	var sr *SearchResult
+	var err error
+	for iQ, index := range scr.Indexes {
+		if len(index) == 0 { // this hapens when no captured k-mer for a mask
+			continue
+		}
+
+		if kmers2 != nil {
+			qkmers = *kmers2[iQ]
+		} else {
+			single[0] = kmers[iQ]
+			qkmers = single
+		}
+
+		for iKmer, kmer := range qkmers {
+			if kmer == 0 {
+				continue
+			}
+
+			if prefixSearch {
+				leftBound = kmer &^ mask
+				rightBound = kmer | mask
+			} else {
+				leftBound = kmer
+				rightBound = kmer
+			}
+
+			// k-mers in the range might belong to multiple anchors
+			// when p is shorter than maskPrefix + anchorPrefix.
+			lastAnchor = getAnchor(rightBound)
+			for anchor = getAnchor(leftBound); anchor <= lastAnchor; anchor++ {
+				i = int(anchor<<1) + 2  // as the firt two elements are special
+				if index[i+1]>>1 == 0 { // no k-mers of this anchor
+					continue
+				}
+
+				b, err = scr.seedBlock(spack, iQ, index, i, anchor, leftBound, rightBound)
+				if err != nil {
+					return nil, err
+				}
+
+				j = sort.Search(len(b.kmers), func(x int) bool { return b.kmers[x] >= leftBound })
+				for e = len(b.kmers); j < e && b.kmers[j] <= rightBound; j++ {
+					vals = b.values[b.starts[j]:b.starts[j+1]]
+					if len(vals) == 0 {
+						continue
+					}
+					// check the reverse flag of the first seed data
+					if checkFlag && vals[0]&MASK_REVERSE != rvflag {
+						continue
+					}
+
+					sr = poolSearchResult.Get().(*SearchResult)
+					sr.IQuery = iQ + chunkIndex // do not forget to add mask offset
+					sr.IQuery2 = iKmer
+					sr.Len = uint8(bits.LeadingZeros64(kmer^b.kmers[j])>>1) + shift
+					sr.IsSuffix = reversedKmer
+					sr.Values = append(sr.Values[:0], vals...)
+
+					*results = append(*results, sr)
+				}
+			}
+		}
+	}
+
+	return results, nil
+}
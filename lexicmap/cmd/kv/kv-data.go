@@ -629,12 +629,12 @@ func ReadKVIndexSelected(file string, selectedMasks []bool) (uint8, int, [][]uin
 }
 
 func readKVIndex(file string, selectedMasks []bool) (uint8, int, [][]uint64, uint8, uint8, uint8, error) {
-	fh, err := os.Open(file)
+	fh, err := util.OpenFile(file)
 	if err != nil {
 		return 0, -1, nil, 0, 0, 0, err
 	}
 	defer fh.Close()
-	r := bufio.NewReaderSize(fh, 16<<10)
+	r := bufio.NewReaderSize(util.NewFileReader(fh), 16<<10)
 	// r := poolBufReader.Get().(*bufio.Reader)
 	// r.Reset(fh)
 	// defer func() {
@@ -772,13 +772,13 @@ func readKVIndex(file string, selectedMasks []bool) (uint8, int, [][]uint64, uin
 // It is intended for sequential mask scans that do not use the anchor lookup
 // table, avoiding the large per-mask allocations made by ReadKVIndex.
 func ReadKVIndexStarts(file string) ([][2]uint64, error) {
-	fh, err := os.Open(file)
+	fh, err := util.OpenFile(file)
 	if err != nil {
 		return nil, err
 	}
 	defer fh.Close()
 
-	r := bufio.NewReaderSize(fh, 16<<10)
+	r := bufio.NewReaderSize(util.NewFileReader(fh), 16<<10)
 	buf8 := make([]byte, 8)
 	buf16 := make([]byte, 16)
 
@@ -833,11 +833,11 @@ func ReadKVIndexStarts(file string) ([][2]uint64, error) {
 
 // ReadKVIndexInfo read the information.
 func ReadKVIndexInfo(file string) (uint8, int, int, uint8, uint8, error) {
-	fh, err := os.Open(file)
+	fh, err := util.OpenFile(file)
 	if err != nil {
 		return 0, -1, 0, 0, 0, err
 	}
-	r := bufio.NewReader(fh)
+	r := bufio.NewReader(util.NewFileReader(fh))
 	defer fh.Close()
 
 	// ---------------------------------------------
@@ -901,11 +901,12 @@ func ReadKVIndexInfo(file string) (uint8, int, int, uint8, uint8, error) {
 
 // ReadKVDataHeader reads only the header information from kv-data file.
 func ReadKVDataHeader(file string) (uint8, int, int, uint8, error) {
-	fh, err := os.Open(file)
+	f, err := util.OpenFile(file)
 	if err != nil {
 		return 0, -1, 0, 0, err
 	}
-	defer fh.Close()
+	defer f.Close()
+	fh := util.NewFileReader(f)
 
 	buf := make([]byte, 8)
 	var n int
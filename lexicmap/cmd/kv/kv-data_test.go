@@ -23,11 +23,27 @@ package kv
 import (
 	"os"
 	"path/filepath"
+	"slices"
 	"testing"
 
 	"github.com/shenwei356/lexichash"
 )
 
+// sameSearchResults compares two search results, IQuery2 is only set by Search2().
+func sameSearchResults(a, b *[]*SearchResult, search2 bool) bool {
+	if len(*a) != len(*b) {
+		return false
+	}
+	for j, r := range *a {
+		r2 := (*b)[j]
+		if r.IQuery != r2.IQuery || (search2 && r.IQuery2 != r2.IQuery2) || r.Len != r2.Len ||
+			r.IsSuffix != r2.IsSuffix || !slices.Equal(r.Values, r2.Values) {
+			return false
+		}
+	}
+	return true
+}
+
 func TestKVData(t *testing.T) {
 	var lenPrefix uint8 = 2 // mask prefix
 	var k uint8 = 5         // kmer size
@@ -347,6 +363,169 @@ func TestKVData(t *testing.T) {
 		}
 	}
 
+	// -------------------------------------------------------------------
+	// searcher with mmap, results should be the same as the default searcher
+
+	scr3, err := NewSearcherWithMmap(file, 2, nil)
+	if err != nil {
+		t.Errorf("%s", err)
+		return
+	}
+
+	for mPrefix = 4; mPrefix <= k; mPrefix++ {
+		for i = 1; i < n-1; i++ {
+			for j := 0; j < nMasks; j++ {
+				kmers[j] = prefix | i
+			}
+			results, err := scr.Search(kmers, mPrefix, false, false)
+			if err != nil {
+				t.Errorf("%s", err)
+				return
+			}
+			results3, err := scr3.Search(kmers, mPrefix, false, false)
+			if err != nil {
+				t.Errorf("%s", err)
+				return
+			}
+
+			if len(*results) != len(*results3) {
+				t.Errorf("query: %s, mmap searcher returned %d results, expected: %d",
+					lexichash.MustDecode(prefix|i, k), len(*results3), len(*results))
+				return
+			}
+			for j, r := range *results {
+				r3 := (*results3)[j]
+				if r.IQuery != r3.IQuery || r.Len != r3.Len || !slices.Equal(r.Values, r3.Values) {
+					t.Errorf("query: %s, result mismatch between mmap searcher and the default one",
+						lexichash.MustDecode(prefix|i, k))
+					return
+				}
+			}
+
+			RecycleSearchResults(results)
+			RecycleSearchResults(results3)
+		}
+	}
+
+	if err = scr3.Close(); err != nil {
+		t.Errorf("%s", err)
+		return
+	}
+
+	// -------------------------------------------------------------------
+	// searchers with a seed cache, results should be the same as the default searcher
+
+	// the small one leads to evictions, and no blocks can be cached with the tiny one
+	for _, maxBytes := range []int64{1 << 20, 64 * 400, 128} {
+		cache := NewSeedCache(maxBytes)
+		scr4, err := NewSearcher(file, 2)
+		if err != nil {
+			t.Errorf("%s", err)
+			return
+		}
+		scr4.SetCache(cache)
+
+		kmers2 := make([]*[]uint64, nMasks)
+		for round := 0; round < 2; round++ {
+			for mPrefix = 4; mPrefix <= k; mPrefix++ {
+				for i = 1; i < n-1; i++ {
+					for j := 0; j < nMasks; j++ {
+						kmers[j] = prefix | i
+						kmers2[j] = &[]uint64{prefix | i, prefix | (n - 1 - i)}
+					}
+					for _, checkFlag := range []bool{false, true} {
+						results, err := scr.Search(kmers, mPrefix, checkFlag, false)
+						if err != nil {
+							t.Errorf("%s", err)
+							return
+						}
+						results4, err := scr4.Search(kmers, mPrefix, checkFlag, false)
+						if err != nil {
+							t.Errorf("%s", err)
+							return
+						}
+						if !sameSearchResults(results, results4, false) {
+							t.Errorf("query: %s, check flag: %v, result mismatch between searcher with cache and the default one",
+								lexichash.MustDecode(prefix|i, k), checkFlag)
+							return
+						}
+						RecycleSearchResults(results)
+						RecycleSearchResults(results4)
+
+						results, err = scr.Search2(kmers2, mPrefix, checkFlag, true)
+						if err != nil {
+							t.Errorf("%s", err)
+							return
+						}
+						results4, err = scr4.Search2(kmers2, mPrefix, checkFlag, true)
+						if err != nil {
+							t.Errorf("%s", err)
+							return
+						}
+						if !sameSearchResults(results, results4, true) {
+							t.Errorf("query: %s, check flag: %v, result mismatch between searcher with cache and the default one (Search2)",
+								lexichash.MustDecode(prefix|i, k), checkFlag)
+							return
+						}
+						RecycleSearchResults(results)
+						RecycleSearchResults(results4)
+					}
+				}
+			}
+		}
+
+		// prefixes shorter than maskPrefix + anchorPrefix (4) span multiple anchor blocks,
+		// all k-mers sharing the prefix should still be returned.
+		for mPrefix = 1; mPrefix < 4; mPrefix++ {
+			nExpectedResults = nMasks * int(min(n, 1<<((k-mPrefix)<<1)))
+			for i = 1; i < n-1; i++ {
+				for j := 0; j < nMasks; j++ {
+					kmers[j] = prefix | i
+					kmers2[j] = &[]uint64{prefix | i}
+				}
+				results4, err := scr4.searchWithCache(kmers, nil, mPrefix, false, false)
+				if err != nil {
+					t.Errorf("%s", err)
+					return
+				}
+				if len(*results4) != nExpectedResults {
+					t.Errorf("query: %s, mPrefix: %d, unexpected number of results: %d, expected: %d",
+						lexichash.MustDecode(prefix|i, k), mPrefix, len(*results4), nExpectedResults)
+					return
+				}
+				RecycleSearchResults(results4)
+
+				results4, err = scr4.searchWithCache(nil, kmers2, mPrefix, false, true)
+				if err != nil {
+					t.Errorf("%s", err)
+					return
+				}
+				if len(*results4) != nExpectedResults {
+					t.Errorf("query: %s, mPrefix: %d, unexpected number of results: %d, expected: %d (Search2)",
+						lexichash.MustDecode(prefix|i, k), mPrefix, len(*results4), nExpectedResults)
+					return
+				}
+				RecycleSearchResults(results4)
+			}
+		}
+
+		stats := cache.Stats()
+		if maxBytes < 400 {
+			if stats.Blocks != 0 || stats.Hits != 0 {
+				t.Errorf("unexpected cache stats: %+v", stats)
+				return
+			}
+		} else if stats.Hits == 0 || stats.Bytes > maxBytes {
+			t.Errorf("unexpected cache stats: %+v", stats)
+			return
+		}
+
+		if err = scr4.Close(); err != nil {
+			t.Errorf("%s", err)
+			return
+		}
+	}
+
 	// -------------------------------------------------------------------
 
 	// clean up
@@ -25,7 +25,6 @@ import (
 	"fmt"
 	"io"
 	"math"
-	"os"
 	"path/filepath"
 	"sync"
 
@@ -40,7 +39,7 @@ type Reader struct {
 	ChunkSize  int   // the number of masks in this chunk
 
 	file string
-	fh   *os.File // file handler of the kv-data file
+	fh   util.File // file handler of the kv-data file
 	r    *bufio.Reader
 
 	buf     []byte
@@ -57,12 +56,12 @@ type Reader struct {
 
 // NewReader creates a reader.
 func NewReader(file string) (*Reader, error) {
-	fh, err := os.Open(file)
+	fh, err := util.OpenFile(file)
 	if err != nil {
 		return nil, errors.Wrapf(err, "reading kv-data file")
 	}
 
-	r := bufio.NewReader(fh)
+	r := bufio.NewReader(util.NewFileReader(fh))
 
 	rdr := &Reader{
 		file: file,
@@ -1029,7 +1028,7 @@ type IndexReader struct {
 	ChunkSize  int   // the number of masks in this chunk
 	NAnchors   int
 
-	fh *os.File // file handler of the kv-data file
+	fh util.File // file handler of the kv-data file
 	r  *bufio.Reader
 
 	buf  []byte
@@ -1040,12 +1039,12 @@ type IndexReader struct {
 
 // NewIndexReader creates a index reader
 func NewIndexReader(file string) (*IndexReader, error) {
-	fh, err := os.Open(file)
+	fh, err := util.OpenFile(file)
 	if err != nil {
 		return nil, errors.Wrapf(err, "reading kv-data file")
 	}
 
-	r := bufio.NewReader(fh)
+	r := bufio.NewReader(util.NewFileReader(fh))
 
 	rdr := &IndexReader{
 		fh:   fh,
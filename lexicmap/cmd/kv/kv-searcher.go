@@ -26,7 +26,6 @@ import (
 	"io"
 	"math"
 	"math/bits"
-	"os"
 	"path/filepath"
 	"sync"
 
@@ -58,11 +57,16 @@ type Searcher struct {
 
 	searchKits chan *SearchKit
 	nWorkers   int
+
+	mmap *util.MmapFile // shared memory-mapped kv-data file, nil for not using mmap
+
+	cache *SeedCache // optional cache of decoded seed data, shared by Searchers of all chunks
 }
 
 // SearchKit contains a group of variables for calling Search() in parallel.
 type SearchKit struct {
-	fh      *os.File // file handler of the kv-data file
+	f       util.File     // file handler of the kv-data file, nil for using mmap
+	fh      io.ReadSeeker // reader of the kv-data file, or a reader of the memory-mapped data
 	r       *bufio.Reader
 	buf     []byte
 	buf2048 []uint8 // for parsing seed data
@@ -70,16 +74,23 @@ type SearchKit struct {
 
 // NewSearcher creates a new Searcher for the given kv-data file.
 func NewSearcher(file string, nWorkers int) (*Searcher, error) {
-	return newSearcher(file, nWorkers, nil)
+	return newSearcher(file, nWorkers, nil, false)
 }
 
 // NewSearcherWithMaskSelection creates a Searcher whose anchor tables are only
 // materialized for selected global mask indexes.
 func NewSearcherWithMaskSelection(file string, nWorkers int, selectedMasks []bool) (*Searcher, error) {
-	return newSearcher(file, nWorkers, selectedMasks)
+	return newSearcher(file, nWorkers, selectedMasks, false)
 }
 
-func newSearcher(file string, nWorkers int, selectedMasks []bool) (*Searcher, error) {
+// NewSearcherWithMmap creates a Searcher which maps the kv-data file into memory,
+// and all the nWorkers SearchKits share the mapping without their own file handlers.
+// selectedMasks could be nil for using all masks.
+func NewSearcherWithMmap(file string, nWorkers int, selectedMasks []bool) (*Searcher, error) {
+	return newSearcher(file, nWorkers, selectedMasks, true)
+}
+
+func newSearcher(file string, nWorkers int, selectedMasks []bool, useMmap bool) (*Searcher, error) {
 	if nWorkers < 1 {
 		nWorkers = 1
 	}
@@ -117,13 +128,28 @@ func newSearcher(file string, nWorkers int, selectedMasks []bool) (*Searcher, er
 		nWorkers: nWorkers,
 	}
 
-	for i := 0; i < nWorkers; i++ {
-		fh, err := os.Open(file)
+	if useMmap {
+		scr.mmap, err = util.OpenMmap(file)
 		if err != nil {
-			return nil, errors.Wrapf(err, "reading kv-data file")
+			return nil, errors.Wrapf(err, "mapping kv-data file")
+		}
+	}
+
+	var f util.File
+	var fh io.ReadSeeker
+	for i := 0; i < nWorkers; i++ {
+		if useMmap {
+			fh = io.NewSectionReader(scr.mmap, 0, int64(scr.mmap.Len()))
+		} else {
+			f, err = util.OpenFile(file)
+			if err != nil {
+				return nil, errors.Wrapf(err, "reading kv-data file")
+			}
+			fh = util.NewFileReader(f)
 		}
 
 		scr.searchKits <- &SearchKit{
+			f:       f,
 			fh:      fh,
 			buf:     make([]byte, 64),
 			buf2048: make([]uint8, seedPosBatchSize<<3), // 256*8
@@ -203,6 +229,10 @@ func (scr *Searcher) Search(kmers []uint64, p uint8, checkFlag bool, reversedKme
 		return nil, fmt.Errorf("the minimum prefix length should be in the range of [%d, %d]", scr.maskPrefix+scr.anchorPrefix, k)
 	}
 
+	if scr.cache != nil {
+		return scr.searchWithCache(kmers, nil, p, checkFlag, reversedKmer)
+	}
+
 	// checkMismatch := m >= 0 && m < int(k-p)
 	// m8 := uint8(m)
 
@@ -651,6 +681,10 @@ func (scr *Searcher) Search2(kmers []*[]uint64, p uint8, checkFlag bool, reverse
 		return nil, fmt.Errorf("the minimum prefix length should be in the range of [%d, %d]", scr.maskPrefix+scr.anchorPrefix, k)
 	}
 
+	if scr.cache != nil {
+		return scr.searchWithCache(nil, kmers, p, checkFlag, reversedKmer)
+	}
+
 	// checkMismatch := m >= 0 && m < int(k-p)
 	// m8 := uint8(m)
 
@@ -1089,10 +1123,17 @@ func (scr *Searcher) Search2(kmers []*[]uint64, p uint8, checkFlag bool, reverse
 
 // Close closes the searcher.
 func (scr *Searcher) Close() error {
+	if scr.mmap != nil {
+		for i := 0; i < scr.nWorkers; i++ {
+			<-scr.searchKits
+		}
+		return scr.mmap.Close()
+	}
+
 	var err error
 	for i := 0; i < scr.nWorkers; i++ {
 		spack := <-scr.searchKits
-		_err := spack.fh.Close()
+		_err := spack.f.Close()
 		if _err != nil {
 			err = _err
 		}
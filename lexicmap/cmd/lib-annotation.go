@@ -0,0 +1,328 @@
+// Copyright © 2023-2026 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+
+	"github.com/shenwei356/LexicMap/lexicmap/cmd/annotation"
+	"github.com/shenwei356/LexicMap/lexicmap/cmd/rangeindex"
+	"github.com/shenwei356/bio/seq"
+	"github.com/shenwei356/bio/seqio/fastx"
+)
+
+// reGenBankFile matches GenBank files.
+var reGenBankFile = regexp.MustCompile(`(?i)\.(gb|gbk|gbff|genbank)(\.gz|\.xz|\.zst|\.bz2|\.lz4)?$`)
+
+// extensions of GFF3 files alongside FASTA/Q files.
+var gffExts = []string{".gff3", ".gff"}
+var gffCompressionExts = []string{"", ".gz", ".xz", ".zst", ".bz2"}
+
+// findGFFFile returns the GFF3 file alongside a FASTA/Q file with the same prefix,
+// e.g., GCF_000017205.1_genomic.gff.gz for GCF_000017205.1_genomic.fna.gz.
+// An empty string is returned if not found.
+func findGFFFile(file string) string {
+	name, _, _ := filepathTrimExtension(filepath.Base(file), nil)
+	prefix := filepath.Join(filepath.Dir(file), name)
+	var f string
+	for _, ext := range gffExts {
+		for _, ext2 := range gffCompressionExts {
+			f = prefix + ext + ext2
+			if _, err := os.Stat(f); err == nil {
+				return f
+			}
+		}
+	}
+	return ""
+}
+
+// genomeSeqReader reads sequences of a genome from a FASTA/Q or GenBank file,
+// along with features in the GenBank file or the GFF3 file alongside.
+type genomeSeqReader struct {
+	fastxReader *fastx.Reader
+	gbReader    *annotation.GenBankReader
+
+	// sequence id -> features, nil for not saving annotations
+	Features map[string][]*annotation.Feature
+	GFFFile  string // the GFF3 file, empty for GenBank files or not found
+}
+
+// newGenomeSeqReader creates a genomeSeqReader.
+// Features of the given types are read if saveAnnotations is true.
+func newGenomeSeqReader(file string, saveAnnotations bool, types map[string]struct{}) (*genomeSeqReader, error) {
+	r := &genomeSeqReader{}
+	var err error
+
+	if reGenBankFile.MatchString(file) {
+		r.gbReader, err = annotation.NewGenBankReader(file, types)
+		if err != nil {
+			return nil, err
+		}
+		if saveAnnotations {
+			r.Features = make(map[string][]*annotation.Feature, 8)
+		}
+		return r, nil
+	}
+
+	r.fastxReader, err = fastx.NewReader(nil, file, "")
+	if err != nil {
+		return nil, err
+	}
+	if saveAnnotations {
+		r.GFFFile = findGFFFile(file)
+		if r.GFFFile != "" {
+			r.Features, err = annotation.ReadGFF3(r.GFFFile, types)
+			if err != nil {
+				r.fastxReader.Close()
+				return nil, err
+			}
+		}
+	}
+	return r, nil
+}
+
+// Read reads a sequence record.
+func (r *genomeSeqReader) Read() (*fastx.Record, error) {
+	if r.fastxReader != nil {
+		return r.fastxReader.Read()
+	}
+
+	gr, err := r.gbReader.Read()
+	if err != nil {
+		return nil, err
+	}
+	if r.Features != nil {
+		r.Features[string(gr.ID)] = gr.Features
+	}
+
+	name := gr.ID
+	if len(gr.Desc) > 0 {
+		name = make([]byte, 0, len(gr.ID)+len(gr.Desc)+1)
+		name = append(name, gr.ID...)
+		name = append(name, ' ')
+		name = append(name, gr.Desc...)
+	}
+	return fastx.NewRecordWithoutValidation(seq.DNAredundant, gr.ID, name, gr.Desc, bytes.ToUpper(gr.Seq))
+}
+
+// Close closes the reader.
+func (r *genomeSeqReader) Close() {
+	if r.fastxReader != nil {
+		r.fastxReader.Close()
+		return
+	}
+	r.gbReader.Close()
+}
+
+// SeqFeatures returns features of sequences of a genome (chunk), nil for no features.
+func (r *genomeSeqReader) SeqFeatures(seqIDs []*[]byte) [][]*annotation.Feature {
+	if len(r.Features) == 0 {
+		return nil
+	}
+	features := make([][]*annotation.Feature, len(seqIDs))
+	var n int
+	for i, seqid := range seqIDs {
+		features[i] = r.Features[string(*seqid)]
+		n += len(features[i])
+	}
+	if n == 0 {
+		return nil
+	}
+	return features
+}
+
+// ------------------------------------------------------------------------
+
+// AnnotationSearcher finds features overlapping with or nearest to hits.
+// It can not be used by multiple goroutines concurrently.
+type AnnotationSearcher struct {
+	layout *IndexLayout
+	rdrs   []*annotation.Reader // readers of genome batches, opened lazily
+	opened []bool
+
+	// features of sequences, which are cleared by Reset().
+	cache map[[3]int]*seqFeatures
+}
+
+// seqFeatures contains features of a sequence and an index of their start positions.
+type seqFeatures struct {
+	features []*annotation.Feature
+	ri       *rangeindex.RangeIndex // start position -> feature index
+	maxLen   uint32                 // the maximum feature length
+}
+
+// NewAnnotationSearcher creates an AnnotationSearcher of an index.
+func NewAnnotationSearcher(idx *Index) (*AnnotationSearcher, error) {
+	n := idx.info.GenomeBatches
+	s := &AnnotationSearcher{
+		layout: idx.layout,
+		rdrs:   make([]*annotation.Reader, n),
+		opened: make([]bool, n),
+		cache:  make(map[[3]int]*seqFeatures, 64),
+	}
+
+	// check the existence of annotation data
+	var err error
+	for i := 0; i < n; i++ {
+		if _, err = s.reader(i); err == nil {
+			return s, nil
+		}
+	}
+	return nil, fmt.Errorf("no annotation data found in the index, please build the index with --save-annotations")
+}
+
+// reader returns the reader of a genome batch, nil for batches without annotation data.
+func (s *AnnotationSearcher) reader(batch int) (*annotation.Reader, error) {
+	if s.opened[batch] {
+		return s.rdrs[batch], nil
+	}
+	s.opened[batch] = true
+
+	rdr, err := annotation.NewReader(filepath.Join(s.layout.GenomeDir(batch), FileAnnotations))
+	if err != nil {
+		return nil, err
+	}
+	s.rdrs[batch] = rdr
+	return rdr, nil
+}
+
+// Reset clears cached features, it should be called after processing the result of a query.
+func (s *AnnotationSearcher) Reset() {
+	for _, sf := range s.cache {
+		if sf.ri != nil {
+			sf.ri.Release()
+		}
+	}
+	clear(s.cache)
+}
+
+// Close closes all readers.
+func (s *AnnotationSearcher) Close() error {
+	s.Reset()
+	var err error
+	for _, rdr := range s.rdrs {
+		if rdr == nil {
+			continue
+		}
+		if err = rdr.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Features returns features overlapping with a region (1-based, closed interval) of a sequence,
+// with a distance of 0. If there are no overlapping features, the nearest feature is returned,
+// with the distance to it. -1 is returned if the sequence has no features.
+func (s *AnnotationSearcher) Features(batch, genomeIdx, seqIdx, start, end int, features []*annotation.Feature) ([]*annotation.Feature, int, error) {
+	key := [3]int{batch, genomeIdx, seqIdx}
+	sf, ok := s.cache[key]
+	if !ok {
+		sf = &seqFeatures{}
+		rdr, _ := s.reader(batch)
+		if rdr != nil {
+			var err error
+			sf.features, err = rdr.Features(genomeIdx, seqIdx, nil)
+			if err != nil {
+				return features, -1, err
+			}
+		}
+		if len(sf.features) > 0 {
+			sf.ri = rangeindex.NewRangeIndex()
+			for i, f := range sf.features {
+				sf.ri.Add(f.Start, uint32(i))
+				sf.maxLen = max(sf.maxLen, f.End-f.Start+1)
+			}
+		}
+		s.cache[key] = sf
+	}
+	if len(sf.features) == 0 {
+		return features, -1, nil
+	}
+
+	// features starting in [start - maxLen + 1, end]
+	left := uint32(1)
+	if uint32(start) > sf.maxLen {
+		left = uint32(start) - sf.maxLen + 1
+	}
+	var f *annotation.Feature
+	var v uint32
+	n := len(features)
+	for _, data := range sf.ri.Query(left, uint32(end)) {
+		_, v = rangeindex.Unpack(data)
+		if f = sf.features[v]; f.End >= uint32(start) {
+			features = append(features, f)
+		}
+	}
+	if len(features) > n {
+		return features, 0, nil
+	}
+
+	// the nearest one
+	var nearest *annotation.Feature
+	dist, d := math.MaxInt, 0
+	for _, f = range sf.features {
+		if int(f.End) < start {
+			d = start - int(f.End)
+		} else {
+			d = int(f.Start) - end
+		}
+		if d < dist {
+			nearest, dist = f, d
+		}
+	}
+	return append(features, nearest), dist, nil
+}
+
+// writeFeatureColumns writes columns of IDs, locus tags, and products of features,
+// and the distance. Multiple values are separated by ";", and empty values are shown as "-".
+func writeFeatureColumns(outfh *bufio.Writer, features []*annotation.Feature, dist int) {
+	if len(features) == 0 {
+		outfh.WriteString("\t-\t-\t-\t-1")
+		return
+	}
+
+	write := func(value func(f *annotation.Feature) string) {
+		outfh.WriteByte('\t')
+		var v string
+		for i, f := range features {
+			if i > 0 {
+				outfh.WriteByte(';')
+			}
+			if v = value(f); v == "" {
+				v = "-"
+			}
+			outfh.WriteString(v)
+		}
+	}
+	write(func(f *annotation.Feature) string { return f.ID })
+	write(func(f *annotation.Feature) string { return f.LocusTag })
+	write(func(f *annotation.Feature) string { return f.Product })
+	outfh.WriteByte('\t')
+	outfh.WriteString(strconv.Itoa(dist))
+}
@@ -0,0 +1,337 @@
+// Copyright © 2023-2026 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/shenwei356/LexicMap/lexicmap/cmd/kv"
+	"github.com/shenwei356/lexichash"
+)
+
+// BuildIndexBatch builds the index of one genome batch, which is used for
+// distributed indexing: genome batches are built independently on different
+// hosts with the same masks and parameters, and are merged with AssembleIndex.
+//
+// batch is the 0-based genome batch index and nBatches is the total number
+// of genome batches, both of which are saved in the index data.
+// A build manifest and a manifest of file sizes are written in the end,
+// the latter of which marks the batch as completed.
+func BuildIndexBatch(outdir string, infiles []string, batch int, nBatches int, opt *IndexBuildingOptions) error {
+	if nBatches < 1 || nBatches > 1<<BITS_BATCH_IDX {
+		return fmt.Errorf("invalid number of genome batches: %d, valid range: [1, %d]", nBatches, 1<<BITS_BATCH_IDX)
+	}
+	if batch < 0 || batch >= nBatches {
+		return fmt.Errorf("invalid genome batch index: %d, valid range: [0, %d]", batch, nBatches-1)
+	}
+	if len(infiles) > 1<<BITS_GENOME_IDX {
+		return fmt.Errorf("at most %d files supported in a genome batch, given: %d", 1<<BITS_GENOME_IDX, len(infiles))
+	}
+
+	// masks
+	lh, err := newLexicHash(opt)
+	if err != nil {
+		return err
+	}
+	maskPrefix, anchorPrefix := seedPrefixes(len(lh.Masks), opt.Partitions)
+
+	bm, err := newIndexBuildManifest(opt, infiles, nBatches)
+	if err != nil {
+		return fmt.Errorf("failed to create build manifest: %s", err)
+	}
+
+	// output failed genome
+	outputBigGenomes := opt.BigGenomeFile != ""
+	var outfhBG *os.File
+	var chBG chan string
+	var doneBG chan int
+	var nBG int
+	if outputBigGenomes {
+		outfhBG, err = os.Create(opt.BigGenomeFile)
+		if err != nil {
+			return fmt.Errorf("failed to write file: %s", opt.BigGenomeFile)
+		}
+
+		chBG = make(chan string, opt.NumCPUs)
+		doneBG = make(chan int)
+
+		go func() {
+			for r := range chBG {
+				nBG++
+				outfhBG.WriteString(r)
+			}
+
+			doneBG <- 1
+		}()
+	}
+
+	if opt.Verbose || opt.Log2File {
+		log.Info()
+		log.Infof("--------------------- [ building index ] ---------------------")
+	}
+
+	datas := make([]*map[uint64]*[]uint64, opt.Masks)
+	for i := 0; i < opt.Masks; i++ {
+		m := kv.PoolKmerData.Get().(*map[uint64]*[]uint64)
+		datas[i] = m
+	}
+
+	_, hasSomeGenomes := buildAnIndex(lh, maskPrefix, anchorPrefix, opt, &datas, outdir, infiles, batch, nBatches, outputBigGenomes, chBG)
+
+	if outputBigGenomes {
+		close(chBG)
+		<-doneBG
+		outfhBG.Close()
+		if opt.Verbose || opt.Log2File {
+			log.Infof("  finished saving %d skipped genome files: %s", nBG, opt.BigGenomeFile)
+		}
+	}
+
+	for _, data := range datas {
+		kv.RecycleKmerData(data)
+	}
+
+	if !hasSomeGenomes {
+		log.Warningf("no valid genomes in batch %d, it will be skipped in assembling", batch)
+	}
+
+	err = writeIndexBuildManifest(filepath.Join(outdir, FileBuildManifest), bm)
+	if err != nil {
+		return fmt.Errorf("failed to write build manifest: %s", err)
+	}
+
+	return saveIndexManifest(outdir, opt)
+}
+
+// reBatchDir matches the directory name of a genome batch.
+var reBatchDir = regexp.MustCompile(`^batch_(\d+)$`)
+
+// indexBatch is the index of a genome batch created by BuildIndexBatch.
+type indexBatch struct {
+	Dir      string
+	Batch    int // 0-based genome batch index
+	Info     *IndexInfo
+	Manifest *IndexBuildManifest
+	MaskSum  string // checksum of the mask file
+}
+
+// readIndexBatch checks the completeness of the index of a genome batch
+// and reads its information.
+func readIndexBatch(dir string) (*indexBatch, error) {
+	err := checkBatchIndex(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("directory not found")
+		}
+		return nil, fmt.Errorf("incomplete or broken: %s", err)
+	}
+
+	b := &indexBatch{Dir: dir}
+
+	b.Manifest, err = readIndexBuildManifest(filepath.Join(dir, FileBuildManifest))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf(`%s not found, was it created by "lexicmap index build-batch"?`, FileBuildManifest)
+		}
+		return nil, fmt.Errorf("failed to read build manifest: %s", err)
+	}
+
+	b.Info, err = readIndexInfo(filepath.Join(dir, FileInfo))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read info file: %s", err)
+	}
+
+	// the genome batch index is only recorded in the name of the genome data directory
+	dirs, err := os.ReadDir(filepath.Join(dir, DirGenomes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read genome directory: %s", err)
+	}
+	b.Batch = -1
+	for _, d := range dirs {
+		if !d.IsDir() || !reBatchDir.MatchString(d.Name()) {
+			continue
+		}
+		if b.Batch >= 0 {
+			return nil, fmt.Errorf("more than one genome batch found, was it merged?")
+		}
+		b.Batch, _ = strconv.Atoi(reBatchDir.FindStringSubmatch(d.Name())[1])
+	}
+	if b.Batch < 0 {
+		return nil, fmt.Errorf("no genome data found")
+	}
+
+	b.MaskSum, _, err = fileChecksum(filepath.Join(dir, FileMasks))
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute checksum of mask file: %s", err)
+	}
+
+	return b, nil
+}
+
+// batchSettings returns a copy of the build manifest with values varying
+// between genome batches cleared, for checking the consistency of batches.
+func (b *indexBatch) batchSettings() *IndexBuildManifest {
+	m := *b.Manifest
+	m.RandSeed = 0
+	m.MaskFile = ""
+	m.MaskFileSum = b.MaskSum // checksum of the masks used in the batch
+	m.GenomeBatchSize = 0
+	m.InputFiles = 0
+	m.InputFilesSum = ""
+	return &m
+}
+
+// AssembleIndex merges indexes of genome batches created by BuildIndexBatch
+// into the final index. The batches must share the same masks and parameters,
+// and all genome batches must be given.
+//
+// Genome data and masks are hard-linked, or copied across file systems,
+// from the batch directories to the final index, so the batch directories are left intact.
+func AssembleIndex(outdir string, dirs []string, opt *IndexBuildingOptions) error {
+	// ----------------------------------
+	// check batches
+
+	if opt.Verbose || opt.Log2File {
+		log.Infof("checking %d genome batches ...", len(dirs))
+	}
+
+	batches := make([]*indexBatch, 0, len(dirs))
+	for _, dir := range dirs {
+		b, err := readIndexBatch(dir)
+		if err != nil {
+			return fmt.Errorf("invalid genome batch %s: %s", dir, err)
+		}
+		batches = append(batches, b)
+	}
+	if len(batches) == 0 {
+		return fmt.Errorf("no genome batches given")
+	}
+
+	sort.Slice(batches, func(i, j int) bool { return batches[i].Batch < batches[j].Batch })
+
+	first := batches[0].batchSettings()
+	nBatches := first.GenomeBatches
+	for i, b := range batches {
+		if i > 0 {
+			if b.Batch == batches[i-1].Batch {
+				return fmt.Errorf("duplicated genome batch %d: %s, %s", b.Batch, batches[i-1].Dir, b.Dir)
+			}
+
+			diffs, err := b.batchSettings().diff(first)
+			if err != nil {
+				return err
+			}
+			if len(diffs) > 0 {
+				return fmt.Errorf("genome batch %s is not compatible with %s, differences:\n  %s",
+					b.Dir, batches[0].Dir, strings.Join(diffs, "\n  "))
+			}
+		}
+
+		if b.Batch >= nBatches {
+			return fmt.Errorf("genome batch index (%d) of %s exceeds the number of batches: %d", b.Batch, b.Dir, nBatches)
+		}
+	}
+
+	if len(batches) < nBatches {
+		missing := make([]string, 0, nBatches-len(batches))
+		var j int
+		for i := 0; i < nBatches; i++ {
+			if j < len(batches) && batches[j].Batch == i {
+				j++
+				continue
+			}
+			missing = append(missing, strconv.Itoa(i))
+		}
+		return fmt.Errorf("%d of %d genome batches missing: %s", len(missing), nBatches, strings.Join(missing, ", "))
+	}
+
+	// only merge indexes with valid genomes
+	paths := make([]string, 0, len(batches))
+	for _, b := range batches {
+		if b.Info.Genomes == 0 {
+			if opt.Verbose || opt.Log2File {
+				log.Infof("  genome batch %d has no valid genomes, skipped: %s", b.Batch, b.Dir)
+			}
+			continue
+		}
+		paths = append(paths, b.Dir)
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("no valid genomes in all genome batches")
+	}
+
+	if opt.Verbose || opt.Log2File {
+		log.Infof("  %d genome batches checked", len(batches))
+	}
+
+	// ----------------------------------
+	// prepare arguments for mergeIndexes
+
+	lh, err := lexichash.NewFromFile(filepath.Join(paths[0], FileMasks))
+	if err != nil {
+		return fmt.Errorf("failed to read masks: %s", err)
+	}
+
+	_, _, _, maskPrefix, anchorPrefix, err := kv.ReadKVIndexInfo(filepath.Join(paths[0], DirSeeds, chunkFile(0)) + kv.KVIndexFileExt)
+	if err != nil {
+		return fmt.Errorf("failed to read seed information: %s", err)
+	}
+
+	kvChunks := batches[0].Info.Chunks
+	if opt.MergeThreads > kvChunks {
+		opt.MergeThreads = kvChunks
+	}
+
+	tmpDir := filepath.Clean(outdir) + ExtTmpDir
+	err = os.RemoveAll(tmpDir)
+	if err != nil {
+		return err
+	}
+
+	// ----------------------------------
+	// merge
+
+	if opt.Verbose || opt.Log2File {
+		log.Info()
+		log.Infof("merging %d indexes...", len(paths))
+	}
+	runtime.GC()
+
+	err = mergeIndexes(lh, maskPrefix, anchorPrefix, opt, kvChunks, outdir, paths, tmpDir, 1, true)
+	if err != nil {
+		return fmt.Errorf("failed to merge indexes: %s", err)
+	}
+
+	// clean tmp dir
+	err = os.RemoveAll(tmpDir)
+	if err != nil {
+		return fmt.Errorf("failed to remove tmp directory: %s", err)
+	}
+
+	return saveIndexManifest(outdir, opt)
+}
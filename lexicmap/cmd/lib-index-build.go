@@ -36,6 +36,7 @@ import (
 	"time"
 
 	"github.com/pelletier/go-toml/v2"
+	"github.com/shenwei356/LexicMap/lexicmap/cmd/annotation"
 	"github.com/shenwei356/LexicMap/lexicmap/cmd/genome"
 	"github.com/shenwei356/LexicMap/lexicmap/cmd/kv"
 	"github.com/shenwei356/LexicMap/lexicmap/cmd/seedposition"
@@ -79,6 +80,9 @@ const FileGenomes = "genomes.bin"
 // FileSeedPositions is the name of seed position file
 const FileSeedPositions = "seed_positions.bin"
 
+// FileAnnotations is the name of genome annotation file
+const FileAnnotations = "annotations.bin"
+
 // FileInfo is the summary file
 const FileInfo = "info.toml"
 
@@ -105,8 +109,10 @@ type IndexBuildingOptions struct {
 	Verbose      bool // show log
 	Log2File     bool // log file
 	Force        bool // force overwrite existed index
+	Resume       bool // resume an interrupted job, skipping completed genome batches
 	MaxOpenFiles int  // maximum opened files, used in merging indexes
 	MergeThreads int  // Maximum Concurrent Merge Jobs
+	Checksums    bool // compute SHA-256 checksums of index files in the manifest
 
 	MinSeqLen int // minimum sequence length, should be >= k
 
@@ -150,10 +156,14 @@ type IndexBuildingOptions struct {
 	ReRefName    *regexp.Regexp   // for extracting genome id from the file name
 	ReSeqExclude []*regexp.Regexp // for excluding sequences according to name pattern
 
-	ContigInterval int // the length of N's between contigs
+	ContigInterval  int // the length of N's between contigs
+	GenomeBlockSize int // the size of uncompressed blocks of genome data, 0 for not compressed
 
 	SaveSeedPositions bool
 
+	SaveAnnotations bool     // save features from GFF3 files alongside FASTA/Q files or GenBank files
+	AnnotationTypes []string // feature types to save, empty for all
+
 	Debug bool
 }
 
@@ -201,22 +211,16 @@ func CheckIndexBuildingOptions(opt *IndexBuildingOptions) error {
 	return nil
 }
 
-// BuildIndex builds index from a list of input files
-func BuildIndex(outdir string, infiles []string, opt *IndexBuildingOptions) error {
-	// they are already checked.
-	//
-	// check options
-	// err := CheckIndexBuildingOptions(opt)
-	// if err != nil {
-	// 	return err
-	// }
-
+// newLexicHash generates masks or reads them from the mask file,
+// and creates lookup tables for faster masking.
+// A mask file with the extension of ".bin" is treated as the binary mask file
+// of an index (masks.bin), otherwise a text file generated by "lexicmap utils masks".
+func newLexicHash(opt *IndexBuildingOptions) (*lexichash.LexicHash, error) {
 	if opt.Verbose || opt.Log2File {
 		log.Info()
 		log.Infof("--------------------- [ generating masks ] ---------------------")
 	}
 
-	// generate masks
 	var lh *lexichash.LexicHash
 	var err error
 
@@ -225,26 +229,53 @@ func BuildIndex(outdir string, infiles []string, opt *IndexBuildingOptions) erro
 			log.Info()
 			log.Infof("reading masks from file: %s", opt.MaskFile)
 		}
-		lh, err = lexichash.NewFromTextFile(opt.MaskFile)
-		checkError(err)
+		if filepath.Ext(opt.MaskFile) == ".bin" {
+			lh, err = lexichash.NewFromFile(opt.MaskFile)
+		} else {
+			lh, err = lexichash.NewFromTextFile(opt.MaskFile)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read masks: %s", err)
+		}
 		if len(lh.Masks) < 64 {
-			return fmt.Errorf("invalid numer of masks: %d, should be >=64", opt.Masks)
+			return nil, fmt.Errorf("invalid numer of masks: %d, should be >=64", len(lh.Masks))
 		}
 		opt.K = lh.K
+		opt.Masks = len(lh.Masks)
 	} else {
 		lh, err = lexichash.NewWithSeed(opt.K, opt.Masks, opt.RandSeed, 0)
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
 	if opt.SoftMasking {
 		lh.SupportSoftMasking()
 	}
 
-	// ----------------------------------
+	// create a lookup table for faster masking
+	lenPrefix := 1
+	for 1<<(lenPrefix<<1) <= len(lh.Masks) {
+		lenPrefix++
+	}
+	lenPrefix--
+	err = lh.IndexMasks(lenPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("indexing masks: %s", err)
+	}
+	err = lh.IndexMasksWithDistinctPrefixes(lenPrefix + 1)
+	if err != nil {
+		return nil, fmt.Errorf("indexing masks for distinct prefixes: %s", err)
+	}
+
+	return lh, nil
+}
+
+// seedPrefixes returns the mask prefix length and anchor prefix length
+// for indexing seeds data.
+func seedPrefixes(nMasks int, partitions int) (uint8, uint8) {
 	// mask prefix length
 	maskPrefix := 1
-	for 1<<(maskPrefix<<1) <= len(lh.Masks) {
+	for 1<<(maskPrefix<<1) <= nMasks {
 		maskPrefix++
 	}
 	maskPrefix--
@@ -253,7 +284,6 @@ func BuildIndex(outdir string, infiles []string, opt *IndexBuildingOptions) erro
 	}
 
 	anchorPrefix := 0
-	partitions := opt.Partitions
 	for partitions > 0 {
 		partitions >>= 2
 		anchorPrefix++
@@ -263,6 +293,55 @@ func BuildIndex(outdir string, infiles []string, opt *IndexBuildingOptions) erro
 		anchorPrefix = 1
 	}
 
+	return uint8(maskPrefix), uint8(anchorPrefix)
+}
+
+// BuildIndex builds index from a list of input files
+func BuildIndex(outdir string, infiles []string, opt *IndexBuildingOptions) error {
+	// they are already checked.
+	//
+	// check options
+	// err := CheckIndexBuildingOptions(opt)
+	// if err != nil {
+	// 	return err
+	// }
+
+	if opt.Verbose || opt.Log2File {
+		log.Info()
+		log.Infof("--------------------- [ generating masks ] ---------------------")
+	}
+
+	// generate masks
+	lh, err := newLexicHash(opt)
+	if err != nil {
+		return err
+	}
+	maskPrefix, anchorPrefix := seedPrefixes(len(lh.Masks), opt.Partitions)
+
+	// split the files in to batches
+	nFiles := len(infiles)
+	nBatches := (nFiles + opt.GenomeBatchSize - 1) / opt.GenomeBatchSize
+	tmpIndexes := make([]string, 0, nBatches)
+	if nBatches > 1<<BITS_BATCH_IDX { // 1<<17
+		checkError(fmt.Errorf("at most %d batches supported. current: %d", 1<<BITS_BATCH_IDX, nBatches))
+	}
+
+	// tmp dir
+	tmpDir := filepath.Clean(outdir) + ExtTmpDir
+	// flags of completed batches of an interrupted job
+	var completed []bool
+	if nBatches > 1 { // only used for > 1 batches
+		completed, err = prepareBatchesDir(tmpDir, opt, infiles, nBatches)
+		if err != nil {
+			checkError(fmt.Errorf("failed to prepare the temporary directory: %s", err))
+		}
+	} else {
+		err = os.RemoveAll(tmpDir)
+		if err != nil {
+			return err
+		}
+	}
+
 	// output failed genome
 	outputBigGenomes := opt.BigGenomeFile != ""
 	var outfhBG *os.File
@@ -270,10 +349,32 @@ func BuildIndex(outdir string, infiles []string, opt *IndexBuildingOptions) erro
 	var doneBG chan int
 	var nBG int
 	if outputBigGenomes {
+		// keep records of completed batches
+		var records []string
+		if slices.Contains(completed, true) {
+			files := make(map[string]struct{}, opt.GenomeBatchSize)
+			for batch, ok := range completed {
+				if !ok {
+					continue
+				}
+				for _, file := range infiles[batch*opt.GenomeBatchSize : min((batch+1)*opt.GenomeBatchSize, nFiles)] {
+					files[file] = struct{}{}
+				}
+			}
+			records, err = readSkippedGenomes(opt.BigGenomeFile, files)
+			if err != nil {
+				checkError(fmt.Errorf("failed to read file: %s", opt.BigGenomeFile))
+			}
+		}
+
 		outfhBG, err = os.Create(opt.BigGenomeFile)
 		if err != nil {
 			checkError(fmt.Errorf("failed to write file: %s", opt.BigGenomeFile))
 		}
+		for _, r := range records {
+			nBG++
+			outfhBG.WriteString(r)
+		}
 
 		chBG = make(chan string, opt.NumCPUs)
 		doneBG = make(chan int)
@@ -288,21 +389,6 @@ func BuildIndex(outdir string, infiles []string, opt *IndexBuildingOptions) erro
 		}()
 	}
 
-	// create a lookup table for faster masking
-	lenPrefix := 1
-	for 1<<(lenPrefix<<1) <= len(lh.Masks) {
-		lenPrefix++
-	}
-	lenPrefix--
-	err = lh.IndexMasks(lenPrefix)
-	if err != nil {
-		checkError(fmt.Errorf("indexing masks: %s", err))
-	}
-	err = lh.IndexMasksWithDistinctPrefixes(lenPrefix + 1)
-	if err != nil {
-		checkError(fmt.Errorf("indexing masks for distinct prefixes: %s", err))
-	}
-
 	// save mask later
 
 	if opt.Verbose || opt.Log2File {
@@ -316,26 +402,6 @@ func BuildIndex(outdir string, infiles []string, opt *IndexBuildingOptions) erro
 		datas[i] = m
 	}
 
-	// split the files in to batches
-	nFiles := len(infiles)
-	nBatches := (nFiles + opt.GenomeBatchSize - 1) / opt.GenomeBatchSize
-	tmpIndexes := make([]string, 0, nBatches)
-
-	// tmp dir
-	tmpDir := filepath.Clean(outdir) + ExtTmpDir
-	err = os.RemoveAll(tmpDir)
-	if err != nil {
-		return err
-	}
-	if nBatches > 1 { // only used for > 1 batches
-		err = os.MkdirAll(tmpDir, 0755)
-		if err != nil {
-			checkError(fmt.Errorf("failed to create dir: %s", err))
-		}
-	} else if nBatches > 1<<BITS_BATCH_IDX { // 1<<17
-		checkError(fmt.Errorf("at most %d batches supported. current: %d", 1<<BITS_BATCH_IDX, nBatches))
-	}
-
 	if nBatches > 512 {
 		log.Warningf("batches > 512: %d, you might increase batch size (-b) for ~5%% smaller index size and better query performance", nBatches)
 	}
@@ -360,8 +426,28 @@ func BuildIndex(outdir string, infiles []string, opt *IndexBuildingOptions) erro
 			outdirB = outdir
 		}
 
-		// build index for this batch
-		kvChunks, hasSomeGenomes = buildAnIndex(lh, uint8(maskPrefix), uint8(anchorPrefix), opt, &datas, outdirB, files, batch, nBatches, outputBigGenomes, chBG)
+		if nBatches > 1 && completed[batch] { // completed in the interrupted job
+			var info *IndexInfo
+			info, err = readIndexInfo(filepath.Join(outdirB, FileInfo))
+			if err != nil {
+				checkError(fmt.Errorf("failed to read info file: %s", err))
+			}
+			kvChunks, hasSomeGenomes = info.Chunks, info.Genomes > 0
+			if opt.Verbose || opt.Log2File {
+				log.Info()
+				log.Infof("  batch %d/%d was completed in the interrupted job, skipped", batch+1, nBatches)
+			}
+		} else {
+			// build index for this batch
+			kvChunks, hasSomeGenomes = buildAnIndex(lh, maskPrefix, anchorPrefix, opt, &datas, outdirB, files, batch, nBatches, outputBigGenomes, chBG)
+
+			if nBatches > 1 { // mark the batch as completed, only with file sizes for a fast checking in resuming
+				err = writeIndexManifest(outdirB, opt.NumCPUs, false)
+				if err != nil {
+					checkError(fmt.Errorf("failed to write manifest file: %s", err))
+				}
+			}
+		}
 
 		if nBatches > 1 && hasSomeGenomes { // only merge indexes with valid genomes
 			tmpIndexes = append(tmpIndexes, outdirB)
@@ -383,7 +469,7 @@ func BuildIndex(outdir string, infiles []string, opt *IndexBuildingOptions) erro
 	}
 
 	if nBatches == 1 {
-		return nil
+		return saveIndexManifest(outdir, opt)
 	}
 
 	runtime.GC()
@@ -393,7 +479,7 @@ func BuildIndex(outdir string, infiles []string, opt *IndexBuildingOptions) erro
 		log.Info()
 		log.Infof("merging %d indexes...", len(tmpIndexes))
 	}
-	err = mergeIndexes(lh, uint8(maskPrefix), uint8(anchorPrefix), opt, kvChunks, outdir, tmpIndexes, tmpDir, 1)
+	err = mergeIndexes(lh, maskPrefix, anchorPrefix, opt, kvChunks, outdir, tmpIndexes, tmpDir, 1, false)
 	if err != nil {
 		return fmt.Errorf("failed to merge indexes: %s", err)
 	}
@@ -404,7 +490,7 @@ func BuildIndex(outdir string, infiles []string, opt *IndexBuildingOptions) erro
 		checkError(fmt.Errorf("failed to remove tmp directory: %s", err))
 	}
 
-	return err
+	return saveIndexManifest(outdir, opt)
 }
 
 // ----------------------------------
@@ -559,7 +645,12 @@ func buildAnIndex(lh *lexichash.LexicHash, maskPrefix uint8, anchorPrefix uint8,
 
 	// genome writer
 	fileGenomes := filepath.Join(dirGenomes, FileGenomes)
-	gw, err := genome.NewWriter(fileGenomes, uint32(batch))
+	var gw *genome.Writer
+	if opt.GenomeBlockSize > 0 {
+		gw, err = genome.NewCompressedWriter(fileGenomes, uint32(batch), opt.GenomeBlockSize)
+	} else {
+		gw, err = genome.NewWriter(fileGenomes, uint32(batch))
+	}
 	if err != nil {
 		checkError(fmt.Errorf("failed to write genome file: %s", err))
 	}
@@ -576,6 +667,39 @@ func buildAnIndex(lh *lexichash.LexicHash, maskPrefix uint8, anchorPrefix uint8,
 		}
 	}
 
+	// annotations
+	var annw *annotation.Writer
+	var annTypes map[string]struct{}
+	if opt.SaveAnnotations {
+		annw, err = annotation.NewWriter(filepath.Join(dirGenomes, FileAnnotations), uint32(batch))
+		if err != nil {
+			checkError(fmt.Errorf("failed to write annotation file: %s", err))
+		}
+
+		annTypes = make(map[string]struct{}, len(opt.AnnotationTypes))
+		for _, t := range opt.AnnotationTypes {
+			annTypes[t] = struct{}{}
+		}
+	}
+	// genome (chunk) -> features of its sequences
+	mFeatures := make(map[*genome.Genome][][]*annotation.Feature, opt.NumCPUs)
+	var muFeatures sync.Mutex
+	var nAnnotated int // the number of genomes (chunks) with features
+
+	// saveFeatures saves features of sequences of a genome (chunk) before sending it to mask
+	saveFeatures := func(refseq *genome.Genome, rdr *genomeSeqReader) {
+		if !opt.SaveAnnotations {
+			return
+		}
+		features := rdr.SeqFeatures(refseq.SeqIDs)
+		if features == nil {
+			return
+		}
+		muFeatures.Lock()
+		mFeatures[refseq] = features
+		muFeatures.Unlock()
+	}
+
 	// 2.2) write genomes to file
 	var nFiles int // the total number of indexed files
 	var totalBases int64
@@ -601,6 +725,23 @@ func buildAnIndex(lh *lexichash.LexicHash, maskPrefix uint8, anchorPrefix uint8,
 				}
 			}
 
+			// --------------------------------
+			// annotations
+			if opt.SaveAnnotations {
+				muFeatures.Lock()
+				features := mFeatures[refseq]
+				delete(mFeatures, refseq)
+				muFeatures.Unlock()
+
+				err = annw.Write(features)
+				if err != nil {
+					checkError(fmt.Errorf("failed to write annotations: %s", err))
+				}
+				if features != nil {
+					nAnnotated++
+				}
+			}
+
 			if debug {
 				log.Debugf("batch: %d, file #%d, genome data saved: %s", batch, refseq.GenomeIdx, refseq.ID)
 				log.Info()
@@ -1515,12 +1656,18 @@ func buildAnIndex(lh *lexichash.LexicHash, maskPrefix uint8, anchorPrefix uint8,
 			// --------------------------------
 			// read sequence
 
-			fastxReader, err := fastx.NewReader(nil, file, "")
+			fastxReader, err := newGenomeSeqReader(file, opt.SaveAnnotations, annTypes)
 			if err != nil {
 				checkError(fmt.Errorf("failed to read seq file: %s", err))
 			}
 			defer fastxReader.Close()
 
+			if debug && opt.SaveAnnotations && fastxReader.GFFFile != "" {
+				log.Debugf("batch: %d, file #%d: %s, %d sequences with features read from: %s",
+					batch, iFile, file, len(fastxReader.Features), fastxReader.GFFFile)
+				log.Info()
+			}
+
 			var record *fastx.Record
 
 			var ignoreSeq bool
@@ -1638,6 +1785,7 @@ func buildAnIndex(lh *lexichash.LexicHash, maskPrefix uint8, anchorPrefix uint8,
 					}
 
 					// send to mask
+					saveFeatures(refseq, fastxReader)
 					genomesMask <- refseq
 
 					chunks++
@@ -1762,6 +1910,7 @@ func buildAnIndex(lh *lexichash.LexicHash, maskPrefix uint8, anchorPrefix uint8,
 			}
 
 			// send to mask
+			saveFeatures(refseq, fastxReader)
 			genomesMask <- refseq
 
 		}(file, iFileBase+iFile)
@@ -1782,6 +1931,12 @@ func buildAnIndex(lh *lexichash.LexicHash, maskPrefix uint8, anchorPrefix uint8,
 	if opt.SaveSeedPositions {
 		checkError(locw.Close())
 	}
+	if opt.SaveAnnotations {
+		checkError(annw.Close())
+		if opt.Verbose || opt.Log2File {
+			log.Infof("  annotations of %d genomes (chunks) saved", nAnnotated)
+		}
+	}
 
 	// genome chunk lists
 	fileGenomeChunks := filepath.Join(outdir, FileGenomeChunks)
@@ -1839,6 +1994,7 @@ func buildAnIndex(lh *lexichash.LexicHash, maskPrefix uint8, anchorPrefix uint8,
 			GenomeBatchSize: nFiles, // just for this batch
 			GenomeBatches:   1,      // just for this batch
 			ContigInterval:  opt.ContigInterval,
+			GenomeBlockSize: opt.GenomeBlockSize,
 
 			SoftMaksing: opt.SoftMasking,
 			MaxKmerFreq: opt.MaxKmerFreq,
@@ -1927,8 +2083,13 @@ type IndexInfo struct {
 	GenomeBatchSize  int   `toml:"genome-batch-size"`
 	GenomeBatches    int   `toml:"genome-batches"`
 	ContigInterval   int   `toml:"contig-interval"`
+	GenomeBlockSize  int   `toml:"genome-block-size,omitempty" comment:"Size of uncompressed blocks of block-compressed genome data (0 for not compressed)."`
 	SoftMaksing      bool  `toml:"soft-masking" comment:"Lowercase bases in soft-masked low-complexity regions are treated as A's and are not seeded,\nwhile they are saved for base-level alignment."`
 	MaxKmerFreq      int   `toml:"max-kmer-freq" comment:"If a mask captures the same k-mer at more than N positions of a genome,\nonly the first N positions are retained. (0 for no filtering)"`
+
+	Shards      []string `toml:"shards,omitempty" comment:"Shard roots for placing seed chunks and genome batches on multiple storage volumes.\nShards of seed chunks and genome batches: 0 for the index directory, i for the i-th shard root."`
+	ChunkShards []int    `toml:"seed-chunk-shards,omitempty"`
+	BatchShards []int    `toml:"genome-batch-shards,omitempty"`
 }
 
 // writeIndexInfo writes summary of one index
@@ -0,0 +1,310 @@
+// Copyright © 2023-2026 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FileManifest is the manifest file of index files, with sizes and optional SHA-256 checksums.
+// info.toml is not included, as it might be updated by other commands.
+const FileManifest = "manifest.tsv"
+
+// noChecksum is the placeholder of checksums in the manifest when they are not computed.
+const noChecksum = "-"
+
+// IndexFileRecord is a record of an index file in the manifest.
+type IndexFileRecord struct {
+	File     string // relative path in the index directory, with "/" as the separator
+	Size     int64
+	Checksum string // SHA-256, in hexadecimal, or noChecksum
+}
+
+// HasChecksum tells if the checksum of the file is recorded.
+func (r *IndexFileRecord) HasChecksum() bool {
+	return r.Checksum != noChecksum
+}
+
+// indexFilesForManifest returns relative paths of all index files written by BuildIndex.
+func indexFilesForManifest(dir string) ([]string, error) {
+	files := make([]string, 0, 1024)
+
+	layout, err := manifestIndexLayout(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	// seeds and genomes might be placed in multiple shard roots
+	err = layout.Walk(func(file string, _ string, _ fs.DirEntry) error {
+		switch {
+		case file == FileMasks, file == FileGenomeIndex, file == FileGenomeChunks,
+			strings.HasPrefix(file, DirSeeds+"/"), strings.HasPrefix(file, DirGenomes+"/"):
+			files = append(files, file)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slices.Sort(files)
+	return files, nil
+}
+
+// manifestIndexLayout returns the layout of an index for locating index files.
+// A directory without the info file, e.g., a temporary index, is treated as unsharded.
+func manifestIndexLayout(dir string) (*IndexLayout, error) {
+	_, err := os.Stat(filepath.Join(dir, FileInfo))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &IndexLayout{Dir: dir, Roots: []string{dir}}, nil
+		}
+		return nil, err
+	}
+
+	layout, _, err := ReadIndexLayout(dir)
+	return layout, err
+}
+
+// fileChecksum computes the SHA-256 checksum of a file.
+func fileChecksum(file string) (string, int64, error) {
+	fh, err := os.Open(file)
+	if err != nil {
+		return "", 0, err
+	}
+	defer fh.Close()
+
+	h := sha256.New()
+	n, err := io.CopyBuffer(h, fh, make([]byte, 1<<20))
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+// computeIndexFileRecords computes sizes and optional checksums of index files in parallel.
+func computeIndexFileRecords(dir string, files []string, threads int, checksum bool) ([]*IndexFileRecord, error) {
+	if threads < 1 {
+		threads = 1
+	}
+	layout, err := manifestIndexLayout(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]*IndexFileRecord, len(files))
+	errs := make([]error, len(files))
+
+	var wg sync.WaitGroup
+	tokens := make(chan int, threads)
+	for i, file := range files {
+		wg.Add(1)
+		tokens <- 1
+		go func(i int, file string) {
+			defer func() {
+				wg.Done()
+				<-tokens
+			}()
+
+			if !checksum {
+				fi, err := os.Stat(layout.File(file))
+				if err != nil {
+					errs[i] = err
+					return
+				}
+				records[i] = &IndexFileRecord{File: file, Size: fi.Size(), Checksum: noChecksum}
+				return
+			}
+
+			sum, size, err := fileChecksum(layout.File(file))
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			records[i] = &IndexFileRecord{File: file, Size: size, Checksum: sum}
+		}(i, file)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return records, nil
+}
+
+// writeIndexManifest computes sizes and optional checksums of all index files,
+// and writes the manifest file.
+func writeIndexManifest(dir string, threads int, checksum bool) error {
+	files, err := indexFilesForManifest(dir)
+	if err != nil {
+		return err
+	}
+
+	records, err := computeIndexFileRecords(dir, files, threads, checksum)
+	if err != nil {
+		return err
+	}
+
+	return writeIndexManifestFile(filepath.Join(dir, FileManifest), records)
+}
+
+// updateIndexManifest recomputes sizes and checksums of some updated index files (relative paths),
+// only if the manifest file exists. Checksums are computed only if they are recorded in the manifest.
+func updateIndexManifest(dir string, files []string, threads int) error {
+	fileManifest := filepath.Join(dir, FileManifest)
+	_, err := os.Stat(fileManifest)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	records, err := readIndexManifest(fileManifest)
+	if err != nil {
+		return err
+	}
+
+	checksum := slices.ContainsFunc(records, (*IndexFileRecord).HasChecksum)
+	updated, err := computeIndexFileRecords(dir, files, threads, checksum)
+	if err != nil {
+		return err
+	}
+
+	m := make(map[string]int, len(records))
+	for i, r := range records {
+		m[r.File] = i
+	}
+	for _, r := range updated {
+		if i, ok := m[r.File]; ok {
+			records[i] = r
+		} else {
+			records = append(records, r)
+		}
+	}
+	slices.SortFunc(records, func(a, b *IndexFileRecord) int {
+		return strings.Compare(a.File, b.File)
+	})
+
+	return writeIndexManifestFile(fileManifest, records)
+}
+
+// writeIndexManifestFile writes the manifest records to a temporary file and renames it,
+// so an existing manifest file is always complete, and it can be used as a completion marker.
+func writeIndexManifestFile(file string, records []*IndexFileRecord) error {
+	tmp := file + ".tmp"
+	fh, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(fh)
+
+	fmt.Fprintf(w, "file\tsize\tsha256\n")
+	for _, r := range records {
+		fmt.Fprintf(w, "%s\t%d\t%s\n", r.File, r.Size, r.Checksum)
+	}
+
+	if err = w.Flush(); err != nil {
+		fh.Close()
+		return err
+	}
+	if err = fh.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, file)
+}
+
+// readIndexManifest reads the manifest file.
+func readIndexManifest(file string) ([]*IndexFileRecord, error) {
+	fh, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	records := make([]*IndexFileRecord, 0, 1024)
+	scanner := bufio.NewScanner(fh)
+	var line string
+	var items []string
+	var header = true
+	for scanner.Scan() {
+		line = strings.TrimRight(scanner.Text(), "\r\n")
+		if line == "" {
+			continue
+		}
+		if header {
+			header = false
+			continue
+		}
+
+		items = strings.Split(line, "\t")
+		if len(items) != 3 {
+			return nil, fmt.Errorf("invalid manifest record: %s", line)
+		}
+		size, err := strconv.ParseInt(items[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid file size in manifest record: %s", line)
+		}
+		records = append(records, &IndexFileRecord{File: items[0], Size: size, Checksum: items[2]})
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// saveIndexManifest writes the manifest file after building an index.
+// SHA-256 checksums are computed unless opt.Checksums is false.
+func saveIndexManifest(outdir string, opt *IndexBuildingOptions) error {
+	if opt.Verbose || opt.Log2File {
+		log.Info()
+		if opt.Checksums {
+			log.Infof("computing sizes and checksums of index files...")
+		} else {
+			log.Infof("recording sizes of index files...")
+		}
+	}
+	timeStart := time.Now()
+
+	err := writeIndexManifest(outdir, opt.NumCPUs, opt.Checksums)
+	if err != nil {
+		return fmt.Errorf("failed to write manifest file: %s", err)
+	}
+
+	if opt.Verbose || opt.Log2File {
+		log.Infof("  finished writing manifest file in %s: %s", time.Since(timeStart), filepath.Join(outdir, FileManifest))
+	}
+	return nil
+}
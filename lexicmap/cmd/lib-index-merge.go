@@ -36,9 +36,11 @@ import (
 	"github.com/shenwei356/lexichash"
 )
 
-// mergeIndexes merge multiple indexes to a big one
+// mergeIndexes merge multiple indexes to a big one.
+// With keepInputs, genome data and masks are hard-linked or copied from the input indexes
+// rather than being moved, so the input indexes are left intact.
 func mergeIndexes(lh *lexichash.LexicHash, maskPrefix uint8, anchorPrefix uint8, opt *IndexBuildingOptions, kvChunks int,
-	outdir string, paths []string, tmpDir string, round int) error {
+	outdir string, paths []string, tmpDir string, round int, keepInputs bool) error {
 	timeStart := time.Now()
 	if opt.Verbose || opt.Log2File {
 		log.Infof("  [round %d]", round)
@@ -59,6 +61,12 @@ func mergeIndexes(lh *lexichash.LexicHash, maskPrefix uint8, anchorPrefix uint8,
 
 	var pathB []string
 
+	// genome data and masks are moved or hard-linked/copied
+	transfer := os.Rename
+	if keepInputs {
+		transfer = linkOrCopy
+	}
+
 	for j = 0; j < batches; j++ { // each chunk for storing kmer-value data
 		begin = j * chunkSize
 		end = begin + chunkSize
@@ -89,26 +97,27 @@ func mergeIndexes(lh *lexichash.LexicHash, maskPrefix uint8, anchorPrefix uint8,
 
 		err := os.MkdirAll(outdir1, 0755)
 		if err != nil {
-			checkError(fmt.Errorf("failed to create dir: %s", err))
+			return fmt.Errorf("failed to create dir: %s", err)
 		}
 
 		// seeds
 		dirSeeds := filepath.Join(outdir1, DirSeeds)
 		err = os.MkdirAll(dirSeeds, 0755)
 		if err != nil {
-			checkError(fmt.Errorf("failed to create dir: %s", err))
+			return fmt.Errorf("failed to create dir: %s", err)
 		}
 
 		// genomes
 		dirGenomes := filepath.Join(outdir1, DirGenomes)
 		err = os.MkdirAll(dirGenomes, 0755)
 		if err != nil {
-			checkError(fmt.Errorf("failed to create dir: %s", err))
+			return fmt.Errorf("failed to create dir: %s", err)
 		}
 
 		// --------------------------------------------------------------------
 		// kmer-value data
 
+		errs := make([]error, kvChunks)
 		for chunk := 0; chunk < kvChunks; chunk++ {
 			tokens <- 1
 			wg.Add(1)
@@ -119,89 +128,17 @@ func mergeIndexes(lh *lexichash.LexicHash, maskPrefix uint8, anchorPrefix uint8,
 					<-tokens
 				}()
 
-				var rdr *kv.Reader
-				var i int
-				// var kmer uint64
-				// var values, values1 *[]uint64
-				// var ok bool
-
-				// read information from an existing index file
-				fileIdx := filepath.Join(pathB[0], DirSeeds, chunkFile(chunk)+kv.KVIndexFileExt)
-				rdrIdx, err := kv.NewIndexReader(fileIdx)
-				if err != nil {
-					checkError(fmt.Errorf("failed to read info from an index file: %s", err))
-				}
-
-				// outfile
-				file := filepath.Join(dirSeeds, chunkFile(chunk))
-				wtr, err := kv.NewWriter(rdrIdx.K, rdrIdx.ChunkIndex, rdrIdx.ChunkSize, file, maskPrefix, anchorPrefix, rdrIdx.Use3BytesForSeedPos)
-				if err != nil {
-					checkError(fmt.Errorf("failed to write a k-mer data file: %s", err))
-				}
-
-				rdrs := make([]*kv.Reader, len(pathB))
-				for i, db := range pathB {
-					rdrs[i], err = kv.NewReader(filepath.Join(db, DirSeeds, chunkFile(chunk)))
-					if err != nil {
-						checkError(fmt.Errorf("failed to read kv-data file: %s", err))
-					}
-				}
-
-				m := kv.PoolKmerData.Get().(*map[uint64]*[]uint64)
-				for c := 0; c < rdrIdx.ChunkSize; c++ { // for all mask
-					clear(*m)
-
-					for i, rdr = range rdrs {
-						// there's no need to read them in memory first
-						// m1, err := rdr.ReadDataOfAMaskAsMap()
-						// if err != nil {
-						// 	checkError(fmt.Errorf("failed to read data of mask %d from file %s: %s",
-						// 		c+rdr.ChunkIndex, pathB[i], err))
-						// }
-
-						// for kmer, values1 = range *m1 {
-						// 	if values, ok = (*m)[kmer]; !ok {
-						// 		(*m)[kmer] = values1 // directly move data from m1 to m, this saves a lot of memory
-						// 	} else {
-						// 		*values = append(*values, (*values1)...)
-						// 	}
-						// }
-						// kv.RecycleKmerData(m1)
-
-						// online processing
-						err = rdr.ReadDataOfAMaskAndAppendToMap(m)
-						if err != nil {
-							checkError(fmt.Errorf("failed to read data of mask %d from file %s: %s",
-								c+rdr.ChunkIndex, pathB[i], err))
-						}
-					}
-
-					err = wtr.WriteDataOfAMask(*m)
-					if err != nil {
-						checkError(fmt.Errorf("failed to write to k-mer data file: %s", err))
-					}
-				}
-
-				kv.RecycleKmerData(m)
-
-				for _, rdr = range rdrs {
-					err = rdr.Close()
-					if err != nil {
-						checkError(fmt.Errorf("failed to close kv-data file: %s", err))
-					}
-				}
-
-				rdrIdx.Close()
-
-				err = wtr.Close()
-				if err != nil {
-					checkError(fmt.Errorf("failed to close kv-data file: %s", err))
-				}
-
+				errs[chunk] = mergeSeedChunk(pathB, dirSeeds, chunk, maskPrefix, anchorPrefix)
 			}(chunk)
 		}
 		wg.Wait()
 
+		for _, err = range errs {
+			if err != nil {
+				return err
+			}
+		}
+
 		// -------------------------------------------------------------------
 		// genomes/, just move
 		var dirGenomesIn, dirG string
@@ -211,14 +148,14 @@ func mergeIndexes(lh *lexichash.LexicHash, maskPrefix uint8, anchorPrefix uint8,
 			dirGenomesIn = filepath.Join(db, DirGenomes)
 			files, err = os.ReadDir(dirGenomesIn)
 			if err != nil {
-				checkError(fmt.Errorf("failed to read genome dir: %s", err))
+				return fmt.Errorf("failed to read genome dir: %s", err)
 			}
 			for _, file = range files {
 				dirG = file.Name()
 				if file.IsDir() && strings.HasPrefix(dirG, "batch_") {
-					err = os.Rename(filepath.Join(dirGenomesIn, dirG), filepath.Join(dirGenomes, dirG))
+					err = transfer(filepath.Join(dirGenomesIn, dirG), filepath.Join(dirGenomes, dirG))
 					if err != nil {
-						checkError(fmt.Errorf("failed to move genome data"))
+						return fmt.Errorf("failed to move genome data: %s", err)
 					}
 				}
 			}
@@ -226,71 +163,29 @@ func mergeIndexes(lh *lexichash.LexicHash, maskPrefix uint8, anchorPrefix uint8,
 
 		// -------------------------------------------------------------------
 		// genomes.map.bin, just concatenate them
-		fh, err := os.Create(filepath.Join(outdir1, FileGenomeIndex))
-		if err != nil {
-			checkError(fmt.Errorf("failed to write genome index mapping file: %s", err))
-		}
-		bw := bufio.NewWriter(fh)
-		for _, db := range pathB {
-			fh1, err := os.Open(filepath.Join(db, FileGenomeIndex))
-			if err != nil {
-				checkError(fmt.Errorf("failed to open genome index mapping file: %s", err))
-			}
-			br := bufio.NewReader(fh1)
-			_, err = io.Copy(bw, br)
-			if err != nil {
-				checkError(fmt.Errorf("failed to copy genome index mapping data: %s", err))
-			}
-			err = fh1.Close()
-			if err != nil {
-				checkError(fmt.Errorf("failed to close genome index mapping file: %s", err))
-			}
-		}
-		bw.Flush()
-		err = fh.Close()
+		err = concatFiles(filepath.Join(outdir1, FileGenomeIndex), pathB, FileGenomeIndex)
 		if err != nil {
-			checkError(fmt.Errorf("failed to close genome index mapping file: %s", err))
+			return fmt.Errorf("failed to write genome index mapping file: %s", err)
 		}
 
 		// -------------------------------------------------------------------
 		// genomes.chunks.bin, just concatenate them
-		fh, err = os.Create(filepath.Join(outdir1, FileGenomeChunks))
+		err = concatFiles(filepath.Join(outdir1, FileGenomeChunks), pathB, FileGenomeChunks)
 		if err != nil {
-			checkError(fmt.Errorf("failed to write genome chunk list file: %s", err))
-		}
-		bw.Reset(fh)
-		for _, db := range pathB {
-			fh1, err := os.Open(filepath.Join(db, FileGenomeChunks))
-			if err != nil {
-				checkError(fmt.Errorf("failed to open genome chunk list file: %s", err))
-			}
-			br := bufio.NewReader(fh1)
-			_, err = io.Copy(bw, br)
-			if err != nil {
-				checkError(fmt.Errorf("failed to copy genome chunk list data: %s", err))
-			}
-			err = fh1.Close()
-			if err != nil {
-				checkError(fmt.Errorf("failed to close genome chunk list file: %s", err))
-			}
-		}
-		bw.Flush()
-		err = fh.Close()
-		if err != nil {
-			checkError(fmt.Errorf("failed to close genome chunk list file: %s", err))
+			return fmt.Errorf("failed to write genome chunk list file: %s", err)
 		}
 
 		// -------------------------------------------------------------------
 		// info.toml, copy one and update the genome number
 		info, err := readIndexInfo(filepath.Join(pathB[0], FileInfo))
 		if err != nil {
-			checkError(fmt.Errorf("failed to open info file: %s", err))
+			return fmt.Errorf("failed to open info file: %s", err)
 		}
 
 		for _, db := range pathB[1:] {
 			info2, err := readIndexInfo(filepath.Join(db, FileInfo))
 			if err != nil {
-				checkError(fmt.Errorf("failed to open info file: %s", err))
+				return fmt.Errorf("failed to open info file: %s", err)
 			}
 
 			info.InputGenomes += info2.InputGenomes
@@ -301,14 +196,14 @@ func mergeIndexes(lh *lexichash.LexicHash, maskPrefix uint8, anchorPrefix uint8,
 
 		err = writeIndexInfo(filepath.Join(outdir1, FileInfo), info)
 		if err != nil {
-			checkError(fmt.Errorf("failed to write info file: %s", err))
+			return fmt.Errorf("failed to write info file: %s", err)
 		}
 
 		// -------------------------------------------------------------------
 		// masks.bin, just copy one
-		err = os.Rename(filepath.Join(pathB[0], FileMasks), filepath.Join(outdir1, FileMasks))
+		err = transfer(filepath.Join(pathB[0], FileMasks), filepath.Join(outdir1, FileMasks))
 		if err != nil {
-			checkError(fmt.Errorf("failed to move mask data"))
+			return fmt.Errorf("failed to move mask data: %s", err)
 		}
 
 	}
@@ -326,22 +221,135 @@ func mergeIndexes(lh *lexichash.LexicHash, maskPrefix uint8, anchorPrefix uint8,
 		// delete old one, actually it's empty
 		err := os.RemoveAll(outdir)
 		if err != nil {
-			checkError(fmt.Errorf("failed to remove empty directory: %s", err))
+			return fmt.Errorf("failed to remove empty directory: %s", err)
 		}
 
 		err = os.Rename(tmpIndexes[0], outdir)
 		if err != nil {
-			checkError(fmt.Errorf("failed to move index directory: %s", err))
+			return fmt.Errorf("failed to move index directory: %s", err)
 		}
 
 		return nil
 	}
 
 	runtime.GC()
-	mergeIndexes(lh, maskPrefix, anchorPrefix, opt, kvChunks, outdir, tmpIndexes, tmpDir, round+1)
+	// indexes of later rounds are temporary ones, which can be moved.
+	return mergeIndexes(lh, maskPrefix, anchorPrefix, opt, kvChunks, outdir, tmpIndexes, tmpDir, round+1, false)
+}
+
+// mergeSeedChunk merges a seed chunk file of multiple indexes.
+func mergeSeedChunk(paths []string, dirSeeds string, chunk int, maskPrefix uint8, anchorPrefix uint8) error {
+	// read information from an existing index file
+	fileIdx := filepath.Join(paths[0], DirSeeds, chunkFile(chunk)+kv.KVIndexFileExt)
+	rdrIdx, err := kv.NewIndexReader(fileIdx)
+	if err != nil {
+		return fmt.Errorf("failed to read info from an index file: %s", err)
+	}
+	defer rdrIdx.Close()
+
+	// outfile
+	file := filepath.Join(dirSeeds, chunkFile(chunk))
+	wtr, err := kv.NewWriter(rdrIdx.K, rdrIdx.ChunkIndex, rdrIdx.ChunkSize, file, maskPrefix, anchorPrefix, rdrIdx.Use3BytesForSeedPos)
+	if err != nil {
+		return fmt.Errorf("failed to write a k-mer data file: %s", err)
+	}
+
+	rdrs := make([]*kv.Reader, 0, len(paths))
+	defer func() {
+		for _, rdr := range rdrs {
+			rdr.Close()
+		}
+	}()
+	var rdr *kv.Reader
+	for _, db := range paths {
+		rdr, err = kv.NewReader(filepath.Join(db, DirSeeds, chunkFile(chunk)))
+		if err != nil {
+			wtr.Close()
+			return fmt.Errorf("failed to read kv-data file: %s", err)
+		}
+		rdrs = append(rdrs, rdr)
+	}
+
+	m := kv.PoolKmerData.Get().(*map[uint64]*[]uint64)
+	defer kv.RecycleKmerData(m)
+	for c := 0; c < rdrIdx.ChunkSize; c++ { // for all mask
+		clear(*m)
+
+		for i, rdr := range rdrs {
+			// online processing, there's no need to read them in memory first
+			err = rdr.ReadDataOfAMaskAndAppendToMap(m)
+			if err != nil {
+				wtr.Close()
+				return fmt.Errorf("failed to read data of mask %d from file %s: %s",
+					c+rdr.ChunkIndex, paths[i], err)
+			}
+		}
+
+		err = wtr.WriteDataOfAMask(*m)
+		if err != nil {
+			wtr.Close()
+			return fmt.Errorf("failed to write to k-mer data file: %s", err)
+		}
+	}
+
+	err = wtr.Close()
+	if err != nil {
+		return fmt.Errorf("failed to close kv-data file: %s", err)
+	}
 	return nil
 }
 
+// concatFiles concatenates the file of the given name in multiple indexes.
+func concatFiles(file string, paths []string, name string) error {
+	fh, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(fh)
+	for _, db := range paths {
+		fh1, err := os.Open(filepath.Join(db, name))
+		if err != nil {
+			fh.Close()
+			return err
+		}
+		_, err = io.Copy(bw, bufio.NewReader(fh1))
+		fh1.Close()
+		if err != nil {
+			fh.Close()
+			return err
+		}
+	}
+	err = bw.Flush()
+	if err != nil {
+		fh.Close()
+		return err
+	}
+	return fh.Close()
+}
+
+// linkOrCopy hard-links a file, or all files in a directory recursively, to dst.
+// Files are copied if hard links are not supported, e.g., across file systems.
+func linkOrCopy(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		if os.Link(path, target) == nil {
+			return nil
+		}
+		return copyFile(path, target)
+	})
+}
+
 var poolUint64s = &sync.Pool{New: func() interface{} {
 	tmp := make([]uint64, 0, 1024)
 	return &tmp
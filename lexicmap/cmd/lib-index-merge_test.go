@@ -0,0 +1,65 @@
+// Copyright © 2023-2026 Wei Shen <shenwei356@gmail.com>
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLinkOrCopy(t *testing.T) {
+	dir := t.TempDir()
+
+	src := filepath.Join(dir, "in", DirGenomes, "batch_0000")
+	files := map[string]string{
+		"genomes.bin":     "genome data",
+		"genomes.bin.idx": "genome index",
+		"sub/extra.bin":   "nested",
+	}
+	for name, data := range files {
+		file := filepath.Join(src, name)
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dst := filepath.Join(dir, "out", DirGenomes, "batch_0000")
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := linkOrCopy(src, dst); err != nil {
+		t.Fatal(err)
+	}
+
+	// both the input and the output are complete
+	for name, data := range files {
+		for _, d := range []string{src, dst} {
+			got, err := os.ReadFile(filepath.Join(d, name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != data {
+				t.Errorf("unexpected data of %s: %q, want %q", filepath.Join(d, name), got, data)
+			}
+		}
+	}
+
+	// a single file
+	file := filepath.Join(dir, "in", FileMasks)
+	if err := os.WriteFile(file, []byte("masks"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := linkOrCopy(file, filepath.Join(dir, "out", FileMasks)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(file); err != nil {
+		t.Errorf("the input file should be kept: %s", err)
+	}
+	if got, err := os.ReadFile(filepath.Join(dir, "out", FileMasks)); err != nil || string(got) != "masks" {
+		t.Errorf("unexpected mask file: %q, %v", got, err)
+	}
+}
@@ -0,0 +1,368 @@
+// Copyright © 2023-2026 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"github.com/shenwei356/util/pathutil"
+)
+
+// FileBuildManifest records parameters and input files of an index building job,
+// saved in the temporary directory for resuming an interrupted job.
+const FileBuildManifest = "build.toml"
+
+// IndexBuildManifest contains parameters and input files affecting the index data of genome batches.
+type IndexBuildManifest struct {
+	MainVersion  uint8 `toml:"main-version" comment:"Index format"`
+	MinorVersion uint8 `toml:"minor-version"`
+
+	K           int    `toml:"max-K" comment:"LexicHash"`
+	Masks       int    `toml:"masks"`
+	RandSeed    int64  `toml:"rand-seed"`
+	MaskFile    string `toml:"mask-file"`
+	MaskFileSum string `toml:"mask-file-sha256"`
+	SoftMasking bool   `toml:"soft-masking"`
+	MaxKmerFreq int    `toml:"max-kmer-freq"`
+
+	DisableDesertFilling   bool   `toml:"no-desert-filling" comment:"Seed distance"`
+	DesertMaxLen           uint32 `toml:"max-seed-dist"`
+	DesertExpectedSeedDist int    `toml:"seed-dist-in-desert"`
+
+	Chunks     int `toml:"chunks" comment:"Seeds (k-mer-value data) files"`
+	Partitions int `toml:"index-partitions"`
+
+	MinSeqLen         int      `toml:"min-seq-len" comment:"Genomes"`
+	MaxGenomeSize     int      `toml:"max-genome"`
+	ReRefName         string   `toml:"ref-name-regexp"`
+	ReSeqExclude      []string `toml:"seq-name-filter"`
+	ContigInterval    int      `toml:"contig-interval"`
+	GenomeBlockSize   int      `toml:"genome-block-size"`
+	SaveSeedPositions bool     `toml:"save-seed-pos"`
+	SaveAnnotations   bool     `toml:"save-annotations"`
+	AnnotationTypes   []string `toml:"annotation-types"`
+
+	GenomeBatchSize int    `toml:"genome-batch-size" comment:"Input files"`
+	GenomeBatches   int    `toml:"genome-batches"`
+	InputFiles      int    `toml:"input-files"`
+	InputFilesSum   string `toml:"input-files-sha256" comment:"SHA-256 checksum of the ordered list of input file paths"`
+}
+
+// newIndexBuildManifest creates a build manifest from the options and input files.
+func newIndexBuildManifest(opt *IndexBuildingOptions, infiles []string, nBatches int) (*IndexBuildManifest, error) {
+	m := &IndexBuildManifest{
+		MainVersion:  MainVersion,
+		MinorVersion: MinorVersion,
+
+		K:           opt.K,
+		Masks:       opt.Masks,
+		RandSeed:    opt.RandSeed,
+		MaskFile:    opt.MaskFile,
+		SoftMasking: opt.SoftMasking,
+		MaxKmerFreq: opt.MaxKmerFreq,
+
+		DisableDesertFilling:   opt.DisableDesertFilling,
+		DesertMaxLen:           opt.DesertMaxLen,
+		DesertExpectedSeedDist: opt.DesertExpectedSeedDist,
+
+		Chunks:     opt.Chunks,
+		Partitions: opt.Partitions,
+
+		MinSeqLen:         opt.MinSeqLen,
+		MaxGenomeSize:     opt.MaxGenomeSize,
+		ContigInterval:    opt.ContigInterval,
+		GenomeBlockSize:   opt.GenomeBlockSize,
+		SaveSeedPositions: opt.SaveSeedPositions,
+		SaveAnnotations:   opt.SaveAnnotations,
+		AnnotationTypes:   opt.AnnotationTypes,
+
+		GenomeBatchSize: opt.GenomeBatchSize,
+		GenomeBatches:   nBatches,
+		InputFiles:      len(infiles),
+	}
+
+	if opt.MaskFile != "" {
+		checksum, _, err := fileChecksum(opt.MaskFile)
+		if err != nil {
+			return nil, err
+		}
+		m.MaskFileSum = checksum
+	}
+	if opt.ReRefName != nil {
+		m.ReRefName = opt.ReRefName.String()
+	}
+	m.ReSeqExclude = make([]string, len(opt.ReSeqExclude))
+	for i, re := range opt.ReSeqExclude {
+		m.ReSeqExclude[i] = re.String()
+	}
+
+	h := sha256.New()
+	for _, file := range infiles {
+		h.Write([]byte(file))
+		h.Write([]byte{'\n'})
+	}
+	m.InputFilesSum = hex.EncodeToString(h.Sum(nil))
+
+	return m, nil
+}
+
+// writeIndexBuildManifest writes the build manifest.
+func writeIndexBuildManifest(file string, m *IndexBuildManifest) error {
+	data, err := toml.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, data, 0644)
+}
+
+// readIndexBuildManifest reads the build manifest.
+func readIndexBuildManifest(file string) (*IndexBuildManifest, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	m := &IndexBuildManifest{}
+	err = toml.Unmarshal(data, m)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// diff returns the lines of settings different from another build manifest.
+func (m *IndexBuildManifest) diff(m2 *IndexBuildManifest) ([]string, error) {
+	data1, err := toml.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	data2, err := toml.Marshal(m2)
+	if err != nil {
+		return nil, err
+	}
+	lines1 := strings.Split(string(data1), "\n")
+	lines2 := strings.Split(string(data2), "\n")
+	if len(lines1) != len(lines2) {
+		return []string{"different format"}, nil
+	}
+
+	diffs := make([]string, 0, 4)
+	for i, line := range lines1 {
+		if line != lines2[i] {
+			diffs = append(diffs, fmt.Sprintf("%s (previous: %s)", line, lines2[i]))
+		}
+	}
+	return diffs, nil
+}
+
+// prepareBatchesDir prepares the temporary directory for saving indexes of genome batches,
+// and returns the flags of completed batches when resuming an interrupted job.
+//
+// A genome batch is completed if the manifest file exists in the batch directory,
+// which is written after all other files of the batch are saved,
+// and the sizes of all files match the manifest. Checksums are not computed here,
+// full verification is left to "lexicmap utils verify-index".
+// Incomplete batches are removed.
+func prepareBatchesDir(tmpDir string, opt *IndexBuildingOptions, infiles []string, nBatches int) ([]bool, error) {
+	completed := make([]bool, nBatches)
+
+	m, err := newIndexBuildManifest(opt, infiles, nBatches)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create build manifest: %s", err)
+	}
+	fileManifest := filepath.Join(tmpDir, FileBuildManifest)
+
+	var resume bool
+	if opt.Resume {
+		resume, err = pathutil.Exists(fileManifest)
+		if err != nil {
+			return nil, err
+		}
+		if !resume && (opt.Verbose || opt.Log2File) {
+			log.Infof("no build manifest found in the temporary directory, start from scratch: %s", tmpDir)
+		}
+	}
+
+	if !resume {
+		err = os.RemoveAll(tmpDir)
+		if err != nil {
+			return nil, err
+		}
+		err = os.MkdirAll(tmpDir, 0755)
+		if err != nil {
+			return nil, err
+		}
+		err = writeIndexBuildManifest(fileManifest, m)
+		if err != nil {
+			return nil, fmt.Errorf("failed to write build manifest: %s", err)
+		}
+		return completed, nil
+	}
+
+	// ---------------------------------------------------------------
+	// resume
+
+	m0, err := readIndexBuildManifest(fileManifest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read build manifest: %s", err)
+	}
+	diffs, err := m.diff(m0)
+	if err != nil {
+		return nil, err
+	}
+	if len(diffs) > 0 {
+		return nil, fmt.Errorf("can not resume the job, as the input files or parameters changed:\n  %s\nplease use the same ones, or run without --resume to start from scratch",
+			strings.Join(diffs, "\n  "))
+	}
+
+	if opt.Verbose || opt.Log2File {
+		log.Infof("checking genome batches of the interrupted job in: %s", tmpDir)
+	}
+	timeStart := time.Now()
+
+	// remove outputs of the unfinished merging step
+	entries, err := os.ReadDir(tmpDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.Name() == FileBuildManifest || (e.IsDir() && strings.HasPrefix(e.Name(), "batch_")) {
+			continue
+		}
+		err = os.RemoveAll(filepath.Join(tmpDir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var nCompleted int
+	var dir string
+	for batch := 0; batch < nBatches; batch++ {
+		dir = filepath.Join(tmpDir, batchDir(batch))
+		err = checkBatchIndex(dir)
+		if err == nil {
+			completed[batch] = true
+			nCompleted++
+			continue
+		}
+
+		if os.IsNotExist(err) {
+			continue
+		}
+		if opt.Verbose || opt.Log2File {
+			log.Infof("  batch %d will be rebuilt: %s", batch+1, err)
+		}
+		err = os.RemoveAll(dir)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if opt.Verbose || opt.Log2File {
+		log.Infof("  %d of %d batches are completed, checked in %s", nCompleted, nBatches, time.Since(timeStart))
+	}
+
+	return completed, nil
+}
+
+// checkBatchIndex checks if the index of a genome batch is completed,
+// with the manifest file as the completion marker and file sizes recorded in it.
+// An error satisfying os.IsNotExist is returned if the batch directory does not exist.
+func checkBatchIndex(dir string) error {
+	_, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+
+	fileManifest := filepath.Join(dir, FileManifest)
+	ok, err := pathutil.Exists(fileManifest)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("unfinished")
+	}
+
+	_, err = readIndexInfo(filepath.Join(dir, FileInfo))
+	if err != nil {
+		return fmt.Errorf("failed to read info file: %s", err)
+	}
+
+	records, err := readIndexManifest(fileManifest)
+	if err != nil {
+		return fmt.Errorf("failed to read manifest file: %s", err)
+	}
+
+	layout, err := manifestIndexLayout(dir)
+	if err != nil {
+		return err
+	}
+	var fi os.FileInfo
+	for _, r := range records {
+		fi, err = os.Stat(layout.File(r.File))
+		if err != nil {
+			if os.IsNotExist(err) {
+				return fmt.Errorf("file missing: %s", r.File)
+			}
+			return err
+		}
+		if fi.Size() != r.Size {
+			return fmt.Errorf("file changed: %s", r.File)
+		}
+	}
+	return nil
+}
+
+// readSkippedGenomes reads records of skipped genomes of some input files
+// from the output file of skipped genomes of the interrupted job.
+func readSkippedGenomes(file string, files map[string]struct{}) ([]string, error) {
+	fh, err := os.Open(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer fh.Close()
+
+	records := make([]string, 0, 8)
+	scanner := bufio.NewScanner(fh)
+	var line string
+	var i int
+	for scanner.Scan() {
+		line = scanner.Text()
+		i = strings.IndexByte(line, '\t')
+		if i < 0 {
+			continue
+		}
+		if _, ok := files[line[:i]]; ok {
+			records = append(records, line+"\n")
+		}
+	}
+	return records, scanner.Err()
+}
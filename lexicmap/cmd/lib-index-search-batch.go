@@ -0,0 +1,357 @@
+// Copyright © 2023-2026 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"cmp"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/shenwei356/LexicMap/lexicmap/cmd/kv"
+)
+
+// batchKmer is a masked k-mer of a query in a block.
+type batchKmer struct {
+	kmer uint64
+	q    int32 // index of the query in the block
+	i    int32 // index of the prefix k-mer in batchQuery.kmers, for getting its locations
+}
+
+// batchKmersOfAMask contains sorted unique k-mers of a mask from all queries in a block.
+type batchKmersOfAMask struct {
+	kmers  []uint64    // sorted unique k-mers, as the input of Search2
+	owners []batchKmer // sorted k-mers of all queries
+	starts []int       // owners of kmers[j] are owners[starts[j]:starts[j+1]]
+}
+
+// set sorts k-mers of all queries and groups them by k-mers.
+func (b *batchKmersOfAMask) set(all []batchKmer) {
+	slices.SortFunc(all, func(x, y batchKmer) int {
+		if x.kmer != y.kmer {
+			return cmp.Compare(x.kmer, y.kmer)
+		}
+		if x.q != y.q {
+			return cmp.Compare(x.q, y.q)
+		}
+		return cmp.Compare(x.i, y.i)
+	})
+	b.owners = all
+	b.kmers = b.kmers[:0]
+	b.starts = b.starts[:0]
+	for i, bk := range all {
+		if i == 0 || bk.kmer != all[i-1].kmer {
+			b.kmers = append(b.kmers, bk.kmer)
+			b.starts = append(b.starts, i)
+		}
+	}
+	b.starts = append(b.starts, len(all))
+}
+
+// ownersOf returns queries sharing the jth k-mer.
+func (b *batchKmersOfAMask) ownersOf(j int) []batchKmer {
+	return b.owners[b.starts[j]:b.starts[j+1]]
+}
+
+// batchMaskedKmer is a captured k-mer of a query.
+type batchMaskedKmer struct {
+	kmer uint64
+	mask int32 // index of the mask
+	i    int32 // index of the prefix k-mer in batchQuery.kmers, only for reversed k-mers
+}
+
+// batchQuery is a query in a block.
+// Masking results, with a size of the number of masks, are compacted right after masking,
+// so a query in a block only costs memory proportional to the number of captured k-mers.
+type batchQuery struct {
+	query *Query
+
+	kmers  []batchMaskedKmer // captured k-mers for prefix matching, in the order of masks
+	locses [][]int           // locations of kmers[i]
+	kmersR []batchMaskedKmer // reversed k-mers for suffix matching, in the order of masks
+
+	mu        sync.Mutex // seed hits from different chunks are added concurrently
+	m         *map[int]*SearchResult
+	collector *seedCollector
+}
+
+// compact keeps captured k-mers and their locations from the results of maskQuery and reverseKmers,
+// which can be recycled then.
+func (bq *batchQuery) compact(_kmers *[]uint64, _locses *[][]int, _kmersR *[]*[]uint64, _locsesR *[]*[]int) {
+	var n, nLocs, nR int
+	for iM, kmer := range *_kmers {
+		if kmer != 0 {
+			n++
+			nLocs += len((*_locses)[iM])
+		}
+	}
+	for _, v := range *_kmersR {
+		nR += len(*v)
+	}
+
+	bq.kmers = make([]batchMaskedKmer, 0, n)
+	bq.locses = make([][]int, 0, n)
+	locs := make([]int, 0, nLocs) // all locations share one slice
+	var b int
+	for iM, kmer := range *_kmers {
+		if kmer == 0 {
+			continue
+		}
+		bq.kmers = append(bq.kmers, batchMaskedKmer{kmer: kmer, mask: int32(iM)})
+		b = len(locs)
+		locs = append(locs, (*_locses)[iM]...)
+		bq.locses = append(bq.locses, locs[b:len(locs):len(locs)])
+	}
+
+	// locations of reversed k-mers are the indexes of the original masks
+	bq.kmersR = make([]batchMaskedKmer, 0, nR)
+	var i int
+	for iM, v := range *_kmersR {
+		for j, kmer := range *v {
+			i, _ = slices.BinarySearchFunc(bq.kmers, int32((*(*_locsesR)[iM])[j]), compareBatchMaskedKmer)
+			bq.kmersR = append(bq.kmersR, batchMaskedKmer{kmer: kmer, mask: int32(iM), i: int32(i)})
+		}
+	}
+}
+
+// compareBatchMaskedKmer compares the mask of a k-mer with a mask index.
+func compareBatchMaskedKmer(x batchMaskedKmer, mask int32) int {
+	return cmp.Compare(x.mask, mask)
+}
+
+// kmersInMasks returns the range of k-mers of masks in [beginM, endM).
+func kmersInMasks(ks []batchMaskedKmer, beginM, endM int) (int, int) {
+	b, _ := slices.BinarySearchFunc(ks, int32(beginM), compareBatchMaskedKmer)
+	e, _ := slices.BinarySearchFunc(ks[b:], int32(endM), compareBatchMaskedKmer)
+	return b, b + e
+}
+
+// SearchBatch searches a block of queries in a throughput-oriented way, for a large number of
+// short queries. Rather than probing all seed chunks for each query independently,
+// masked k-mers of all queries are collected and sorted for each mask, so each seed chunk file
+// is walked once in order with Search2. Seed hits are then distributed back to queries,
+// which are chained and aligned with at most conc queries at the same time.
+// Search results are saved in query.result, and queries shorter than k should not be given.
+func (idx *Index) SearchBatch(queries []*Query, conc int) error {
+	if len(queries) == 0 {
+		return nil
+	}
+	if conc < 1 {
+		conc = 1
+	}
+
+	var wg sync.WaitGroup
+	tokens := make(chan int, idx.opt.NumCPUs)
+	timeStart := time.Now()
+
+	// ----------------------------------------------------------------
+	// 1) mask all queries
+
+	bqs := make([]*batchQuery, len(queries))
+	var errMask error
+	var muErr sync.Mutex
+	for i, q := range queries {
+		tokens <- 1
+		wg.Add(1)
+		go func(i int, q *Query) {
+			defer func() {
+				<-tokens
+				wg.Done()
+			}()
+
+			_kmers, _locses, err := idx.maskQuery(q, false)
+			if err != nil {
+				muErr.Lock()
+				errMask = err
+				muErr.Unlock()
+				return
+			}
+			_kmersR, _locsesR := idx.reverseKmers(_kmers)
+
+			m := poolSearchResultsMap.Get().(*map[int]*SearchResult)
+			bq := &batchQuery{
+				query:     q,
+				m:         m,
+				collector: idx.newSeedCollector(m, nil),
+			}
+			bq.collector.stats = q.stats
+
+			// masking results are released right away, rather than being kept for the whole block
+			bq.compact(_kmers, _locses, _kmersR, _locsesR)
+			idx.recycleReversedKmers(_kmersR, _locsesR)
+			idx.lh.RecycleMaskResult(_kmers, _locses)
+
+			bqs[i] = bq
+		}(i, q)
+	}
+	wg.Wait()
+
+	if errMask != nil {
+		for _, bq := range bqs {
+			if bq != nil {
+				bq.collector.close()
+				poolSearchResultsMap.Put(bq.m)
+			}
+		}
+		return errMask
+	}
+
+	// ----------------------------------------------------------------
+	// 2) matching k-mers of all queries chunk by chunk
+
+	inMemorySearch := idx.opt.InMemorySearch
+	var nSearchers int
+	if inMemorySearch {
+		nSearchers = len(idx.InMemorySearchers)
+	} else {
+		nSearchers = len(idx.Searchers)
+	}
+	minPrefix := idx.opt.MinPrefix
+
+	for iS := 0; iS < nSearchers; iS++ {
+		var beginM, endM int // range of mask of a chunk
+		if inMemorySearch {
+			beginM = idx.InMemorySearchers[iS].ChunkIndex
+			endM = beginM + idx.InMemorySearchers[iS].ChunkSize
+		} else {
+			beginM = idx.Searchers[iS].ChunkIndex
+			endM = beginM + idx.Searchers[iS].ChunkSize
+		}
+
+		tokens <- 1
+		wg.Add(1)
+		go func(iS, beginM, endM int) {
+			defer func() {
+				<-tokens
+				wg.Done()
+			}()
+
+			nM := endM - beginM
+
+			// sorted k-mers of each mask
+			bks := make([]batchKmersOfAMask, nM)  // for prefix matching
+			bksR := make([]batchKmersOfAMask, nM) // for suffix matching
+			kmers := make([]*[]uint64, nM)
+			kmersR := make([]*[]uint64, nM)
+
+			all := make([][]batchKmer, nM)
+			allR := make([][]batchKmer, nM)
+			var b, e, j int
+			var k batchMaskedKmer
+			for q, bq := range bqs {
+				b, e = kmersInMasks(bq.kmers, beginM, endM)
+				for i := b; i < e; i++ {
+					k = bq.kmers[i]
+					j = int(k.mask) - beginM
+					all[j] = append(all[j], batchKmer{kmer: k.kmer, q: int32(q), i: int32(i)})
+				}
+
+				b, e = kmersInMasks(bq.kmersR, beginM, endM)
+				for _, k = range bq.kmersR[b:e] {
+					j = int(k.mask) - beginM
+					allR[j] = append(allR[j], batchKmer{kmer: k.kmer, q: int32(q), i: k.i})
+				}
+			}
+			for j = 0; j < nM; j++ {
+				bks[j].set(all[j])
+				kmers[j] = &bks[j].kmers
+				bksR[j].set(allR[j])
+				kmersR[j] = &bksR[j].kmers
+			}
+
+			var srs, srs2 *[]*kv.SearchResult
+			var err error
+			if inMemorySearch {
+				scr := idx.InMemorySearchers[iS]
+				srs, err = scr.Search2(kmers, minPrefix, true, false) // prefix search
+				checkError(err)
+				srs2, err = scr.Search2(kmersR, minPrefix, true, true) // suffix search
+				checkError(err)
+			} else {
+				idx.searcherTokens[iS] <- 1 // get the access to the searcher
+				scr := idx.Searchers[iS]
+				srs, err = scr.Search2(kmers, minPrefix, true, false) // prefix search
+				checkError(err)
+				srs2, err = scr.Search2(kmersR, minPrefix, true, true) // suffix search
+				checkError(err)
+				<-idx.searcherTokens[iS] // return the access
+			}
+
+			// distribute seed hits to queries
+			var bq *batchQuery
+			for _, sr := range *srs {
+				for _, o := range bks[sr.IQuery-beginM].ownersOf(sr.IQuery2) {
+					bq = bqs[o.q]
+					bq.mu.Lock()
+					bq.collector.add(sr, bq.locses[o.i])
+					bq.mu.Unlock()
+				}
+			}
+			for _, sr := range *srs2 {
+				for _, o := range bksR[sr.IQuery-beginM].ownersOf(sr.IQuery2) {
+					bq = bqs[o.q]
+					bq.mu.Lock()
+					bq.collector.add(sr, bq.locses[o.i])
+					bq.mu.Unlock()
+				}
+			}
+			kv.RecycleSearchResults(srs)
+			kv.RecycleSearchResults(srs2)
+		}(iS, beginM, endM)
+	}
+	wg.Wait()
+
+	// captured k-mers are not needed in chaining and alignment
+	for _, bq := range bqs {
+		bq.kmers, bq.locses, bq.kmersR = nil, nil, nil
+	}
+
+	// seed matching is shared by all queries in the block
+	timeSeeding := time.Since(timeStart)
+	for _, q := range queries {
+		if q.stats != nil {
+			q.stats.TimeSeeding = timeSeeding
+		}
+	}
+
+	// ----------------------------------------------------------------
+	// 3) chaining and alignment for each query
+
+	tokensQ := make(chan int, conc)
+	for _, bq := range bqs {
+		tokensQ <- 1
+		wg.Add(1)
+		go func(bq *batchQuery) {
+			defer func() {
+				<-tokensQ
+				wg.Done()
+			}()
+
+			var err error
+			bq.query.result, err = idx.chainAndAlign(bq.query, bq.m, false, time.Time{})
+			checkError(err)
+			bq.collector.close()
+		}(bq)
+	}
+	wg.Wait()
+
+	return nil
+}
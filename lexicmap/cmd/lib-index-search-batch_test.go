@@ -0,0 +1,187 @@
+// Copyright © 2023-2026 Wei Shen <shenwei356@gmail.com>
+
+package cmd
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"testing"
+)
+
+func TestBatchKmersOfAMask(t *testing.T) {
+	all := []batchKmer{
+		{kmer: 30, q: 0},
+		{kmer: 10, q: 1},
+		{kmer: 30, q: 2, i: 1},
+		{kmer: 20, q: 3},
+		{kmer: 10, q: 4, i: 2},
+	}
+
+	var b batchKmersOfAMask
+	b.set(all)
+
+	if want := []uint64{10, 20, 30}; !reflect.DeepEqual(b.kmers, want) {
+		t.Fatalf("unexpected unique k-mers: %v, want %v", b.kmers, want)
+	}
+
+	owners := [][]int32{{1, 4}, {3}, {0, 2}}
+	for j, want := range owners {
+		var got []int32
+		for _, o := range b.ownersOf(j) {
+			if o.kmer != b.kmers[j] {
+				t.Errorf("unexpected owner k-mer: %d, want %d", o.kmer, b.kmers[j])
+			}
+			got = append(got, o.q)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("unexpected owners of k-mer %d: %v, want %v", b.kmers[j], got, want)
+		}
+	}
+
+	// reuse the object with no k-mers
+	b.set(nil)
+	if len(b.kmers) != 0 || len(b.starts) != 1 {
+		t.Errorf("unexpected result of empty input: %v, %v", b.kmers, b.starts)
+	}
+}
+
+func TestSearchBatchEquivalence(t *testing.T) {
+	dir := t.TempDir()
+
+	// random genomes
+	r := rand.New(rand.NewSource(11))
+	genomes := make([][]byte, 4)
+	files := make([]string, len(genomes))
+	for i := range genomes {
+		genomes[i] = make([]byte, 20000)
+		for j := range genomes[i] {
+			genomes[i][j] = "ACGT"[r.Intn(4)]
+		}
+		files[i] = filepath.Join(dir, fmt.Sprintf("g%d.fa", i+1))
+		err := os.WriteFile(files[i], []byte(fmt.Sprintf(">g%d\n%s\n", i+1, genomes[i])), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dbDir := filepath.Join(dir, "db.lmi")
+	bopt := &IndexBuildingOptions{
+		NumCPUs:      2,
+		MaxOpenFiles: 64,
+		MergeThreads: 1,
+
+		MinSeqLen:     31,
+		MaxGenomeSize: 1 << 30,
+
+		K:        31,
+		Masks:    1024,
+		RandSeed: 1,
+
+		DesertMaxLen:           100,
+		DesertExpectedSeedDist: 50,
+		DesertSeedPosRange:     25,
+
+		Chunks:          4,
+		Partitions:      16,
+		GenomeBatchSize: 2, // two batches
+
+		ReRefName:      regexp.MustCompile(`(?i)(.+)\.(f[aq](st[aq])?|fna)(\.gz|\.xz|\.zst|\.bz2)?$`),
+		ContigInterval: 1000,
+	}
+	if err := CheckIndexBuildingOptions(bopt); err != nil {
+		t.Fatal(err)
+	}
+	if err := BuildIndex(dbDir, files, bopt); err != nil {
+		t.Fatal(err)
+	}
+
+	sopt := DefaultIndexSearchingOptions
+	sopt.NumCPUs = 2
+	sopt.MaxSeedSearchingConcurrency = 2
+	idx, err := NewIndexSearcher(dbDir, &sopt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if err := idx.Close(); err != nil {
+			t.Error(err)
+		}
+	}()
+	sco := DefaultSeqComparatorOptions
+	idx.SetSeqCompareOptions(&sco)
+
+	// queries from both strands of all genomes, and one with no hits
+	code := map[byte]int{'A': 0, 'C': 1, 'G': 2, 'T': 3}
+	queries := make([]*Query, 0, 2*len(genomes)+1)
+	for i, g := range genomes {
+		b := 1000 + i*3000
+		s := append([]byte{}, g[b:b+500]...)
+		// with a SNP every 40 bp, so the hits depend on the matched seeds
+		for j := 20; j < len(s); j += 40 {
+			s[j] = "CGTA"[code[s[j]]]
+		}
+		queries = append(queries, &Query{seqID: []byte(fmt.Sprintf("q%d", i+1)), seq: s})
+
+		rc := make([]byte, len(s))
+		for j, c := range s {
+			rc[len(s)-1-j] = "TGCA"[code[c]]
+		}
+		queries = append(queries, &Query{seqID: []byte(fmt.Sprintf("q%d_rc", i+1)), seq: rc})
+	}
+	s := make([]byte, 500)
+	for j := range s {
+		s[j] = "ACGT"[r.Intn(4)]
+	}
+	queries = append(queries, &Query{seqID: []byte("random"), seq: s})
+
+	want := make([][]string, len(queries))
+	for i, q := range queries {
+		rs, err := idx.Search(q, nil, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want[i] = summarizeSearchResults(rs)
+		if rs != nil {
+			idx.RecycleSearchResults(rs)
+		}
+	}
+
+	if err = idx.SearchBatch(queries, 3); err != nil {
+		t.Fatal(err)
+	}
+	for i, q := range queries {
+		got := summarizeSearchResults(q.result)
+		if q.result != nil {
+			idx.RecycleSearchResults(q.result)
+		}
+
+		if i < len(queries)-1 && len(want[i]) == 0 {
+			t.Errorf("query %s: no hits found", q.seqID)
+		}
+		if !reflect.DeepEqual(got, want[i]) {
+			t.Errorf("query %s: unexpected hits of SearchBatch: %v, want %v", q.seqID, got, want[i])
+		}
+	}
+}
+
+// summarizeSearchResults formats the hits of a query for comparison.
+func summarizeSearchResults(rs *[]*SearchResult) []string {
+	if rs == nil {
+		return nil
+	}
+	hits := make([]string, 0, len(*rs))
+	for _, r := range *rs {
+		for _, sd := range *r.SimilarityDetails {
+			for _, c := range *sd.Similarity.Chains {
+				hits = append(hits, fmt.Sprintf("%d:%d %s %v %d %d-%d %d-%d %d %d",
+					r.GenomeBatch, r.GenomeIndex, sd.SeqID, sd.RC, sd.NSeeds,
+					c.QBegin, c.QEnd, c.TBegin, c.TEnd, c.MatchedBases, c.Gaps))
+			}
+		}
+	}
+	return hits
+}
@@ -252,14 +252,37 @@ func (idx *Index) GSearchScreen(query *GQuery, windows int, saveDetails bool, ma
 		taxids := idx.opt.TaxIds
 		negativeTaxids := idx.opt.NegativeTaxIds
 
+		// ubiquitous seeds
+		seedIDF := idx.opt.SeedIDF
+		maxSeedGenomes := idx.maxSeedGenomes
+		maxSeedHits := idx.opt.SeedMaxHits
+		checkSeedFreq := seedIDF || maxSeedGenomes > 0
+		nGenomes := idx.nGenomes
+		chunk2genome := idx.genomeChunk2Genome
+		var dfBuf, hitsBuf []uint64
+		var df int
+		var score uint64
+		var values []uint64
+
 		for srs := range ch {
 			// different k-mers in subjects,
 			// most of cases, there are more than one
 			for _, sr = range *srs {
+				score = uint64(sr.Len)
+				if checkSeedFreq {
+					df = seedGenomeFreq(sr.Values, chunk2genome, maxSeedGenomes, &dfBuf)
+					if maxSeedGenomes > 0 && df > maxSeedGenomes {
+						continue
+					}
+					if seedIDF {
+						score = uint64(float32(sr.Len)*seedIDFWeight(df, nGenomes) + 0.5)
+					}
+				}
+				values = sampleSeedHits(sr.Values, maxSeedHits, &hitsBuf)
 
 				// multiple locations for each MATCHED k-mer
 				// but most of cases, there's only one.
-				for _, refpos = range sr.Values {
+				for _, refpos = range values {
 					refBatchAndIdxUint64 = refpos >> BITS_NONE_IDX // batch+refIdx
 
 					// filter by taxid
@@ -337,7 +360,7 @@ func (idx *Index) GSearchScreen(query *GQuery, windows int, saveDetails bool, ma
 							r.LongestMatches[sr.IQuery] = uint8(sr.Len)
 						}
 					}
-					r.Score += uint64(sr.Len) // matched length
+					r.Score += score // matched length, weighted by the inverse genome frequency with SeedIDF
 				}
 			}
 
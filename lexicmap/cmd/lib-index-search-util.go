@@ -22,6 +22,7 @@ package cmd
 
 import (
 	"math"
+	"math/bits"
 	"slices"
 	"sync"
 
@@ -302,3 +303,100 @@ func scoreAndEvalue(match, mismatch, gapOpen, gapExt int, totalBase int, lambda,
 		return score, int(bitScore), evalue
 	}
 }
+
+// minSeedWeight is the weight of seeds found in all genomes.
+const minSeedWeight = 0.1
+
+// seedGenomeFreq returns the number of distinct genomes of a matched seed,
+// where chunks of a split genome are counted as one genome, i.e., the same unit as Index.nGenomes.
+// Values of a genome are not always contiguous (e.g., seeds of desert regions, and data merged
+// from multiple batches), so genome IDs are deduplicated with an open-addressing hash set,
+// which takes O(n) time. The counting stops once the number exceeds limit (> 0),
+// e.g., the maximum genome frequency for skipping a seed.
+// chunk2genome maps batch+ref indexes of genome chunks to that of the first chunk,
+// and it could be nil. buf is a reusable buffer.
+func seedGenomeFreq(values []uint64, chunk2genome map[uint64]uint64, limit int, buf *[]uint64) int {
+	switch len(values) {
+	case 0:
+		return 0
+	case 1:
+		return 1
+	}
+
+	// slots of genome IDs + 1, 0 for empty ones
+	size := 4
+	for size < len(values)<<1 {
+		size <<= 1
+	}
+	set := *buf
+	if cap(set) < size {
+		set = make([]uint64, size)
+	} else {
+		set = set[:size]
+		clear(set)
+	}
+	*buf = set
+	mask := uint64(size - 1)
+	shift := 64 - bits.Len(uint(mask))
+
+	var n int
+	var g, g0, i uint64
+	pre := uint64(math.MaxUint64)
+	var ok bool
+	for _, v := range values {
+		g = v >> BITS_NONE_IDX
+		if chunk2genome != nil {
+			if g0, ok = chunk2genome[g]; ok {
+				g = g0
+			}
+		}
+		if g == pre { // values of a genome are mostly contiguous
+			continue
+		}
+		pre = g
+
+		g++
+		for i = (g * 0x9E3779B97F4A7C15) >> shift; ; i = (i + 1) & mask {
+			if set[i] == g {
+				break
+			}
+			if set[i] == 0 {
+				set[i] = g
+				n++
+				break
+			}
+		}
+		if limit > 0 && n > limit {
+			break
+		}
+	}
+	return n
+}
+
+// sampleSeedHits returns n values evenly sampled from all values of a matched seed,
+// rather than the first n ones, which are mostly from genomes of the first batches.
+// The values are not modified, and buf is a reusable buffer.
+func sampleSeedHits(values []uint64, n int, buf *[]uint64) []uint64 {
+	if n <= 0 || len(values) <= n {
+		return values
+	}
+	s := (*buf)[:0]
+	for i := 0; i < n; i++ {
+		s = append(s, values[i*len(values)/n])
+	}
+	*buf = s
+	return s
+}
+
+// seedIDFWeight returns the IDF-style weight of a seed found in df of n genomes,
+// which decreases from 1 for seeds in one genome to minSeedWeight for seeds in all genomes,
+// i.e., minSeedWeight + (1 - minSeedWeight) * ln(n/df) / ln(n).
+func seedIDFWeight(df, n int) float32 {
+	if n <= 1 || df <= 1 {
+		return 1
+	}
+	if df >= n {
+		return minSeedWeight
+	}
+	return float32(minSeedWeight + (1-minSeedWeight)*math.Log(float64(n)/float64(df))/math.Log(float64(n)))
+}
@@ -0,0 +1,71 @@
+// Copyright © 2023-2026 Wei Shen <shenwei356@gmail.com>
+
+package cmd
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSeedGenomeFreq(t *testing.T) {
+	value := func(genome uint64, pos uint64) uint64 {
+		return genome<<BITS_NONE_IDX | pos
+	}
+
+	// genomes 2 and 3 are chunks of the same genome
+	chunk2genome := map[uint64]uint64{2: 2, 3: 2}
+
+	var buf []uint64
+	for i, c := range []struct {
+		values       []uint64
+		chunk2genome map[uint64]uint64
+		expected     int
+	}{
+		{nil, nil, 0},
+		{[]uint64{value(1, 10)}, nil, 1},
+		{[]uint64{value(1, 10), value(1, 20), value(5, 30)}, nil, 2},
+		// values of a genome are not contiguous
+		{[]uint64{value(1, 10), value(5, 30), value(1, 20), value(5, 10)}, nil, 2},
+		{[]uint64{value(2, 10), value(1, 30), value(3, 20)}, nil, 3},
+		{[]uint64{value(2, 10), value(1, 30), value(3, 20)}, chunk2genome, 2},
+	} {
+		if df := seedGenomeFreq(c.values, c.chunk2genome, 0, &buf); df != c.expected {
+			t.Errorf("case %d: expected %d, result %d", i, c.expected, df)
+		}
+	}
+
+	// many genomes, with the buffer reused
+	values := make([]uint64, 0, 3000)
+	for g := uint64(0); g < 1000; g++ {
+		values = append(values, value(g, 1), value(999-g, 2), value(g, 3))
+	}
+	if df := seedGenomeFreq(values, nil, 0, &buf); df != 1000 {
+		t.Errorf("expected %d, result %d", 1000, df)
+	}
+
+	// the counting stops once the number exceeds the limit
+	if df := seedGenomeFreq(values, nil, 10, &buf); df != 11 {
+		t.Errorf("expected %d with a limit of 10, result %d", 11, df)
+	}
+}
+
+func TestSampleSeedHits(t *testing.T) {
+	values := []uint64{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}
+
+	var buf []uint64
+	if s := sampleSeedHits(values, 0, &buf); !reflect.DeepEqual(s, values) {
+		t.Errorf("unexpected result without a limit: %v", s)
+	}
+	if s := sampleSeedHits(values, 20, &buf); !reflect.DeepEqual(s, values) {
+		t.Errorf("unexpected result with a big limit: %v", s)
+	}
+	if s, want := sampleSeedHits(values, 3, &buf), []uint64{0, 3, 6}; !reflect.DeepEqual(s, want) {
+		t.Errorf("unexpected sampled values: %v, want %v", s, want)
+	}
+	if s, want := sampleSeedHits(values, 5, &buf), []uint64{0, 2, 4, 6, 8}; !reflect.DeepEqual(s, want) {
+		t.Errorf("unexpected sampled values: %v, want %v", s, want)
+	}
+	if values[1] != 1 {
+		t.Errorf("the values are modified")
+	}
+}
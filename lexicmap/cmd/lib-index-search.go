@@ -26,7 +26,6 @@ import (
 	"cmp"
 	"fmt"
 	"io"
-	"io/fs"
 	"math"
 	"math/bits"
 	"os"
@@ -34,6 +33,7 @@ import (
 	"runtime"
 	"slices"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 	"unsafe"
@@ -65,6 +65,8 @@ type IndexSearchingOptions struct {
 	MaxSeedSearchingConcurrency int
 
 	InMemorySearch bool  // load the seed/kv data into memory
+	UseMmap        bool  // memory-map seed and genome data files, readers share the mappings without file handlers
+	SeedCacheSize  int64 // maximum size of the cache of decoded seed data, 0 for no cache
 	MinPrefix      uint8 // minimum prefix length, e.g., 15
 	// MaxMismatch     int   // maximum mismatch, e.g., 3
 	MinSinglePrefix uint8 // minimum prefix length of the single seed, e.g., 20
@@ -72,6 +74,17 @@ type IndexSearchingOptions struct {
 	TopN       int // keep the topN scores, e.g, 10
 	TopNChains int // keep the top N chains
 
+	// query masking
+	QueryDust        bool // mask low-complexity regions in queries with DUST
+	QueryDustWindow  int  // window size of DUST, e.g., 64
+	QueryDustLevel   int  // score threshold of DUST, e.g., 20
+	QuerySoftMasking bool // treat lowercase bases in queries as soft-masked
+
+	// ubiquitous seeds
+	SeedIDF           bool    // weight seed scores by the inverse genome frequency in ranking genomes
+	SeedMaxGenomeFreq float64 // skip seeds found in more than this fraction of genomes, 0 or 1 for no limit
+	SeedMaxHits       int     // only keep N evenly sampled hits of a seed, 0 for no limit
+
 	// seeds chaining
 	MaxGap      float64 // e.g., 5000
 	MaxDistance float64 // e.g., 20k
@@ -147,7 +160,8 @@ var DefaultIndexSearchingOptions = IndexSearchingOptions{
 type Index struct {
 	path string
 
-	info *IndexInfo // index info
+	info   *IndexInfo   // index info
+	layout *IndexLayout // paths of seed chunks and genome batches
 
 	openFileTokens chan int // control the max open files
 
@@ -163,9 +177,10 @@ type Index struct {
 	// k-mer-value searchers
 	Searchers         []*kv.Searcher
 	InMemorySearchers []*kv.InMemorySearcher
-	searcherTokens    []chan int // make sure one seachers is only used by one query
-	poolKmers         *sync.Pool // for suffix index
-	poolLocses        *sync.Pool // for suffix index
+	searcherTokens    []chan int    // make sure one seachers is only used by one query
+	seedCache         *kv.SeedCache // cache of decoded seed data shared by all searchers, optional
+	poolKmers         *sync.Pool    // for suffix index
+	poolLocses        *sync.Pool    // for suffix index
 
 	// general options, and some for seed searching
 	opt *IndexSearchingOptions
@@ -184,6 +199,7 @@ type Index struct {
 	// genome data reader
 	poolGenomeRdrs []chan *genome.Reader
 	hasGenomeRdrs  bool
+	mmapGenomes    []*genome.MmapData // memory-mapped genome data, only for UseMmap
 
 	BatchGenomeIndex2GenomeID map[uint64][]byte
 
@@ -193,10 +209,16 @@ type Index struct {
 	poolGenomeChunksIdx2List     *sync.Pool
 	poolGenomeChunksPointer2List *sync.Pool
 	genomeChunksIdx              map[uint64][2]uint32 // batch+ref index -> #chunks, chunk index
+	genomeChunk2Genome           map[uint64]uint64    // batch+ref index -> that of the first chunk
 
 	// totalBases
 	totalBases int64
 
+	// number of genomes, where chunks of a split genome are counted once
+	nGenomes int
+	// seeds found in more than this number of genomes are skipped, 0 for no limit
+	maxSeedGenomes int
+
 	// filter results by taxid
 	filterByTaxId         bool
 	filterByPositiveTaxId bool
@@ -270,19 +292,26 @@ func NewIndexSearcher(outDir string, opt *IndexSearchingOptions) (*Index, error)
 		return idx, nil
 	}
 
-	ok, err := pathutil.DirExists(outDir)
-	if err != nil {
-		return nil, err
-	}
-	if !ok {
-		return nil, fmt.Errorf("index path not found: %s", outDir)
+	// index files of a remote index (a URL) are read with range requests,
+	// while small files in the root directory are fetched as a whole.
+	if !util.IsRemote(outDir) {
+		ok, err := pathutil.DirExists(outDir)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("index path not found: %s", outDir)
+		}
 	}
 
 	idx := &Index{path: outDir, opt: opt}
 
 	// -----------------------------------------------------
 	// info file
-	fileInfo := filepath.Join(outDir, FileInfo)
+	fileInfo, err := util.FetchFile(filepath.Join(outDir, FileInfo))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read info file: %s", err)
+	}
 	info, err := readIndexInfo(fileInfo)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read info file: %s", err)
@@ -290,6 +319,16 @@ func NewIndexSearcher(outDir string, opt *IndexSearchingOptions) (*Index, error)
 	if info.MainVersion != MainVersion {
 		checkError(fmt.Errorf("index main versions do not match: %d (index) != %d (tool). please re-create the index", info.MainVersion, MainVersion))
 	}
+	idx.layout, err = NewIndexLayout(outDir, info)
+	if err != nil {
+		return nil, err
+	}
+	if err = idx.layout.CheckRoots(); err != nil {
+		return nil, err
+	}
+	if opt.UseMmap && idx.layout.Remote() {
+		return nil, fmt.Errorf("memory-mapping is not supported for remote indexes: %s", outDir)
+	}
 	if info.InputBases == 0 {
 		// checkError(fmt.Errorf(`please run "lexicmap utils recount-bases -d %s"`, outDir))
 		startTime := time.Now()
@@ -307,7 +346,7 @@ func NewIndexSearcher(outDir string, opt *IndexSearchingOptions) (*Index, error)
 
 	idx.info = info
 
-	if idx.opt.MaxOpenFiles < info.Chunks+2 {
+	if !idx.opt.UseMmap && idx.opt.MaxOpenFiles < info.Chunks+2 {
 		return nil, fmt.Errorf("max open files (%d) should not be < chunks (%d) + 2",
 			idx.opt.MaxOpenFiles, info.Chunks)
 	}
@@ -355,7 +394,11 @@ func NewIndexSearcher(outDir string, opt *IndexSearchingOptions) (*Index, error)
 			}
 
 			// genomes.map.bin
-			fh, err := os.Open(filepath.Join(idx.path, FileGenomeIndex))
+			fileGenomeIndex, err := util.FetchFile(filepath.Join(idx.path, FileGenomeIndex))
+			if err != nil {
+				checkError(fmt.Errorf("  failed to read genome index mapping file: %s", err))
+			}
+			fh, err := os.Open(fileGenomeIndex)
 			if err != nil {
 				checkError(fmt.Errorf("  failed to read genome index mapping file: %s", err))
 			}
@@ -423,7 +466,10 @@ func NewIndexSearcher(outDir string, opt *IndexSearchingOptions) (*Index, error)
 
 	// -----------------------------------------------------
 	// read masks
-	fileMask := filepath.Join(outDir, FileMasks)
+	fileMask, err := util.FetchFile(filepath.Join(outDir, FileMasks))
+	if err != nil {
+		return nil, err
+	}
 	if opt.Verbose || opt.Log2File {
 		log.Infof("  reading masks...")
 	}
@@ -501,9 +547,11 @@ func NewIndexSearcher(outDir string, opt *IndexSearchingOptions) (*Index, error)
 
 	// -----------------------------------------------------
 	// read genome chunks data if existed
-	fileGenomeChunks := filepath.Join(outDir, FileGenomeChunks)
-	idx.genomeChunks, err = readGenomeChunksLists(fileGenomeChunks)
-	if err != nil {
+	fileGenomeChunks, err := util.FetchFile(filepath.Join(outDir, FileGenomeChunks))
+	if err == nil {
+		idx.genomeChunks, err = readGenomeChunksLists(fileGenomeChunks)
+	}
+	if err != nil && !os.IsNotExist(err) { // the file is optional
 		return nil, err
 	}
 	if len(idx.genomeChunks) > 0 {
@@ -535,6 +583,24 @@ func NewIndexSearcher(outDir string, opt *IndexSearchingOptions) (*Index, error)
 			}
 		}
 		idx.genomeChunksIdx = m
+
+		// batch+ref index -> that of the first chunk, for counting genomes of seeds
+		m2 := make(map[uint64]uint64, len(m))
+		for _, idxs := range idx.genomeChunks {
+			for _, i := range idxs {
+				m2[i] = idxs[0]
+			}
+		}
+		idx.genomeChunk2Genome = m2
+	}
+
+	// genomes and the frequency limit of seeds
+	idx.nGenomes = info.Genomes
+	for _, idxs := range idx.genomeChunks {
+		idx.nGenomes -= len(idxs) - 1
+	}
+	if idx.opt.SeedMaxGenomeFreq > 0 && idx.opt.SeedMaxGenomeFreq < 1 {
+		idx.maxSeedGenomes = max(int(idx.opt.SeedMaxGenomeFreq*float64(idx.nGenomes)), 1)
 	}
 	// -----------------------------------------------------
 	// read index of seeds
@@ -542,17 +608,14 @@ func NewIndexSearcher(outDir string, opt *IndexSearchingOptions) (*Index, error)
 	inMemorySearch := idx.opt.InMemorySearch
 
 	threads := opt.NumCPUs
-	dirSeeds := filepath.Join(outDir, DirSeeds)
-	fileSeeds := make([]string, 0, 64)
-	fs.WalkDir(os.DirFS(dirSeeds), ".", func(p string, d fs.DirEntry, err error) error {
-		if filepath.Ext(p) == ExtSeeds {
-			fileSeeds = append(fileSeeds, filepath.Join(dirSeeds, p))
-		}
-		return nil
-	})
+	// seed chunks might be placed in multiple shard roots
+	fileSeeds := make([]string, 0, info.Chunks)
+	for chunk := 0; chunk < info.Chunks; chunk++ {
+		fileSeeds = append(fileSeeds, idx.layout.SeedFile(chunk))
+	}
 
 	if len(fileSeeds) == 0 {
-		return nil, fmt.Errorf("seeds file not found in: %s", dirSeeds)
+		return nil, fmt.Errorf("seeds file not found in: %s", filepath.Join(outDir, DirSeeds))
 	}
 	if inMemorySearch {
 		idx.InMemorySearchers = make([]*kv.InMemorySearcher, 0, len(fileSeeds))
@@ -582,7 +645,7 @@ func NewIndexSearcher(outDir string, opt *IndexSearchingOptions) (*Index, error)
 	}}
 
 	// check options again
-	if opt.MaxOpenFiles < len(fileSeeds) {
+	if !opt.UseMmap && opt.MaxOpenFiles < len(fileSeeds) {
 		return nil, fmt.Errorf("MaxOpenFiles (%d) should be > number of seeds files (%d), or even bigger", opt.MaxOpenFiles, len(fileSeeds))
 	}
 	idx.openFileTokens = make(chan int, opt.MaxOpenFiles) // tokens
@@ -592,10 +655,19 @@ func NewIndexSearcher(outDir string, opt *IndexSearchingOptions) (*Index, error)
 	if opt.Verbose || opt.Log2File {
 		if inMemorySearch {
 			log.Infof("  reading seeds (k-mer-value) data into memory...")
+		} else if opt.UseMmap {
+			log.Infof("  reading indexes of seeds (k-mer-value) data and memory-mapping the data...")
 		} else {
 			log.Infof("  reading indexes of seeds (k-mer-value) data...")
 		}
 	}
+
+	if !inMemorySearch && opt.SeedCacheSize > 0 {
+		idx.seedCache = kv.NewSeedCache(opt.SeedCacheSize)
+		if opt.Verbose || opt.Log2File {
+			log.Infof("  caching decoded seed data with a maximum size of %s", humanize.IBytes(uint64(opt.SeedCacheSize)))
+		}
+	}
 	done := make(chan int)
 	var ch chan *kv.Searcher
 	var chIM chan *kv.InMemorySearcher
@@ -634,7 +706,9 @@ func NewIndexSearcher(outDir string, opt *IndexSearchingOptions) (*Index, error)
 
 				idx.Searchers = append(idx.Searchers, scr)
 
-				idx.openFileTokens <- 1 // increase the number of open files
+				if !opt.UseMmap {
+					idx.openFileTokens <- 1 // increase the number of open files
+				}
 			}
 			done <- 1
 		}()
@@ -670,10 +744,19 @@ func NewIndexSearcher(outDir string, opt *IndexSearchingOptions) (*Index, error)
 
 				chIM <- scr
 			} else { // just read the index data
-				scr, err := kv.NewSearcherWithMaskSelection(file, idx.opt.MaxSeedSearchingConcurrency, idx.maskSelection)
+				var scr *kv.Searcher
+				var err error
+				if opt.UseMmap {
+					scr, err = kv.NewSearcherWithMmap(file, idx.opt.MaxSeedSearchingConcurrency, idx.maskSelection)
+				} else {
+					scr, err = kv.NewSearcherWithMaskSelection(file, idx.opt.MaxSeedSearchingConcurrency, idx.maskSelection)
+				}
 				if err != nil {
 					checkError(fmt.Errorf("failed to create a searcher from file: %s: %s", file, err))
 				}
+				if idx.seedCache != nil {
+					scr.SetCache(idx.seedCache)
+				}
 
 				ch <- scr
 			}
@@ -692,7 +775,41 @@ func NewIndexSearcher(outDir string, opt *IndexSearchingOptions) (*Index, error)
 
 	// we can create genome reader pools
 	n := (idx.opt.MaxOpenFiles - len(fileSeeds)*idx.opt.MaxSeedSearchingConcurrency - 1) / info.GenomeBatches // 1 is for the output file
-	if n < 1 {
+	if opt.UseMmap {
+		// readers of memory-mapped data need no file handlers
+		if opt.Verbose || opt.Log2File {
+			log.Infof("  memory-mapping %d genome batches, each with %d readers...", info.GenomeBatches, opt.NumCPUs)
+		}
+		idx.mmapGenomes = make([]*genome.MmapData, info.GenomeBatches)
+		idx.poolGenomeRdrs = make([]chan *genome.Reader, info.GenomeBatches)
+
+		var wg sync.WaitGroup
+		tokens := make(chan int, opt.NumCPUs)
+		for i := 0; i < info.GenomeBatches; i++ {
+			tokens <- 1
+			wg.Add(1)
+			go func(i int) {
+				fileGenomes := idx.layout.GenomeFile(i)
+				m, err := genome.NewMmapData(fileGenomes)
+				if err != nil {
+					checkError(fmt.Errorf("failed to memory-map genome data: %s", err))
+				}
+				idx.mmapGenomes[i] = m
+
+				pool := make(chan *genome.Reader, opt.NumCPUs)
+				for j := 0; j < opt.NumCPUs; j++ {
+					pool <- m.NewReader()
+				}
+				idx.poolGenomeRdrs[i] = pool
+
+				wg.Done()
+				<-tokens
+			}(i)
+		}
+		wg.Wait()
+
+		idx.hasGenomeRdrs = true
+	} else if n < 1 {
 		idx.hasGenomeRdrs = false
 		log.Warningf("  no reader pools created for %d genome batches, please consider increasing the number of max open files (%d).",
 			info.GenomeBatches, idx.opt.MaxOpenFiles)
@@ -716,7 +833,7 @@ func NewIndexSearcher(outDir string, opt *IndexSearchingOptions) (*Index, error)
 				tokens <- 1
 				wg.Add(1)
 				go func(i int) {
-					fileGenomes := filepath.Join(outDir, DirGenomes, batchDir(i), FileGenomes)
+					fileGenomes := idx.layout.GenomeFile(i)
 					rdr, err := genome.NewReader(fileGenomes)
 					if err != nil {
 						checkError(fmt.Errorf("failed to create genome reader: %s", err))
@@ -756,6 +873,15 @@ func NewIndexSearcher(outDir string, opt *IndexSearchingOptions) (*Index, error)
 	return idx, nil
 }
 
+// SeedCacheStats returns statistics of the cache of decoded seed data,
+// and false if the cache is not used.
+func (idx *Index) SeedCacheStats() (kv.SeedCacheStats, bool) {
+	if idx.seedCache == nil {
+		return kv.SeedCacheStats{}, false
+	}
+	return idx.seedCache.Stats(), true
+}
+
 // Close closes the searcher.
 func (idx *Index) Close() error {
 	var _err error
@@ -795,9 +921,64 @@ func (idx *Index) Close() error {
 		}
 		wg.Wait()
 	}
+	for _, m := range idx.mmapGenomes {
+		err := m.Close()
+		if err != nil {
+			_err = err
+		}
+	}
 	return _err
 }
 
+// SubSeq2 extracts the subsequence of a sequence (seqid) in a genome,
+// from start to end (both are 0-based and included).
+// As a genome might be split into multiple chunks, all batch+ref indexes
+// of the genome, returned by readGenomeMapName2Idx, should be given.
+// It also returns the actual end position (0-based).
+// Please call genome.RecycleGenome() after using the result.
+func (idx *Index) SubSeq2(batchIDAndRefIDs *[]uint64, seqid []byte, start int, end int) (*genome.Genome, int, error) {
+	var rdr *genome.Reader
+	var tSeq *genome.Genome
+	var _end, genomeBatch, genomeIdx int
+	var err error
+	for _, batchIDAndRefID := range *batchIDAndRefIDs {
+		genomeBatch = int(batchIDAndRefID >> BITS_GENOME_IDX)
+		genomeIdx = int(batchIDAndRefID & MASK_GENOME_IDX)
+
+		if idx.hasGenomeRdrs {
+			rdr = <-idx.poolGenomeRdrs[genomeBatch]
+		} else {
+			idx.openFileTokens <- 1 // genome file
+			fileGenome := idx.layout.GenomeFile(genomeBatch)
+			rdr, err = genome.NewReader(fileGenome)
+			if err != nil {
+				<-idx.openFileTokens
+				return nil, -1, fmt.Errorf("failed to read genome data file: %s", err)
+			}
+		}
+
+		tSeq, _end, err = rdr.SubSeq2(genomeIdx, seqid, start, end)
+
+		if idx.hasGenomeRdrs {
+			idx.poolGenomeRdrs[genomeBatch] <- rdr
+		} else {
+			if err := rdr.Close(); err != nil {
+				checkError(fmt.Errorf("failed to close genome data file: %s", err))
+			}
+			<-idx.openFileTokens
+		}
+
+		if err == nil && tSeq != nil {
+			return tSeq, _end, nil
+		}
+		// the sequence might not be in this genome chunk
+	}
+	if err == nil {
+		err = fmt.Errorf("seqid not found: %s", seqid)
+	}
+	return nil, -1, err
+}
+
 // --------------------------------------------------------------------------
 // structs for seeding results
 
@@ -1034,6 +1215,9 @@ type SearchResult struct {
 	Score  float32 //  score for sorting
 	Chains *[]*[]int32
 
+	seedLen    float32 // total length of matched seeds, only for SeedIDF
+	seedWeight float32 // total length of matched seeds weighted by the inverse genome frequency
+
 	// more about the alignment detail
 	SimilarityDetails *[]*SimilarityDetail // sequence comparing
 	AlignedFraction   float64              // query coverage per genome
@@ -1130,6 +1314,16 @@ func (r *SearchResult) Reset() {
 	r.Chains = nil
 	r.SimilarityDetails = nil
 	r.AlignedFraction = 0
+	r.seedLen = 0
+	r.seedWeight = 0
+}
+
+// rankingScore returns the chaining score scaled by the mean weight of matched seeds.
+func (r *SearchResult) rankingScore() float32 {
+	if r.seedLen == 0 {
+		return r.Score
+	}
+	return r.Score * r.seedWeight / r.seedLen
 }
 
 // RecycleSearchResults recycles a search result object
@@ -1202,22 +1396,226 @@ func (idx *Index) Search(query *Query, genomeIds *map[uint64]*[]uint64, debug bo
 		}()
 	}
 
-	s := query.seq
+	stats := query.stats
+	var timeSeeding time.Time
+	if stats != nil {
+		timeSeeding = time.Now()
+	}
 
 	// ----------------------------------------------------------------
 	// 1) mask the query sequence
 
+	_kmers, _locses, err := idx.maskQuery(query, debug)
+	if err != nil {
+		return nil, err
+	}
+	defer idx.lh.RecycleMaskResult(_kmers, _locses)
+
+	// ----------------------------------------------------------------
+	// 2) matching the captured k-mers in databases
+
+	// a map for collecting matches for each reference: IdIdx -> result
+	m := poolSearchResultsMap.Get().(*map[int]*SearchResult)
+
+	inMemorySearch := idx.opt.InMemorySearch
+
+	var searchers []*kv.Searcher
+	var searchersIM []*kv.InMemorySearcher
+	var nSearchers int
+
+	if inMemorySearch {
+		searchersIM = idx.InMemorySearchers
+		nSearchers = len(searchersIM)
+	} else {
+		searchers = idx.Searchers
+		nSearchers = len(searchers)
+	}
+
+	minPrefix := idx.opt.MinPrefix
+	// maxMismatch := idx.opt.MaxMismatch
+
+	ch := make(chan *[]*kv.SearchResult, nSearchers)
+	done := make(chan int) // later, we will reuse this
+	var wg sync.WaitGroup
+	var beginM, endM int // range of mask of a chunk
+
+	// -----------------------
+	// reverse k-mers
+	_kmersR, _locsesR := idx.reverseKmers(_kmers)
+	// -----------------------
+
+	// 2.2) collect search results, they will be kept in RAM.
+	// For quries with a lot of hits, the memory would be high.
+	// And it's inevitable currently, but if we do want to decrease the memory usage,
+	// we can write these matches in temporal files.
+	collector := idx.newSeedCollector(m, genomeIds)
+	collector.stats = stats
+	go func() {
+		var locs []int
+		for srs := range ch {
+			// different k-mers in subjects,
+			// most of cases, there are more than one
+			for _, sr := range *srs {
+				// locations in the query
+				// multiple locations for each QUERY k-mer,
+				// but most of cases, there's only one.
+				if !sr.IsSuffix {
+					locs = (*_locses)[sr.IQuery] // the mask is unknown
+				} else {
+					locs = (*_locses)[(*(*_locsesR)[sr.IQuery])[sr.IQuery2]] // the mask is unknown
+				}
+				collector.add(sr, locs)
+			}
+
+			kv.RecycleSearchResults(srs)
+		}
+
+		collector.close()
+		done <- 1
+	}()
+
+	// 2.1) search with multiple searchers
+	for iS := 0; iS < nSearchers; iS++ {
+		if inMemorySearch {
+			beginM = searchersIM[iS].ChunkIndex
+			endM = searchersIM[iS].ChunkIndex + searchersIM[iS].ChunkSize
+		} else {
+			beginM = searchers[iS].ChunkIndex
+			endM = searchers[iS].ChunkIndex + searchers[iS].ChunkSize
+		}
+
+		wg.Add(1)
+		go func(iS, beginM, endM int) {
+			var srs *[]*kv.SearchResult
+			var srs2 *[]*kv.SearchResult
+			var err error
+			if inMemorySearch {
+				// prefix search
+				// srs, err = searchersIM[iS].Search((*_kmers)[beginM:endM], minPrefix, maxMismatch)
+				srs, err = searchersIM[iS].Search((*_kmers)[beginM:endM], minPrefix, true, false)
+				if err != nil {
+					checkError(err)
+				}
+
+				// suffix search
+				srs2, err = searchersIM[iS].Search2((*_kmersR)[beginM:endM], minPrefix, true, true)
+				if err != nil {
+					checkError(err)
+				}
+				if len(*srs2) > 0 {
+					*srs = append(*srs, (*srs2)...)
+					*srs2 = (*srs2)[:0] // important
+				}
+				kv.RecycleSearchResults(srs2)
+			} else {
+				idx.searcherTokens[iS] <- 1 // get the access to the searcher
+
+				// prefix search
+				// srs, err = searchers[iS].Search((*_kmers)[beginM:endM], minPrefix, maxMismatch)
+				srs, err = searchers[iS].Search((*_kmers)[beginM:endM], minPrefix, true, false)
+				if err != nil {
+					checkError(err)
+				}
+
+				// suffix search
+				srs2, err = searchers[iS].Search2((*_kmersR)[beginM:endM], minPrefix, true, true)
+				if err != nil {
+					checkError(err)
+				}
+				if len(*srs2) > 0 {
+					*srs = append(*srs, (*srs2)...)
+					*srs2 = (*srs2)[:0] // important
+				}
+				kv.RecycleSearchResults(srs2)
+
+				<-idx.searcherTokens[iS] // return the access
+			}
+			if err != nil {
+				checkError(err)
+			}
+
+			if len(*srs) == 0 { // no matcheds
+				kv.RecycleSearchResults(srs)
+			} else {
+				ch <- srs // send result
+			}
+
+			wg.Done()
+			// <-tokensS
+		}(iS, beginM, endM)
+	}
+	wg.Wait()
+	close(ch)
+	<-done
+
+	idx.recycleReversedKmers(_kmersR, _locsesR)
+
+	if debug {
+		if idx.filterByTaxId {
+			log.Debugf("%s (%s bp): finished seed-matching with filtering by TaxId (%s genome hits) in %s",
+				query.seqID, humanize.Comma(int64(len(query.seq))), humanize.Comma(int64(len(*m))), time.Since(startTime))
+		} else {
+			log.Debugf("%s (%s bp): finished seed-matching (%s genome hits) in %s",
+				query.seqID, humanize.Comma(int64(len(query.seq))), humanize.Comma(int64(len(*m))), time.Since(startTime))
+		}
+		if collector.nSkippedSeeds > 0 {
+			log.Debugf("%s (%s bp): %s matched seeds found in more than %s genomes are skipped",
+				query.seqID, humanize.Comma(int64(len(query.seq))), humanize.Comma(int64(collector.nSkippedSeeds)),
+				humanize.Comma(int64(idx.maxSeedGenomes)))
+		}
+
+		startTime = time.Now()
+	}
+
+	if stats != nil {
+		stats.TimeSeeding = time.Since(timeSeeding)
+	}
+
+	return idx.chainAndAlign(query, m, debug, startTime)
+}
+
+// maskQuery masks the query sequence and returns the captured k-mers and their locations,
+// with low-complexity k-mers set to 0.
+// Please remember to recycle the results with idx.lh.RecycleMaskResult.
+func (idx *Index) maskQuery(query *Query, debug bool) (*[]uint64, *[][]int, error) {
+	s := query.seq
+
 	// _kmers, _locses, err := idx.lh.Mask(s, nil)
 	// _kmers, _locses, err := idx.lh.MaskKnownPrefixes(s, nil)
 	funcMask := idx.lh.MaskKnownDistinctPrefixes
 	if idx.info.MainVersion == 3 && idx.info.MinorVersion < 5 { // for backward compatibility
 		funcMask = idx.lh.MaskKnownDistinctPrefixesWithStrandBias
 	}
-	_kmers, _locses, err := funcMask(s, nil, true)
+
+	// masked regions are not seeded, but they are still used in alignment
+	var skipRegions [][2]int
+	if idx.opt.QueryDust {
+		query.maskRegions = util.DustRegions(s, idx.opt.QueryDustWindow, idx.opt.QueryDustLevel, query.maskRegions)
+	}
+	if len(query.maskRegions) > 0 {
+		query.maskRegions = util.MergeRegions(query.maskRegions)
+		skipRegions = query.maskRegions
+
+		if debug {
+			var buf strings.Builder
+			var masked int
+			for i, r := range skipRegions {
+				masked += r[1] - r[0] + 1
+				if i > 0 {
+					buf.WriteByte(',')
+				}
+				fmt.Fprintf(&buf, "%d-%d", r[0]+1, r[1]+1)
+			}
+			log.Debugf("%s (%s bp): %d masked regions (%s bp, %.2f%%) not seeded: %s",
+				query.seqID, humanize.Comma(int64(len(s))), len(skipRegions), humanize.Comma(int64(masked)),
+				float64(masked)/float64(len(s))*100, buf.String())
+		}
+	}
+
+	_kmers, _locses, err := funcMask(s, skipRegions, true)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	defer idx.lh.RecycleMaskResult(_kmers, _locses)
 
 	// remove low-complexity k-mers
 	k8 := idx.k8
@@ -1237,18 +1635,27 @@ func (idx *Index) Search(query *Query, genomeIds *map[uint64]*[]uint64, debug bo
 		}
 	}
 
-	// ----------------------------------------------------------------
-	// 2) matching the captured k-mers in databases
-
-	// a map for collecting matches for each reference: IdIdx -> result
-	m := poolSearchResultsMap.Get().(*map[int]*SearchResult)
+	if query.stats != nil {
+		var n int
+		for _, kmer := range *_kmers {
+			if kmer != 0 {
+				n++
+			}
+		}
+		query.stats.MaskedKmers = n
+	}
 
-	inMemorySearch := idx.opt.InMemorySearch
+	return _kmers, _locses, nil
+}
 
+// reverseKmers reverses captured k-mers for suffix matching, and assigns them to the masks
+// with the minimum hash values. Locations of the returned k-mers are the indexes of the original masks.
+// Please remember to recycle the results with idx.recycleReversedKmers.
+func (idx *Index) reverseKmers(_kmers *[]uint64) (*[]*[]uint64, *[]*[]int) {
 	var searchers []*kv.Searcher
 	var searchersIM []*kv.InMemorySearcher
 	var nSearchers int
-
+	inMemorySearch := idx.opt.InMemorySearch
 	if inMemorySearch {
 		searchersIM = idx.InMemorySearchers
 		nSearchers = len(searchersIM)
@@ -1256,17 +1663,9 @@ func (idx *Index) Search(query *Query, genomeIds *map[uint64]*[]uint64, debug bo
 		searchers = idx.Searchers
 		nSearchers = len(searchers)
 	}
-
-	minPrefix := idx.opt.MinPrefix
-	// maxMismatch := idx.opt.MaxMismatch
-
-	ch := make(chan *[]*kv.SearchResult, nSearchers)
-	done := make(chan int) // later, we will reuse this
 	var wg sync.WaitGroup
 	var beginM, endM int // range of mask of a chunk
 
-	// -----------------------
-	// reverse k-mers
 	_kmersR := idx.poolKmers.Get().(*[]*[]uint64)
 	_locsesR := idx.poolLocses.Get().(*[]*[]int)
 
@@ -1348,322 +1747,277 @@ func (idx *Index) Search(query *Query, genomeIds *map[uint64]*[]uint64, debug bo
 	wg.Wait()
 	close(chR)
 	<-doneR
-	// -----------------------
 
-	// 2.2) collect search results, they will be kept in RAM.
-	// For quries with a lot of hits, the memory would be high.
-	// And it's inevitable currently, but if we do want to decrease the memory usage,
-	// we can write these matches in temporal files.
-	go func() {
-		var refpos uint64
-
-		// query substring
-		var posQ int
-		var beginQ int
-		var rcQ bool
-
-		// var qCode, tCode uint64
-		var kPrefix int
-		var refBatchAndIdx, posT, beginT int
-		// var mismatch uint8
-		var rcT bool
-		var rvT bool
-
-		K := idx.k
-		// K8 := idx.k8
-		var locs []int
-		var sr *kv.SearchResult
-		var ok bool
+	return _kmersR, _locsesR
+}
 
-		// filter by taxid
-		var refBatchAndIdxUint64 uint64
-		var filter *map[uint64]bool
-		filterByTaxId := idx.filterByTaxId
-		filterByPositiveTaxId := idx.filterByPositiveTaxId
-		filterByNegativeTaxId := idx.filterByNegativeTaxId
-		if filterByTaxId {
-			filter = idx.poolTaxIDfilter.Get().(*map[uint64]bool)
-		}
-		var keepGenome, matchOne bool
-		taxon := idx.Taxonomy
-		genomeIdx2TaxId := idx.genomeIdx2TaxId
-		keepGenomesWithoutTaxId := idx.opt.KeepGenomesWithoutTaxId
-		var _taxid, taxid uint32
-		taxids := idx.opt.TaxIds
-		negativeTaxids := idx.opt.NegativeTaxIds
-
-		// filter by a list of BatchAndIdx
-		filterByGenomeID := genomeIds != nil
+// recycleReversedKmers recycles the results of reverseKmers.
+func (idx *Index) recycleReversedKmers(_kmersR *[]*[]uint64, _locsesR *[]*[]int) {
+	var v *[]uint64
+	for _, v = range *_kmersR {
+		*v = (*v)[:0]
+	}
 
-		for srs := range ch {
-			// different k-mers in subjects,
-			// most of cases, there are more than one
-			for _, sr = range *srs {
-				// matched length
-				kPrefix = int(sr.Len)
-				// mismatch = sr.Mismatch
-				// qCode = (*_kmers)[sr.IQuery]
+	var vl *[]int
+	for _, vl = range *_locsesR {
+		*vl = (*vl)[:0]
+	}
+	idx.poolKmers.Put(_kmersR)
+	idx.poolLocses.Put(_locsesR)
+}
 
-				// locations in the query
-				// multiple locations for each QUERY k-mer,
-				// but most of cases, there's only one.
-				if !sr.IsSuffix {
-					locs = (*_locses)[sr.IQuery] // the mask is unknown
-				} else {
-					locs = (*_locses)[(*(*_locsesR)[sr.IQuery])[sr.IQuery2]] // the mask is unknown
-					// fmt.Println(sr.IQuery, (*_locsesR)[sr.IQuery], locs)
-				}
-				for _, posQ = range locs {
-					// query k-mers do not have the reverse flag !!!!
-					rcQ = posQ&MASK_STRAND > 0 // if on the reverse complement sequence
-					posQ >>= BITS_STRAND
-
-					// matched
-					// code = util.KmerPrefix(sr.Kmer, K8, sr.LenPrefix)
-					// tCode = sr.Kmer
-
-					// multiple locations for each MATCHED k-mer
-					// but most of cases, there's only one.
-					for _, refpos = range sr.Values {
-						// refBatchAndIdx = int(refpos >> 30) // batch+refIdx
-						refBatchAndIdxUint64 = refpos >> BITS_NONE_IDX // batch+refIdx
-
-						// filter by a white list of subject batch+refIdx
-						if filterByGenomeID {
-							if _, ok = (*genomeIds)[refBatchAndIdxUint64]; !ok {
-								continue
-							}
-						}
+// seedCollector collects matched seeds of a query into search results of genomes.
+type seedCollector struct {
+	idx       *Index
+	m         *map[int]*SearchResult // genome -> search result
+	genomeIds *map[uint64]*[]uint64  // optional white list of batch+refIdx
+	filter    *map[uint64]bool       // cache of filtering by TaxId
 
-						refBatchAndIdx = int(refBatchAndIdxUint64)
+	nSkippedSeeds int      // number of ubiquitous seeds skipped
+	dfBuf         []uint64 // buffer for counting genomes of seeds
+	hitsBuf       []uint64 // buffer for sampling hits of seeds
 
-						// filter by taxid
-						if filterByTaxId {
-							if keepGenome, ok = (*filter)[refBatchAndIdxUint64]; ok {
-								if !keepGenome {
-									continue
-								}
-							} else {
+	stats *QueryStats // optional
+}
 
-								if taxid, ok = genomeIdx2TaxId[refBatchAndIdxUint64]; ok {
-									// black list
-									if filterByNegativeTaxId {
-										matchOne = false
-										for _, _taxid = range negativeTaxids {
-											if taxon.LCA(taxid, _taxid) == _taxid {
-												matchOne = true
-												break
-											}
-										}
-										if matchOne {
-											(*filter)[refBatchAndIdxUint64] = false
-											continue
-										} else if !filterByPositiveTaxId {
-											(*filter)[refBatchAndIdxUint64] = true
-											continue
-										}
-									}
+// newSeedCollector creates a seedCollector.
+func (idx *Index) newSeedCollector(m *map[int]*SearchResult, genomeIds *map[uint64]*[]uint64) *seedCollector {
+	c := &seedCollector{idx: idx, m: m, genomeIds: genomeIds}
+	if idx.filterByTaxId {
+		c.filter = idx.poolTaxIDfilter.Get().(*map[uint64]bool)
+	}
+	return c
+}
 
-									// white list
-									if filterByPositiveTaxId {
-										matchOne = false
-										for _, _taxid = range taxids {
-											if taxon.LCA(taxid, _taxid) == _taxid {
-												matchOne = true
-												break
-											}
-										}
-										if matchOne {
-											(*filter)[refBatchAndIdxUint64] = true
-										} else {
-											(*filter)[refBatchAndIdxUint64] = false
-											continue
-										}
-									}
-								} else if !keepGenomesWithoutTaxId {
-									(*filter)[refBatchAndIdxUint64] = false
-									continue
-								}
-								(*filter)[refBatchAndIdxUint64] = true
-							}
-						}
+// close recycles the data.
+func (c *seedCollector) close() {
+	if c.filter != nil {
+		clear(*c.filter)
+		c.idx.poolTaxIDfilter.Put(c.filter)
+		c.filter = nil
+	}
+}
 
-						// posT = int(refpos << 34 >> 35)
-						posT = int(refpos << BITS_IDX >> BITS_IDX_FLAGS)
-						rvT = refpos&MASK_REVERSE > 0
-						rcT = refpos>>BITS_REVERSE&MASK_STRAND > 0
+// add adds a matched k-mer with its locations in the query.
+// The search result of the k-mer is not modified.
+func (c *seedCollector) add(sr *kv.SearchResult, locs []int) {
+	idx := c.idx
+	m := c.m
+	genomeIds := c.genomeIds
 
-						if !rvT {
-							// query location
-							if rcQ { // on the negative strand
-								beginQ = posQ + K - kPrefix
-							} else {
-								beginQ = posQ
-							}
+	var refpos uint64
 
-							// subject location
-							if rcT {
-								beginT = posT + K - kPrefix
-							} else {
-								beginT = posT
+	// query substring
+	var posQ int
+	var beginQ int
+	var rcQ bool
+
+	var kPrefix int
+	var refBatchAndIdx, posT, beginT int
+	var rcT bool
+	var rvT bool
+
+	K := idx.k
+	var ok bool
+
+	// filter by taxid
+	var refBatchAndIdxUint64 uint64
+	filter := c.filter
+	filterByTaxId := idx.filterByTaxId
+	filterByPositiveTaxId := idx.filterByPositiveTaxId
+	filterByNegativeTaxId := idx.filterByNegativeTaxId
+	var keepGenome, matchOne bool
+	taxon := idx.Taxonomy
+	genomeIdx2TaxId := idx.genomeIdx2TaxId
+	keepGenomesWithoutTaxId := idx.opt.KeepGenomesWithoutTaxId
+	var _taxid, taxid uint32
+	taxids := idx.opt.TaxIds
+	negativeTaxids := idx.opt.NegativeTaxIds
+
+	// filter by a list of BatchAndIdx
+	filterByGenomeID := genomeIds != nil
+
+	// ubiquitous seeds
+	seedIDF := idx.opt.SeedIDF
+	maxSeedGenomes := idx.maxSeedGenomes
+	maxSeedHits := idx.opt.SeedMaxHits
+	checkSeedFreq := seedIDF || maxSeedGenomes > 0
+	var df int
+	var w float32
+
+	if checkSeedFreq {
+		df = seedGenomeFreq(sr.Values, idx.genomeChunk2Genome, maxSeedGenomes, &c.dfBuf)
+		if maxSeedGenomes > 0 && df > maxSeedGenomes {
+			c.nSkippedSeeds++
+			return
+		}
+		w = seedIDFWeight(df, idx.nGenomes)
+	}
+	values := sampleSeedHits(sr.Values, maxSeedHits, &c.hitsBuf)
+
+	// matched length
+	kPrefix = int(sr.Len)
+
+	var nSeeds int
+	if c.stats != nil {
+		defer func() { c.stats.SeedsPerPrefix[kPrefix] += nSeeds }()
+	}
+
+	for _, posQ = range locs {
+		// query k-mers do not have the reverse flag !!!!
+		rcQ = posQ&MASK_STRAND > 0 // if on the reverse complement sequence
+		posQ >>= BITS_STRAND
+
+		// multiple locations for each MATCHED k-mer
+		// but most of cases, there's only one.
+		for _, refpos = range values {
+			refBatchAndIdxUint64 = refpos >> BITS_NONE_IDX // batch+refIdx
+
+			// filter by a white list of subject batch+refIdx
+			if filterByGenomeID {
+				if _, ok = (*genomeIds)[refBatchAndIdxUint64]; !ok {
+					continue
+				}
+			}
+
+			refBatchAndIdx = int(refBatchAndIdxUint64)
+
+			// filter by taxid
+			if filterByTaxId {
+				if keepGenome, ok = (*filter)[refBatchAndIdxUint64]; ok {
+					if !keepGenome {
+						continue
+					}
+				} else {
+
+					if taxid, ok = genomeIdx2TaxId[refBatchAndIdxUint64]; ok {
+						// black list
+						if filterByNegativeTaxId {
+							matchOne = false
+							for _, _taxid = range negativeTaxids {
+								if taxon.LCA(taxid, _taxid) == _taxid {
+									matchOne = true
+									break
+								}
 							}
-						} else {
-							// query location
-							if rcQ { // on the negative strand
-								beginQ = posQ
-							} else {
-								beginQ = posQ + K - kPrefix
+							if matchOne {
+								(*filter)[refBatchAndIdxUint64] = false
+								continue
+							} else if !filterByPositiveTaxId {
+								(*filter)[refBatchAndIdxUint64] = true
+								continue
 							}
+						}
 
-							// subject location
-							if rcT {
-								beginT = posT
+						// white list
+						if filterByPositiveTaxId {
+							matchOne = false
+							for _, _taxid = range taxids {
+								if taxon.LCA(taxid, _taxid) == _taxid {
+									matchOne = true
+									break
+								}
+							}
+							if matchOne {
+								(*filter)[refBatchAndIdxUint64] = true
 							} else {
-								beginT = posT + K - kPrefix
+								(*filter)[refBatchAndIdxUint64] = false
+								continue
 							}
 						}
-
-						_sub2 := poolSub.Get().(*SubstrPair)
-						_sub2.QBegin = int32(beginQ)
-						_sub2.TBegin = int32(beginT)
-						// _sub2.QCode = qCode
-						// _sub2.TCode = tCode
-						_sub2.Len = uint8(kPrefix)
-						// _sub2.Mismatch = mismatch
-						_sub2.QRC = rcQ
-						_sub2.TRC = rcT
-
-						var r *SearchResult
-						if r, ok = (*m)[refBatchAndIdx]; !ok {
-							subs := poolSubs.Get().(*[]*SubstrPair)
-
-							r = poolSearchResult.Get().(*SearchResult)
-							r.BatchGenomeIndex = uint64(refBatchAndIdx)
-							r.GenomeBatch = refBatchAndIdx >> BITS_GENOME_IDX
-							r.GenomeIndex = refBatchAndIdx & MASK_GENOME_IDX
-							// r.ID = r.ID[:0] // extract it from genome file later
-							r.GenomeSize = 0
-							r.NumSeqs = 0
-							r.Subs = subs
-							r.Score = 0
-							r.Chains = nil            // important
-							r.SimilarityDetails = nil // important
-							r.AlignedFraction = 0
-
-							(*m)[refBatchAndIdx] = r
-						}
-
-						*r.Subs = append(*r.Subs, _sub2)
+					} else if !keepGenomesWithoutTaxId {
+						(*filter)[refBatchAndIdxUint64] = false
+						continue
 					}
+					(*filter)[refBatchAndIdxUint64] = true
 				}
 			}
 
-			kv.RecycleSearchResults(srs)
-		}
-
-		if filterByTaxId {
-			clear(*filter)
-			idx.poolTaxIDfilter.Put(filter)
-		}
-		done <- 1
-	}()
-
-	// 2.1) search with multiple searchers
-	for iS := 0; iS < nSearchers; iS++ {
-		if inMemorySearch {
-			beginM = searchersIM[iS].ChunkIndex
-			endM = searchersIM[iS].ChunkIndex + searchersIM[iS].ChunkSize
-		} else {
-			beginM = searchers[iS].ChunkIndex
-			endM = searchers[iS].ChunkIndex + searchers[iS].ChunkSize
-		}
+			posT = int(refpos << BITS_IDX >> BITS_IDX_FLAGS)
+			rvT = refpos&MASK_REVERSE > 0
+			rcT = refpos>>BITS_REVERSE&MASK_STRAND > 0
 
-		wg.Add(1)
-		go func(iS, beginM, endM int) {
-			var srs *[]*kv.SearchResult
-			var srs2 *[]*kv.SearchResult
-			var err error
-			if inMemorySearch {
-				// prefix search
-				// srs, err = searchersIM[iS].Search((*_kmers)[beginM:endM], minPrefix, maxMismatch)
-				srs, err = searchersIM[iS].Search((*_kmers)[beginM:endM], minPrefix, true, false)
-				if err != nil {
-					checkError(err)
+			if !rvT {
+				// query location
+				if rcQ { // on the negative strand
+					beginQ = posQ + K - kPrefix
+				} else {
+					beginQ = posQ
 				}
 
-				// suffix search
-				srs2, err = searchersIM[iS].Search2((*_kmersR)[beginM:endM], minPrefix, true, true)
-				if err != nil {
-					checkError(err)
-				}
-				if len(*srs2) > 0 {
-					*srs = append(*srs, (*srs2)...)
-					*srs2 = (*srs2)[:0] // important
+				// subject location
+				if rcT {
+					beginT = posT + K - kPrefix
+				} else {
+					beginT = posT
 				}
-				kv.RecycleSearchResults(srs2)
 			} else {
-				idx.searcherTokens[iS] <- 1 // get the access to the searcher
-
-				// prefix search
-				// srs, err = searchers[iS].Search((*_kmers)[beginM:endM], minPrefix, maxMismatch)
-				srs, err = searchers[iS].Search((*_kmers)[beginM:endM], minPrefix, true, false)
-				if err != nil {
-					checkError(err)
+				// query location
+				if rcQ { // on the negative strand
+					beginQ = posQ
+				} else {
+					beginQ = posQ + K - kPrefix
 				}
 
-				// suffix search
-				srs2, err = searchers[iS].Search2((*_kmersR)[beginM:endM], minPrefix, true, true)
-				if err != nil {
-					checkError(err)
-				}
-				if len(*srs2) > 0 {
-					*srs = append(*srs, (*srs2)...)
-					*srs2 = (*srs2)[:0] // important
+				// subject location
+				if rcT {
+					beginT = posT
+				} else {
+					beginT = posT + K - kPrefix
 				}
-				kv.RecycleSearchResults(srs2)
-
-				<-idx.searcherTokens[iS] // return the access
-			}
-			if err != nil {
-				checkError(err)
 			}
 
-			if len(*srs) == 0 { // no matcheds
-				kv.RecycleSearchResults(srs)
-			} else {
-				ch <- srs // send result
+			_sub2 := poolSub.Get().(*SubstrPair)
+			_sub2.QBegin = int32(beginQ)
+			_sub2.TBegin = int32(beginT)
+			_sub2.Len = uint8(kPrefix)
+			_sub2.QRC = rcQ
+			_sub2.TRC = rcT
+
+			var r *SearchResult
+			if r, ok = (*m)[refBatchAndIdx]; !ok {
+				subs := poolSubs.Get().(*[]*SubstrPair)
+
+				r = poolSearchResult.Get().(*SearchResult)
+				r.BatchGenomeIndex = uint64(refBatchAndIdx)
+				r.GenomeBatch = refBatchAndIdx >> BITS_GENOME_IDX
+				r.GenomeIndex = refBatchAndIdx & MASK_GENOME_IDX
+				r.GenomeSize = 0
+				r.NumSeqs = 0
+				r.Subs = subs
+				r.Score = 0
+				r.Chains = nil            // important
+				r.SimilarityDetails = nil // important
+				r.AlignedFraction = 0
+				r.seedLen = 0
+				r.seedWeight = 0
+
+				(*m)[refBatchAndIdx] = r
 			}
 
-			wg.Done()
-			// <-tokensS
-		}(iS, beginM, endM)
-	}
-	wg.Wait()
-	close(ch)
-	<-done
-
-	var v *[]uint64
-	for _, v = range *_kmersR {
-		*v = (*v)[:0]
-	}
-
-	var vl *[]int
-	for _, vl = range *_locsesR {
-		*vl = (*vl)[:0]
+			*r.Subs = append(*r.Subs, _sub2)
+			nSeeds++
+			if seedIDF {
+				r.seedLen += float32(kPrefix)
+				r.seedWeight += w * float32(kPrefix)
+			}
+		}
 	}
-	idx.poolKmers.Put(_kmersR)
-	idx.poolLocses.Put(_locsesR)
+}
 
-	if debug {
-		if idx.filterByTaxId {
-			log.Debugf("%s (%s bp): finished seed-matching with filtering by TaxId (%s genome hits) in %s",
-				query.seqID, humanize.Comma(int64(len(query.seq))), humanize.Comma(int64(len(*m))), time.Since(startTime))
-		} else {
-			log.Debugf("%s (%s bp): finished seed-matching (%s genome hits) in %s",
-				query.seqID, humanize.Comma(int64(len(query.seq))), humanize.Comma(int64(len(*m))), time.Since(startTime))
-		}
+// chainAndAlign chains matched seeds in each genome, and performs alignment for the top genomes.
+// The map of genome search results is recycled.
+func (idx *Index) chainAndAlign(query *Query, m *map[int]*SearchResult, debug bool, startTime time.Time) (*[]*SearchResult, error) {
+	s := query.seq
+	var wg sync.WaitGroup
+	done := make(chan int)
+	var err error
 
-		startTime = time.Now()
+	stats := query.stats
+	var timeChaining time.Time
+	if stats != nil {
+		timeChaining = time.Now()
+		stats.GenomesSeeded = len(*m)
 	}
 
 	if len(*m) == 0 { // no results
@@ -1778,6 +2132,9 @@ func (idx *Index) Search(query *Query, genomeIds *map[uint64]*[]uint64, debug bo
 	poolSearchResultsMap.Put(m)
 
 	// 3.2) only keep the top N targets
+	if stats != nil {
+		stats.GenomesChained = len(*rs)
+	}
 	topN := idx.opt.TopN
 	if topN > 0 && len(*rs) > topN {
 		// sort subjects in descending order based on the score
@@ -1785,9 +2142,15 @@ func (idx *Index) Search(query *Query, genomeIds *map[uint64]*[]uint64, debug bo
 		// sort.Slice(*rs, func(i, j int) bool {
 		// 	return (*rs)[i].Score > (*rs)[j].Score
 		// })
-		slices.SortFunc(*rs, func(a, b *SearchResult) int {
-			return cmp.Compare(b.Score, a.Score)
-		})
+		if idx.opt.SeedIDF {
+			slices.SortFunc(*rs, func(a, b *SearchResult) int {
+				return cmp.Compare(b.rankingScore(), a.rankingScore())
+			})
+		} else {
+			slices.SortFunc(*rs, func(a, b *SearchResult) int {
+				return cmp.Compare(b.Score, a.Score)
+			})
+		}
 
 		// Since recycling too many substring pairs results in a high memory load,
 		// We just throw them away, and let GC handle them.
@@ -1804,6 +2167,14 @@ func (idx *Index) Search(query *Query, genomeIds *map[uint64]*[]uint64, debug bo
 		*rs = (*rs)[:topN]
 	}
 
+	if stats != nil {
+		stats.GenomesTopN = len(*rs)
+		for _, r := range *rs {
+			stats.Chains += len(*r.Chains)
+		}
+		stats.TimeChaining = time.Since(timeChaining)
+	}
+
 	if debug {
 		log.Debugf("%s (%s bp): finished chaining (%s genome hits) in %s",
 			query.seqID, humanize.Comma(int64(len(query.seq))), humanize.Comma(int64(len(*rs))), time.Since(startTime))
@@ -1934,7 +2305,7 @@ func (idx *Index) Search(query *Query, genomeIds *map[uint64]*[]uint64, debug bo
 			rdr = <-idx.poolGenomeRdrs[refBatch]
 		} else {
 			idx.openFileTokens <- 1 // genome file
-			fileGenome := filepath.Join(idx.path, DirGenomes, batchDir(refBatch), FileGenomes)
+			fileGenome := idx.layout.GenomeFile(refBatch)
 			rdr, err = genome.NewReader(fileGenome)
 			if err != nil {
 				checkError(fmt.Errorf("failed to read genome data file: %s", err))
@@ -1963,6 +2334,8 @@ func (idx *Index) Search(query *Query, genomeIds *map[uint64]*[]uint64, debug bo
 
 		var tSeq *genome.Genome
 
+		var timeExt, timeWFA time.Time // for query stats
+
 		// sort chains according to coordinates for faster file seeking
 		if len(*r.Chains) > 1 {
 			// sort.Slice(*r.Chains, func(i, j int) bool {
@@ -2058,10 +2431,16 @@ func (idx *Index) Search(query *Query, genomeIds *map[uint64]*[]uint64, debug bo
 			// comparing the two sequences with pseudo-alignment
 
 			// fmt.Printf("qBegin: %d, qEnd: %d, len(tseq): %d\n", qBegin, qEnd, len(tSeq.Seq))
+			if stats != nil {
+				timeExt = time.Now()
+			}
 			cr, err := cpr.Compare(uint32(qBegin), uint32(qEnd), tSeq.Seq, qlen)
 			if err != nil {
 				checkError(err)
 			}
+			if stats != nil {
+				stats.TimeExtension.Add(int64(time.Since(timeExt)))
+			}
 			if cr == nil { // no matches in the pseudo alignment
 				continue
 			}
@@ -2252,20 +2631,34 @@ func (idx *Index) Search(query *Query, genomeIds *map[uint64]*[]uint64, debug bo
 								} else if c.AlignedBasesQ > 10000 {
 									_extLen2 += 10
 								}
+								if stats != nil {
+									timeExt = time.Now()
+								}
 								_qseq, _tseq, _s1, _e1, _s2, _e2, err = extendMatch(s, tSeq.Seq, c.QBegin, c.QEnd+1, start, end, _extLen2, c.TBegin, c.MaxExtLen, rc)
 								if err != nil {
 									checkError(fmt.Errorf("fail to extend aligned region"))
 								}
+								if stats != nil {
+									timeWFA = time.Now()
+									stats.TimeExtension.Add(int64(timeWFA.Sub(timeExt)))
+								}
 
 								// fmt.Printf("q: %s\nt: %s\n", _qseq, _tseq)
 								cigar, err = algn.Align(_qseq, _tseq)
 								if err != nil {
 									checkError(fmt.Errorf("fail to align sequence"))
 								}
+								if stats != nil {
+									stats.TimeWFA.Add(int64(time.Since(timeWFA)))
+									stats.Aligns.Add(1)
+								}
 
 								// score and e-value
 								c.Score, c.BitScore, c.Evalue = fScoreAndEvalue(len(_qseq), cigar)
 								if c.Evalue > maxEvalue {
+									if stats != nil {
+										stats.FilteredEvalue.Add(1)
+									}
 									poolChain2.Put(c)
 									(*r2.Chains)[i] = nil
 									continue
@@ -2306,6 +2699,13 @@ func (idx *Index) Search(query *Query, genomeIds *map[uint64]*[]uint64, debug bo
 								}
 
 								if c.AlignedFraction < minQcovHSP || c.PIdent < minPIdent {
+									if stats != nil {
+										if c.AlignedFraction < minQcovHSP {
+											stats.FilteredQcovHSP.Add(1)
+										} else {
+											stats.FilteredPIdent.Add(1)
+										}
+									}
 									poolChain2.Put(c)
 									(*r2.Chains)[i] = nil
 									continue
@@ -2349,6 +2749,10 @@ func (idx *Index) Search(query *Query, genomeIds *map[uint64]*[]uint64, debug bo
 									wfa.RecycleAlignmentResult(cigar)
 								}
 
+								if stats != nil {
+									stats.AlignsKept.Add(1)
+								}
+
 								similarityScore = float64(c.BitScore) * c.PIdent
 								if similarityScore > maxSimilarityScore {
 									maxSimilarityScore = similarityScore
@@ -2519,20 +2923,34 @@ func (idx *Index) Search(query *Query, genomeIds *map[uint64]*[]uint64, debug bo
 						} else if c.AlignedBasesQ > 10000 {
 							_extLen2 += 10
 						}
+						if stats != nil {
+							timeExt = time.Now()
+						}
 						_qseq, _tseq, _s1, _e1, _s2, _e2, err = extendMatch(s, tSeq.Seq, c.QBegin, c.QEnd+1, start, end, _extLen2, c.TBegin, c.MaxExtLen, rc)
 						if err != nil {
 							checkError(fmt.Errorf("fail to extend aligned region"))
 						}
+						if stats != nil {
+							timeWFA = time.Now()
+							stats.TimeExtension.Add(int64(timeWFA.Sub(timeExt)))
+						}
 
 						// fmt.Printf("q: %s\nt: %s\n", _qseq, _tseq)
 						cigar, err = algn.Align(_qseq, _tseq)
 						if err != nil {
 							checkError(fmt.Errorf("fail to align sequence"))
 						}
+						if stats != nil {
+							stats.TimeWFA.Add(int64(time.Since(timeWFA)))
+							stats.Aligns.Add(1)
+						}
 
 						// score and e-value
 						c.Score, c.BitScore, c.Evalue = fScoreAndEvalue(len(_qseq), cigar)
 						if c.Evalue > maxEvalue {
+							if stats != nil {
+								stats.FilteredEvalue.Add(1)
+							}
 							poolChain2.Put(c)
 							(*r2.Chains)[i] = nil
 							continue
@@ -2575,6 +2993,13 @@ func (idx *Index) Search(query *Query, genomeIds *map[uint64]*[]uint64, debug bo
 						}
 
 						if c.AlignedFraction < minQcovHSP || c.PIdent < minPIdent {
+							if stats != nil {
+								if c.AlignedFraction < minQcovHSP {
+									stats.FilteredQcovHSP.Add(1)
+								} else {
+									stats.FilteredPIdent.Add(1)
+								}
+							}
 							poolChain2.Put(c)
 							(*r2.Chains)[i] = nil
 							continue
@@ -2618,6 +3043,10 @@ func (idx *Index) Search(query *Query, genomeIds *map[uint64]*[]uint64, debug bo
 							wfa.RecycleAlignmentResult(cigar)
 						}
 
+						if stats != nil {
+							stats.AlignsKept.Add(1)
+						}
+
 						similarityScore = float64(c.BitScore) * c.PIdent
 						if similarityScore > maxSimilarityScore {
 							maxSimilarityScore = similarityScore
@@ -2721,6 +3150,9 @@ func (idx *Index) Search(query *Query, genomeIds *map[uint64]*[]uint64, debug bo
 				r.AlignedFraction = 100
 			}
 			if r.AlignedFraction < minQcovGnm { // no valid alignments
+				if stats != nil {
+					stats.FilteredQcovGenome.Add(1)
+				}
 				idx.RecycleSimilarityDetails(sds)
 				idx.RecycleSearchResult(r) // do not forget to recycle unused objects
 
@@ -2886,6 +3318,9 @@ func (idx *Index) Search(query *Query, genomeIds *map[uint64]*[]uint64, debug bo
 				r.AlignedFraction = 100
 			}
 			if r.AlignedFraction < minQcovGnm { // no valid alignments
+				if stats != nil {
+					stats.FilteredQcovGenome.Add(1)
+				}
 				idx.RecycleSearchResult(r) // do not forget to recycle unused objects
 
 				continue
@@ -0,0 +1,230 @@
+// Copyright © 2023-2026 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+
+	"github.com/shenwei356/LexicMap/lexicmap/cmd/util"
+	"github.com/shenwei356/util/pathutil"
+)
+
+// Seed data files (seeds/chunk_*.bin) and genome batch directories (genomes/batch_*)
+// of an index can be placed on multiple storage volumes, i.e., shard roots,
+// which are recorded in the info file (info.toml):
+//
+//	shards = ['/mnt/disk2/db.lmi.shard', '/mnt/disk3/db.lmi.shard']
+//	seed-chunk-shards = [0, 1, 2, 0, 1, 2, ...]
+//	genome-batch-shards = [0, 0, 1, ...]
+//
+// The value 0 means the index directory, and i means the i-th shard root.
+// A shard root has the same directory structure as the index directory,
+// e.g., /mnt/disk2/db.lmi.shard/seeds/chunk_001.bin.
+// Shards are moved with "lexicmap utils relocate-shard".
+
+// IndexLayout resolves paths of seed data files and genome batch directories
+// of an index, which might be placed in multiple shard roots.
+type IndexLayout struct {
+	Dir   string   // index directory
+	Roots []string // Roots[0] is the index directory, and others are shard roots
+
+	chunkShards []int
+	batchShards []int
+}
+
+// NewIndexLayout creates an IndexLayout from the index directory and the index information.
+// Relative shard roots are relative to the index directory.
+func NewIndexLayout(dir string, info *IndexInfo) (*IndexLayout, error) {
+	l := &IndexLayout{
+		Dir:   dir,
+		Roots: make([]string, 0, len(info.Shards)+1),
+	}
+	l.Roots = append(l.Roots, dir)
+	for _, root := range info.Shards {
+		if !filepath.IsAbs(root) && !util.IsRemote(root) {
+			root = filepath.Join(dir, root)
+		}
+		l.Roots = append(l.Roots, root)
+	}
+
+	if len(info.ChunkShards) > 0 && len(info.ChunkShards) != info.Chunks {
+		return nil, fmt.Errorf("the number of seed chunk shards (%d) does not match that of seed chunks (%d)",
+			len(info.ChunkShards), info.Chunks)
+	}
+	if len(info.BatchShards) > 0 && len(info.BatchShards) != info.GenomeBatches {
+		return nil, fmt.Errorf("the number of genome batch shards (%d) does not match that of genome batches (%d)",
+			len(info.BatchShards), info.GenomeBatches)
+	}
+	for _, s := range info.ChunkShards {
+		if s < 0 || s >= len(l.Roots) {
+			return nil, fmt.Errorf("invalid shard of a seed chunk: %d, valid range: [0, %d]", s, len(l.Roots)-1)
+		}
+	}
+	for _, s := range info.BatchShards {
+		if s < 0 || s >= len(l.Roots) {
+			return nil, fmt.Errorf("invalid shard of a genome batch: %d, valid range: [0, %d]", s, len(l.Roots)-1)
+		}
+	}
+	l.chunkShards = info.ChunkShards
+	l.batchShards = info.BatchShards
+
+	return l, nil
+}
+
+// ReadIndexLayout reads the info file of an index and returns its IndexLayout.
+func ReadIndexLayout(dir string) (*IndexLayout, *IndexInfo, error) {
+	info, err := readIndexInfo(filepath.Join(dir, FileInfo))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read info file: %s", err)
+	}
+	l, err := NewIndexLayout(dir, info)
+	if err != nil {
+		return nil, nil, err
+	}
+	return l, info, nil
+}
+
+// Sharded tells if some seed chunks or genome batches are placed in shard roots.
+func (l *IndexLayout) Sharded() bool {
+	return len(l.Roots) > 1
+}
+
+// CheckRoots checks if all local shard roots exist.
+func (l *IndexLayout) CheckRoots() error {
+	for _, root := range l.Roots[1:] {
+		if util.IsRemote(root) {
+			continue
+		}
+		ok, err := pathutil.DirExists(root)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("shard root not found: %s", root)
+		}
+	}
+	return nil
+}
+
+// Remote tells if the index directory or any shard root is remote, i.e., a URL.
+func (l *IndexLayout) Remote() bool {
+	for _, root := range l.Roots {
+		if util.IsRemote(root) {
+			return true
+		}
+	}
+	return false
+}
+
+// ChunkShard returns the shard of a seed chunk.
+func (l *IndexLayout) ChunkShard(chunk int) int {
+	if chunk < len(l.chunkShards) {
+		return l.chunkShards[chunk]
+	}
+	return 0
+}
+
+// BatchShard returns the shard of a genome batch.
+func (l *IndexLayout) BatchShard(batch int) int {
+	if batch < len(l.batchShards) {
+		return l.batchShards[batch]
+	}
+	return 0
+}
+
+// SeedFile returns the path of a seed data file.
+func (l *IndexLayout) SeedFile(chunk int) string {
+	return filepath.Join(l.Roots[l.ChunkShard(chunk)], DirSeeds, chunkFile(chunk))
+}
+
+// GenomeDir returns the path of a genome batch directory.
+func (l *IndexLayout) GenomeDir(batch int) string {
+	return filepath.Join(l.Roots[l.BatchShard(batch)], DirGenomes, batchDir(batch))
+}
+
+// GenomeFile returns the path of the genome data file of a genome batch.
+func (l *IndexLayout) GenomeFile(batch int) string {
+	return filepath.Join(l.GenomeDir(batch), FileGenomes)
+}
+
+var reSeedChunkFile = regexp.MustCompile(`^` + DirSeeds + `/chunk_(\d+)`)
+var reGenomeBatchFile = regexp.MustCompile(`^` + DirGenomes + `/batch_(\d+)/`)
+
+// File returns the path of a file with the relative path in the index directory,
+// e.g., seeds/chunk_001.bin.idx, or genomes/batch_0000/genomes.bin.
+func (l *IndexLayout) File(file string) string {
+	file = path.Clean(filepath.ToSlash(file))
+	if m := reSeedChunkFile.FindStringSubmatch(file); m != nil {
+		chunk, _ := strconv.Atoi(m[1])
+		return filepath.Join(l.Roots[l.ChunkShard(chunk)], file)
+	}
+	if m := reGenomeBatchFile.FindStringSubmatch(file); m != nil {
+		batch, _ := strconv.Atoi(m[1])
+		return filepath.Join(l.Roots[l.BatchShard(batch)], file)
+	}
+	return filepath.Join(l.Dir, file)
+}
+
+// Walk walks all files of the index, including those in shard roots, and calls fn
+// with the relative path in the index directory (with "/" as the separator) and the actual path.
+// Files in the seed and genome directories not belonging to the root, e.g.,
+// leftovers of relocated shards, are skipped.
+func (l *IndexLayout) Walk(fn func(file string, fpath string, d fs.DirEntry) error) error {
+	for i, root := range l.Roots {
+		subs := []string{"."}
+		if i > 0 {
+			subs = []string{DirSeeds, DirGenomes}
+		}
+		for _, sub := range subs {
+			_, err := os.Stat(filepath.Join(root, sub))
+			if err != nil {
+				if os.IsNotExist(err) {
+					continue
+				}
+				return err
+			}
+
+			err = fs.WalkDir(os.DirFS(root), sub, func(p string, d fs.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if d.IsDir() {
+					return nil
+				}
+				fpath := filepath.Join(root, p)
+				if l.File(p) != fpath {
+					return nil
+				}
+				return fn(p, fpath, d)
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
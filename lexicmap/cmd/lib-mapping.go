@@ -0,0 +1,279 @@
+// Copyright © 2023-2026 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"math"
+	"slices"
+)
+
+// types of alignments in the mapping mode
+const (
+	MappingPrimary       uint8 = iota + 1 // the best alignment of a query across all genomes
+	MappingSupplementary                  // alignments of other query regions, e.g., in chimeric reads
+	MappingSecondary                      // alternative alignments of the query region of a primary/supplementary one
+)
+
+// MappingTypeNames are names of alignment types.
+var MappingTypeNames = []string{"", "primary", "supplementary", "secondary"}
+
+// MaxMAPQ is the maximum mapping quality.
+const MaxMAPQ = 60
+
+// MappingOptions contains options for selecting alignments in the mapping mode.
+type MappingOptions struct {
+	// Maximum number of secondary alignments for each primary or supplementary alignment.
+	MaxSecondary int
+	// Minimum ratio of the score of a secondary alignment to that of the primary/supplementary one.
+	MinSecondaryRatio float64
+	// Maximum fraction of the overlap (in the query) between a supplementary alignment
+	// and the primary/other supplementary ones, relative to the shorter one.
+	MaxOverlap float64
+}
+
+// DefaultMappingOptions is the default MappingOptions.
+var DefaultMappingOptions = MappingOptions{
+	MaxSecondary:      5,
+	MinSecondaryRatio: 0.8,
+	MaxOverlap:        0.5,
+}
+
+// MappedAlignment is an HSP in the mapping mode.
+type MappedAlignment struct {
+	Result *SearchResult
+	Detail *SimilarityDetail
+	Chain  *Chain2Result
+	Cls    int // 1-based index of the HSP cluster in the genome
+	HSP    int // 1-based index of the HSP in the genome
+
+	Type uint8
+	MAPQ int
+
+	// the best score of other alignments of the query region, only for primary/supplementary ones
+	score2 int
+	// the primary/supplementary alignment of a secondary one
+	parent *MappedAlignment
+}
+
+// sameGenome tells if two alignments are in the same genome.
+func (a *MappedAlignment) sameGenome(b *MappedAlignment) bool {
+	return a.Result.BatchGenomeIndex == b.Result.BatchGenomeIndex
+}
+
+// Strand returns the subject strand.
+func (a *MappedAlignment) Strand() byte {
+	if a.Detail.RC {
+		return '-'
+	}
+	return '+'
+}
+
+// queryOverlap returns the overlap of query regions relative to the shorter one.
+func (a *MappedAlignment) queryOverlap(b *MappedAlignment) float64 {
+	ov := min(a.Chain.QEnd, b.Chain.QEnd) - max(a.Chain.QBegin, b.Chain.QBegin) + 1
+	if ov <= 0 {
+		return 0
+	}
+	return float64(ov) / float64(min(a.Chain.QEnd-a.Chain.QBegin+1, b.Chain.QEnd-b.Chain.QBegin+1))
+}
+
+// mappingQuality computes MAPQ from the score gap between the best and second-best alignments.
+func mappingQuality(score1, score2 int) int {
+	if score1 <= 0 {
+		return 0
+	}
+	if score2 <= 0 {
+		return MaxMAPQ
+	}
+	if score2 >= score1 {
+		return 0
+	}
+	return int(math.Round(MaxMAPQ * (1 - float64(score2)/float64(score1))))
+}
+
+// SelectMappings selects alignments of a query in the mapping mode from the search results,
+// and appends them to alns, in the order of the primary, supplementary (sorted by query start),
+// and secondary (sorted by score) ones.
+//
+//  1. All HSPs across all genomes are sorted by the chain score, and the best one is the primary alignment.
+//     For ties, HSPs in the genome of the primary alignment are preferred.
+//  2. An HSP overlapping (in the query) with none of the primary/supplementary alignments by more than
+//     MaxOverlap becomes a supplementary alignment.
+//  3. Other HSPs are alternative alignments of the primary/supplementary alignment with the largest
+//     overlap. The best of them decides the MAPQ, and the ones with scores >= MinSecondaryRatio
+//     are reported as secondary alignments, at most MaxSecondary.
+func SelectMappings(results []*SearchResult, opt *MappingOptions, alns []*MappedAlignment) []*MappedAlignment {
+	cands := make([]*MappedAlignment, 0, 8)
+
+	var cls, hsp int
+	for _, r := range results {
+		if r.SimilarityDetails == nil {
+			continue
+		}
+		cls = 1
+		hsp = 1
+		for _, sd := range *r.SimilarityDetails {
+			for _, c := range *sd.Similarity.Chains {
+				if c == nil {
+					continue
+				}
+				cands = append(cands, &MappedAlignment{Result: r, Detail: sd, Chain: c, Cls: cls, HSP: hsp})
+				hsp++
+			}
+			cls++
+		}
+	}
+	if len(cands) == 0 {
+		return alns
+	}
+
+	slices.SortStableFunc(cands, func(a, b *MappedAlignment) int {
+		return b.Chain.Score - a.Chain.Score
+	})
+	primary := cands[0]
+	slices.SortStableFunc(cands[1:], func(a, b *MappedAlignment) int {
+		if a.Chain.Score != b.Chain.Score {
+			return b.Chain.Score - a.Chain.Score
+		}
+		if a.sameGenome(primary) == b.sameGenome(primary) {
+			return 0
+		}
+		if a.sameGenome(primary) {
+			return -1
+		}
+		return 1
+	})
+
+	primary.Type = MappingPrimary
+	segs := make([]*MappedAlignment, 1, 4) // primary and supplementary alignments
+	segs[0] = primary
+	secondaries := make([]*MappedAlignment, 0, 8)
+	nSecondaries := make(map[*MappedAlignment]int, 4)
+
+	var best *MappedAlignment
+	var ov, maxOv float64
+	for _, a := range cands[1:] {
+		best, maxOv = nil, 0
+		for _, s := range segs {
+			ov = a.queryOverlap(s)
+			if ov > maxOv {
+				best, maxOv = s, ov
+			}
+		}
+
+		if maxOv <= opt.MaxOverlap {
+			a.Type = MappingSupplementary
+			segs = append(segs, a)
+			continue
+		}
+
+		if best.score2 == 0 { // candidates are sorted by score, the first one is the second-best
+			best.score2 = a.Chain.Score
+		}
+		if nSecondaries[best] < opt.MaxSecondary &&
+			float64(a.Chain.Score) >= opt.MinSecondaryRatio*float64(best.Chain.Score) {
+			a.Type = MappingSecondary
+			a.parent = best
+			nSecondaries[best]++
+			secondaries = append(secondaries, a)
+		}
+	}
+
+	for _, s := range segs {
+		s.MAPQ = mappingQuality(s.Chain.Score, s.score2)
+	}
+
+	slices.SortStableFunc(segs[1:], func(a, b *MappedAlignment) int {
+		return a.Chain.QBegin - b.Chain.QBegin
+	})
+
+	alns = append(alns, segs...)
+	alns = append(alns, secondaries...)
+	return alns
+}
+
+// MappingBreakpoint is a junction between two adjacent (in the query) primary/supplementary alignments.
+type MappingBreakpoint struct {
+	Left, Right *MappedAlignment
+}
+
+// breakpoint classes
+const (
+	BreakpointIntraSequence = "intra-sequence"
+	BreakpointInterSequence = "inter-sequence"
+	BreakpointInterGenome   = "inter-genome"
+)
+
+// QGap returns the number of query bases between the two alignments, negative values for overlaps.
+func (b *MappingBreakpoint) QGap() int {
+	return b.Right.Chain.QBegin - b.Left.Chain.QEnd - 1
+}
+
+// LeftPos returns the 0-based subject position of the left side of the junction.
+func (b *MappingBreakpoint) LeftPos() int {
+	if b.Left.Detail.RC {
+		return b.Left.Chain.TBegin
+	}
+	return b.Left.Chain.TEnd
+}
+
+// RightPos returns the 0-based subject position of the right side of the junction.
+func (b *MappingBreakpoint) RightPos() int {
+	if b.Right.Detail.RC {
+		return b.Right.Chain.TEnd
+	}
+	return b.Right.Chain.TBegin
+}
+
+// Class returns the class of the breakpoint.
+func (b *MappingBreakpoint) Class() string {
+	if !b.Left.sameGenome(b.Right) {
+		return BreakpointInterGenome
+	}
+	if !bytes.Equal(b.Left.Detail.SeqID, b.Right.Detail.SeqID) {
+		return BreakpointInterSequence
+	}
+	return BreakpointIntraSequence
+}
+
+// MappingBreakpoints returns breakpoints between adjacent (in the query) primary/supplementary
+// alignments returned by SelectMappings.
+func MappingBreakpoints(alns []*MappedAlignment, bps []MappingBreakpoint) []MappingBreakpoint {
+	segs := make([]*MappedAlignment, 0, 4)
+	for _, a := range alns {
+		if a.Type == MappingSecondary {
+			break
+		}
+		segs = append(segs, a)
+	}
+	if len(segs) < 2 {
+		return bps
+	}
+	slices.SortStableFunc(segs, func(a, b *MappedAlignment) int {
+		return a.Chain.QBegin - b.Chain.QBegin
+	})
+
+	for i := 1; i < len(segs); i++ {
+		bps = append(bps, MappingBreakpoint{Left: segs[i-1], Right: segs[i]})
+	}
+	return bps
+}
@@ -0,0 +1,129 @@
+// Copyright © 2023-2026 Wei Shen <shenwei356@gmail.com>
+
+package cmd
+
+import (
+	"testing"
+)
+
+// mappingTestResult creates a search result of a genome with HSPs on one sequence.
+func mappingTestResult(genome uint64, seqid string, rc bool, chains ...*Chain2Result) *SearchResult {
+	cs := make([]*Chain2Result, len(chains))
+	copy(cs, chains)
+	sd := &SimilarityDetail{
+		RC:         rc,
+		SeqID:      []byte(seqid),
+		Similarity: &SeqComparatorResult{Chains: &cs},
+	}
+	sds := []*SimilarityDetail{sd}
+	return &SearchResult{BatchGenomeIndex: genome, SimilarityDetails: &sds}
+}
+
+func TestSelectMappings(t *testing.T) {
+	// a chimeric read: [0, 999] from genome 1, [1000, 1999] from genome 2
+	left := &Chain2Result{QBegin: 0, QEnd: 999, TBegin: 5000, TEnd: 5999, Score: 1000}
+	leftAlt := &Chain2Result{QBegin: 10, QEnd: 999, TBegin: 9000, TEnd: 9989, Score: 900}
+	leftLow := &Chain2Result{QBegin: 0, QEnd: 900, TBegin: 100, TEnd: 1000, Score: 500}
+	right := &Chain2Result{QBegin: 990, QEnd: 1999, TBegin: 300, TEnd: 1309, Score: 950}
+
+	results := []*SearchResult{
+		mappingTestResult(1, "chr", false, left, leftAlt),
+		mappingTestResult(2, "plasmid", true, right),
+		mappingTestResult(3, "chr", false, leftLow),
+	}
+
+	opt := DefaultMappingOptions
+	alns := SelectMappings(results, &opt, nil)
+	if len(alns) != 3 {
+		t.Fatalf("unexpected number of alignments: %d", len(alns))
+	}
+
+	if alns[0].Chain != left || alns[0].Type != MappingPrimary {
+		t.Errorf("unexpected primary alignment: %+v", alns[0].Chain)
+	}
+	if want := mappingQuality(1000, 900); alns[0].MAPQ != want {
+		t.Errorf("unexpected MAPQ of the primary alignment: %d, want %d", alns[0].MAPQ, want)
+	}
+	if alns[0].Cls != 1 || alns[0].HSP != 1 {
+		t.Errorf("unexpected cls/hsp: %d/%d", alns[0].Cls, alns[0].HSP)
+	}
+
+	if alns[1].Chain != right || alns[1].Type != MappingSupplementary || alns[1].MAPQ != MaxMAPQ {
+		t.Errorf("unexpected supplementary alignment: %+v, type: %d, MAPQ: %d", alns[1].Chain, alns[1].Type, alns[1].MAPQ)
+	}
+
+	// leftLow is not reported as its score is < 0.8 * 1000
+	if alns[2].Chain != leftAlt || alns[2].Type != MappingSecondary || alns[2].MAPQ != 0 {
+		t.Errorf("unexpected secondary alignment: %+v", alns[2].Chain)
+	}
+	if alns[2].HSP != 2 {
+		t.Errorf("unexpected hsp of the secondary alignment: %d", alns[2].HSP)
+	}
+
+	bps := MappingBreakpoints(alns, nil)
+	if len(bps) != 1 {
+		t.Fatalf("unexpected number of breakpoints: %d", len(bps))
+	}
+	bp := bps[0]
+	if bp.QGap() != -10 {
+		t.Errorf("unexpected qgap: %d", bp.QGap())
+	}
+	if bp.LeftPos() != 5999 || bp.RightPos() != 1309 {
+		t.Errorf("unexpected junction positions: %d, %d", bp.LeftPos(), bp.RightPos())
+	}
+	if bp.Class() != BreakpointInterGenome {
+		t.Errorf("unexpected breakpoint class: %s", bp.Class())
+	}
+
+	// no secondary alignments
+	opt.MaxSecondary = 0
+	alns = SelectMappings(results, &opt, alns[:0])
+	if len(alns) != 2 {
+		t.Errorf("unexpected number of alignments: %d", len(alns))
+	}
+}
+
+func TestSelectMappingsTies(t *testing.T) {
+	// the same locus in two genomes, and another region only in the second genome
+	a1 := &Chain2Result{QBegin: 0, QEnd: 999, Score: 1000}
+	a2 := &Chain2Result{QBegin: 0, QEnd: 999, Score: 1000}
+	b1 := &Chain2Result{QBegin: 1000, QEnd: 1499, Score: 500}
+	b2 := &Chain2Result{QBegin: 1000, QEnd: 1499, Score: 500}
+
+	results := []*SearchResult{
+		mappingTestResult(1, "chr", false, a1, b1),
+		mappingTestResult(2, "chr", false, b2, a2),
+	}
+
+	alns := SelectMappings(results, &DefaultMappingOptions, nil)
+	if len(alns) != 4 {
+		t.Fatalf("unexpected number of alignments: %d", len(alns))
+	}
+	if alns[0].Chain != a1 || alns[0].MAPQ != 0 {
+		t.Errorf("unexpected primary alignment: %+v, MAPQ: %d", alns[0].Chain, alns[0].MAPQ)
+	}
+	// HSPs in the genome of the primary alignment are preferred
+	if alns[1].Chain != b1 || alns[1].Type != MappingSupplementary {
+		t.Errorf("unexpected supplementary alignment: %+v", alns[1].Chain)
+	}
+	if bps := MappingBreakpoints(alns, nil); len(bps) != 1 || bps[0].Class() != BreakpointIntraSequence {
+		t.Errorf("unexpected breakpoints: %v", bps)
+	}
+}
+
+func TestMappingQuality(t *testing.T) {
+	tests := []struct {
+		s1, s2, mapq int
+	}{
+		{1000, 0, 60},
+		{1000, 1000, 0},
+		{1000, 1200, 0},
+		{1000, 500, 30},
+		{0, 0, 0},
+	}
+	for _, test := range tests {
+		if mapq := mappingQuality(test.s1, test.s2); mapq != test.mapq {
+			t.Errorf("mappingQuality(%d, %d) = %d, want %d", test.s1, test.s2, mapq, test.mapq)
+		}
+	}
+}
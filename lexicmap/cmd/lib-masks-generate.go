@@ -0,0 +1,639 @@
+// Copyright © 2023-2026 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"container/heap"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"slices"
+	"sort"
+	"sync"
+
+	"github.com/shenwei356/LexicMap/lexicmap/cmd/util"
+	"github.com/shenwei356/bio/seqio/fastx"
+)
+
+// MaskGenerationOptions contains the options for generating masks from a genome collection.
+type MaskGenerationOptions struct {
+	NumCPUs  int
+	Verbose  bool
+	Log2File bool
+
+	K          int   // k-mer size
+	Masks      int   // number of masks
+	Seed       int64 // seed for generating random candidate masks
+	Candidates int   // number of random candidate masks for each mask prefix
+
+	DesertMaxLen int // maximum seed distance, longer gaps are sketching deserts
+}
+
+// MaskQuality is the estimated seed distribution of a mask set in a genome.
+type MaskQuality struct {
+	File       string
+	GenomeSize int
+
+	Seeds         int // number of distinct seed positions
+	Repeated      int // masks capturing k-mers with multiple occurrences
+	LowComplexity int // masks capturing low-complexity k-mers, which are discarded in indexing
+
+	MeanDist float64 // mean seed distance
+	CVDist   float64 // coefficient of variation of seed distances
+	MaxDist  int     // the maximum seed distance
+
+	Deserts     int // number of seed distances longer than DesertMaxLen
+	DesertBases int // total length of deserts
+}
+
+// MaskGenerationResult is the result of GenerateMasksFromGenomes.
+type MaskGenerationResult struct {
+	Masks []uint64 // sorted masks
+
+	Files []string // sampled genome files
+
+	Optimised []*MaskQuality // seed distribution of the generated masks in each genome
+	Random    []*MaskQuality // seed distribution of random masks with the same prefix constraint
+
+	LowComplexityPrefixes int // number of selected masks with low-complexity prefixes
+	PoorMasks             int // number of selected masks with poor captures
+}
+
+// maskPrefixLen returns the length of prefixes that all masks together need to cover,
+// i.e., the biggest p with 4^p <= nMasks, the same as in newLexicHash.
+func maskPrefixLen(nMasks int) int {
+	var p int
+	for 1<<((p+1)<<1) <= nMasks {
+		p++
+	}
+	return p
+}
+
+// GenerateMasksFromGenomes generates masks tuned to the given genomes.
+//
+// Masks keep the structure of random LexicHash masks: all masks have distinct
+// (p+1)-base prefixes, and all p-base prefixes are covered, where p is the biggest
+// value with 4^p <= nMasks. For each (p+1)-base prefix, opt.Candidates masks with
+// random suffixes are generated, and the k-mer each one captures in every genome
+// (the one with the minimum XOR value) is computed. Candidates capturing low-complexity
+// k-mers or k-mers with multiple occurrences, and ones with low-complexity prefixes,
+// are regarded as poor ones. Masks are then chosen greedily to split the biggest
+// seed distances, with the cost of a distance d being d^2 + D^2*max(0, d-D),
+// so deserts are reduced first and the seeds are distributed evenly.
+func GenerateMasksFromGenomes(files []string, opt *MaskGenerationOptions) (*MaskGenerationResult, error) {
+	k := opt.K
+	p := maskPrefixLen(opt.Masks)
+	p1 := p + 1
+	if p1 > k {
+		return nil, fmt.Errorf("too many masks (%d) for k-mer size %d", opt.Masks, k)
+	}
+	if opt.Candidates < 1 {
+		opt.Candidates = 1
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no genome files given")
+	}
+	nGenomes := len(files)
+
+	rng := rand.New(rand.NewSource(opt.Seed))
+
+	// ---------------------------------------------------------------
+	// candidate masks
+
+	nPrefixes := 1 << (p1 << 1)
+	nCand := nPrefixes * opt.Candidates
+	shift := uint((k - p1) << 1)
+	suffixMask := uint64(1)<<shift - 1
+
+	masks := make([]uint64, nCand)
+	lcPrefix := make([]bool, nPrefixes)
+	var prefix uint64
+	var c int
+	for i := 0; i < nPrefixes; i++ {
+		prefix = uint64(i)
+		lcPrefix[i] = isLowComplexityPrefix(prefix, p1)
+		for j := 0; j < opt.Candidates; j++ {
+			masks[c] = prefix<<shift | rng.Uint64()&suffixMask
+			c++
+		}
+	}
+
+	if opt.Verbose || opt.Log2File {
+		log.Infof("  %d candidate masks with %d-base prefixes generated", nCand, p1)
+	}
+
+	// ---------------------------------------------------------------
+	// captured positions in each genome
+
+	pos := make([]int32, nCand*nGenomes)     // captured positions, -1 for none
+	flags := make([]uint8, nCand*nGenomes)   // capture flags
+	genomes := make([]*maskGenome, nGenomes) // seed positions of selected masks
+
+	var wg sync.WaitGroup
+	tokens := make(chan int, max(opt.NumCPUs, 1))
+	var mu sync.Mutex
+	var errs error
+	var done int
+	for g, file := range files {
+		wg.Add(1)
+		tokens <- 1
+		go func(g int, file string) {
+			defer func() {
+				wg.Done()
+				<-tokens
+			}()
+
+			kmers, size, err := readGenomeKmers(file, k)
+			if err != nil {
+				mu.Lock()
+				errs = err
+				mu.Unlock()
+				return
+			}
+			genomes[g] = &maskGenome{size: size}
+
+			var lo, hi, i, j int
+			ttt := uint64(1)<<(k<<1) - 1
+			k8 := uint8(k)
+			for c, mask := range masks {
+				i = c*nGenomes + g
+				if len(kmers) == 0 {
+					pos[i] = -1
+					continue
+				}
+
+				lo, hi = minXorKmers(kmers, mask, k)
+				pos[i] = int32(kmers[lo].pos)
+
+				code := kmers[lo].code
+				if code == 0 || code == ttt || util.IsLowComplexityDust(code, k8) {
+					flags[i] = maskCaptureLowComplexity
+					continue
+				}
+				for j = lo + 1; j < hi; j++ { // ignore palindromic k-mers
+					if kmers[j].pos != kmers[lo].pos {
+						flags[i] = maskCaptureRepeated
+						break
+					}
+				}
+			}
+			poolGenomeKmers.Put(&kmers)
+
+			if opt.Verbose || opt.Log2File {
+				mu.Lock()
+				done++
+				log.Infof("  [%d/%d] %d bp, %d k-mers: %s", done, nGenomes, size, len(kmers), file)
+				mu.Unlock()
+			}
+		}(g, file)
+	}
+	wg.Wait()
+	if errs != nil {
+		return nil, errs
+	}
+
+	// ---------------------------------------------------------------
+	// mask selection
+
+	sel := &maskSelector{
+		nGenomes: nGenomes,
+		pos:      pos,
+		flags:    flags,
+		genomes:  genomes,
+		desert:   float64(opt.DesertMaxLen),
+	}
+
+	// candidates are poor if they have low-complexity prefixes or
+	// have poor captures in more than half of the genomes
+	poor := make([]bool, nCand)
+	var nPoor, i, g int
+	for c = range masks {
+		if lcPrefix[c/opt.Candidates] {
+			poor[c] = true
+			continue
+		}
+		nPoor = 0
+		i = c * nGenomes
+		for g = 0; g < nGenomes; g++ {
+			if flags[i+g] != 0 {
+				nPoor++
+			}
+		}
+		poor[c] = nPoor<<1 > nGenomes
+	}
+
+	ties := make([]uint32, nCand) // for breaking ties randomly
+	for c = range ties {
+		ties[c] = rng.Uint32()
+	}
+
+	selected := make([]int, 0, opt.Masks)
+	usedPrefix := make([]bool, nPrefixes)
+	covered := make([]bool, nPrefixes>>2)
+
+	h := make(maskCandidateHeap, 0, nCand)
+	for c = range masks {
+		h = append(h, &maskCandidate{idx: c, gain: sel.gain(c), poor: poor[c], tie: ties[c]})
+	}
+	heap.Init(&h)
+
+	// 1. covering all p-base prefixes
+	var item *maskCandidate
+	var pre int
+	nGroups := nPrefixes >> 2
+	for len(selected) < nGroups && h.Len() > 0 {
+		item = h[0]
+		pre = item.idx / opt.Candidates
+		if covered[pre>>2] {
+			heap.Pop(&h)
+			continue
+		}
+		item.gain = sel.gain(item.idx)
+		heap.Fix(&h, 0)
+		if h[0] != item { // lazy evaluation
+			continue
+		}
+		heap.Pop(&h)
+
+		covered[pre>>2] = true
+		usedPrefix[pre] = true
+		selected = append(selected, item.idx)
+		sel.add(item.idx)
+	}
+
+	// 2. the remaining masks with distinct (p+1)-base prefixes
+	h = h[:0]
+	for c = range masks {
+		if !usedPrefix[c/opt.Candidates] {
+			h = append(h, &maskCandidate{idx: c, gain: sel.gain(c), poor: poor[c], tie: ties[c]})
+		}
+	}
+	heap.Init(&h)
+	for len(selected) < opt.Masks && h.Len() > 0 {
+		item = h[0]
+		pre = item.idx / opt.Candidates
+		if usedPrefix[pre] {
+			heap.Pop(&h)
+			continue
+		}
+		item.gain = sel.gain(item.idx)
+		heap.Fix(&h, 0)
+		if h[0] != item {
+			continue
+		}
+		heap.Pop(&h)
+
+		usedPrefix[pre] = true
+		selected = append(selected, item.idx)
+		sel.add(item.idx)
+	}
+
+	// ---------------------------------------------------------------
+	// random masks with the same prefix constraint, as the baseline
+
+	random := make([]int, 0, opt.Masks)
+	clear(usedPrefix)
+	for pre = 0; pre < nPrefixes; pre += 4 {
+		i = pre + rng.Intn(4)
+		usedPrefix[i] = true
+		random = append(random, i*opt.Candidates)
+	}
+	for _, i = range rng.Perm(nPrefixes) {
+		if len(random) >= opt.Masks {
+			break
+		}
+		if !usedPrefix[i] {
+			usedPrefix[i] = true
+			random = append(random, i*opt.Candidates)
+		}
+	}
+
+	// ---------------------------------------------------------------
+
+	result := &MaskGenerationResult{
+		Masks:     make([]uint64, len(selected)),
+		Files:     files,
+		Optimised: sel.evaluate(selected, files, opt.DesertMaxLen),
+		Random:    sel.evaluate(random, files, opt.DesertMaxLen),
+	}
+	for i, c = range selected {
+		result.Masks[i] = masks[c]
+		if lcPrefix[c/opt.Candidates] {
+			result.LowComplexityPrefixes++
+		}
+		if poor[c] {
+			result.PoorMasks++
+		}
+	}
+	slices.Sort(result.Masks)
+
+	return result, nil
+}
+
+const (
+	maskCaptureRepeated      uint8 = 1
+	maskCaptureLowComplexity uint8 = 2
+)
+
+// isLowComplexityPrefix checks a short prefix with the DUST score of 3-mers.
+func isLowComplexityPrefix(code uint64, k int) bool {
+	if k < 4 {
+		return false
+	}
+	var counts [64]uint8
+	for i := 0; i <= k-3; i++ {
+		counts[code>>(i<<1)&63]++
+	}
+	var score int
+	for _, c := range counts {
+		score += int(c) * (int(c) - 1) >> 1
+	}
+	return score >= k-3
+}
+
+// genomeKmer is a k-mer and its position in the genome.
+type genomeKmer struct {
+	code uint64
+	pos  uint32
+}
+
+var poolGenomeKmers = &sync.Pool{New: func() interface{} {
+	tmp := make([]genomeKmer, 0, 1<<20)
+	return &tmp
+}}
+
+var maskBase2bit = func() (t [256]uint8) {
+	for i := range t {
+		t[i] = 4
+	}
+	t['A'], t['C'], t['G'], t['T'] = 0, 1, 2, 3
+	t['a'], t['c'], t['g'], t['t'] = 0, 1, 2, 3
+	return t
+}()
+
+// readGenomeKmers returns the sorted k-mers on both strands of a genome,
+// where positions are in the coordinates of concatenated sequences.
+func readGenomeKmers(file string, k int) ([]genomeKmer, int, error) {
+	fastxReader, err := fastx.NewReader(nil, file, "")
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read seq file: %s", err)
+	}
+	defer fastxReader.Close()
+
+	kmers := *poolGenomeKmers.Get().(*[]genomeKmer)
+	kmers = kmers[:0]
+
+	var record *fastx.Record
+	var size, n, i int
+	var b, fwd, rev uint64
+	kmask := uint64(1)<<(k<<1) - 1
+	shift := uint((k - 1) << 1)
+	for {
+		record, err = fastxReader.Read()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, 0, fmt.Errorf("read seq %s: %s", file, err)
+		}
+
+		if size+len(record.Seq.Seq) > math.MaxInt32 {
+			return nil, 0, fmt.Errorf("genome too big: %s", file)
+		}
+
+		n = 0
+		for i = range record.Seq.Seq {
+			b = uint64(maskBase2bit[record.Seq.Seq[i]])
+			if b > 3 {
+				n = 0
+				continue
+			}
+			fwd = (fwd<<2 | b) & kmask
+			rev = rev>>2 | (3-b)<<shift
+			if n++; n >= k {
+				kmers = append(kmers,
+					genomeKmer{code: fwd, pos: uint32(size + i - k + 1)},
+					genomeKmer{code: rev, pos: uint32(size + i - k + 1)})
+			}
+		}
+		size += len(record.Seq.Seq)
+	}
+
+	slices.SortFunc(kmers, func(a, b genomeKmer) int {
+		if a.code < b.code {
+			return -1
+		}
+		if a.code > b.code {
+			return 1
+		}
+		return int(a.pos) - int(b.pos)
+	})
+
+	return kmers, size, nil
+}
+
+// minXorKmers returns the range of k-mers with the minimum XOR value with the mask,
+// i.e., the k-mer captured by the mask and all its occurrences.
+func minXorKmers(kmers []genomeKmer, mask uint64, k int) (lo, hi int) {
+	lo, hi = 0, len(kmers)
+	var bit uint64
+	var s int
+	for b := (k << 1) - 1; b >= 0; b-- {
+		if kmers[lo].code == kmers[hi-1].code {
+			break
+		}
+		bit = uint64(1) << b
+		s = lo + sort.Search(hi-lo, func(i int) bool { return kmers[lo+i].code&bit > 0 })
+		if mask&bit == 0 {
+			if s > lo {
+				hi = s
+			}
+		} else if s < hi {
+			lo = s
+		}
+	}
+	return lo, hi
+}
+
+// maskGenome stores sorted seed positions of selected masks in a genome.
+type maskGenome struct {
+	size  int
+	seeds []int32
+}
+
+// maskSelector computes the gain of adding a candidate mask.
+type maskSelector struct {
+	nGenomes int
+	pos      []int32
+	flags    []uint8
+	genomes  []*maskGenome
+	desert   float64
+}
+
+// cost is the cost of a seed distance.
+func (s *maskSelector) cost(d float64) float64 {
+	if d > s.desert {
+		return d*d + s.desert*s.desert*(d-s.desert)
+	}
+	return d * d
+}
+
+// gain returns the reduced cost of adding a candidate.
+func (s *maskSelector) gain(c int) float64 {
+	var gain float64
+	var g, j, a, b int
+	var x int32
+	var found bool
+	i := c * s.nGenomes
+	for g = 0; g < s.nGenomes; g++ {
+		x = s.pos[i+g]
+		if x < 0 || s.flags[i+g] != 0 {
+			continue
+		}
+		seeds := s.genomes[g].seeds
+		j, found = slices.BinarySearch(seeds, x)
+		if found {
+			continue
+		}
+		a, b = 0, s.genomes[g].size
+		if j > 0 {
+			a = int(seeds[j-1])
+		}
+		if j < len(seeds) {
+			b = int(seeds[j])
+		}
+		gain += s.cost(float64(b-a)) - s.cost(float64(int(x)-a)) - s.cost(float64(b-int(x)))
+	}
+	return gain
+}
+
+// add adds the seeds of a selected candidate.
+func (s *maskSelector) add(c int) {
+	var g, j int
+	var x int32
+	var found bool
+	i := c * s.nGenomes
+	for g = 0; g < s.nGenomes; g++ {
+		x = s.pos[i+g]
+		if x < 0 || s.flags[i+g] != 0 {
+			continue
+		}
+		j, found = slices.BinarySearch(s.genomes[g].seeds, x)
+		if !found {
+			s.genomes[g].seeds = slices.Insert(s.genomes[g].seeds, j, x)
+		}
+	}
+}
+
+// evaluate computes the seed distribution of a mask set in each genome.
+func (s *maskSelector) evaluate(cands []int, files []string, desert int) []*MaskQuality {
+	qs := make([]*MaskQuality, s.nGenomes)
+	seeds := make([]int32, 0, len(cands))
+	var i, g, d, prev int
+	var flag uint8
+	var sum, sum2 float64
+	for g = 0; g < s.nGenomes; g++ {
+		q := &MaskQuality{File: files[g], GenomeSize: s.genomes[g].size}
+		qs[g] = q
+
+		seeds = seeds[:0]
+		for _, c := range cands {
+			i = c*s.nGenomes + g
+			if s.pos[i] < 0 {
+				continue
+			}
+			flag = s.flags[i]
+			if flag == maskCaptureLowComplexity {
+				q.LowComplexity++
+				continue
+			}
+			if flag == maskCaptureRepeated {
+				q.Repeated++
+			}
+			seeds = append(seeds, s.pos[i])
+		}
+		slices.Sort(seeds)
+		seeds = slices.Compact(seeds)
+		q.Seeds = len(seeds)
+
+		sum, sum2 = 0, 0
+		prev = 0
+		for i = 0; i <= len(seeds); i++ {
+			if i < len(seeds) {
+				d = int(seeds[i]) - prev
+				prev = int(seeds[i])
+			} else {
+				d = q.GenomeSize - prev
+			}
+			sum += float64(d)
+			sum2 += float64(d) * float64(d)
+			if d > q.MaxDist {
+				q.MaxDist = d
+			}
+			if d > desert {
+				q.Deserts++
+				q.DesertBases += d
+			}
+		}
+		n := float64(len(seeds) + 1)
+		q.MeanDist = sum / n
+		if q.MeanDist > 0 {
+			q.CVDist = math.Sqrt(math.Max(sum2/n-q.MeanDist*q.MeanDist, 0)) / q.MeanDist
+		}
+	}
+	return qs
+}
+
+// maskCandidate is a candidate mask in the heap.
+type maskCandidate struct {
+	idx  int
+	gain float64
+	poor bool
+	tie  uint32
+}
+
+// maskCandidateHeap puts good candidates with bigger gains on the top.
+type maskCandidateHeap []*maskCandidate
+
+func (h maskCandidateHeap) Len() int { return len(h) }
+
+func (h maskCandidateHeap) Less(i, j int) bool {
+	if h[i].poor != h[j].poor {
+		return !h[i].poor
+	}
+	if h[i].gain != h[j].gain {
+		return h[i].gain > h[j].gain
+	}
+	return h[i].tie < h[j].tie
+}
+
+func (h maskCandidateHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *maskCandidateHeap) Push(x interface{}) { *h = append(*h, x.(*maskCandidate)) }
+
+func (h *maskCandidateHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
@@ -0,0 +1,132 @@
+// Copyright © 2023-2026 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bufio"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// QueryStatsHeader is the header line of the per-query diagnostics file.
+const QueryStatsHeader = "query\tqlen\tmasked_kmers\tseeds\tgenomes_seeded\tgenomes_chained\tgenomes_topn\tchains\taligns\taligns_kept\tfilt_evalue\tfilt_qcov_hsp\tfilt_pident\tfilt_qcov_gnm\thits\ttime_seeding\ttime_chaining\ttime_extension\ttime_wfa"
+
+// QueryStats records diagnostics of searching a query, which help to find out
+// why a query has no or few hits, and which stage costs the most time.
+// Values modified during the concurrent alignment of genomes are atomic.
+type QueryStats struct {
+	MaskedKmers int // captured k-mers, excluding low-complexity ones
+
+	// matched seed pairs of each prefix length, indexed by the length
+	SeedsPerPrefix [33]int
+
+	GenomesSeeded  int // genomes with matched seeds
+	GenomesChained int // genomes passing the chaining score, before keeping the top N genomes
+	GenomesTopN    int // genomes for alignment, after keeping the top N genomes
+	Chains         int // chains in genomes for alignment
+
+	Aligns     atomic.Int64 // alignments of HSP fragments
+	AlignsKept atomic.Int64 // alignments passing all the filters
+
+	// alignments (or genomes for FilteredQcovGenome) filtered out by each reason
+	FilteredEvalue     atomic.Int64
+	FilteredQcovHSP    atomic.Int64
+	FilteredPIdent     atomic.Int64
+	FilteredQcovGenome atomic.Int64
+
+	// wall time of seed matching (including masking) and chaining
+	TimeSeeding  time.Duration
+	TimeChaining time.Duration
+
+	// time of pseudo-alignment and extension, and base-level alignment with WFA,
+	// summed over genomes which are aligned concurrently
+	TimeExtension atomic.Int64
+	TimeWFA       atomic.Int64
+}
+
+// Reset resets all the values.
+func (s *QueryStats) Reset() {
+	s.MaskedKmers = 0
+	clear(s.SeedsPerPrefix[:])
+	s.GenomesSeeded = 0
+	s.GenomesChained = 0
+	s.GenomesTopN = 0
+	s.Chains = 0
+	s.Aligns.Store(0)
+	s.AlignsKept.Store(0)
+	s.FilteredEvalue.Store(0)
+	s.FilteredQcovHSP.Store(0)
+	s.FilteredPIdent.Store(0)
+	s.FilteredQcovGenome.Store(0)
+	s.TimeSeeding = 0
+	s.TimeChaining = 0
+	s.TimeExtension.Store(0)
+	s.TimeWFA.Store(0)
+}
+
+// Write writes a line of the stats, matching QueryStatsHeader.
+// Seeds are formatted as "prefix_length:number" pairs separated by commas, or "-" for none.
+// Time is in seconds.
+func (s *QueryStats) Write(w *bufio.Writer, queryID []byte, qlen int, hits int) {
+	w.Write(queryID)
+	w.WriteByte('\t')
+	w.WriteString(strconv.Itoa(qlen))
+	w.WriteByte('\t')
+	w.WriteString(strconv.Itoa(s.MaskedKmers))
+
+	w.WriteByte('\t')
+	var n int
+	for l, v := range s.SeedsPerPrefix {
+		if v == 0 {
+			continue
+		}
+		if n > 0 {
+			w.WriteByte(',')
+		}
+		w.WriteString(strconv.Itoa(l))
+		w.WriteByte(':')
+		w.WriteString(strconv.Itoa(v))
+		n++
+	}
+	if n == 0 {
+		w.WriteByte('-')
+	}
+
+	for _, v := range []int64{
+		int64(s.GenomesSeeded), int64(s.GenomesChained), int64(s.GenomesTopN), int64(s.Chains),
+		s.Aligns.Load(), s.AlignsKept.Load(),
+		s.FilteredEvalue.Load(), s.FilteredQcovHSP.Load(), s.FilteredPIdent.Load(), s.FilteredQcovGenome.Load(),
+		int64(hits),
+	} {
+		w.WriteByte('\t')
+		w.WriteString(strconv.FormatInt(v, 10))
+	}
+
+	for _, t := range []time.Duration{
+		s.TimeSeeding, s.TimeChaining,
+		time.Duration(s.TimeExtension.Load()), time.Duration(s.TimeWFA.Load()),
+	} {
+		w.WriteByte('\t')
+		w.WriteString(strconv.FormatFloat(t.Seconds(), 'f', 6, 64))
+	}
+	w.WriteByte('\n')
+}
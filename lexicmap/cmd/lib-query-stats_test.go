@@ -0,0 +1,56 @@
+// Copyright © 2023-2026 Wei Shen <shenwei356@gmail.com>
+
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQueryStatsWrite(t *testing.T) {
+	var buf bytes.Buffer
+	w := bufio.NewWriter(&buf)
+
+	s := &QueryStats{}
+	s.MaskedKmers = 1000
+	s.SeedsPerPrefix[15] = 3
+	s.SeedsPerPrefix[31] = 120
+	s.GenomesSeeded = 10
+	s.GenomesChained = 5
+	s.GenomesTopN = 2
+	s.Chains = 4
+	s.Aligns.Add(6)
+	s.AlignsKept.Add(2)
+	s.FilteredEvalue.Add(1)
+	s.FilteredQcovHSP.Add(2)
+	s.FilteredPIdent.Add(1)
+	s.FilteredQcovGenome.Add(1)
+	s.TimeSeeding = 1500 * time.Millisecond
+	s.TimeWFA.Add(int64(time.Millisecond))
+	s.Write(w, []byte("q1"), 500, 1)
+
+	s.Reset()
+	s.Write(w, []byte("q2"), 10, 0) // a query without hits
+	w.Flush()
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	expected := []string{
+		"q1\t500\t1000\t15:3,31:120\t10\t5\t2\t4\t6\t2\t1\t2\t1\t1\t1\t1.500000\t0.000000\t0.000000\t0.001000",
+		"q2\t10\t0\t-\t0\t0\t0\t0\t0\t0\t0\t0\t0\t0\t0\t0.000000\t0.000000\t0.000000\t0.000000",
+	}
+	if len(lines) != len(expected) {
+		t.Fatalf("expected %d lines, got %d", len(expected), len(lines))
+	}
+	nCols := len(strings.Split(QueryStatsHeader, "\t"))
+	for i, line := range lines {
+		if line != expected[i] {
+			t.Errorf("line %d: expected %q, got %q", i+1, expected[i], line)
+		}
+		if n := len(strings.Split(line, "\t")); n != nCols {
+			t.Errorf("line %d: expected %d columns, got %d", i+1, nCols, n)
+		}
+	}
+}
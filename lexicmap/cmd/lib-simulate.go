@@ -0,0 +1,323 @@
+// Copyright © 2023-2026 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"github.com/shenwei356/xopen"
+)
+
+// SimTruthHeader is the header line of the truth file of simulated queries.
+const SimTruthHeader = "query\tqlen\tsgenome\tsseqid\tsstart\tsend\tsstr\tslen\tsub_rate\tindel_rate\tsubs\tins\tdels\tdivergence"
+
+// SimTruth is the source region and mutations of a simulated query.
+type SimTruth struct {
+	Query  string
+	Qlen   int
+	Genome string
+	SeqID  string
+	Start  int  // 1-based
+	End    int  // 1-based
+	Strand byte // '+' or '-'
+	SeqLen int  // length of the source sequence
+
+	SubRate   float64
+	IndelRate float64
+
+	SimMutations
+}
+
+// SimMutations records the mutations introduced into a simulated query.
+type SimMutations struct {
+	Subs     int // substituted bases
+	InsBases int // inserted bases
+	DelBases int // deleted bases
+}
+
+// Divergence returns the percentage of mutated bases relative to the source region.
+func (t *SimTruth) Divergence() float64 {
+	n := t.End - t.Start + 1
+	if n <= 0 {
+		return 0
+	}
+	return float64(t.Subs+t.InsBases+t.DelBases) / float64(n) * 100
+}
+
+// Write writes a line matching SimTruthHeader.
+func (t *SimTruth) Write(w *bufio.Writer) {
+	fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%d\t%d\t%c\t%d\t%g\t%g\t%d\t%d\t%d\t%.3f\n",
+		t.Query, t.Qlen, t.Genome, t.SeqID, t.Start, t.End, t.Strand, t.SeqLen,
+		t.SubRate, t.IndelRate, t.Subs, t.InsBases, t.DelBases, t.Divergence())
+}
+
+// readSimTruth reads a truth file created by "lexicmap utils simulate-queries".
+func readSimTruth(file string) ([]*SimTruth, error) {
+	fh, err := xopen.Ropen(file)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	truths := make([]*SimTruth, 0, 1024)
+	m := make(map[string]struct{}, 1024)
+	ncols := len(strings.Split(SimTruthHeader, "\t"))
+
+	scanner := bufio.NewScanner(fh)
+	var line string
+	var items []string
+	headerLine := true
+	var iLine int
+	for scanner.Scan() {
+		iLine++
+		line = strings.TrimRight(scanner.Text(), "\r\n")
+		if line == "" {
+			continue
+		}
+		if headerLine {
+			headerLine = false
+			if line != SimTruthHeader {
+				return nil, fmt.Errorf("invalid header of the truth file, please use the output of 'lexicmap utils simulate-queries'")
+			}
+			continue
+		}
+		items = strings.Split(line, "\t")
+		if len(items) != ncols {
+			return nil, fmt.Errorf("line %d: %d columns found, %d expected", iLine, len(items), ncols)
+		}
+		if len(items[6]) != 1 {
+			return nil, fmt.Errorf("line %d: invalid strand: %s", iLine, items[6])
+		}
+
+		t := &SimTruth{
+			Query:  items[0],
+			Genome: items[2],
+			SeqID:  items[3],
+			Strand: items[6][0],
+		}
+		ints := []*int{nil, &t.Qlen, nil, nil, &t.Start, &t.End, nil, &t.SeqLen, nil, nil, &t.Subs, &t.InsBases, &t.DelBases}
+		for i, v := range ints {
+			if v == nil {
+				continue
+			}
+			if *v, err = strconv.Atoi(items[i]); err != nil {
+				return nil, fmt.Errorf("line %d: failed to parse integer: %s", iLine, items[i])
+			}
+		}
+		if t.SubRate, err = strconv.ParseFloat(items[8], 64); err != nil {
+			return nil, fmt.Errorf("line %d: failed to parse sub_rate: %s", iLine, items[8])
+		}
+		if t.IndelRate, err = strconv.ParseFloat(items[9], 64); err != nil {
+			return nil, fmt.Errorf("line %d: failed to parse indel_rate: %s", iLine, items[9])
+		}
+
+		if _, ok := m[t.Query]; ok {
+			return nil, fmt.Errorf("duplicated query: %s", t.Query)
+		}
+		m[t.Query] = struct{}{}
+		truths = append(truths, t)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return truths, nil
+}
+
+// simChooseRegion randomly chooses a region with a length of l from sequences of the given sizes,
+// where all possible regions have equal chances. If all sequences are shorter than l,
+// the longest one is used if it's not shorter than minLen, otherwise, -1 is returned for j.
+func simChooseRegion(rng *rand.Rand, sizes []int, l int, minLen int) (j, start, length int) {
+	var total int64
+	for _, s := range sizes {
+		if s >= l {
+			total += int64(s - l + 1)
+		}
+	}
+
+	if total == 0 {
+		j = -1
+		for i, s := range sizes {
+			if s >= minLen && (j < 0 || s > sizes[j]) {
+				j = i
+			}
+		}
+		if j < 0 {
+			return -1, 0, 0
+		}
+		return j, 0, sizes[j]
+	}
+
+	r := rng.Int63n(total)
+	var n int64
+	for i, s := range sizes {
+		if s < l {
+			continue
+		}
+		n = int64(s - l + 1)
+		if r < n {
+			return i, int(r), l
+		}
+		r -= n
+	}
+	return -1, 0, 0 // not happen
+}
+
+var simBases = []byte("ACGT")
+
+// simMutate introduces substitutions and indels into s and appends the result to out.
+// At each base, an indel happens with the probability of indelRate, with the length
+// in the range of [1, maxIndelLen] and equal chances of insertions and deletions,
+// otherwise, the base is substituted with another one with the probability of subRate.
+func simMutate(rng *rand.Rand, s []byte, subRate, indelRate float64, maxIndelLen int, out []byte) ([]byte, SimMutations) {
+	var mut SimMutations
+	var p float64
+	var l int
+	var b byte
+	for i := 0; i < len(s); i++ {
+		p = rng.Float64()
+		if p < indelRate {
+			l = 1 + rng.Intn(maxIndelLen)
+			if rng.Intn(2) == 0 { // insertion before the base
+				for j := 0; j < l; j++ {
+					out = append(out, simBases[rng.Intn(4)])
+				}
+				mut.InsBases += l
+				out = append(out, s[i])
+			} else { // deletion
+				l = min(l, len(s)-i)
+				mut.DelBases += l
+				i += l - 1
+			}
+			continue
+		}
+		if p < indelRate+subRate {
+			b = simBases[rng.Intn(3)]
+			if b == s[i] {
+				b = 'T'
+			}
+			out = append(out, b)
+			mut.Subs++
+			continue
+		}
+		out = append(out, s[i])
+	}
+	return out, mut
+}
+
+// matchLocus tells if an HSP hits the source region of a simulated query,
+// i.e., it's on the same sequence and strand, and at least minOverlap of the HSP
+// in the subject overlaps with the source region.
+func (t *SimTruth) matchLocus(genome, seqid string, strand string, start, end int, minOverlap float64) bool {
+	if genome != t.Genome || seqid != t.SeqID || len(strand) != 1 || strand[0] != t.Strand {
+		return false
+	}
+	if start > end {
+		start, end = end, start
+	}
+	overlap := min(end, t.End) - max(start, t.Start) + 1
+	if overlap <= 0 {
+		return false
+	}
+	return float64(overlap) >= minOverlap*float64(end-start+1)
+}
+
+// SimEvalQuery is the evaluation result of a simulated query.
+type SimEvalQuery struct {
+	Truth *SimTruth
+
+	Genomes     int  // genome hits
+	GenomeFound bool // the source genome is hit
+	HSPs        int
+	HSPsCorrect int // HSPs hitting the source region
+}
+
+// SimEvalStratum accumulates evaluation results of queries in a stratum.
+type SimEvalStratum struct {
+	Strata string // stratified by what
+	Bin    string
+
+	Queries     int
+	GenomeFound int // queries with the source genome hit
+	Genomes     int // genome hits
+	LocusFound  int // queries with the source region hit
+	HSPs        int
+	HSPsCorrect int
+}
+
+// Add adds the result of a query.
+func (s *SimEvalStratum) Add(q *SimEvalQuery) {
+	s.Queries++
+	s.Genomes += q.Genomes
+	if q.GenomeFound {
+		s.GenomeFound++
+	}
+	s.HSPs += q.HSPs
+	s.HSPsCorrect += q.HSPsCorrect
+	if q.HSPsCorrect > 0 {
+		s.LocusFound++
+	}
+}
+
+// SimEvalHeader is the header line of evaluation results.
+const SimEvalHeader = "strata\tbin\tqueries\tgenome_found\tgenome_hits\tgenome_recall\tgenome_precision\tlocus_found\thsps\thsps_correct\tlocus_recall\tlocus_precision"
+
+// Write writes a line matching SimEvalHeader. Precision of strata without hits is "-".
+func (s *SimEvalStratum) Write(w *bufio.Writer) {
+	ratio := func(a, b int) string {
+		if b == 0 {
+			return "-"
+		}
+		return strconv.FormatFloat(float64(a)/float64(b), 'f', 4, 64)
+	}
+	fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%d\t%s\t%s\t%d\t%d\t%d\t%s\t%s\n",
+		s.Strata, s.Bin, s.Queries,
+		s.GenomeFound, s.Genomes, ratio(s.GenomeFound, s.Queries), ratio(s.GenomeFound, s.Genomes),
+		s.LocusFound, s.HSPs, s.HSPsCorrect, ratio(s.LocusFound, s.Queries), ratio(s.HSPsCorrect, s.HSPs))
+}
+
+// simBins creates strata of bins from sorted breaks, e.g., breaks of 1,5 create
+// three bins: [0,1), [1,5), and [5,inf).
+func simBins(strata string, breaks []float64) []*SimEvalStratum {
+	bins := make([]*SimEvalStratum, 0, len(breaks)+1)
+	var pre float64
+	for _, b := range breaks {
+		bins = append(bins, &SimEvalStratum{Strata: strata, Bin: fmt.Sprintf("[%g,%g)", pre, b)})
+		pre = b
+	}
+	bins = append(bins, &SimEvalStratum{Strata: strata, Bin: fmt.Sprintf("[%g,%g)", pre, math.Inf(1))})
+	return bins
+}
+
+// simBinIndex returns the index of the bin of v.
+func simBinIndex(breaks []float64, v float64) int {
+	for i, b := range breaks {
+		if v < b {
+			return i
+		}
+	}
+	return len(breaks)
+}
@@ -0,0 +1,150 @@
+// Copyright © 2023-2026 Wei Shen <shenwei356@gmail.com>
+
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSimMutate(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	s := bytes.Repeat([]byte("ACGTTGCA"), 125)
+
+	// no mutations
+	out, mut := simMutate(rng, s, 0, 0, 5, nil)
+	if !bytes.Equal(out, s) || mut != (SimMutations{}) {
+		t.Errorf("unexpected mutations with zero rates: %+v", mut)
+	}
+
+	// substitutions only
+	out, mut = simMutate(rng, s, 1, 0, 5, out[:0])
+	if len(out) != len(s) || mut.Subs != len(s) || mut.InsBases+mut.DelBases != 0 {
+		t.Errorf("unexpected mutations with a substitution rate of 1: %+v", mut)
+	}
+	for i, b := range out {
+		if b == s[i] {
+			t.Fatalf("base %d not substituted", i)
+		}
+	}
+
+	// indels only
+	out, mut = simMutate(rng, s, 0, 0.05, 5, out[:0])
+	if mut.Subs != 0 || mut.InsBases == 0 || mut.DelBases == 0 {
+		t.Errorf("unexpected mutations with an indel rate of 0.05: %+v", mut)
+	}
+	if len(out) != len(s)+mut.InsBases-mut.DelBases {
+		t.Errorf("unexpected length: %d, expected %d", len(out), len(s)+mut.InsBases-mut.DelBases)
+	}
+}
+
+func TestSimChooseRegion(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	for i := 0; i < 1000; i++ {
+		j, start, length := simChooseRegion(rng, []int{100, 1000, 50}, 200, 50)
+		if j != 1 || length != 200 || start < 0 || start+length > 1000 {
+			t.Fatalf("invalid region: %d, %d, %d", j, start, length)
+		}
+	}
+
+	// all sequences are shorter than the length
+	if j, start, length := simChooseRegion(rng, []int{100, 300, 50}, 500, 200); j != 1 || start != 0 || length != 300 {
+		t.Errorf("expected the longest sequence, got: %d, %d, %d", j, start, length)
+	}
+	if j, _, _ := simChooseRegion(rng, []int{100, 50}, 500, 200); j != -1 {
+		t.Errorf("expected no regions, got sequence %d", j)
+	}
+}
+
+func TestSimTruthMatchLocus(t *testing.T) {
+	truth := &SimTruth{Genome: "g1", SeqID: "s1", Start: 1001, End: 2000, Strand: '-'}
+
+	tests := []struct {
+		genome, seqid, strand string
+		start, end            int
+		expected              bool
+	}{
+		{"g1", "s1", "-", 1001, 2000, true},
+		{"g1", "s1", "-", 1500, 2400, true},  // 501/901 overlapped
+		{"g1", "s1", "-", 1800, 2400, false}, // 201/601 overlapped
+		{"g1", "s1", "+", 1001, 2000, false},
+		{"g1", "s2", "-", 1001, 2000, false},
+		{"g2", "s1", "-", 1001, 2000, false},
+		{"g1", "s1", "-", 3000, 4000, false},
+	}
+	for i, c := range tests {
+		if m := truth.matchLocus(c.genome, c.seqid, c.strand, c.start, c.end, 0.5); m != c.expected {
+			t.Errorf("case %d: expected %v, got %v", i+1, c.expected, m)
+		}
+	}
+}
+
+func TestSimTruthReadWrite(t *testing.T) {
+	truths := []*SimTruth{
+		{Query: "sim_1", Qlen: 1003, Genome: "g1", SeqID: "s1", Start: 1, End: 1000, Strand: '+', SeqLen: 5000,
+			SubRate: 0.01, IndelRate: 0.001, SimMutations: SimMutations{Subs: 10, InsBases: 5, DelBases: 2}},
+		{Query: "sim_2", Qlen: 500, Genome: "g2", SeqID: "s9", Start: 201, End: 700, Strand: '-', SeqLen: 800},
+	}
+
+	file := filepath.Join(t.TempDir(), "truth.tsv")
+	fh, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := bufio.NewWriter(fh)
+	w.WriteString(SimTruthHeader + "\n")
+	for _, truth := range truths {
+		truth.Write(w)
+	}
+	w.Flush()
+	fh.Close()
+
+	truths2, err := readSimTruth(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(truths2) != len(truths) {
+		t.Fatalf("expected %d records, got %d", len(truths), len(truths2))
+	}
+	for i, truth := range truths {
+		if *truths2[i] != *truth {
+			t.Errorf("record %d: expected %+v, got %+v", i+1, *truth, *truths2[i])
+		}
+	}
+	if d := truths2[0].Divergence(); math.Abs(d-1.7) > 1e-9 {
+		t.Errorf("expected divergence 1.7, got %f", d)
+	}
+}
+
+func TestSimBins(t *testing.T) {
+	breaks := []float64{1, 5}
+	bins := simBins("divergence", breaks)
+	labels := []string{"[0,1)", "[1,5)", "[5,+Inf)"}
+	if len(bins) != len(labels) {
+		t.Fatalf("expected %d bins, got %d", len(labels), len(bins))
+	}
+	for i, b := range bins {
+		if b.Bin != labels[i] {
+			t.Errorf("bin %d: expected %s, got %s", i, labels[i], b.Bin)
+		}
+	}
+
+	for v, i := range map[float64]int{0: 0, 0.99: 0, 1: 1, 4.5: 1, 5: 2, 100: 2} {
+		if j := simBinIndex(breaks, v); j != i {
+			t.Errorf("value %f: expected bin %d, got %d", v, i, j)
+		}
+	}
+
+	var s SimEvalStratum
+	s.Add(&SimEvalQuery{Genomes: 3, GenomeFound: true, HSPs: 4, HSPsCorrect: 1})
+	s.Add(&SimEvalQuery{})
+	if s.Queries != 2 || s.GenomeFound != 1 || s.Genomes != 3 || s.LocusFound != 1 || s.HSPs != 4 || s.HSPsCorrect != 1 {
+		t.Errorf("unexpected stratum: %+v", s)
+	}
+}
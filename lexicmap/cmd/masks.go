@@ -22,6 +22,7 @@ package cmd
 
 import (
 	"fmt"
+	"math/rand"
 	"os"
 	"path/filepath"
 	"strings"
@@ -35,8 +36,43 @@ import (
 
 var masksCmd = &cobra.Command{
 	Use:   "masks",
-	Short: "View masks of the index or generate new masks randomly",
-	Long: `View masks of the index or generate new masks randomly
+	Short: "View masks of the index or generate new masks randomly or from genomes",
+	Long: `View masks of the index or generate new masks randomly or from genomes
+
+Generating masks from genomes:
+  If genome files are given via positional arguments or -X/--infile-list,
+  masks are tuned to the genome collection, and the output can be used in
+  "lexicmap index -M".
+
+  1. Up to -n/--genomes genomes are randomly sampled as representative ones.
+  2. For each mask prefix of p+1 bases, where p is the biggest value with
+     4^p <= -m/--masks, -c/--candidates masks with random suffixes are generated,
+     and the k-mer each one captures in every genome is computed.
+  3. Candidates are regarded as poor if they have low-complexity prefixes,
+     or capture low-complexity k-mers (discarded in indexing) or k-mers with
+     multiple occurrences in more than half of the genomes.
+  4. Masks are chosen greedily to cover all p-base prefixes first and then to
+     fill the remaining masks with distinct (p+1)-base prefixes, each time
+     choosing the one best splitting the longest seed distances, so that
+     sketching deserts (> -D/--seed-max-desert) are reduced and seeds are
+     distributed more uniformly.
+  5. A quality report is written to -r/--report, comparing the estimated seed
+     distributions of the generated masks and random masks in each genome.
+
+  Memory: about 32 bytes per base for each genome processed in parallel (-j/--threads).
+
+Columns of the quality report:
+  1.  masks,          Mask set: optimised or random.
+  2.  file,           Genome file.
+  3.  genome_size,    Genome size.
+  4.  seeds,          Number of distinct seed positions.
+  5.  repeated,       Number of masks capturing k-mers with multiple occurrences.
+  6.  low_complexity, Number of masks capturing low-complexity k-mers.
+  7.  mean_dist,      Mean seed distance.
+  8.  cv_dist,        Coefficient of variation of seed distances.
+  9.  max_dist,       Maximum seed distance.
+  10. deserts,        Number of seed distances longer than -D/--seed-max-desert.
+  11. desert_bases,   Total length of deserts.
 
 `,
 	Run: func(cmd *cobra.Command, args []string) {
@@ -78,6 +114,21 @@ var masksCmd = &cobra.Command{
 		lcPrefix := getFlagNonNegativeInt(cmd, "prefix")
 		seed := getFlagPositiveInt(cmd, "seed")
 
+		var files []string
+		if len(args) > 0 || getFlagString(cmd, "infile-list") != "" {
+			if dbDir != "" {
+				checkError(fmt.Errorf("flag -d/--index is not allowed when generating masks from genomes"))
+			}
+			files = getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+		}
+		nGenomes := getFlagNonNegativeInt(cmd, "genomes")
+		nCandidates := getFlagPositiveInt(cmd, "candidates")
+		maxDesert := getFlagPositiveInt(cmd, "seed-max-desert")
+		reportFile := getFlagString(cmd, "report")
+		if len(files) > 0 && reportFile == "" && !isStdout(outFile) {
+			reportFile = strings.TrimSuffix(outFile, ".gz") + ".report.tsv"
+		}
+
 		// ---------------------------------------------------------------
 		// output file handler
 		outfh, gw, w, err := outStream(outFile, strings.HasSuffix(outFile, ".gz"), opt.CompressionLevel)
@@ -129,6 +180,74 @@ var masksCmd = &cobra.Command{
 					fmt.Fprintf(outfh, "%d\t%s\n", i+1, decoder(code, _k))
 				}
 			}
+		} else if len(files) > 0 { // from genomes
+			if outputLog {
+				log.Infof("%d genome file(s) given", len(files))
+			}
+
+			if nGenomes > 0 && len(files) > nGenomes {
+				rng := rand.New(rand.NewSource(int64(seed)))
+				rng.Shuffle(len(files), func(i, j int) { files[i], files[j] = files[j], files[i] })
+				files = files[:nGenomes]
+				if outputLog {
+					log.Infof("%d genome(s) randomly sampled", nGenomes)
+				}
+			}
+
+			if outputLog {
+				log.Infof("generating masks from genomes...")
+			}
+
+			result, err := GenerateMasksFromGenomes(files, &MaskGenerationOptions{
+				NumCPUs:  opt.NumCPUs,
+				Verbose:  opt.Verbose,
+				Log2File: opt.Log2File,
+
+				K:          k,
+				Masks:      nMasks,
+				Seed:       int64(seed),
+				Candidates: nCandidates,
+
+				DesertMaxLen: maxDesert,
+			})
+			checkError(err)
+
+			_k := uint8(k)
+			for i, code := range result.Masks {
+				fmt.Fprintf(outfh, "%d\t%s\n", i+1, decoder(code, _k))
+			}
+
+			if outputLog {
+				var q1, q2 MaskQuality
+				for i, q := range result.Optimised {
+					q1.Seeds += q.Seeds
+					q1.Deserts += q.Deserts
+					q1.DesertBases += q.DesertBases
+					q1.CVDist += q.CVDist
+					q2.Seeds += result.Random[i].Seeds
+					q2.Deserts += result.Random[i].Deserts
+					q2.DesertBases += result.Random[i].DesertBases
+					q2.CVDist += result.Random[i].CVDist
+				}
+				n := float64(len(result.Optimised))
+				log.Infof("%d masks generated, %d with poor captures, %d with low-complexity prefixes",
+					len(result.Masks), result.PoorMasks, result.LowComplexityPrefixes)
+				log.Infof("  mean seeds per genome: %.1f (random masks: %.1f)",
+					float64(q1.Seeds)/n, float64(q2.Seeds)/n)
+				log.Infof("  mean deserts per genome: %.1f (random masks: %.1f)",
+					float64(q1.Deserts)/n, float64(q2.Deserts)/n)
+				log.Infof("  mean desert bases per genome: %.1f (random masks: %.1f)",
+					float64(q1.DesertBases)/n, float64(q2.DesertBases)/n)
+				log.Infof("  mean CV of seed distances: %.4f (random masks: %.4f)",
+					q1.CVDist/n, q2.CVDist/n)
+			}
+
+			if reportFile != "" {
+				checkError(writeMaskReport(reportFile, result, opt.CompressionLevel))
+				if outputLog {
+					log.Infof("quality report saved to: %s", reportFile)
+				}
+			}
 		} else { // re generate
 			if outputLog {
 				log.Infof("generating new mask...")
@@ -166,5 +285,46 @@ func init() {
 	masksCmd.Flags().IntP("prefix", "p", 0,
 		formatFlagUsage(`Length of mask k-mer prefix for checking low-complexity (0 for no checking).`))
 
-	masksCmd.SetUsageTemplate(usageTemplate("{ -d <index path> | [-k <k>] [-n <masks>] [-s <seed>] } [-o out.tsv.gz]"))
+	masksCmd.Flags().IntP("genomes", "n", 20,
+		formatFlagUsage(`Maximum number of genomes randomly sampled from the input genome files for generating masks (0 for all).`))
+
+	masksCmd.Flags().IntP("candidates", "c", 4,
+		formatFlagUsage(`Number of random candidate masks for each mask prefix when generating masks from genomes.`))
+
+	masksCmd.Flags().IntP("seed-max-desert", "D", 100,
+		formatFlagUsage(`Maximum length of sketching deserts when generating masks from genomes. It should be the same as the value in "lexicmap index".`))
+
+	masksCmd.Flags().StringP("report", "r", "",
+		formatFlagUsage(`Quality report file of masks generated from genomes. By default, it's the output file with a suffix of ".report.tsv", and no report is written when outputting to stdout.`))
+
+	masksCmd.SetUsageTemplate(usageTemplate("{ -d <index path> | [-k <k>] [-m <masks>] [-s <seed>] [genome files] } [-o out.tsv.gz]"))
+}
+
+// writeMaskReport writes the quality report of masks generated from genomes.
+func writeMaskReport(file string, result *MaskGenerationResult, level int) error {
+	outfh, gw, w, err := outStream(file, strings.HasSuffix(file, ".gz"), level)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(outfh, "masks\tfile\tgenome_size\tseeds\trepeated\tlow_complexity\tmean_dist\tcv_dist\tmax_dist\tdeserts\tdesert_bases\n")
+	for _, set := range []struct {
+		name string
+		qs   []*MaskQuality
+	}{
+		{"optimised", result.Optimised},
+		{"random", result.Random},
+	} {
+		for _, q := range set.qs {
+			fmt.Fprintf(outfh, "%s\t%s\t%d\t%d\t%d\t%d\t%.2f\t%.4f\t%d\t%d\t%d\n",
+				set.name, q.File, q.GenomeSize, q.Seeds, q.Repeated, q.LowComplexity,
+				q.MeanDist, q.CVDist, q.MaxDist, q.Deserts, q.DesertBases)
+		}
+	}
+
+	outfh.Flush()
+	if gw != nil {
+		gw.Close()
+	}
+	return w.Close()
 }
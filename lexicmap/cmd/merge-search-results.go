@@ -337,6 +337,10 @@ func (h SearchResultsHeap) Pop() interface{} {
 type SearchResultReader struct {
 	query string
 
+	// ExtraColumns are names of columns after the 20 basic ones in the header line,
+	// e.g., the alignment columns of -a/--all, and the feature columns of --annotations.
+	ExtraColumns []string
+
 	fh *xopen.Reader
 
 	ch chan *SearchResultOfAGenome
@@ -361,9 +365,20 @@ func NewSearchResultReader(file string, query string, bufferSize int64) (*Search
 	scanner.Buffer(buf, int(bufferSize))
 	ncols := 20
 
+	// the header line
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r\n")
+		if line == "" {
+			continue
+		}
+		if items := strings.Split(line, "\t"); len(items) > ncols {
+			r.ExtraColumns = items[ncols:]
+		}
+		break
+	}
+
 	go func() {
 		var line string
-		headerLine := true
 		var query, qlen, hits, sgenome, sseqid, qcovGnm, cls, hsp, qcovHSP, alenHSP string
 		var pident, gaps, qstart, qend, sstart, send, sstr, slen, evalue, bitscore string
 		var extra string
@@ -371,7 +386,7 @@ func NewSearchResultReader(file string, query string, bufferSize int64) (*Search
 		var _bitscore int
 		var _hits int
 
-		var sgenomePre string
+		var sgenomePre, queryPre string
 
 		items := make([]string, ncols)
 
@@ -385,10 +400,6 @@ func NewSearchResultReader(file string, query string, bufferSize int64) (*Search
 			if line == "" {
 				continue
 			}
-			if headerLine {
-				headerLine = false
-				continue
-			}
 			stringSplitNByByte(line, '\t', ncols, &items)
 			if len(items) < ncols {
 				checkError(fmt.Errorf("the input has only %d columns (<%d), please use output from 'lexicmap search'", len(items), ncols))
@@ -443,7 +454,7 @@ func NewSearchResultReader(file string, query string, bufferSize int64) (*Search
 
 			// -------
 
-			if sgenome != sgenomePre { // new one
+			if sgenome != sgenomePre || query != queryPre { // new one
 				if rGnm.Sgenome != "" {
 					r.ch <- rGnm
 
@@ -457,6 +468,7 @@ func NewSearchResultReader(file string, query string, bufferSize int64) (*Search
 				rGnm.QcovGnm = qcovGnm
 
 				sgenomePre = sgenome
+				queryPre = query
 			}
 
 			rSeq := poolSearchResultOfASequence.Get().(*SearchResultOfASequence)
@@ -0,0 +1,56 @@
+// Copyright © 2023-2026 Wei Shen <shenwei356@gmail.com>
+
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSearchResultReaderExtraColumns(t *testing.T) {
+	basic := "query\tqlen\thits\tsgenome\tsseqid\tqcovGnm\tcls\thsp\tqcovHSP\talenHSP\tpident\tgaps\tqstart\tqend\tsstart\tsend\tsstr\tslen\tevalue\tbitscore"
+	record := "q1\t10\t1\tg1\ts1\t100.000\t1\t1\t100.000\t10\t100.000\t0\t1\t10\t101\t110\t+\t1000\t1.00e-01\t20"
+
+	for _, c := range []struct {
+		name   string
+		header string
+		extra  string
+		want   []string
+	}{
+		{"basic", "", "", nil},
+		{"all", "\tcigar\tqseq\tsseq\talign", "\t10M\tACGTACGTAC\tACGTACGTAC\t||||||||||",
+			[]string{"cigar", "qseq", "sseq", "align"}},
+		{"annotations", "\tfeat_id\tfeat_locus_tag\tfeat_product\tfeat_dist", "\t-\t-\t-\t-1",
+			[]string{"feat_id", "feat_locus_tag", "feat_product", "feat_dist"}},
+	} {
+		t.Run(c.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "r.tsv")
+			data := basic + c.header + "\n" + record + c.extra + "\n"
+			if err := os.WriteFile(file, []byte(data), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			reader, err := NewSearchResultReader(file, "", 1<<20)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(reader.ExtraColumns, c.want) {
+				t.Errorf("unexpected extra columns: %v, want %v", reader.ExtraColumns, c.want)
+			}
+
+			rGnm := reader.Next()
+			if rGnm == nil || len(rGnm.Records) != 1 {
+				t.Fatalf("one record expected")
+			}
+			if extra := strings.TrimPrefix(c.extra, "\t"); rGnm.Records[0].Extra != extra {
+				t.Errorf("unexpected extra data: %q, want %q", rGnm.Records[0].Extra, extra)
+			}
+			if reader.Next() != nil {
+				t.Errorf("only one genome expected")
+			}
+		})
+	}
+}
@@ -140,6 +140,8 @@ Limitations:
 		if err != nil {
 			checkError(fmt.Errorf("failed to read info file: %s", err))
 		}
+		layout, err := NewIndexLayout(dbDir, info)
+		checkError(err)
 
 		if outputLog {
 			log.Infof("  checking passed")
@@ -375,7 +377,7 @@ Limitations:
 					<-tokens
 				}()
 
-				fileSeeds := filepath.Join(dbDir, DirSeeds, chunkFile(chunk))
+				fileSeeds := layout.SeedFile(chunk)
 
 				// -------------------------------
 				// header
@@ -0,0 +1,282 @@
+// Copyright © 2023-2026 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+var queryCovCmd = &cobra.Command{
+	Use:   "query-cov",
+	Short: "Compute query coverage intervals and depth from search results",
+	Long: `Compute query coverage intervals and depth from search results
+
+Input:
+  - Output file of 'lexicmap search', both the default 20- and 24-column formats are supported.
+  - Results of multiple queries are supported.
+
+Output:
+  - Per-genome query coverage intervals in BED format (-o/--out-file),
+    where intervals of all HSPs in a genome are merged. Positions are in
+    query coordinates (0-based start and 1-based end), with 5 columns:
+      1. query,   query sequence ID.
+      2. start,   start position of the covered region.
+      3. end,     end position of the covered region.
+      4. sgenome, subject genome ID.
+      5. hsps,    number of HSPs overlapping with the region.
+  - Optional depth profile across all hit genomes in bedGraph format (-g/--bedgraph),
+    where the depth is the number of genomes covering each region of the query.
+    Regions with zero depth are also reported.
+
+Tips:
+  - Filter the search result before computing coverage with 'lexicmap utils filter-results',
+    to skip low-identity HSPs.
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		opt := getOptions(cmd)
+
+		outFile := getFlagString(cmd, "out-file")
+		fileBedGraph := getFlagString(cmd, "bedgraph")
+		query := getFlagString(cmd, "query")
+		maxGap := getFlagNonNegativeInt(cmd, "max-gap")
+
+		bufferSizeS := getFlagString(cmd, "buffer-size")
+		if bufferSizeS == "" {
+			checkError(fmt.Errorf("value of buffer size. supported unit: K, M, G"))
+		}
+		bufferSize, err := ParseByteSize(bufferSizeS)
+		if err != nil {
+			checkError(fmt.Errorf("invalid value of buffer size. supported unit: K, M, G"))
+		}
+
+		timeStart := time.Now()
+		defer func() {
+			if opt.Verbose {
+				log.Info()
+				log.Infof("elapsed time: %s", time.Since(timeStart))
+				log.Info()
+			}
+		}()
+
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+
+		// ---------------------------------------------------------------
+
+		outfh, gw, w, err := outStream(outFile, strings.HasSuffix(outFile, ".gz"), opt.CompressionLevel)
+		checkError(err)
+		defer func() {
+			outfh.Flush()
+			if gw != nil {
+				gw.Close()
+			}
+			w.Close()
+		}()
+
+		outputBedGraph := fileBedGraph != ""
+		var depth *QueryDepth
+		var gfh *bufio.Writer
+		if outputBedGraph {
+			_gfh, ggw, gw2, err := outStream(fileBedGraph, strings.HasSuffix(fileBedGraph, ".gz"), opt.CompressionLevel)
+			checkError(err)
+			gfh = _gfh
+			defer func() {
+				gfh.Flush()
+				if ggw != nil {
+					ggw.Close()
+				}
+				gw2.Close()
+			}()
+		}
+
+		var rGnm *SearchResultOfAGenome
+		var rSeq *SearchResultOfASequence
+		var qlen, qstart, qend int
+		var queryPre string
+		var nQueries, nGenomes int
+		regions := make([][3]int, 0, 128) // start, end, hsps
+
+		for _, file := range files {
+			reader, err := NewSearchResultReader(file, query, bufferSize)
+			checkError(err)
+
+			for {
+				rGnm = reader.Next()
+				if rGnm == nil {
+					break
+				}
+
+				if rGnm.Query != queryPre { // a new query
+					if outputBedGraph && depth != nil {
+						depth.WriteBedGraph(gfh, queryPre)
+					}
+
+					qlen, err = strconv.Atoi(rGnm.Qlen)
+					if err != nil {
+						checkError(fmt.Errorf("failed to parse qlen: %s", rGnm.Qlen))
+					}
+					if outputBedGraph {
+						depth = NewQueryDepth(qlen)
+					}
+
+					queryPre = rGnm.Query
+					nQueries++
+				}
+				nGenomes++
+
+				// intervals of HSPs, 0-based start and 1-based end
+				regions = regions[:0]
+				for _, rSeq = range rGnm.Records {
+					qstart, err = strconv.Atoi(rSeq.Qstart)
+					if err != nil {
+						checkError(fmt.Errorf("failed to parse qstart: %s", rSeq.Qstart))
+					}
+					qend, err = strconv.Atoi(rSeq.Qend)
+					if err != nil {
+						checkError(fmt.Errorf("failed to parse qend: %s", rSeq.Qend))
+					}
+					regions = append(regions, [3]int{qstart - 1, qend, 1})
+				}
+				regions = mergeQueryRegions(regions, maxGap)
+
+				for _, r := range regions {
+					fmt.Fprintf(outfh, "%s\t%d\t%d\t%s\t%d\n", rGnm.Query, r[0], r[1], rGnm.Sgenome, r[2])
+					if outputBedGraph {
+						depth.Add(r[0], r[1])
+					}
+				}
+
+				RecycleSearchResultOfAGenome(rGnm)
+			}
+		}
+		if outputBedGraph && depth != nil {
+			depth.WriteBedGraph(gfh, queryPre)
+		}
+
+		if opt.Verbose {
+			log.Infof("coverage computed for %d genome hits of %d queries", nGenomes, nQueries)
+		}
+	},
+}
+
+func init() {
+	utilsCmd.AddCommand(queryCovCmd)
+
+	queryCovCmd.Flags().StringP("out-file", "o", "-",
+		formatFlagUsage(`Out file of per-genome coverage intervals in BED format, supports the ".gz" suffix ("-" for stdout).`))
+
+	queryCovCmd.Flags().StringP("bedgraph", "g", "",
+		formatFlagUsage(`Out file of the depth profile across all hit genomes in bedGraph format, supports the ".gz" suffix.`))
+
+	queryCovCmd.Flags().StringP("query", "q", "",
+		formatFlagUsage(`Only compute coverage for this query.`))
+
+	queryCovCmd.Flags().IntP("max-gap", "G", 0,
+		formatFlagUsage(`Merge intervals of HSPs in a genome if the gap between them is <= this value.`))
+
+	queryCovCmd.Flags().StringP("buffer-size", "b", "20M",
+		formatFlagUsage(`Size of buffer, supported unit: K, M, G. You need increase the value when "bufio.Scanner: token too long" error reported`))
+
+	queryCovCmd.SetUsageTemplate(usageTemplate(""))
+}
+
+// mergeQueryRegions merges overlapping regions (0-based start, 1-based end, count),
+// regions with gaps <= maxGap are also merged.
+func mergeQueryRegions(regions [][3]int, maxGap int) [][3]int {
+	if len(regions) <= 1 {
+		return regions
+	}
+
+	slices.SortFunc(regions, func(a, b [3]int) int {
+		if a[0] == b[0] {
+			return a[1] - b[1]
+		}
+		return a[0] - b[0]
+	})
+
+	var i int
+	for _, r := range regions[1:] {
+		if r[0]-regions[i][1] <= maxGap {
+			if r[1] > regions[i][1] {
+				regions[i][1] = r[1]
+			}
+			regions[i][2] += r[2]
+			continue
+		}
+		i++
+		regions[i] = r
+	}
+	return regions[:i+1]
+}
+
+// QueryDepth records the number of genomes covering each position of a query.
+type QueryDepth struct {
+	diff []int32
+}
+
+// NewQueryDepth creates a QueryDepth for a query.
+func NewQueryDepth(qlen int) *QueryDepth {
+	return &QueryDepth{diff: make([]int32, qlen+1)}
+}
+
+// Add adds a region (0-based start, 1-based end).
+func (d *QueryDepth) Add(start, end int) {
+	if start < 0 {
+		start = 0
+	}
+	if end > len(d.diff)-1 {
+		end = len(d.diff) - 1
+	}
+	if start >= end {
+		return
+	}
+	d.diff[start]++
+	d.diff[end]--
+}
+
+// WriteBedGraph outputs the depth profile in bedGraph format.
+func (d *QueryDepth) WriteBedGraph(outfh *bufio.Writer, query string) {
+	qlen := len(d.diff) - 1
+	if qlen <= 0 {
+		return
+	}
+	var v, vPre int32
+	var start int
+	for i := 0; i < qlen; i++ {
+		v += d.diff[i]
+		if i == 0 {
+			vPre = v
+			continue
+		}
+		if v != vPre {
+			fmt.Fprintf(outfh, "%s\t%d\t%d\t%d\n", query, start, i, vPre)
+			start, vPre = i, v
+		}
+	}
+	fmt.Fprintf(outfh, "%s\t%d\t%d\t%d\n", query, start, qlen, vPre)
+}
@@ -179,6 +179,7 @@ When to use this command?
 			Log2File:     opt.Log2File,
 			MaxOpenFiles: maxOpenFiles,
 			MergeThreads: mergeThreads,
+			Checksums:    !getFlagBool(cmd, "no-checksums"),
 		}
 
 		// outdir string,                           dbDir
@@ -186,7 +187,7 @@ When to use this command?
 		// tmpDir string,                           tmpDir
 		// round int                                1
 
-		err = mergeIndexes(lh, maskPrefix, anchorPrefix, bopt, kvChunks, dbDir, batchDirs, tmpDir, 1)
+		err = mergeIndexes(lh, maskPrefix, anchorPrefix, bopt, kvChunks, dbDir, batchDirs, tmpDir, 1, false)
 		if err != nil {
 			checkError(fmt.Errorf("failed to merge indexes: %s", err))
 		}
@@ -196,6 +197,9 @@ When to use this command?
 		if err != nil {
 			checkError(fmt.Errorf("failed to remove tmp directory: %s", err))
 		}
+
+		// sizes and checksums of index files
+		checkError(saveIndexManifest(dbDir, bopt))
 	},
 }
 
@@ -211,5 +215,8 @@ func init() {
 	remergeCmd.Flags().IntP("max-open-files", "", 1024,
 		formatFlagUsage(`Maximum opened files, used in merging indexes. If there are >100 batches, please increase this value and set a bigger "ulimit -n" in shell.`))
 
+	remergeCmd.Flags().BoolP("no-checksums", "", false,
+		formatFlagUsage(`Do not compute SHA-256 checksums of index files in the manifest file (manifest.tsv), only file sizes are recorded.`))
+
 	remergeCmd.SetUsageTemplate(usageTemplate("[flags] -d <index path>"))
 }
@@ -28,6 +28,7 @@ import (
 
 	"github.com/dustin/go-humanize"
 	"github.com/shenwei356/LexicMap/lexicmap/cmd/genome"
+	"github.com/shenwei356/LexicMap/lexicmap/cmd/util"
 	"github.com/shenwei356/bio/seq"
 	"github.com/spf13/cobra"
 )
@@ -94,6 +95,11 @@ func updateInputBases(info *IndexInfo, dbDir string, threads int) (int64, error)
 		done <- 1
 	}()
 
+	layout, err := NewIndexLayout(dbDir, info)
+	if err != nil {
+		return 0, err
+	}
+
 	// extract genome sizes
 	var wg sync.WaitGroup
 	tokens := make(chan int, threads)
@@ -101,7 +107,7 @@ func updateInputBases(info *IndexInfo, dbDir string, threads int) (int64, error)
 		wg.Add(1)
 		tokens <- 1
 		go func(i int) {
-			fileGenomes := filepath.Join(dbDir, DirGenomes, batchDir(i), FileGenomes)
+			fileGenomes := layout.GenomeFile(i)
 			rdr, err := genome.NewReader(fileGenomes)
 			if err != nil {
 				checkError(fmt.Errorf("failed to create genome reader: %s", err))
@@ -124,8 +130,11 @@ func updateInputBases(info *IndexInfo, dbDir string, threads int) (int64, error)
 
 	// update info file
 	info.InputBases = totalBases
+	if util.IsRemote(dbDir) { // read-only
+		return totalBases, nil
+	}
 
-	err := writeIndexInfo(filepath.Join(dbDir, FileInfo), info)
+	err = writeIndexInfo(filepath.Join(dbDir, FileInfo), info)
 	if err != nil {
 		return 0, (fmt.Errorf("failed to write info file: %s", err))
 	}
@@ -23,6 +23,7 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
 	"sync"
 	"time"
@@ -65,6 +66,8 @@ var reindexSeedsCmd = &cobra.Command{
 		if err != nil {
 			checkError(fmt.Errorf("failed to read info file: %s", err))
 		}
+		layout, err := NewIndexLayout(dbDir, info)
+		checkError(err)
 
 		// ---------------------------------------------------------------
 
@@ -113,7 +116,7 @@ var reindexSeedsCmd = &cobra.Command{
 		tokens := make(chan int, opt.NumCPUs)
 		threadsFloat := float64(opt.NumCPUs)
 		for chunk := 0; chunk < info.Chunks; chunk++ {
-			file := filepath.Join(dbDir, DirSeeds, chunkFile(chunk))
+			file := layout.SeedFile(chunk)
 			wg.Add(1)
 			tokens <- 1
 
@@ -147,6 +150,16 @@ var reindexSeedsCmd = &cobra.Command{
 		if opt.Verbose {
 			log.Infof("  finished updating the index information file: %s", fileInfo)
 		}
+
+		// checksums of updated seed index files
+		files := make([]string, info.Chunks)
+		for chunk := 0; chunk < info.Chunks; chunk++ {
+			files[chunk] = path.Join(DirSeeds, chunkFile(chunk)+kv.KVIndexFileExt)
+		}
+		err = updateIndexManifest(dbDir, files, opt.NumCPUs)
+		if err != nil {
+			checkError(fmt.Errorf("failed to update manifest file: %s", err))
+		}
 	},
 }
 
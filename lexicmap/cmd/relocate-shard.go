@@ -0,0 +1,465 @@
+// Copyright © 2023-2026 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shenwei356/LexicMap/lexicmap/cmd/kv"
+	"github.com/shenwei356/util/pathutil"
+	"github.com/spf13/cobra"
+)
+
+var relocateShardCmd = &cobra.Command{
+	Use:   "relocate-shard",
+	Short: "Move seed chunks and genome batches of an index to another storage volume",
+	Long: `Move seed chunks and genome batches of an index to another storage volume
+
+Seed data files (seeds/chunk_*.bin) and genome batch directories (genomes/batch_*)
+of an index can be placed in multiple shard roots, e.g., directories on different
+disks, so the index can be larger than a single disk, and reading seed data and
+genomes in "lexicmap search" is spread across devices.
+
+Shard roots are recorded in the index information file (info.toml):
+
+  shards = ['/mnt/disk2/db.lmi.shard', '/mnt/disk3/db.lmi.shard']
+  seed-chunk-shards = [0, 1, 2, 0, 1, 2, ...]
+  genome-batch-shards = [0, 0, 1, ...]
+
+The value 0 means the index directory, and i means the i-th shard root.
+A shard root has the same directory structure as the index directory.
+Other files (masks, genome map, info, and manifest) are always kept in the index directory.
+
+Steps:
+  1. Copying files of the chosen seed chunks (--chunks) and genome batches (--batches)
+     to the shard root (-t/--to). Files are copied in parallel (-j/--threads).
+  2. Verifying the copied files with the manifest file (manifest.tsv), or with sizes
+     of the source files if the manifest file is absent.
+  3. Updating the index information file.
+  4. Removing the source files. Shard roots not used anymore are removed from info.toml.
+
+Tips:
+  1. To move shards back to the index directory, set the index directory to -t/--to.
+  2. Use "lexicmap utils verify-index" to check the index after relocating.
+  3. If the index directory is moved, no changes are needed as absolute paths of
+     shard roots are recorded. If a shard root is moved, please edit info.toml.
+  4. "lexicmap index --force" does not delete files in shard roots.
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		opt := getOptions(cmd)
+
+		var fhLog *os.File
+		if opt.Log2File {
+			fhLog = addLog(opt.LogFile, opt.Verbose)
+		}
+
+		outputLog := opt.Verbose || opt.Log2File
+
+		timeStart := time.Now()
+		defer func() {
+			if outputLog {
+				log.Info()
+				log.Infof("elapsed time: %s", time.Since(timeStart))
+				log.Info()
+			}
+			if opt.Log2File {
+				fhLog.Close()
+			}
+		}()
+
+		// ---------------------------------------------------------------
+
+		dbDir := getFlagString(cmd, "index")
+		if dbDir == "" {
+			checkError(fmt.Errorf("flag -d/--index needed"))
+		}
+		dbDir = filepath.Clean(dbDir)
+
+		to := getFlagString(cmd, "to")
+		if to == "" {
+			checkError(fmt.Errorf("flag -t/--to needed"))
+		}
+
+		chunksStr := getFlagStringSlice(cmd, "chunks")
+		batchesStr := getFlagStringSlice(cmd, "batches")
+		if len(chunksStr) == 0 && len(batchesStr) == 0 {
+			checkError(fmt.Errorf("at least one of the flags --chunks and --batches is needed"))
+		}
+
+		layout, info, err := ReadIndexLayout(dbDir)
+		checkError(err)
+		if info.MainVersion != MainVersion {
+			checkError(fmt.Errorf("index main versions do not match: %d (index) != %d (tool). please re-create the index", info.MainVersion, MainVersion))
+		}
+		checkError(layout.CheckRoots())
+
+		chunks, err := parseIndexRanges(chunksStr, info.Chunks)
+		if err != nil {
+			checkError(fmt.Errorf("invalid value of --chunks: %s", err))
+		}
+		batches, err := parseIndexRanges(batchesStr, info.GenomeBatches)
+		if err != nil {
+			checkError(fmt.Errorf("invalid value of --batches: %s", err))
+		}
+
+		// ---------------------------------------------------------------
+		// the target shard
+
+		target, root, err := shardOfRoot(layout, info, to)
+		checkError(err)
+		if target > 0 {
+			for _, sub := range []string{DirSeeds, DirGenomes} {
+				checkError(os.MkdirAll(filepath.Join(root, sub), 0755))
+			}
+			if target > len(info.Shards) {
+				info.Shards = append(info.Shards, root)
+			}
+		}
+
+		if outputLog {
+			if target == 0 {
+				log.Infof("moving shards back to the index directory: %s", dbDir)
+			} else {
+				log.Infof("moving shards to the shard root #%d: %s", target, root)
+			}
+		}
+
+		// ---------------------------------------------------------------
+		// files to move
+
+		var srcs, dsts, files []string
+		_chunks := make([]int, 0, len(chunks))
+		for _, chunk := range chunks {
+			if layout.ChunkShard(chunk) == target {
+				continue
+			}
+			_chunks = append(_chunks, chunk)
+			file := path.Join(DirSeeds, chunkFile(chunk))
+			for _, f := range []string{file, file + kv.KVIndexFileExt} {
+				files = append(files, f)
+				srcs = append(srcs, layout.File(f))
+				dsts = append(dsts, filepath.Join(root, filepath.FromSlash(f)))
+			}
+		}
+		_batches := make([]int, 0, len(batches))
+		srcDirs := make([]string, 0, len(batches)) // genome batch directories to remove
+		for _, batch := range batches {
+			if layout.BatchShard(batch) == target {
+				continue
+			}
+			_batches = append(_batches, batch)
+			srcDirs = append(srcDirs, layout.GenomeDir(batch))
+			entries, err := os.ReadDir(layout.GenomeDir(batch))
+			if err != nil {
+				checkError(fmt.Errorf("failed to read genome batch directory: %s", err))
+			}
+			for _, e := range entries {
+				if e.IsDir() {
+					continue
+				}
+				f := path.Join(DirGenomes, batchDir(batch), e.Name())
+				files = append(files, f)
+				srcs = append(srcs, layout.File(f))
+				dsts = append(dsts, filepath.Join(root, filepath.FromSlash(f)))
+			}
+		}
+
+		if len(files) == 0 {
+			if outputLog {
+				log.Infof("all chosen seed chunks and genome batches are already in the target, nothing to do")
+			}
+			return
+		}
+		if outputLog {
+			log.Infof("  %d seed chunks and %d genome batches (%d files) to move", len(_chunks), len(_batches), len(files))
+		}
+
+		// ---------------------------------------------------------------
+		// copy and verify
+
+		var manifest map[string]*IndexFileRecord
+		fileManifest := filepath.Join(dbDir, FileManifest)
+		ok, err := pathutil.Exists(fileManifest)
+		if err != nil {
+			checkError(fmt.Errorf("failed to check manifest file: %s", err))
+		}
+		if ok {
+			records, err := readIndexManifest(fileManifest)
+			if err != nil {
+				checkError(fmt.Errorf("failed to read manifest file: %s", err))
+			}
+			manifest = make(map[string]*IndexFileRecord, len(records))
+			for _, r := range records {
+				manifest[r.File] = r
+			}
+		} else if outputLog {
+			log.Warningf("manifest file not found, copied files are only checked with file sizes: %s", fileManifest)
+		}
+
+		if outputLog {
+			log.Infof("copying and verifying files ...")
+		}
+		err = copyShardFiles(files, srcs, dsts, manifest, opt.NumCPUs)
+		if err != nil {
+			checkError(fmt.Errorf("failed to copy files: %s", err))
+		}
+
+		// ---------------------------------------------------------------
+		// update the index information
+
+		if len(info.ChunkShards) == 0 {
+			info.ChunkShards = make([]int, info.Chunks)
+		}
+		for _, chunk := range _chunks {
+			info.ChunkShards[chunk] = target
+		}
+		if len(info.BatchShards) == 0 {
+			info.BatchShards = make([]int, info.GenomeBatches)
+		}
+		for _, batch := range _batches {
+			info.BatchShards[batch] = target
+		}
+		compactIndexShards(info)
+
+		err = writeIndexInfo(filepath.Join(dbDir, FileInfo), info)
+		if err != nil {
+			checkError(fmt.Errorf("failed to write info file: %s", err))
+		}
+		if outputLog {
+			log.Infof("  finished updating the index information file: %s", filepath.Join(dbDir, FileInfo))
+		}
+
+		// ---------------------------------------------------------------
+		// remove source files
+
+		for _, src := range srcs {
+			checkError(os.Remove(src))
+		}
+		for _, dir := range srcDirs {
+			checkError(os.Remove(dir))
+		}
+		if outputLog {
+			log.Infof("  finished removing source files")
+		}
+	},
+}
+
+func init() {
+	utilsCmd.AddCommand(relocateShardCmd)
+
+	relocateShardCmd.Flags().StringP("index", "d", "",
+		formatFlagUsage(`Index directory created by "lexicmap index".`))
+
+	relocateShardCmd.Flags().StringP("to", "t", "",
+		formatFlagUsage(`Target shard root, e.g., a directory on another disk. Set the index directory to move shards back.`))
+
+	relocateShardCmd.Flags().StringSliceP("chunks", "c", []string{},
+		formatFlagUsage(`Seed chunks to move, e.g., "0-7,10". "all" for all chunks.`))
+
+	relocateShardCmd.Flags().StringSliceP("batches", "b", []string{},
+		formatFlagUsage(`Genome batches to move, e.g., "0-3,5". "all" for all batches.`))
+
+	relocateShardCmd.SetUsageTemplate(usageTemplate("-d <index path> -t <shard root> [--chunks <list>] [--batches <list>]"))
+}
+
+// parseIndexRanges parses a list of integers and ranges (e.g., "0-7,10") in [0, n),
+// and returns sorted unique values. "all" means all values.
+func parseIndexRanges(vals []string, n int) ([]int, error) {
+	m := make(map[int]struct{}, n)
+	var begin, end int
+	var err error
+	for _, val := range vals {
+		val = strings.TrimSpace(val)
+		if val == "" {
+			continue
+		}
+		if val == "all" {
+			begin, end = 0, n-1
+		} else if i := strings.Index(val, "-"); i > 0 {
+			if begin, err = strconv.Atoi(val[:i]); err != nil {
+				return nil, fmt.Errorf("invalid range: %s", val)
+			}
+			if end, err = strconv.Atoi(val[i+1:]); err != nil {
+				return nil, fmt.Errorf("invalid range: %s", val)
+			}
+			if begin > end {
+				return nil, fmt.Errorf("invalid range: %s", val)
+			}
+		} else {
+			if begin, err = strconv.Atoi(val); err != nil {
+				return nil, fmt.Errorf("invalid value: %s", val)
+			}
+			end = begin
+		}
+
+		if begin < 0 || end >= n {
+			return nil, fmt.Errorf("value out of range [0, %d]: %s", n-1, val)
+		}
+		for i := begin; i <= end; i++ {
+			m[i] = struct{}{}
+		}
+	}
+
+	list := make([]int, 0, len(m))
+	for i := range m {
+		list = append(list, i)
+	}
+	slices.Sort(list)
+	return list, nil
+}
+
+// shardOfRoot returns the shard of a root and its absolute path.
+// A new shard root gets the number of existing shard roots plus one.
+func shardOfRoot(layout *IndexLayout, info *IndexInfo, root string) (int, string, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return -1, "", err
+	}
+	for i, r := range layout.Roots {
+		r, err = filepath.Abs(r)
+		if err != nil {
+			return -1, "", err
+		}
+		if r == root {
+			return i, root, nil
+		}
+	}
+
+	ok, err := pathutil.Exists(root)
+	if err != nil {
+		return -1, "", err
+	}
+	if ok {
+		ok, err = pathutil.DirExists(root)
+		if err != nil {
+			return -1, "", err
+		}
+		if !ok {
+			return -1, "", fmt.Errorf("the shard root is not a directory: %s", root)
+		}
+	}
+	return len(info.Shards) + 1, root, nil
+}
+
+// copyShardFiles copies files in parallel, and verifies copied files with the manifest records
+// of the relative paths, or sizes of source files if the manifest is nil.
+func copyShardFiles(files, srcs, dsts []string, manifest map[string]*IndexFileRecord, threads int) error {
+	var wg sync.WaitGroup
+	tokens := make(chan int, max(1, threads))
+	errs := make([]error, len(files))
+	for i := range files {
+		wg.Add(1)
+		tokens <- 1
+		go func(i int) {
+			defer func() {
+				<-tokens
+				wg.Done()
+			}()
+
+			err := os.MkdirAll(filepath.Dir(dsts[i]), 0755)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			err = copyFile(srcs[i], dsts[i])
+			if err != nil {
+				errs[i] = err
+				return
+			}
+
+			if r, ok := manifest[files[i]]; ok && r.HasChecksum() {
+				checksum, size, err := fileChecksum(dsts[i])
+				if err != nil {
+					errs[i] = err
+					return
+				}
+				if size != r.Size || checksum != r.Checksum {
+					errs[i] = fmt.Errorf("checksum mismatch after copying")
+				}
+				return
+			}
+
+			fi1, err := os.Stat(srcs[i])
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			fi2, err := os.Stat(dsts[i])
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			if fi1.Size() != fi2.Size() {
+				errs[i] = fmt.Errorf("size mismatch after copying")
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return fmt.Errorf("%s: %s", files[i], err)
+		}
+	}
+	return nil
+}
+
+// compactIndexShards removes shard roots not used by any seed chunk or genome batch,
+// and clears shard lists if all files are in the index directory.
+func compactIndexShards(info *IndexInfo) {
+	used := make([]bool, len(info.Shards)+1)
+	for _, s := range info.ChunkShards {
+		used[s] = true
+	}
+	for _, s := range info.BatchShards {
+		used[s] = true
+	}
+
+	newShard := make([]int, len(used))
+	shards := make([]string, 0, len(info.Shards))
+	for i, root := range info.Shards {
+		if used[i+1] {
+			shards = append(shards, root)
+			newShard[i+1] = len(shards)
+		}
+	}
+	if len(shards) == 0 {
+		info.Shards, info.ChunkShards, info.BatchShards = nil, nil, nil
+		return
+	}
+
+	info.Shards = shards
+	for i, s := range info.ChunkShards {
+		info.ChunkShards[i] = newShard[s]
+	}
+	for i, s := range info.BatchShards {
+		info.BatchShards[i] = newShard[s]
+	}
+}
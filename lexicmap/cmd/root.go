@@ -82,8 +82,8 @@ func formatFlagUsage(s string) string {
 
 func usageTemplate(s string) string {
 	return fmt.Sprintf(`Usage:{{if .Runnable}}
-  {{.UseLine}}{{end}}{{if .HasAvailableSubCommands}}
-  {{.CommandPath}} [command]{{end}} %s{{if gt (len .Aliases) 0}}
+  {{.UseLine}} %[1]s{{end}}{{if .HasAvailableSubCommands}}
+  {{.CommandPath}} [command]{{if not .Runnable}} %[1]s{{end}}{{end}}{{if gt (len .Aliases) 0}}
 
 Aliases:
   {{.NameAndAliases}}{{end}}{{if .HasExample}}
@@ -0,0 +1,657 @@
+// Copyright © 2023-2026 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shenwei356/bio/seq"
+	"github.com/shenwei356/bio/seqio/fastx"
+	"github.com/spf13/cobra"
+)
+
+var screenContaminationCmd = &cobra.Command{
+	Use:   "screen-contamination",
+	Short: "Screen an assembly for contaminant contigs with taxonomy-aware searching",
+	Long: `Screen an assembly for contaminant contigs with taxonomy-aware searching
+
+Input:
+  - Contigs of a query assembly in (gzipped) FASTA format, via positional parameters
+    and/or a file list via the flag -X/--infile-list. Contigs in all files are
+    regarded as one assembly.
+  - Taxonomy data (-T/--taxdump) and the genome-to-TaxId mapping file (-G/--genome2taxid)
+    of genomes in the index.
+
+How:
+  1. Each contig is split into non-overlapping fragments of -s/--frag-size bp.
+     The last fragment shorter than -m/--min-frag-len is merged into the previous one,
+     and contigs shorter than -m/--min-frag-len are not screened.
+  2. Fragments are searched against the index, and the genome(s) with the highest bit score
+     of a HSP (query coverage >= -q/--min-qcov) are used to assign a fragment to a taxon
+     at the rank of -r/--rank. Fragments with no hits, with unclassified genomes, or with
+     best genomes from different taxa are unassigned.
+  3. The majority taxon of the assembly is the one with the most assigned bases.
+     Use -t/--taxid to specify the expected taxon if the assembly might be heavily contaminated.
+  4. Assigned fragments of a contig are concordant if they belong to the majority taxon,
+     and discordant otherwise. A contig is flagged as contaminated if the fraction of
+     discordant bases in assigned bases >= -f/--min-discordant-frac.
+
+Output (one row per contig, -o/--out-file):
+  1.  contig,          Contig ID.
+  2.  length,          Contig length.
+  3.  fragments,       The number of fragments.
+  4.  assigned,        The number of assigned fragments.
+  5.  concordant,      The number of concordant fragments.
+  6.  discordant,      The number of discordant fragments.
+  7.  discordant_frac, The fraction of discordant bases in assigned bases.
+  8.  taxid,           TaxId of the taxon with the most assigned bases of the contig, 0 for none.
+  9.  taxon,           Name of the taxon.
+  10. verdict,         clean, contaminated, or unassigned (no assigned fragments).
+
+  Optionally, contigs not flagged as contaminated are written to a FASTA file (-c/--clean-fasta),
+  where unassigned contigs can also be removed with --drop-unassigned.
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		opt := getOptions(cmd)
+		seq.ValidateSeq = false
+
+		var fhLog *os.File
+		if opt.Log2File {
+			fhLog = addLog(opt.LogFile, opt.Verbose)
+		}
+
+		outputLog := opt.Verbose || opt.Log2File
+
+		timeStart := time.Now()
+		defer func() {
+			if outputLog {
+				log.Info()
+				log.Infof("elapsed time: %s", time.Since(timeStart))
+				log.Info()
+			}
+			if opt.Log2File {
+				fhLog.Close()
+			}
+		}()
+
+		var err error
+
+		// ---------------------------------------------------------------
+
+		dbDir := getFlagString(cmd, "index")
+		if dbDir == "" {
+			checkError(fmt.Errorf("flag -d/--index needed"))
+		}
+		outFile := getFlagString(cmd, "out-file")
+		fileClean := getFlagString(cmd, "clean-fasta")
+		dropUnassigned := getFlagBool(cmd, "drop-unassigned")
+		lineWidth := getFlagNonNegativeInt(cmd, "line-width")
+
+		taxdumpDir := getFlagString(cmd, "taxdump")
+		genome2taxidFile := getFlagString(cmd, "genome2taxid")
+		if taxdumpDir == "" || genome2taxidFile == "" {
+			checkError(fmt.Errorf("flags -T/--taxdump and -G/--genome2taxid needed"))
+		}
+		rank := strings.ToLower(getFlagNonEmptyString(cmd, "rank"))
+		expectedTaxid := uint32(getFlagNonNegativeInt(cmd, "taxid"))
+
+		fragSize := getFlagPositiveInt(cmd, "frag-size")
+		minFragLen := getFlagPositiveInt(cmd, "min-frag-len")
+		if minFragLen > fragSize {
+			checkError(fmt.Errorf("the value of flag -m/--min-frag-len (%d) should not be > that of -s/--frag-size (%d)", minFragLen, fragSize))
+		}
+		minDiscordantFrac := getFlagNonNegativeFloat64(cmd, "min-discordant-frac")
+		if minDiscordantFrac == 0 || minDiscordantFrac > 1 {
+			checkError(fmt.Errorf("the value of flag -f/--min-discordant-frac (%f) should be in range of (0, 1]", minDiscordantFrac))
+		}
+
+		minIdent := getFlagNonNegativeFloat64(cmd, "align-min-match-pident")
+		if minIdent < 60 || minIdent > 100 {
+			checkError(fmt.Errorf("the value of flag -i/--align-min-match-pident (%f) should be in range of [60, 100]", minIdent))
+		}
+		minQcov := getFlagNonNegativeFloat64(cmd, "min-qcov")
+		if minQcov > 100 {
+			checkError(fmt.Errorf("the value of flag -q/--min-qcov (%f) should be in range of [0, 100]", minQcov))
+		}
+
+		maxOpenFiles := getFlagPositiveInt(cmd, "max-open-files")
+		inMemorySearch := getFlagBool(cmd, "load-whole-seeds")
+		maxQueryConcurrency := getFlagNonNegativeInt(cmd, "max-query-conc")
+		if maxQueryConcurrency == 0 {
+			maxQueryConcurrency = opt.NumCPUs
+		}
+
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+
+		// ---------------------------------------------------------------
+		// taxonomy
+
+		if outputLog {
+			log.Infof("loading taxonomy data from: %s", taxdumpDir)
+		}
+		tax, err := loadTaxonomyWithRankAndNames(taxdumpDir)
+		if err != nil {
+			checkError(fmt.Errorf("failed to load taxonomy data: %s", err))
+		}
+		genome2taxid, err := readKVsUint32(genome2taxidFile, false)
+		if err != nil {
+			checkError(fmt.Errorf("failed to read genome2taxid file: %s", genome2taxidFile))
+		}
+		if outputLog {
+			log.Infof("  %d genome2taxid records loaded", len(genome2taxid))
+		}
+		taxa := NewGenomeTaxa(tax, genome2taxid, rank)
+
+		var expectedTaxon uint32
+		var expectedName string
+		if expectedTaxid > 0 {
+			expectedTaxon, expectedName = taxa.TaxonOfTaxId(expectedTaxid)
+			if expectedTaxon == 0 {
+				checkError(fmt.Errorf("no taxon at the rank of %s found for the TaxId %d", rank, expectedTaxid))
+			}
+		}
+
+		// ---------------------------------------------------------------
+		// contigs
+
+		if outputLog {
+			log.Infof("reading contigs from %d files ...", len(files))
+		}
+
+		contigs := make([]*ScreenedContig, 0, 1024)
+		frags := make([]*ContigFragment, 0, 4096)
+		var nBases int
+		for _, file := range files {
+			contigs, frags, err = readScreenedContigs(file, contigs, frags, fragSize, minFragLen)
+			checkError(err)
+		}
+		for _, c := range contigs {
+			nBases += len(c.Seq)
+		}
+		if outputLog {
+			log.Infof("  %d contigs (%d bp) are split into %d fragments", len(contigs), nBases, len(frags))
+		}
+
+		// ---------------------------------------------------------------
+		// index
+
+		if outputLog {
+			log.Info()
+			log.Infof("loading index: %s", dbDir)
+		}
+
+		sopt := &IndexSearchingOptions{
+			NumCPUs:      opt.NumCPUs,
+			Verbose:      opt.Verbose,
+			Log2File:     opt.Log2File,
+			MaxOpenFiles: maxOpenFiles,
+
+			MaxSeedSearchingConcurrency: max(maxQueryConcurrency/2, 2),
+
+			MinPrefix:       15,
+			MinSinglePrefix: 17,
+			InMemorySearch:  inMemorySearch,
+
+			MaxGap:      50,
+			MaxDistance: 1000,
+
+			ExtendLength:  1000,
+			ExtendLength2: 50,
+
+			MinQueryAlignedFractionInAGenome: minQcov,
+			MaxEvalue:                        10,
+		}
+
+		idx, err := NewIndexSearcher(dbDir, sopt)
+		checkError(err)
+		defer func() {
+			checkError(idx.Close())
+		}()
+
+		minAlignLen := 50
+		idx.SetSeqCompareOptions(&SeqComparatorOptions{
+			K:         uint8(31),
+			MinPrefix: 11,
+
+			Chaining2Options: Chaining2Options{
+				MaxGap:      20,
+				MinScore:    int(float64(minAlignLen) * minIdent / 100),
+				MinAlignLen: minAlignLen,
+				MinIdentity: minIdent,
+				BandBase:    100,
+				BandCount:   50,
+
+				HeuristicKmerPidentThreshold: 15,
+			},
+
+			MinAlignedFraction: minQcov,
+			MinIdentity:        minIdent,
+		})
+
+		if outputLog {
+			log.Infof("index loaded in %s", time.Since(timeStart))
+			log.Info()
+		}
+
+		// ---------------------------------------------------------------
+		// searching
+
+		if outputLog {
+			log.Infof("searching %d fragments ...", len(frags))
+		}
+
+		id2name := idx.BatchGenomeIndex2GenomeID
+
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		tokens := make(chan int, maxQueryConcurrency)
+		var nDone int
+		for _, frag := range frags {
+			tokens <- 1
+			wg.Add(1)
+
+			go func(frag *ContigFragment) {
+				defer func() {
+					<-tokens
+					wg.Done()
+				}()
+
+				contig := contigs[frag.Contig]
+
+				query := poolQuery.Get().(*Query)
+				query.Reset()
+				query.seqID = append(query.seqID, contig.ID...)
+				query.seq = append(query.seq, bytes.ToUpper(contig.Seq[frag.Start:frag.End])...)
+
+				if len(query.seq) >= idx.k {
+					var err error
+					query.result, err = idx.Search(query, nil, false)
+					checkError(err)
+				}
+
+				if query.result != nil {
+					var name string
+					for _, r := range *query.result {
+						_, c := typingBestHSP(r)
+						if c == nil || c.AlignedFraction < minQcov {
+							continue
+						}
+
+						if c.BitScore > frag.BitScore {
+							frag.BitScore = c.BitScore
+							frag.Genomes = frag.Genomes[:0]
+						} else if c.BitScore < frag.BitScore {
+							continue
+						}
+
+						// a genome might be split into multiple chunks
+						name = string(id2name[r.BatchGenomeIndex])
+						if !slices.Contains(frag.Genomes, name) {
+							frag.Genomes = append(frag.Genomes, name)
+						}
+					}
+
+					idx.RecycleSearchResults(query.result)
+				}
+				poolQuery.Put(query)
+
+				mu.Lock()
+				nDone++
+				if opt.Verbose && (nDone&127 == 0 || nDone == len(frags)) {
+					fmt.Fprintf(os.Stderr, "\rprocessed fragments: %d/%d", nDone, len(frags))
+				}
+				mu.Unlock()
+			}(frag)
+		}
+		wg.Wait()
+		if opt.Verbose {
+			fmt.Fprintln(os.Stderr)
+		}
+
+		// ---------------------------------------------------------------
+		// taxonomic assignment
+
+		// taxon -> assigned bases in the assembly
+		taxonBases := make(map[uint32]int, 64)
+		var nAssigned int
+		for _, frag := range frags {
+			frag.TaxId = screenFragmentTaxon(taxa, frag.Genomes)
+			if frag.TaxId > 0 {
+				taxonBases[frag.TaxId] += frag.End - frag.Start
+				nAssigned++
+			}
+		}
+
+		majority := expectedTaxon
+		if majority == 0 {
+			majority = screenTopTaxon(taxonBases)
+		}
+
+		if outputLog {
+			log.Infof("  %d of %d fragments are assigned to %d taxa at the rank of %s",
+				nAssigned, len(frags), len(taxonBases), rank)
+			if expectedTaxon > 0 {
+				log.Infof("  expected taxon: %s (taxid: %d)", expectedName, expectedTaxon)
+			} else if majority > 0 {
+				log.Infof("  majority taxon: %s (taxid: %d), %.2f%% of assigned bases",
+					tax.Name(majority), majority, float64(taxonBases[majority])/float64(sumScreenBases(taxonBases))*100)
+			} else {
+				log.Warningf("  no fragments are assigned, all contigs are unassigned")
+			}
+			if taxa.Missing > 0 {
+				log.Warningf("  %d genomes are not found in the genome2taxid file or the taxonomy data", taxa.Missing)
+			}
+		}
+
+		// ---------------------------------------------------------------
+		// verdicts
+
+		outfh, gw, w, err := outStream(outFile, strings.HasSuffix(outFile, ".gz"), opt.CompressionLevel)
+		checkError(err)
+		defer func() {
+			outfh.Flush()
+			if gw != nil {
+				gw.Close()
+			}
+			w.Close()
+		}()
+
+		fmt.Fprintln(outfh, "contig\tlength\tfragments\tassigned\tconcordant\tdiscordant\tdiscordant_frac\ttaxid\ttaxon\tverdict")
+
+		var nContaminated, nUnassigned, contaminatedBases int
+		var assignedBases, discordantBases, l int
+		var frac float64
+		var taxon uint32
+		var taxonName string
+		contigBases := make(map[uint32]int, 8)
+		for _, c := range contigs {
+			clear(contigBases)
+			assignedBases, discordantBases = 0, 0
+			for _, frag := range frags[c.FragStart:c.FragEnd] {
+				if frag.TaxId == 0 {
+					continue
+				}
+				l = frag.End - frag.Start
+
+				c.Assigned++
+				assignedBases += l
+				contigBases[frag.TaxId] += l
+				if frag.TaxId == majority {
+					c.Concordant++
+				} else {
+					c.Discordant++
+					discordantBases += l
+				}
+			}
+
+			frac = 0
+			if assignedBases > 0 {
+				frac = float64(discordantBases) / float64(assignedBases)
+			}
+
+			switch {
+			case c.Assigned == 0:
+				c.Verdict = ScreenUnassigned
+				nUnassigned++
+			case frac >= minDiscordantFrac:
+				c.Verdict = ScreenContaminated
+				nContaminated++
+				contaminatedBases += len(c.Seq)
+			default:
+				c.Verdict = ScreenClean
+			}
+
+			taxon = screenTopTaxon(contigBases)
+			if taxon > 0 {
+				taxonName = tax.Name(taxon)
+			} else {
+				taxonName = "-"
+			}
+
+			fmt.Fprintf(outfh, "%s\t%d\t%d\t%d\t%d\t%d\t%.4f\t%d\t%s\t%s\n",
+				c.ID, len(c.Seq), c.FragEnd-c.FragStart, c.Assigned, c.Concordant, c.Discordant,
+				frac, taxon, taxonName, c.Verdict)
+		}
+
+		if outputLog {
+			log.Infof("%d contigs (%d bp) are flagged as contaminated, %d contigs are unassigned",
+				nContaminated, contaminatedBases, nUnassigned)
+			log.Infof("verdicts of %d contigs saved to: %s", len(contigs), outFile)
+		}
+
+		if fileClean != "" {
+			cfh, cgw, cw, err := outStream(fileClean, strings.HasSuffix(fileClean, ".gz"), opt.CompressionLevel)
+			checkError(err)
+
+			var n int
+			var text []byte
+			var buffer *bytes.Buffer
+			for _, c := range contigs {
+				if c.Verdict == ScreenContaminated || (dropUnassigned && c.Verdict == ScreenUnassigned) {
+					continue
+				}
+				fmt.Fprintf(cfh, ">%s\n", c.Name)
+				text, buffer = wrapByteSlice(c.Seq, lineWidth, buffer)
+				cfh.Write(text)
+				cfh.WriteString("\n")
+				n++
+			}
+
+			cfh.Flush()
+			if cgw != nil {
+				cgw.Close()
+			}
+			cw.Close()
+
+			if outputLog {
+				log.Infof("%d clean contigs saved to: %s", n, fileClean)
+			}
+		}
+	},
+}
+
+func init() {
+	utilsCmd.AddCommand(screenContaminationCmd)
+
+	screenContaminationCmd.Flags().StringP("index", "d", "",
+		formatFlagUsage(`Index directory created by "lexicmap index".`))
+
+	screenContaminationCmd.Flags().StringP("out-file", "o", "-",
+		formatFlagUsage(`Out file of per-contig verdicts, supports the ".gz" suffix ("-" for stdout).`))
+
+	screenContaminationCmd.Flags().StringP("clean-fasta", "c", "",
+		formatFlagUsage(`Out file of contigs not flagged as contaminated in FASTA format, supports the ".gz" suffix.`))
+
+	screenContaminationCmd.Flags().BoolP("drop-unassigned", "", false,
+		formatFlagUsage(`Do not write unassigned contigs to the file of -c/--clean-fasta.`))
+
+	screenContaminationCmd.Flags().IntP("line-width", "", 60,
+		formatFlagUsage(`Line width of sequences in the file of -c/--clean-fasta (0 for no wrap).`))
+
+	screenContaminationCmd.Flags().StringP("taxdump", "T", "",
+		formatFlagUsage(`Directory containing taxdump files (nodes.dmp, names.dmp, etc.). For other non-NCBI taxonomy data, please use 'taxonkit create-taxdump' to create taxdump files.`))
+
+	screenContaminationCmd.Flags().StringP("genome2taxid", "G", "",
+		formatFlagUsage(`Two-column tabular file for mapping genome ID to TaxId.`))
+
+	screenContaminationCmd.Flags().StringP("rank", "r", "genus",
+		formatFlagUsage(`Taxonomic rank to assign fragments at.`))
+
+	screenContaminationCmd.Flags().IntP("taxid", "t", 0,
+		formatFlagUsage(`TaxId of the expected taxon of the assembly. By default, the majority taxon is used.`))
+
+	screenContaminationCmd.Flags().IntP("frag-size", "s", 1000,
+		formatFlagUsage(`Size of fragments of contigs.`))
+
+	screenContaminationCmd.Flags().IntP("min-frag-len", "m", 200,
+		formatFlagUsage(`Minimum length of a fragment.`))
+
+	screenContaminationCmd.Flags().Float64P("min-discordant-frac", "f", 0.5,
+		formatFlagUsage(`Minimum fraction of discordant bases in assigned bases of a contig to flag it as contaminated.`))
+
+	screenContaminationCmd.Flags().Float64P("align-min-match-pident", "i", 80,
+		formatFlagUsage(`Minimum base identity (percentage) in a HSP segment.`))
+
+	screenContaminationCmd.Flags().Float64P("min-qcov", "q", 50,
+		formatFlagUsage(`Minimum query coverage (percentage) of a HSP for assigning a fragment.`))
+
+	screenContaminationCmd.Flags().IntP("max-open-files", "", 1024,
+		formatFlagUsage(`Maximum opened files. It mainly affects candidate subsequence extraction. Increase this value if you have hundreds of genome batches, and do not forgot to set a bigger "ulimit -n" in shell if the value is > 1024.`))
+
+	screenContaminationCmd.Flags().IntP("max-query-conc", "J", 8,
+		formatFlagUsage(`Maximum number of concurrent fragments to search.`))
+
+	screenContaminationCmd.Flags().BoolP("load-whole-seeds", "w", false,
+		formatFlagUsage(`Load the whole seed data into memory for faster seed matching. It will consume a lot of RAM.`))
+
+	screenContaminationCmd.SetUsageTemplate(usageTemplate("-d <index path> -T <taxdump dir> -G <genome2taxid> [contigs.fasta[.gz] ...] [-o verdicts.tsv] [-c clean.fasta]"))
+}
+
+// Verdicts of screened contigs.
+const (
+	ScreenClean        = "clean"
+	ScreenContaminated = "contaminated"
+	ScreenUnassigned   = "unassigned"
+)
+
+// ScreenedContig is a contig of an assembly to screen.
+type ScreenedContig struct {
+	ID   string
+	Name string // the full head line
+	Seq  []byte // the original sequence
+
+	FragStart, FragEnd int // indexes of fragments in the fragment list
+
+	Assigned   int
+	Concordant int
+	Discordant int
+	Verdict    string
+}
+
+// ContigFragment is a fragment of a contig, and the genomes with the best hit.
+type ContigFragment struct {
+	Contig     int // index of the contig
+	Start, End int // 0-based, end exclusive
+
+	BitScore int
+	Genomes  []string // genomes with the highest bit score
+
+	TaxId uint32 // TaxId of the assigned taxon, 0 for unassigned
+}
+
+// readScreenedContigs reads contigs from a file, and splits them into fragments.
+func readScreenedContigs(file string, contigs []*ScreenedContig, frags []*ContigFragment,
+	fragSize, minFragLen int) ([]*ScreenedContig, []*ContigFragment, error) {
+
+	fastxReader, err := fastx.NewReader(nil, file, "")
+	if err != nil {
+		return contigs, frags, err
+	}
+	defer fastxReader.Close()
+
+	var record *fastx.Record
+	for {
+		record, err = fastxReader.Read()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return contigs, frags, fmt.Errorf("%s: %s", file, err)
+		}
+
+		c := &ScreenedContig{
+			ID:   string(record.ID),
+			Name: string(record.Name),
+			Seq:  []byte(string(record.Seq.Seq)),
+		}
+
+		c.FragStart = len(frags)
+		for _, r := range splitContig(len(c.Seq), fragSize, minFragLen) {
+			frags = append(frags, &ContigFragment{Contig: len(contigs), Start: r[0], End: r[1]})
+		}
+		c.FragEnd = len(frags)
+
+		contigs = append(contigs, c)
+	}
+
+	return contigs, frags, nil
+}
+
+// splitContig splits a sequence of the given length into non-overlapping fragments.
+// The last fragment shorter than minFragLen is merged into the previous one.
+func splitContig(l, fragSize, minFragLen int) [][2]int {
+	if l < minFragLen {
+		return nil
+	}
+
+	regions := make([][2]int, 0, l/fragSize+1)
+	var end int
+	for start := 0; start < l; start = end {
+		end = min(start+fragSize, l)
+		if len(regions) > 0 && end-start < minFragLen {
+			regions[len(regions)-1][1] = end
+			break
+		}
+		regions = append(regions, [2]int{start, end})
+	}
+	return regions
+}
+
+// screenFragmentTaxon returns the taxon of the best genomes of a fragment at the rank.
+// 0 is returned if the genomes are unclassified or belong to different taxa.
+func screenFragmentTaxon(taxa *GenomeTaxa, genomes []string) uint32 {
+	var taxon, t uint32
+	for _, name := range genomes {
+		_, t, _ = taxa.Taxon(name)
+		if t == 0 || (taxon > 0 && t != taxon) {
+			return 0
+		}
+		taxon = t
+	}
+	return taxon
+}
+
+// screenTopTaxon returns the taxon with the most bases, ties are broken by the smaller TaxId.
+func screenTopTaxon(taxonBases map[uint32]int) uint32 {
+	var top uint32
+	var topBases int
+	for t, n := range taxonBases {
+		if n > topBases || (n == topBases && t < top) {
+			top, topBases = t, n
+		}
+	}
+	return top
+}
+
+func sumScreenBases(taxonBases map[uint32]int) (n int) {
+	for _, b := range taxonBases {
+		n += b
+	}
+	return n
+}
@@ -207,7 +207,15 @@ Output format:
 		topNChains := getFlagNonNegativeInt(cmd, "top-n-chains")
 		// topNChains := 5 // not used in this command
 
+		seedIDF := getFlagBool(cmd, "seed-idf")
+		seedMaxGenomeFreq := getFlagFloat64(cmd, "seed-max-genome-freq")
+		if seedMaxGenomeFreq <= 0 || seedMaxGenomeFreq > 1 {
+			checkError(fmt.Errorf("the value of flag --seed-max-genome-freq should be in range of (0, 1]"))
+		}
+		seedMaxHits := getFlagNonNegativeInt(cmd, "seed-max-hits")
+
 		inMemorySearch := getFlagBool(cmd, "load-whole-seeds")
+		useMmap := getFlagBool(cmd, "mmap")
 		minAlignLen := getFlagPositiveInt(cmd, "align-min-match-len")
 		if minAlignLen < 20 {
 			checkError(fmt.Errorf("the value of flag -l/--align-min-match-len (%d) should be >= 20", minAlignLen))
@@ -350,6 +358,11 @@ Output format:
 			TopN:            topn,
 			TopNChains:      topNChains,
 			InMemorySearch:  inMemorySearch,
+			UseMmap:         useMmap,
+
+			SeedIDF:           seedIDF,
+			SeedMaxGenomeFreq: seedMaxGenomeFreq,
+			SeedMaxHits:       seedMaxHits,
 
 			MaxGap:      float64(maxGap),
 			MaxDistance: float64(maxDist),
@@ -739,6 +752,15 @@ func init() {
 	gsearchCmd.Flags().IntP("top-n-genomes", "n", 10,
 		formatFlagUsage(`Keep the top N genome matches for a query (0 for all) in the genome filtering phase.`))
 
+	gsearchCmd.Flags().BoolP("seed-idf", "", false,
+		formatFlagUsage(`Weight scores of matched seeds by their inverse genome frequency (IDF-style) in ranking genomes for -n/--top-n-genomes, so genomes sharing only ubiquitous seeds (e.g., rRNA genes and IS elements) are ranked lower. The genome frequency of a seed is the number of distinct genomes in its values in the seed data, where chunks of a split genome are counted as one genome.`))
+
+	gsearchCmd.Flags().Float64P("seed-max-genome-freq", "", 1,
+		formatFlagUsage(`Skip matched seeds found in more than this fraction of genomes in the index (chunks of a split genome are counted as one genome), which reduces the time of chaining for queries with ubiquitous seeds. Attention: queries only sharing such seeds with genomes would have no results. Range: (0, 1], 1 for no limit.`))
+
+	gsearchCmd.Flags().IntP("seed-max-hits", "", 0,
+		formatFlagUsage(`Only keep N hits (genome positions) evenly sampled from all hits of each matched seed (0 for no limit). It may reduce the search sensitivity.`))
+
 	gsearchCmd.Flags().IntP("max-subject-genome-size", "", 20,
 		formatFlagUsage(`Maximum size of subject genomes to be considered (in MB).`))
 
@@ -758,6 +780,9 @@ func init() {
 	gsearchCmd.Flags().BoolP("load-whole-seeds", "w", false,
 		formatFlagUsage(`Load the whole seed data into memory for faster seed matching. It will consume a lot of RAM.`))
 
+	gsearchCmd.Flags().BoolP("mmap", "", false,
+		formatFlagUsage(`Memory-map seed and genome data files. All searching threads share the mappings without their own file handlers, so the value of --max-open-files does not matter. It's recommended for indexes with hundreds of genome batches on local disks.`))
+
 	// pseudo alignment
 	// gsearchCmd.Flags().IntP("align-ext-len", "", 1000,
 	// 	formatFlagUsage(`Extend length of upstream and downstream of seed regions, for extracting query and target sequences for alignment. It should be <= contig interval length in database.`))
@@ -23,10 +23,13 @@ package cmd
 import (
 	"bufio"
 	"fmt"
+	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
 
+	"github.com/shenwei356/bio/taxdump"
 	"github.com/shenwei356/xopen"
 )
 
@@ -38,6 +41,10 @@ type Query struct {
 	seqID  []byte
 	seq    []byte
 	result *[]*SearchResult
+
+	maskRegions [][2]int // 0-based closed intervals of masked regions, which are not seeded
+
+	stats *QueryStats // optional diagnostics, nil for not recording
 }
 
 // Reset reset the data for next round of using
@@ -45,6 +52,10 @@ func (q *Query) Reset() {
 	q.seqID = q.seqID[:0]
 	q.seq = q.seq[:0]
 	q.result = nil
+	q.maskRegions = q.maskRegions[:0]
+	if q.stats != nil {
+		q.stats.Reset()
+	}
 }
 
 var poolQuery = &sync.Pool{New: func() interface{} {
@@ -144,3 +155,27 @@ func parseTaxids(taxdumpDir string, genome2taxidFile string, taxidsStr []string,
 
 	return taxids, negativeTaxids
 }
+
+// loadTaxonomyWithRankAndNames loads taxonomy data with ranks and scientific names
+// from NCBI-format taxdump files. merged.dmp is optional.
+func loadTaxonomyWithRankAndNames(taxdumpDir string) (*taxdump.Taxonomy, error) {
+	t, err := taxdump.NewTaxonomyWithRankFromNCBI(filepath.Join(taxdumpDir, "nodes.dmp"))
+	if err != nil {
+		return nil, err
+	}
+
+	err = t.LoadNamesFromNCBI(filepath.Join(taxdumpDir, "names.dmp"))
+	if err != nil {
+		return nil, err
+	}
+
+	fileMerged := filepath.Join(taxdumpDir, "merged.dmp")
+	if _, err = os.Stat(fileMerged); err == nil {
+		err = t.LoadMergedNodesFromNCBI(fileMerged)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return t, nil
+}
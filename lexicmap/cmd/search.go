@@ -21,6 +21,7 @@
 package cmd
 
 import (
+	"bufio"
 	"fmt"
 	"io"
 	"os"
@@ -30,6 +31,9 @@ import (
 	"sync"
 	"time"
 
+	"github.com/dustin/go-humanize"
+	"github.com/shenwei356/LexicMap/lexicmap/cmd/annotation"
+	"github.com/shenwei356/LexicMap/lexicmap/cmd/util"
 	"github.com/shenwei356/bio/seq"
 	"github.com/shenwei356/bio/seqio/fastx"
 	"github.com/spf13/cobra"
@@ -65,6 +69,9 @@ Tips:
      any taxonomy data with TaxonKit https://bioinf.shenwei.me/taxonkit/usage/#create-taxdump )
      and a genome-ID-to-TaxId mapping file (-G/--genome2taxid).
      There's no need to rebuild the index.
+  4. Indexes on a HTTP server or S3-compatible object storage can be searched directly,
+     by giving a URL to -d/--index, e.g., https://host/db.lmi. Data are read with HTTP range
+     requests, and they can be cached in a local directory (--remote-cache-dir) for later runs.
 
 Alignment result relationship:
 
@@ -108,12 +115,69 @@ Output format:
     23. sseq,     Aligned part of subject sequence.                   (optional with -a/--all)
     24. align,    Alignment text ("|" and " ") between qseq and sseq. (optional with -a/--all)
 
+  Optional columns with --annotations, appended to the end, for indexes built with --save-annotations.
+  They are not supported by other commands parsing search results, e.g., "lexicmap utils 2blast".
+    feat_id,        IDs of features overlapping with the HSP, or the nearest one if there's no overlap.
+                    Multiple values are separated by ";".
+    feat_locus_tag, Locus tags of the features.
+    feat_product,   Products of the features.
+    feat_dist,      Distance to the nearest feature, 0 for overlapping features, -1 for no features.
+
 Result ordering:
   For a HSP cluster, SimilarityScore = max(bitscore*pident)
   1. Within each HSP cluster, HSPs are sorted by sstart.
   2. Within each subject genome, HSP clusters are sorted in descending order by SimilarityScore.
   3. Results of multiple subject genomes are sorted by the highest SimilarityScore of HSP clusters.
 
+Mapping mode (--mapping):
+  It's designed for long reads, where one placement of a read is needed, rather than all HSPs.
+  1. All HSPs across all genomes are sorted by the chain score, and the best one is the primary alignment.
+     For ties, HSPs in the genome of the primary alignment are preferred.
+  2. An HSP overlapping (in the query) with none of the primary and supplementary alignments by more than
+     --mapping-max-overlap becomes a supplementary alignment, e.g., another part of a chimeric read.
+  3. Other HSPs are alternative placements of the primary/supplementary alignment they overlap most.
+     The ones with scores >= --mapping-secondary-ratio are reported as secondary alignments,
+     at most --mapping-max-secondary for each.
+  4. MAPQ = 60 * (1 - score2/score1), where score1 is the score of a primary/supplementary alignment,
+     and score2 is the best score of its alternative placements. MAPQ of secondary alignments is 0.
+     Attention: queries matching multiple highly similar genomes, e.g., strains of the same species,
+     would have low MAPQ values, as they have equally good placements.
+  Alignments of a query are ordered as: the primary one, supplementary ones (sorted by qstart),
+  and secondary ones. So they are not grouped by genomes, and the column "hits" is the number of
+  genomes of reported alignments. Two more columns are appended to the end:
+    type, Alignment type: primary, supplementary, or secondary.
+    mapq, Mapping quality.
+  Optional breakpoints between adjacent primary/supplementary alignments (--mapping-breakpoints),
+  with 14 columns:
+    query, qlen, qend_left, qstart_right, qgap (negative values for overlaps),
+    sgenome_left, sseqid_left, spos_left, sstr_left, sgenome_right, sseqid_right, spos_right, sstr_right,
+    class (intra-sequence, inter-sequence, or inter-genome).
+
+Query diagnostics (--query-stats):
+  One row for each query, including queries without hits, for finding out why a query has no or few
+  hits and which stage costs the most time. Columns:
+    query,            Query sequence ID.
+    qlen,             Query sequence length.
+    masked_kmers,     Number of captured k-mers, excluding low-complexity ones.
+    seeds,            Matched seed pairs of each prefix length, e.g., 15:3,31:120.
+    genomes_seeded,   Number of genomes (or genome chunks) with matched seeds.
+    genomes_chained,  Number of genomes passing the chaining score, before keeping the top N genomes.
+    genomes_topn,     Number of genomes for alignment, after keeping the top N genomes.
+    chains,           Number of seed chains in genomes for alignment.
+    aligns,           Number of base-level alignments performed.
+    aligns_kept,      Number of alignments passing all the filters.
+    filt_evalue,      Number of alignments filtered by -e/--max-evalue.
+    filt_qcov_hsp,    Number of alignments filtered by -q/--min-qcov-per-hsp.
+    filt_pident,      Number of alignments filtered by -i/--align-min-match-pident.
+    filt_qcov_gnm,    Number of genomes filtered by -Q/--min-qcov-per-genome.
+    hits,             Number of genome hits, the same as the column "hits" of search results,
+                      i.e., genomes with reported alignments in the mapping mode (--mapping).
+    time_seeding,     Wall time (seconds) of masking and seed matching.
+                      For --query-block-size, it's the time of the whole block.
+    time_chaining,    Wall time (seconds) of chaining.
+    time_extension,   Time (seconds) of pseudo-alignment and extension, summed over genomes.
+    time_wfa,         Time (seconds) of base-level alignment with WFA, summed over genomes.
+
 `,
 	Run: func(cmd *cobra.Command, args []string) {
 		opt := getOptions(cmd)
@@ -166,6 +230,25 @@ Result ordering:
 		}
 		moreColumns := getFlagBool(cmd, "all")
 		showSseqIdx := getFlagBool(cmd, "show-sseq-idx")
+		showAnnotations := getFlagBool(cmd, "annotations")
+
+		mapping := getFlagBool(cmd, "mapping")
+		mopt := &MappingOptions{
+			MaxSecondary:      getFlagNonNegativeInt(cmd, "mapping-max-secondary"),
+			MinSecondaryRatio: getFlagNonNegativeFloat64(cmd, "mapping-secondary-ratio"),
+			MaxOverlap:        getFlagNonNegativeFloat64(cmd, "mapping-max-overlap"),
+		}
+		if mopt.MinSecondaryRatio > 1 {
+			checkError(fmt.Errorf("the value of flag --mapping-secondary-ratio should be in range of [0, 1]"))
+		}
+		if mopt.MaxOverlap > 1 {
+			checkError(fmt.Errorf("the value of flag --mapping-max-overlap should be in range of [0, 1]"))
+		}
+		fileBreakpoints := getFlagString(cmd, "mapping-breakpoints")
+		if fileBreakpoints != "" && !mapping {
+			checkError(fmt.Errorf("the flag --mapping-breakpoints needs --mapping"))
+		}
+		fileQueryStats := getFlagString(cmd, "query-stats")
 
 		// maxMismatch := getFlagInt(cmd, "seed-max-mismatch")
 		minSinglePrefix := getFlagPositiveInt(cmd, "seed-min-single-prefix")
@@ -184,6 +267,21 @@ Result ordering:
 		// 	checkError(fmt.Errorf("the value of flag -m/--seed-min-matches (%d) should be >= that of -P/--seed-min-single-prefix (%d)", minMatches, minSinglePrefix))
 		// }
 
+		queryDust := getFlagBool(cmd, "query-dust")
+		queryDustWindow := getFlagPositiveInt(cmd, "query-dust-window")
+		if queryDustWindow < 8 {
+			checkError(fmt.Errorf("the value of flag --query-dust-window should be >= 8"))
+		}
+		queryDustLevel := getFlagPositiveInt(cmd, "query-dust-level")
+		querySoftMasking := getFlagBool(cmd, "query-soft-masking")
+
+		seedIDF := getFlagBool(cmd, "seed-idf")
+		seedMaxGenomeFreq := getFlagFloat64(cmd, "seed-max-genome-freq")
+		if seedMaxGenomeFreq <= 0 || seedMaxGenomeFreq > 1 {
+			checkError(fmt.Errorf("the value of flag --seed-max-genome-freq should be in range of (0, 1]"))
+		}
+		seedMaxHits := getFlagNonNegativeInt(cmd, "seed-max-hits")
+
 		maxGap := getFlagPositiveInt(cmd, "seed-max-gap")
 		maxDist := getFlagPositiveInt(cmd, "seed-max-dist")
 		extLen := getFlagNonNegativeInt(cmd, "align-ext-len")
@@ -193,6 +291,29 @@ Result ordering:
 		topn := getFlagNonNegativeInt(cmd, "top-n-genomes")
 		topNChains := getFlagNonNegativeInt(cmd, "top-n-chains")
 		inMemorySearch := getFlagBool(cmd, "load-whole-seeds")
+		useMmap := getFlagBool(cmd, "mmap")
+		seedCacheSize, err := ParseByteSize(getFlagString(cmd, "seed-cache-size"))
+		if err != nil {
+			checkError(fmt.Errorf("invalid value of flag --seed-cache-size: %s", getFlagString(cmd, "seed-cache-size")))
+		}
+		if inMemorySearch && seedCacheSize > 0 {
+			log.Warningf("the flag --seed-cache-size is ignored when -w/--load-whole-seeds is given")
+			seedCacheSize = 0
+		}
+
+		// remote indexes
+		remoteCacheDir := getFlagString(cmd, "remote-cache-dir")
+		remoteBlockSize, err := ParseByteSize(getFlagString(cmd, "remote-block-size"))
+		if err != nil || remoteBlockSize <= 0 {
+			checkError(fmt.Errorf("invalid value of flag --remote-block-size: %s", getFlagString(cmd, "remote-block-size")))
+		}
+		if remoteCacheDir != "" {
+			storage, err := util.NewCachedStorage(util.NewHTTPStorage(nil, 0), remoteCacheDir, remoteBlockSize)
+			checkError(err)
+			util.SetRemoteStorage(storage, filepath.Join(remoteCacheDir, "files"))
+		} else {
+			util.SetRemoteStorage(util.NewHTTPStorage(nil, remoteBlockSize), "")
+		}
 
 		minAlignLen := getFlagPositiveInt(cmd, "align-min-match-len")
 		if minAlignLen < minSinglePrefix {
@@ -277,6 +398,10 @@ Result ordering:
 		if maxQueryConcurrency == 0 {
 			maxQueryConcurrency = opt.NumCPUs
 		}
+		queryBlockSize := getFlagNonNegativeInt(cmd, "query-block-size")
+		if queryBlockSize > 0 && getFlagBool(cmd, "debug") {
+			checkError(fmt.Errorf("the flag --debug is not supported with --query-block-size"))
+		}
 		// maxSeedSearchingConcurrency := getFlagPositiveInt(cmd, "max-seed-matching-conc")
 		maxSeedSearchingConcurrency := maxQueryConcurrency / 2
 		if maxSeedSearchingConcurrency < 2 {
@@ -317,6 +442,17 @@ Result ordering:
 			TopN:           topn,
 			TopNChains:     topNChains,
 			InMemorySearch: inMemorySearch,
+			UseMmap:        useMmap,
+			SeedCacheSize:  seedCacheSize,
+
+			QueryDust:        queryDust,
+			QueryDustWindow:  queryDustWindow,
+			QueryDustLevel:   queryDustLevel,
+			QuerySoftMasking: querySoftMasking,
+
+			SeedIDF:           seedIDF,
+			SeedMaxGenomeFreq: seedMaxGenomeFreq,
+			SeedMaxHits:       seedMaxHits,
 
 			MaxGap:      float64(maxGap),
 			MaxDistance: float64(maxDist),
@@ -394,6 +530,22 @@ Result ordering:
 			if sopt.TopNChains > 0 {
 				log.Infof("  keep the top %d chains", sopt.TopNChains)
 			}
+			if sopt.QueryDust {
+				log.Infof("  masking low-complexity regions in queries with DUST (window: %d, level: %d)",
+					sopt.QueryDustWindow, sopt.QueryDustLevel)
+			}
+			if sopt.QuerySoftMasking {
+				log.Infof("  treating lowercase bases in queries as soft-masked")
+			}
+			if sopt.SeedIDF {
+				log.Infof("  weighting seed scores by the inverse genome frequency in ranking genomes")
+			}
+			if sopt.SeedMaxGenomeFreq < 1 {
+				log.Infof("  skipping seeds found in more than %.2f%% genomes", sopt.SeedMaxGenomeFreq*100)
+			}
+			if sopt.SeedMaxHits > 0 {
+				log.Infof("  keeping %d evenly sampled hits of each seed", sopt.SeedMaxHits)
+			}
 
 			if gc {
 				log.Infof("  maximum number of concurrent queries: %d, force garbage collection for every %d queries", maxQueryConcurrency, gcInterval)
@@ -401,6 +553,22 @@ Result ordering:
 			if len(taxids)+len(negativeTaxids) > 0 {
 				log.Infof("  filtering genomes by %d TaxIds and %d negative TaxIds", len(taxids), len(negativeTaxids))
 			}
+			if queryBlockSize > 0 {
+				log.Infof("  searching queries in blocks of %d", queryBlockSize)
+			}
+			if mapping {
+				log.Infof("  mapping mode: at most %d secondary alignments with score ratio >= %.2f, max query overlap of supplementary alignments: %.2f",
+					mopt.MaxSecondary, mopt.MinSecondaryRatio, mopt.MaxOverlap)
+			}
+		}
+
+		var annSearcher *AnnotationSearcher
+		if showAnnotations {
+			annSearcher, err = NewAnnotationSearcher(idx)
+			checkError(err)
+			defer func() {
+				checkError(annSearcher.Close())
+			}()
 		}
 
 		// ---------------------------------------------------------------
@@ -427,16 +595,109 @@ Result ordering:
 		if moreColumns {
 			fmt.Fprintf(outfh, "\tcigar\tqseq\tsseq\talign")
 		}
+		if showAnnotations {
+			fmt.Fprintf(outfh, "\tfeat_id\tfeat_locus_tag\tfeat_product\tfeat_dist")
+		}
+		if mapping {
+			fmt.Fprintf(outfh, "\ttype\tmapq")
+		}
 		fmt.Fprintln(outfh)
 
+		var bpfh *bufio.Writer
+		if fileBreakpoints != "" {
+			var bpgw io.WriteCloser
+			var bpw *os.File
+			bpfh, bpgw, bpw, err = outStream(fileBreakpoints, strings.HasSuffix(fileBreakpoints, ".gz"), opt.CompressionLevel)
+			checkError(err)
+			defer func() {
+				bpfh.Flush()
+				if bpgw != nil {
+					bpgw.Close()
+				}
+				bpw.Close()
+			}()
+
+			fmt.Fprintf(bpfh, "query\tqlen\tqend_left\tqstart_right\tqgap\tsgenome_left\tsseqid_left\tspos_left\tsstr_left\tsgenome_right\tsseqid_right\tspos_right\tsstr_right\tclass\n")
+		}
+
+		var qsfh *bufio.Writer
+		if fileQueryStats != "" {
+			var qsgw io.WriteCloser
+			var qsw *os.File
+			qsfh, qsgw, qsw, err = outStream(fileQueryStats, strings.HasSuffix(fileQueryStats, ".gz"), opt.CompressionLevel)
+			checkError(err)
+			defer func() {
+				qsfh.Flush()
+				if qsgw != nil {
+					qsgw.Close()
+				}
+				qsw.Close()
+			}()
+
+			fmt.Fprintln(qsfh, QueryStatsHeader)
+		}
+
 		gcIntervalMinus1 := gcInterval - 1
 		id2name := idx.BatchGenomeIndex2GenomeID
 
+		// write an HSP without the line break
+		var features []*annotation.Feature
+		var dist int
+		writeHSP := func(queryID []byte, qlen int, targets int, r *SearchResult, sd *SimilarityDetail, c *Chain2Result, _c, j int) {
+			var strand byte
+			if sd.RC {
+				strand = '-'
+			} else {
+				strand = '+'
+			}
+
+			if showSseqIdx {
+				fmt.Fprintf(outfh, "%s\t%d\t%d\t%s\tc%d/%d:s%d/%d:%s\t%.3f\t%d\t%d\t%.3f\t%d\t%.3f\t%d\t%d\t%d\t%d\t%d\t%c\t%d\t%.2e\t%d",
+					queryID, qlen,
+					targets, id2name[r.BatchGenomeIndex], sd.ChunkIdx+1, sd.NChunks, sd.SeqIdx+1, sd.NSeqs, sd.SeqID, r.AlignedFraction,
+					_c,
+					j, c.AlignedFraction, c.AlignedLength, c.PIdent, c.Gaps,
+					c.QBegin+1, c.QEnd+1,
+					c.TBegin+1, c.TEnd+1,
+					strand, sd.SeqLen,
+					c.Evalue, c.BitScore,
+				)
+			} else {
+				fmt.Fprintf(outfh, "%s\t%d\t%d\t%s\t%s\t%.3f\t%d\t%d\t%.3f\t%d\t%.3f\t%d\t%d\t%d\t%d\t%d\t%c\t%d\t%.2e\t%d",
+					queryID, qlen,
+					targets, id2name[r.BatchGenomeIndex], sd.SeqID, r.AlignedFraction,
+					_c,
+					j, c.AlignedFraction, c.AlignedLength, c.PIdent, c.Gaps,
+					c.QBegin+1, c.QEnd+1,
+					c.TBegin+1, c.TEnd+1,
+					strand, sd.SeqLen,
+					c.Evalue, c.BitScore,
+				)
+			}
+			if moreColumns {
+				fmt.Fprintf(outfh, "\t%s\t%s\t%s\t%s", c.CIGAR, c.QSeq, c.TSeq, c.Alignment)
+			}
+			if showAnnotations {
+				features, dist, err = annSearcher.Features(r.GenomeBatch, r.GenomeIndex, int(sd.SeqIdx),
+					c.TBegin+1, c.TEnd+1, features[:0])
+				checkError(err)
+				writeFeatureColumns(outfh, features, dist)
+			}
+		}
+
+		// for the mapping mode
+		var alns []*MappedAlignment
+		var bps []MappingBreakpoint
+		mGenomes := make(map[uint64]struct{}, 8)
+
 		// -------  output function -------
 
 		printResult := func(q *Query) {
 			total++
 			if q.result == nil { // seqs shorter than K or queries without matches.
+				if qsfh != nil {
+					q.stats.Write(qsfh, q.seqID, len(q.seq), 0)
+				}
 				poolQuery.Put(q)
 
 				if gc && total&gcIntervalMinus1 == 0 {
@@ -463,66 +724,65 @@ Result ordering:
 			var targets = len(*q.result)
 			matched++
 
-			var strand byte
-			var _c, j int
-			for _, r := range *q.result { // each genome
-				_c = 1
-				j = 1
-				for _, sd = range *r.SimilarityDetails { // each chain
-					cr = sd.Similarity
-
-					// if sd.RC {
-					// 	strand = '-'
-					// } else {
-					// 	strand = '+'
-					// }
-
-					for _, c = range *cr.Chains { // each match
-						if c == nil {
-							continue
-						}
+			if mapping {
+				alns = SelectMappings(*q.result, mopt, alns[:0])
 
-						if sd.RC {
-							strand = '-'
-						} else {
-							strand = '+'
-						}
+				// the number of genomes of reported alignments
+				clear(mGenomes)
+				for _, a := range alns {
+					mGenomes[a.Result.BatchGenomeIndex] = struct{}{}
+				}
+				targets = len(mGenomes)
+			}
 
-						if showSseqIdx {
-							fmt.Fprintf(outfh, "%s\t%d\t%d\t%s\tc%d/%d:s%d/%d:%s\t%.3f\t%d\t%d\t%.3f\t%d\t%.3f\t%d\t%d\t%d\t%d\t%d\t%c\t%d\t%.2e\t%d",
-								queryID, len(q.seq),
-								targets, id2name[r.BatchGenomeIndex], sd.ChunkIdx+1, sd.NChunks, sd.SeqIdx+1, sd.NSeqs, sd.SeqID, r.AlignedFraction,
-								_c,
-								j, c.AlignedFraction, c.AlignedLength, c.PIdent, c.Gaps,
-								c.QBegin+1, c.QEnd+1,
-								c.TBegin+1, c.TEnd+1,
-								strand, sd.SeqLen,
-								c.Evalue, c.BitScore,
-							)
-						} else {
-							fmt.Fprintf(outfh, "%s\t%d\t%d\t%s\t%s\t%.3f\t%d\t%d\t%.3f\t%d\t%.3f\t%d\t%d\t%d\t%d\t%d\t%c\t%d\t%.2e\t%d",
-								queryID, len(q.seq),
-								targets, id2name[r.BatchGenomeIndex], sd.SeqID, r.AlignedFraction,
-								_c,
-								j, c.AlignedFraction, c.AlignedLength, c.PIdent, c.Gaps,
-								c.QBegin+1, c.QEnd+1,
-								c.TBegin+1, c.TEnd+1,
-								strand, sd.SeqLen,
-								c.Evalue, c.BitScore,
-							)
-						}
-						if moreColumns {
-							fmt.Fprintf(outfh, "\t%s\t%s\t%s\t%s", c.CIGAR, c.QSeq, c.TSeq, c.Alignment)
-						}
+			// the same number of hits as the search result
+			if qsfh != nil {
+				q.stats.Write(qsfh, q.seqID, len(q.seq), targets)
+			}
 
-						fmt.Fprintln(outfh)
+			if mapping {
+				for _, a := range alns {
+					writeHSP(queryID, len(q.seq), targets, a.Result, a.Detail, a.Chain, a.Cls, a.HSP)
+					fmt.Fprintf(outfh, "\t%s\t%d\n", MappingTypeNames[a.Type], a.MAPQ)
+				}
 
-						j++
+				if bpfh != nil {
+					bps = MappingBreakpoints(alns, bps[:0])
+					for _, bp := range bps {
+						fmt.Fprintf(bpfh, "%s\t%d\t%d\t%d\t%d\t%s\t%s\t%d\t%c\t%s\t%s\t%d\t%c\t%s\n",
+							queryID, len(q.seq), bp.Left.Chain.QEnd+1, bp.Right.Chain.QBegin+1, bp.QGap(),
+							id2name[bp.Left.Result.BatchGenomeIndex], bp.Left.Detail.SeqID, bp.LeftPos()+1, bp.Left.Strand(),
+							id2name[bp.Right.Result.BatchGenomeIndex], bp.Right.Detail.SeqID, bp.RightPos()+1, bp.Right.Strand(),
+							bp.Class(),
+						)
+					}
+				}
+			} else {
+				var _c, j int
+				for _, r := range *q.result { // each genome
+					_c = 1
+					j = 1
+					for _, sd = range *r.SimilarityDetails { // each chain
+						cr = sd.Similarity
+
+						for _, c = range *cr.Chains { // each match
+							if c == nil {
+								continue
+							}
+
+							writeHSP(queryID, len(q.seq), targets, r, sd, c, _c, j)
+							fmt.Fprintln(outfh)
+
+							j++
+						}
+						_c++
 					}
-					_c++
 				}
 			}
 			idx.RecycleSearchResults(q.result)
+			if showAnnotations {
+				annSearcher.Reset()
+			}
 
 			poolQuery.Put(q)
 			outfh.Flush()
@@ -551,6 +811,19 @@ Result ordering:
 		var record *fastx.Record
 		K := idx.k
 
+		// for searching queries in blocks
+		var block []*Query
+		if queryBlockSize > 0 {
+			block = make([]*Query, 0, queryBlockSize)
+		}
+		searchBlock := func() {
+			checkError(idx.SearchBatch(block, maxQueryConcurrency))
+			for _, query := range block {
+				ch <- query
+			}
+			block = block[:0]
+		}
+
 		for _, file := range files {
 			fastxReader, err := fastx.NewReader(nil, file, "")
 			checkError(err)
@@ -567,6 +840,12 @@ Result ordering:
 
 				query := poolQuery.Get().(*Query)
 				query.Reset()
+				if qsfh != nil && query.stats == nil {
+					query.stats = &QueryStats{}
+				}
+
+				query.seqID = append(query.seqID, record.ID...)
+				query.seq = append(query.seq, record.Seq.Seq...)
 
 				if len(record.Seq.Seq) < K {
 					query.result = nil
@@ -574,11 +853,9 @@ Result ordering:
 					continue
 				}
 
-				tokens <- 1
-				wg.Add(1)
-
-				query.seqID = append(query.seqID, record.ID...)
-				query.seq = append(query.seq, record.Seq.Seq...)
+				if querySoftMasking {
+					query.maskRegions = util.LowerCaseRegions(query.seq, query.maskRegions)
+				}
 				d := byte('a' - 'A')
 				for i, b := range query.seq {
 					if b >= 'a' && b <= 'z' {
@@ -586,6 +863,17 @@ Result ordering:
 					}
 				}
 
+				if queryBlockSize > 0 {
+					block = append(block, query)
+					if len(block) == queryBlockSize {
+						searchBlock()
+					}
+					continue
+				}
+
+				tokens <- 1
+				wg.Add(1)
+
 				go func(query *Query) {
 					defer func() {
 						<-tokens
@@ -603,6 +891,9 @@ Result ordering:
 			}
 			fastxReader.Close()
 		}
+		if len(block) > 0 {
+			searchBlock()
+		}
 		wg.Wait()
 		close(ch)
 		<-done
@@ -617,10 +908,20 @@ Result ordering:
 			log.Infof("")
 			log.Infof("processed queries: %d, speed: %.3f queries per minute\n", total, speed)
 			log.Infof("%.4f%% (%d/%d) queries matched", float64(matched)/float64(total)*100, matched, total)
+			if stats, ok := idx.SeedCacheStats(); ok {
+				log.Infof("seed cache: %.2f%% (%d/%d) hits, %d blocks (%s) cached",
+					stats.HitRate()*100, stats.Hits, stats.Hits+stats.Misses, stats.Blocks, humanize.IBytes(uint64(stats.Bytes)))
+			}
 			log.Infof("done searching")
 			if outFile != "-" {
 				log.Infof("search results saved to: %s", outFile)
 			}
+			if fileBreakpoints != "" {
+				log.Infof("breakpoints saved to: %s", fileBreakpoints)
+			}
+			if fileQueryStats != "" {
+				log.Infof("query stats saved to: %s", fileQueryStats)
+			}
 
 		}
 
@@ -632,7 +933,7 @@ func init() {
 	RootCmd.AddCommand(mapCmd)
 
 	mapCmd.Flags().StringP("index", "d", "",
-		formatFlagUsage(`Index directory created by "lexicmap index".`))
+		formatFlagUsage(`Index directory created by "lexicmap index". It can also be a URL of an index on a HTTP server or S3-compatible object storage supporting range requests, e.g., https://host/db.lmi.`))
 
 	mapCmd.Flags().StringP("out-file", "o", "-",
 		formatFlagUsage(`Out file, supports a ".gz" suffix ("-" for stdout).`))
@@ -646,9 +947,33 @@ func init() {
 	mapCmd.Flags().BoolP("all", "a", false,
 		formatFlagUsage(`Output more columns, e.g., matched sequences. Use this if you want to output blast-style format with "lexicmap utils 2blast".`))
 
+	mapCmd.Flags().BoolP("annotations", "", false,
+		formatFlagUsage(`Output four more columns of features overlapping with or nearest to HSPs, for indexes built with "lexicmap index --save-annotations".`))
+
+	mapCmd.Flags().BoolP("mapping", "", false,
+		formatFlagUsage(`Mapping mode for long reads. Only one primary alignment across all genomes, supplementary alignments of other query regions (e.g., in chimeric reads), and secondary alignments are reported for each query, with two more columns of the alignment type and MAPQ.`))
+
+	mapCmd.Flags().IntP("mapping-max-secondary", "", 5,
+		formatFlagUsage(`Maximum number of secondary alignments for each primary or supplementary alignment in the mapping mode.`))
+
+	mapCmd.Flags().Float64P("mapping-secondary-ratio", "", 0.8,
+		formatFlagUsage(`Minimum ratio of the chain score of a secondary alignment to that of the primary or supplementary one in the mapping mode.`))
+
+	mapCmd.Flags().Float64P("mapping-max-overlap", "", 0.5,
+		formatFlagUsage(`Maximum fraction of the query overlap, relative to the shorter one, between a supplementary alignment and the primary or other supplementary ones in the mapping mode.`))
+
+	mapCmd.Flags().StringP("mapping-breakpoints", "", "",
+		formatFlagUsage(`Output split-read breakpoints between adjacent primary and supplementary alignments to this file in the mapping mode.`))
+
+	mapCmd.Flags().StringP("query-stats", "", "",
+		formatFlagUsage(`Output diagnostics of each query to this file, including numbers of masked k-mers, matched seeds, candidate genomes, chains, alignments, filtered alignments, and time of each stage. Queries without hits are also included.`))
+
 	mapCmd.Flags().IntP("max-query-conc", "J", 8,
 		formatFlagUsage(`Maximum number of concurrent queries. Bigger values do not improve the batch searching speed and consume much memory.`))
 
+	mapCmd.Flags().IntP("query-block-size", "", 0,
+		formatFlagUsage(`Search queries in blocks of N in a throughput-oriented mode (0 for disable), for millions of short queries like reads. Masked k-mers of all queries in a block are sorted and searched by walking each seed chunk file once, rather than probing seed data for each query independently. Bigger values reduce random I/O but consume more memory, about 64 bytes per captured k-mer of each query (no more than the number of masks of the index) in seed matching, while chaining and alignment are performed for at most -J/--max-query-conc queries at the same time. It can't be used with --debug.`))
+
 	mapCmd.Flags().IntP("gc-interval", "", 64,
 		formatFlagUsage(`Force garbage collection every N queries (0 for disable). The value can't be too small.`))
 
@@ -669,6 +994,27 @@ func init() {
 	// mapCmd.Flags().IntP("seed-max-mismatch", "m", -1,
 	// 	formatFlagUsage(`Maximum mismatch between non-prefix regions of shared substrings.`))
 
+	mapCmd.Flags().BoolP("query-dust", "", false,
+		formatFlagUsage(`Mask low-complexity regions (e.g., tandem repeats and homopolymers) in queries with the DUST algorithm. Masked regions are not seeded but are still used in base-level alignment. Masked regions are reported with --debug.`))
+
+	mapCmd.Flags().IntP("query-dust-window", "", 64,
+		formatFlagUsage(`Window size of DUST for --query-dust.`))
+
+	mapCmd.Flags().IntP("query-dust-level", "", 20,
+		formatFlagUsage(`Score threshold of DUST for --query-dust. Smaller values mask more regions.`))
+
+	mapCmd.Flags().BoolP("query-soft-masking", "", false,
+		formatFlagUsage(`Treat lowercase bases in queries as soft-masked. They are not seeded but are still used in base-level alignment.`))
+
+	mapCmd.Flags().BoolP("seed-idf", "", false,
+		formatFlagUsage(`Weight scores of matched seeds by their inverse genome frequency (IDF-style) in ranking genomes for -n/--top-n-genomes, so genomes sharing only ubiquitous seeds (e.g., rRNA genes and IS elements) are ranked lower. The genome frequency of a seed is the number of distinct genomes in its values in the seed data, where chunks of a split genome are counted as one genome.`))
+
+	mapCmd.Flags().Float64P("seed-max-genome-freq", "", 1,
+		formatFlagUsage(`Skip matched seeds found in more than this fraction of genomes in the index (chunks of a split genome are counted as one genome), which reduces the time of chaining for queries with ubiquitous seeds. Attention: queries only sharing such seeds with genomes would have no results. Range: (0, 1], 1 for no limit.`))
+
+	mapCmd.Flags().IntP("seed-max-hits", "", 0,
+		formatFlagUsage(`Only keep N hits (genome positions) evenly sampled from all hits of each matched seed (0 for no limit). It may reduce the search sensitivity.`))
+
 	mapCmd.Flags().IntP("seed-max-gap", "", 50,
 		formatFlagUsage(`Minimum gap in seed chaining.`))
 	mapCmd.Flags().IntP("seed-max-dist", "", 1000,
@@ -683,6 +1029,18 @@ func init() {
 	mapCmd.Flags().BoolP("load-whole-seeds", "w", false,
 		formatFlagUsage(`Load the whole seed data into memory for faster seed matching. It will consume a lot of RAM.`))
 
+	mapCmd.Flags().BoolP("mmap", "", false,
+		formatFlagUsage(`Memory-map seed and genome data files. All searching threads share the mappings without their own file handlers, so the value of --max-open-files does not matter. It's recommended for indexes with hundreds of genome batches on local disks.`))
+
+	mapCmd.Flags().StringP("seed-cache-size", "", "0",
+		formatFlagUsage(`Maximum size of the in-memory cache of decoded seed data, shared by all queries, supported units: B, K, M, G. It's a middle ground between searching on disk and -w/--load-whole-seeds, and it accelerates searching batches of related queries (e.g., genes of a plasmid) which match the same seeds. (0 for no cache)`))
+
+	mapCmd.Flags().StringP("remote-cache-dir", "", "",
+		formatFlagUsage(`Directory for caching data blocks of a remote index (-d/--index is a URL), which can be reused in later runs. Without it, all data are read from the remote server.`))
+
+	mapCmd.Flags().StringP("remote-block-size", "", "1M",
+		formatFlagUsage(`Block size of data read from a remote index, supported units: B, K, M, G. Remote reads are aligned to blocks, and recently used blocks are kept in memory.`))
+
 	// pseudo alignment
 	mapCmd.Flags().IntP("align-ext-len", "", 1000,
 		formatFlagUsage(`Extend length of upstream and downstream of seed regions, for extracting query and target sequences for alignment. It should be <= contig interval length in database.`))
@@ -711,7 +1069,7 @@ func init() {
 		formatFlagUsage(`Maximum evalue of a HSP segment.`))
 
 	mapCmd.Flags().BoolP("debug", "", false,
-		formatFlagUsage(`Print debug information, including a progress bar. (recommended when searching with one query).`))
+		formatFlagUsage(`Print debug information, including a progress bar. (recommended when searching with one query). It can't be used with --query-block-size.`))
 
 	mapCmd.SetUsageTemplate(usageTemplate("-d <index path> [query.fasta[.gz] ...] [-o result.tsv[.gz]]"))
 
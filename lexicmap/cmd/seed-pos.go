@@ -133,8 +133,10 @@ Figures:
 		if err != nil {
 			checkError(fmt.Errorf("failed to read info file: %s", err))
 		}
+		layout, err := NewIndexLayout(dbDir, info)
+		checkError(err)
 
-		fileSeedLoc := filepath.Join(dbDir, DirGenomes, batchDir(0), FileSeedPositions)
+		fileSeedLoc := filepath.Join(layout.GenomeDir(0), FileSeedPositions)
 		ok, err := pathutil.Exists(fileSeedLoc)
 		if err != nil {
 			checkError(fmt.Errorf("check index file structure: %s", err))
@@ -192,7 +194,7 @@ Figures:
 					tokens <- 1
 					wg.Add(1)
 					go func(i int) {
-						fileGenomes := filepath.Join(dbDir, DirGenomes, batchDir(i), FileGenomes)
+						fileGenomes := layout.GenomeFile(i)
 						rdr, err := genome.NewReader(fileGenomes)
 						if err != nil {
 							checkError(fmt.Errorf("failed to create genome reader: %s", err))
@@ -284,7 +286,7 @@ Figures:
 		for batch := 0; batch < info.GenomeBatches; batch++ {
 			_batch := batch
 			readerPools[batch] = &sync.Pool{New: func() interface{} {
-				fileSeedLoc := filepath.Join(dbDir, DirGenomes, batchDir(_batch), FileSeedPositions)
+				fileSeedLoc := filepath.Join(layout.GenomeDir(_batch), FileSeedPositions)
 				rdr, err := seedposition.NewReader(fileSeedLoc)
 				if err != nil {
 					checkError(fmt.Errorf("failed to read seed position data file: %s", err))
@@ -362,7 +364,7 @@ Figures:
 				if hasGenomeRdrs {
 					rdr = <-poolGenomeRdrs[ref2locs.GenomeBatch]
 				} else {
-					fileGenome := filepath.Join(dbDir, DirGenomes, batchDir(ref2locs.GenomeBatch), FileGenomes)
+					fileGenome := layout.GenomeFile(ref2locs.GenomeBatch)
 					rdr, err = genome.NewReader(fileGenome)
 					if err != nil {
 						checkError(fmt.Errorf("failed to read genome data file: %s", err))
@@ -712,7 +714,7 @@ Figures:
 					if hasGenomeRdrs {
 						gRdr = <-poolGenomeRdrs[ref2locs.GenomeBatch]
 					} else {
-						fileGenome := filepath.Join(dbDir, DirGenomes, batchDir(ref2locs.GenomeBatch), FileGenomes)
+						fileGenome := layout.GenomeFile(ref2locs.GenomeBatch)
 						gRdr, err = genome.NewReader(fileGenome)
 						if err != nil {
 							checkError(fmt.Errorf("failed to read genome data file: %s", err))
@@ -254,12 +254,14 @@ type Reader struct {
 	batch    uint32
 	nRecords uint32
 
-	fh     *os.File
+	f      util.File
+	fh     io.ReadSeeker
 	offset int // offset of the first index record
 
 	buf []byte
 
-	fhData *os.File
+	fData  util.File
+	fhData io.ReadSeeker
 }
 
 var poolReader = &sync.Pool{New: func() interface{} {
@@ -281,10 +283,11 @@ func NewReader(file string) (*Reader, error) {
 	var err error
 	r := poolReader.Get().(*Reader)
 
-	r.fh, err = os.Open(fileIndex)
+	r.f, err = util.OpenFile(fileIndex)
 	if err != nil {
 		return nil, err
 	}
+	r.fh = util.NewFileReader(r.f)
 
 	buf := r.buf
 
@@ -338,23 +341,24 @@ func NewReader(file string) (*Reader, error) {
 
 	// ------------ data file ----------------
 
-	r.fhData, err = os.Open(file)
+	r.fData, err = util.OpenFile(file)
 	if err != nil {
 		return nil, err
 	}
+	r.fhData = util.NewFileReader(r.fData)
 
 	return r, nil
 }
 
 // Close closes and recycles the reader.
 func (r *Reader) Close() error {
-	err := r.fh.Close()
+	err := r.f.Close()
 	if err != nil {
 		poolReader.Put(r)
 		return err
 	}
 
-	err = r.fhData.Close()
+	err = r.fData.Close()
 	if err != nil {
 		poolReader.Put(r)
 		return err
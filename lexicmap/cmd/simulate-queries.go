@@ -0,0 +1,366 @@
+// Copyright © 2023-2026 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/shenwei356/LexicMap/lexicmap/cmd/genome"
+	"github.com/shenwei356/bio/seq"
+	"github.com/spf13/cobra"
+)
+
+var simulateQueriesCmd = &cobra.Command{
+	Use:   "simulate-queries",
+	Short: "Simulate queries from indexed genomes for evaluating search accuracy",
+	Long: `Simulate queries from indexed genomes for evaluating search accuracy
+
+How:
+  1. For each query, a genome is randomly chosen from the index, and then a region
+     with a length in the range of [-l/--min-len, -L/--max-len] is sampled from
+     sequences of the genome, on a random strand.
+     If all sequences of the genome are shorter than the length, the longest one is used,
+     and genomes with no sequences >= -l/--min-len are skipped.
+  2. A divergence level, i.e., a pair of substitution rate (-r/--sub-rates) and indel
+     rate (-g/--indel-rates), is randomly chosen. At each base of the region,
+     an indel happens with the probability of the indel rate, with a length in the range of
+     [1, -m/--max-indel-len] and equal chances of insertions and deletions; otherwise,
+     the base is substituted with the probability of the substitution rate.
+  3. Simulated queries are saved in FASTA format, and the source regions and mutations
+     are saved in the truth file (-t/--truth-file), which can be used by
+     "lexicmap utils evaluate" to measure the accuracy of "lexicmap search".
+
+Output of the truth file (tab-delimited):
+  1.  query,      Query ID.
+  2.  qlen,       Query length.
+  3.  sgenome,    Source genome ID.
+  4.  sseqid,     Source sequence ID.
+  5.  sstart,     Start position of the source region (1-based).
+  6.  send,       End position of the source region (1-based).
+  7.  sstr,       Strand of the source region.
+  8.  slen,       Length of the source sequence.
+  9.  sub_rate,   Substitution rate.
+  10. indel_rate, Indel rate.
+  11. subs,       The number of substituted bases.
+  12. ins,        The number of inserted bases.
+  13. dels,       The number of deleted bases.
+  14. divergence, Percentage of mutated bases (subs + ins + dels) in the source region.
+
+Attention:
+  1. All degenerate bases in reference genomes were converted to the lexicographic first bases.
+     E.g., N was converted to A. Therefore, simulated queries might contain consecutive A's.
+  2. Queries are sorted by the genome data files for faster sequence extraction.
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		opt := getOptions(cmd)
+		seq.ValidateSeq = false
+
+		outputLog := opt.Verbose || opt.Log2File
+
+		dbDir := getFlagString(cmd, "index")
+		if dbDir == "" {
+			checkError(fmt.Errorf("flag -d/--index needed"))
+		}
+
+		outFile := getFlagString(cmd, "out-file")
+		fileTruth := getFlagString(cmd, "truth-file")
+		if fileTruth == "" {
+			checkError(fmt.Errorf("flag -t/--truth-file needed"))
+		}
+
+		n := getFlagPositiveInt(cmd, "num-queries")
+		minLen := getFlagPositiveInt(cmd, "min-len")
+		maxLen := getFlagPositiveInt(cmd, "max-len")
+		if minLen > maxLen {
+			checkError(fmt.Errorf("the value of -l/--min-len (%d) should not be larger than -L/--max-len (%d)", minLen, maxLen))
+		}
+
+		subRates := getFlagCommaSeparatedFloat64s(cmd, "sub-rates")
+		indelRates := getFlagCommaSeparatedFloat64s(cmd, "indel-rates")
+		if len(subRates) == 0 {
+			checkError(fmt.Errorf("flag -r/--sub-rates needed"))
+		}
+		if len(subRates) != len(indelRates) {
+			checkError(fmt.Errorf("the numbers of values of -r/--sub-rates (%d) and -g/--indel-rates (%d) do not match", len(subRates), len(indelRates)))
+		}
+		for i, r := range subRates {
+			if r < 0 || indelRates[i] < 0 || r+indelRates[i] > 1 {
+				checkError(fmt.Errorf("invalid pair of substitution rate (%g) and indel rate (%g), they should be non-negative, with a sum <= 1", r, indelRates[i]))
+			}
+		}
+		maxIndelLen := getFlagPositiveInt(cmd, "max-indel-len")
+
+		seed := getFlagInt64(cmd, "seed")
+		prefix := getFlagString(cmd, "prefix")
+		lineWidth := getFlagNonNegativeInt(cmd, "line-width")
+
+		timeStart := time.Now()
+		defer func() {
+			if outputLog {
+				log.Info()
+				log.Infof("elapsed time: %s", time.Since(timeStart))
+				log.Info()
+			}
+		}()
+
+		// ---------------------------------------------------------------
+		// index
+
+		if outputLog {
+			log.Infof("loading index: %s", dbDir)
+		}
+
+		info, err := readIndexInfo(filepath.Join(dbDir, FileInfo))
+		if err != nil {
+			checkError(fmt.Errorf("failed to read info file: %s", err))
+		}
+		if info.MainVersion != MainVersion {
+			checkError(fmt.Errorf("index main versions do not match: %d (index) != %d (tool). please re-create the index", info.MainVersion, MainVersion))
+		}
+		layout, err := NewIndexLayout(dbDir, info)
+		checkError(err)
+
+		refname2idx, err := readGenomeMapName2Idx(filepath.Join(dbDir, FileGenomeIndex))
+		if err != nil {
+			checkError(fmt.Errorf("failed to read genomes index mapping file: %s", err))
+		}
+		names := make([]string, 0, len(refname2idx))
+		for name := range refname2idx {
+			names = append(names, name)
+		}
+		slices.Sort(names) // for reproducibility
+
+		// ---------------------------------------------------------------
+		// sample genomes, lengths, strands, and divergence levels
+
+		rng := rand.New(rand.NewSource(seed))
+
+		plans := make([]*simPlan, n)
+		var chunks *[]uint64
+		for i := range plans {
+			p := &simPlan{Genome: names[rng.Intn(len(names))]}
+			chunks = refname2idx[p.Genome]
+			p.BatchGenomeIndex = (*chunks)[rng.Intn(len(*chunks))] // genome chunks of a big genome
+			p.Len = minLen + rng.Intn(maxLen-minLen+1)
+			p.Level = rng.Intn(len(subRates))
+			p.RC = rng.Intn(2) == 1
+			plans[i] = p
+		}
+		slices.SortStableFunc(plans, func(a, b *simPlan) int {
+			if a.BatchGenomeIndex < b.BatchGenomeIndex {
+				return -1
+			}
+			if a.BatchGenomeIndex > b.BatchGenomeIndex {
+				return 1
+			}
+			return 0
+		})
+
+		// ---------------------------------------------------------------
+		// extract and mutate regions
+
+		if outputLog {
+			log.Infof("simulating %d queries from %d genomes ...", n, len(names))
+		}
+
+		outfh, gw, w, err := outStream(outFile, strings.HasSuffix(outFile, ".gz"), opt.CompressionLevel)
+		checkError(err)
+		defer func() {
+			outfh.Flush()
+			if gw != nil {
+				gw.Close()
+			}
+			w.Close()
+		}()
+
+		tfh, tgw, tw, err := outStream(fileTruth, strings.HasSuffix(fileTruth, ".gz"), opt.CompressionLevel)
+		checkError(err)
+		defer func() {
+			tfh.Flush()
+			if tgw != nil {
+				tgw.Close()
+			}
+			tw.Close()
+		}()
+		fmt.Fprintln(tfh, SimTruthHeader)
+
+		var rdr *genome.Reader
+		var g *genome.Genome // genome information
+		batchPre, keyPre := -1, uint64(1<<64-1)
+		var batch, gIdx int
+		var offsets []int // start positions of sequences in the concatenated sequence
+
+		var region, qseq []byte
+		var buffer *bytes.Buffer
+		var text []byte
+		var nQueries, nSkipped int
+		var mut SimMutations
+
+		for _, p := range plans {
+			batch = int(p.BatchGenomeIndex >> BITS_GENOME_IDX)
+			gIdx = int(p.BatchGenomeIndex & MASK_GENOME_IDX)
+
+			if batch != batchPre {
+				if rdr != nil {
+					checkError(rdr.Close())
+				}
+				rdr, err = genome.NewReader(layout.GenomeFile(batch))
+				if err != nil {
+					checkError(fmt.Errorf("failed to create genome reader: %s", err))
+				}
+				batchPre = batch
+			}
+
+			if p.BatchGenomeIndex != keyPre {
+				if g != nil {
+					genome.RecycleGenome(g)
+				}
+				g, err = rdr.GenomeInfo(gIdx)
+				if err != nil {
+					checkError(fmt.Errorf("failed to read genome information of %s: %s", p.Genome, err))
+				}
+				keyPre = p.BatchGenomeIndex
+
+				offsets = offsets[:0]
+				var offset int
+				for _, l := range g.SeqSizes {
+					offsets = append(offsets, offset)
+					offset += l + info.ContigInterval
+				}
+			}
+
+			// choose a sequence and a start position
+			j, start, length := simChooseRegion(rng, g.SeqSizes, p.Len, minLen)
+			if j < 0 {
+				nSkipped++
+				continue
+			}
+
+			tSeq, err := rdr.SubSeq(gIdx, offsets[j]+start, offsets[j]+start+length-1)
+			if err != nil {
+				checkError(fmt.Errorf("failed to extract subsequence of %s: %s", p.Genome, err))
+			}
+			region = append(region[:0], tSeq.Seq...)
+			genome.RecycleGenome(tSeq)
+
+			strand := byte('+')
+			if p.RC {
+				RC(region)
+				strand = '-'
+			}
+
+			qseq, mut = simMutate(rng, region, subRates[p.Level], indelRates[p.Level], maxIndelLen, qseq[:0])
+
+			nQueries++
+			t := &SimTruth{
+				Query:        fmt.Sprintf("%s%d", prefix, nQueries),
+				Qlen:         len(qseq),
+				Genome:       p.Genome,
+				SeqID:        string(*g.SeqIDs[j]),
+				Start:        start + 1,
+				End:          start + length,
+				Strand:       strand,
+				SeqLen:       g.SeqSizes[j],
+				SubRate:      subRates[p.Level],
+				IndelRate:    indelRates[p.Level],
+				SimMutations: mut,
+			}
+			t.Write(tfh)
+
+			fmt.Fprintf(outfh, ">%s\n", t.Query)
+			text, buffer = wrapByteSlice(qseq, lineWidth, buffer)
+			outfh.Write(text)
+			outfh.WriteByte('\n')
+		}
+		if g != nil {
+			genome.RecycleGenome(g)
+		}
+		if rdr != nil {
+			checkError(rdr.Close())
+		}
+
+		if outputLog {
+			log.Infof("%d queries saved to: %s", nQueries, outFile)
+			log.Infof("truth saved to: %s", fileTruth)
+			if nSkipped > 0 {
+				log.Warningf("%d queries skipped as the sampled genomes have no sequences >= %d bp", nSkipped, minLen)
+			}
+		}
+	},
+}
+
+func init() {
+	utilsCmd.AddCommand(simulateQueriesCmd)
+
+	simulateQueriesCmd.Flags().StringP("index", "d", "",
+		formatFlagUsage(`Index directory created by "lexicmap index".`))
+
+	simulateQueriesCmd.Flags().StringP("out-file", "o", "-",
+		formatFlagUsage(`Out file of simulated queries in FASTA format, supports the ".gz" suffix ("-" for stdout).`))
+
+	simulateQueriesCmd.Flags().StringP("truth-file", "t", "",
+		formatFlagUsage(`Out file of the source regions and mutations of queries, supports the ".gz" suffix.`))
+
+	simulateQueriesCmd.Flags().IntP("num-queries", "n", 1000,
+		formatFlagUsage(`Number of queries to simulate.`))
+
+	simulateQueriesCmd.Flags().IntP("min-len", "l", 500,
+		formatFlagUsage(`Minimum length of sampled regions.`))
+
+	simulateQueriesCmd.Flags().IntP("max-len", "L", 5000,
+		formatFlagUsage(`Maximum length of sampled regions.`))
+
+	simulateQueriesCmd.Flags().StringP("sub-rates", "r", "0,0.01,0.03,0.05,0.1",
+		formatFlagUsage(`Comma-separated substitution rates of divergence levels, paired with -g/--indel-rates.`))
+
+	simulateQueriesCmd.Flags().StringP("indel-rates", "g", "0,0.001,0.003,0.005,0.01",
+		formatFlagUsage(`Comma-separated indel rates of divergence levels, paired with -r/--sub-rates.`))
+
+	simulateQueriesCmd.Flags().IntP("max-indel-len", "m", 5,
+		formatFlagUsage(`Maximum length of an indel.`))
+
+	simulateQueriesCmd.Flags().Int64P("seed", "s", 1,
+		formatFlagUsage(`Seed of the random number generator.`))
+
+	simulateQueriesCmd.Flags().StringP("prefix", "p", "sim_",
+		formatFlagUsage(`Prefix of query IDs.`))
+
+	simulateQueriesCmd.Flags().IntP("line-width", "w", 60,
+		formatFlagUsage("Line width of sequences (0 for no wrap)."))
+
+	simulateQueriesCmd.SetUsageTemplate(usageTemplate(""))
+}
+
+// simPlan is a sampled genome, length, strand, and divergence level of a query.
+type simPlan struct {
+	Genome           string
+	BatchGenomeIndex uint64
+	Len              int
+	Level            int // index of the divergence level
+	RC               bool
+}
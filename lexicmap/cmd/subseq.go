@@ -134,6 +134,8 @@ Attention:
 			if info.MainVersion != MainVersion {
 				checkError(fmt.Errorf("index main versions do not match: %d (index) != %d (tool). please re-create the index", info.MainVersion, MainVersion))
 			}
+			layout, err := NewIndexLayout(dbDir, info)
+			checkError(err)
 
 			if maxOpenFiles < info.GenomeBatches {
 				log.Warningf("the value of --max-open-files (%d) should be larger than the number of genome batches (%d)", maxOpenFiles, info.GenomeBatches)
@@ -166,7 +168,7 @@ Attention:
 					tokens <- 1
 					wg.Add(1)
 					go func(i int) {
-						fileGenomes := filepath.Join(dbDir, DirGenomes, batchDir(i), FileGenomes)
+						fileGenomes := layout.GenomeFile(i)
 						rdr, err := genome.NewReader(fileGenomes)
 						if err != nil {
 							checkError(fmt.Errorf("failed to create genome reader: %s", err))
@@ -545,6 +547,8 @@ Attention:
 		if info.MainVersion != MainVersion {
 			checkError(fmt.Errorf("index main versions do not match: %d (index) != %d (tool). please re-create the index", info.MainVersion, MainVersion))
 		}
+		layout, err := NewIndexLayout(dbDir, info)
+		checkError(err)
 
 		// genomes.map file for mapping index to genome id
 		m, err := readGenomeMapName2Idx(filepath.Join(dbDir, FileGenomeIndex))
@@ -583,7 +587,7 @@ Attention:
 			genomeBatch = int(batchIDAndRefID >> BITS_GENOME_IDX)
 			genomeIdx = int(batchIDAndRefID & MASK_GENOME_IDX)
 
-			fileGenome := filepath.Join(dbDir, DirGenomes, batchDir(genomeBatch), FileGenomes)
+			fileGenome := layout.GenomeFile(genomeBatch)
 			rdr, err = genome.NewReader(fileGenome)
 			if err != nil {
 				checkError(fmt.Errorf("failed to read genome data file: %s", err))
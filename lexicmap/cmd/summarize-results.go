@@ -0,0 +1,581 @@
+// Copyright © 2023-2026 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shenwei356/bio/taxdump"
+	"github.com/spf13/cobra"
+)
+
+var summarizeResultsCmd = &cobra.Command{
+	Use:   "summarize-results",
+	Short: "Summarize search results per genome and per taxon",
+	Long: `Summarize search results per genome and per taxon
+
+Input:
+  - Output file of 'lexicmap search', both the default 20- and 24-column formats are supported.
+  - Results of multiple queries are supported.
+
+Output (one row per genome, -o/--out-file):
+  1.  query,         Query sequence ID.
+  2.  qlen,          Query sequence length.
+  3.  sgenome,       Subject genome ID.
+  4.  qcovGnm,       Query coverage (percentage) per genome: $(aligned bases in the genome)/$qlen.
+  5.  clusters,      The number of HSP clusters.
+  6.  hsps,          The number of HSPs.
+  7.  copies,        The number of HSP clusters with query coverage >= -c/--min-qcov-per-copy.
+  8.  alen,          Total aligned length of all HSPs.
+  9.  best_sseqid,   Subject sequence ID of the best HSP cluster.
+  10. best_slen,     Subject sequence length of the best HSP cluster.
+  11. best_plasmid,  Whether the subject sequence of the best HSP cluster is plasmid-like (yes/no).
+  12. best_qcov,     Query coverage (percentage) of the best HSP cluster.
+  13. best_alen,     Aligned length of the best HSP cluster.
+  14. best_pident,   Percentage of base identity of the best HSP cluster, weighted by aligned length.
+  15. best_bitscore, The highest bit score of HSPs in the best HSP cluster.
+  16. best_evalue,   The lowest expect value of HSPs in the best HSP cluster.
+
+  With -T/--taxdump and -G/--genome2taxid, two columns are inserted after sgenome:
+      taxid,         TaxId of the subject genome, 0 for genomes absent in the genome2taxid file.
+      taxon,         Name of the taxon at the rank of -r/--rank.
+
+Output (one row per taxon, -t/--taxon-out-file, needs -T/--taxdump and -G/--genome2taxid):
+  1.  query,             Query sequence ID.
+  2.  qlen,              Query sequence length.
+  3.  taxid,             TaxId of the taxon at the rank of -r/--rank, 0 for unclassified genomes.
+  4.  rank,              Rank.
+  5.  taxon,             Name of the taxon.
+  6.  genomes,           The number of genomes.
+  7.  copies,            Total copies in all genomes.
+  8.  plasmid_genomes,   The number of genomes with the best HSP cluster on a plasmid-like sequence.
+  9.  qcovGnm_mean,      Mean qcovGnm.
+  10. pident_min,        Minimum best_pident of genomes.
+  11. pident_q1,         The first quartile of best_pident of genomes.
+  12. pident_median,     Median best_pident of genomes.
+  13. pident_q3,         The third quartile of best_pident of genomes.
+  14. pident_max,        Maximum best_pident of genomes.
+  15. pident_mean,       Mean best_pident of genomes.
+  16. pident_stdev,      Standard deviation of best_pident of genomes.
+
+  Taxa of a query are sorted by the number of genomes in descending order.
+
+Best HSP cluster:
+  The HSP cluster with the highest SimilarityScore = max(bitscore*pident), i.e.,
+  the first one of a genome in the search result.
+
+Plasmid-like sequences:
+  Search results do not contain sequence descriptions, so a subject sequence is
+  regarded as plasmid-like if its ID matches -p/--plasmid-regexp, or its length
+  <= -L/--max-plasmid-len. Both are off by default, as sequence IDs are usually
+  accessions, and a length threshold would also take short contigs of draft
+  assemblies as plasmids.
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		opt := getOptions(cmd)
+
+		outFile := getFlagString(cmd, "out-file")
+		outFileTaxon := getFlagString(cmd, "taxon-out-file")
+		query := getFlagString(cmd, "query")
+
+		bufferSizeS := getFlagString(cmd, "buffer-size")
+		if bufferSizeS == "" {
+			checkError(fmt.Errorf("value of buffer size. supported unit: K, M, G"))
+		}
+		bufferSize, err := ParseByteSize(bufferSizeS)
+		if err != nil {
+			checkError(fmt.Errorf("invalid value of buffer size. supported unit: K, M, G"))
+		}
+
+		minQcovCopy := getFlagNonNegativeFloat64(cmd, "min-qcov-per-copy")
+		if minQcovCopy > 100 {
+			checkError(fmt.Errorf("the value of flag -c/--min-qcov-per-copy (%f) should be in range of [0, 100]", minQcovCopy))
+		}
+		maxPlasmidLen := getFlagNonNegativeInt(cmd, "max-plasmid-len")
+		var rePlasmid *regexp.Regexp
+		plasmidRegexp := getFlagString(cmd, "plasmid-regexp")
+		if plasmidRegexp != "" {
+			rePlasmid, err = regexp.Compile(plasmidRegexp)
+			checkError(err)
+		}
+
+		taxdumpDir := getFlagString(cmd, "taxdump")
+		genome2taxidFile := getFlagString(cmd, "genome2taxid")
+		rank := strings.ToLower(getFlagNonEmptyString(cmd, "rank"))
+
+		useTaxonomy := taxdumpDir != "" || genome2taxidFile != ""
+		if useTaxonomy && !(taxdumpDir != "" && genome2taxidFile != "") {
+			checkError(fmt.Errorf("flags -T/--taxdump and -G/--genome2taxid should be given together"))
+		}
+		if outFileTaxon != "" && !useTaxonomy {
+			checkError(fmt.Errorf("flags -T/--taxdump and -G/--genome2taxid are needed if -t/--taxon-out-file is given"))
+		}
+
+		timeStart := time.Now()
+		defer func() {
+			if opt.Verbose {
+				log.Info()
+				log.Infof("elapsed time: %s", time.Since(timeStart))
+				log.Info()
+			}
+		}()
+
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+
+		// ---------------------------------------------------------------
+		// taxonomy
+
+		var taxa *GenomeTaxa
+		if useTaxonomy {
+			if opt.Verbose {
+				log.Infof("loading taxonomy data from: %s", taxdumpDir)
+			}
+			tax, err := loadTaxonomyWithRankAndNames(taxdumpDir)
+			if err != nil {
+				checkError(fmt.Errorf("failed to load taxonomy data: %s", err))
+			}
+
+			genome2taxid, err := readKVsUint32(genome2taxidFile, false)
+			if err != nil {
+				checkError(fmt.Errorf("failed to read genome2taxid file: %s", genome2taxidFile))
+			}
+			if opt.Verbose {
+				log.Infof("  %d genome2taxid records loaded", len(genome2taxid))
+			}
+
+			taxa = NewGenomeTaxa(tax, genome2taxid, rank)
+		}
+
+		// ---------------------------------------------------------------
+
+		outfh, gw, w, err := outStream(outFile, strings.HasSuffix(outFile, ".gz"), opt.CompressionLevel)
+		checkError(err)
+		defer func() {
+			outfh.Flush()
+			if gw != nil {
+				gw.Close()
+			}
+			w.Close()
+		}()
+
+		fmt.Fprintf(outfh, "query\tqlen\tsgenome")
+		if useTaxonomy {
+			fmt.Fprintf(outfh, "\ttaxid\ttaxon")
+		}
+		fmt.Fprintln(outfh, "\tqcovGnm\tclusters\thsps\tcopies\talen\tbest_sseqid\tbest_slen\tbest_plasmid\tbest_qcov\tbest_alen\tbest_pident\tbest_bitscore\tbest_evalue")
+
+		outputTaxon := outFileTaxon != ""
+		var tfh *bufio.Writer
+		if outputTaxon {
+			_tfh, tgw, tw, err := outStream(outFileTaxon, strings.HasSuffix(outFileTaxon, ".gz"), opt.CompressionLevel)
+			checkError(err)
+			tfh = _tfh
+			defer func() {
+				tfh.Flush()
+				if tgw != nil {
+					tgw.Close()
+				}
+				tw.Close()
+			}()
+
+			fmt.Fprintln(tfh, "query\tqlen\ttaxid\trank\ttaxon\tgenomes\tcopies\tplasmid_genomes\tqcovGnm_mean\tpident_min\tpident_q1\tpident_median\tpident_q3\tpident_max\tpident_mean\tpident_stdev")
+		}
+
+		var rGnm *SearchResultOfAGenome
+		var queryPre, qlenPre string
+		var nQueries, nGenomes int
+		var taxid, taxidRank uint32
+		var taxonName string
+		var ts *TaxonSummary
+		var ok bool
+		summarizer := &GenomeHitSummarizer{
+			MinQcovCopy:   minQcovCopy,
+			MaxPlasmidLen: maxPlasmidLen,
+			RePlasmid:     rePlasmid,
+		}
+		taxonSummaries := make(map[uint32]*TaxonSummary, 1024)
+
+		flushTaxa := func() {
+			if !outputTaxon || len(taxonSummaries) == 0 {
+				return
+			}
+			list := make([]*TaxonSummary, 0, len(taxonSummaries))
+			for _, ts := range taxonSummaries {
+				list = append(list, ts)
+			}
+			slices.SortFunc(list, func(a, b *TaxonSummary) int {
+				if a.Genomes == b.Genomes {
+					return strings.Compare(a.Name, b.Name)
+				}
+				return b.Genomes - a.Genomes
+			})
+			for _, ts := range list {
+				ts.Write(tfh, queryPre, qlenPre, rank)
+			}
+			clear(taxonSummaries)
+		}
+
+		for _, file := range files {
+			reader, err := NewSearchResultReader(file, query, bufferSize)
+			checkError(err)
+
+			for {
+				rGnm = reader.Next()
+				if rGnm == nil {
+					break
+				}
+
+				if rGnm.Query != queryPre { // a new query
+					flushTaxa()
+
+					queryPre, qlenPre = rGnm.Query, rGnm.Qlen
+					nQueries++
+				}
+				nGenomes++
+
+				s := summarizer.Summarize(rGnm)
+
+				fmt.Fprintf(outfh, "%s\t%s\t%s", rGnm.Query, rGnm.Qlen, rGnm.Sgenome)
+				if useTaxonomy {
+					taxid, taxidRank, taxonName = taxa.Taxon(rGnm.Sgenome)
+					fmt.Fprintf(outfh, "\t%d\t%s", taxid, taxonName)
+				}
+				fmt.Fprintf(outfh, "\t%s\t%d\t%d\t%d\t%d\t%s\t%s\t%s\t%.3f\t%d\t%.3f\t%d\t%.2e\n",
+					rGnm.QcovGnm, s.Clusters, s.HSPs, s.Copies, s.Alen,
+					s.BestSseqid, s.BestSlen, yesOrNo(s.BestPlasmid),
+					s.BestQcov, s.BestAlen, s.BestPident, s.BestBitscore, s.BestEvalue)
+
+				if outputTaxon {
+					if ts, ok = taxonSummaries[taxidRank]; !ok {
+						ts = &TaxonSummary{TaxId: taxidRank, Name: taxonName, Pidents: make([]float64, 0, 8)}
+						taxonSummaries[taxidRank] = ts
+					}
+					ts.Add(rGnm.QcovGnm, s)
+				}
+
+				RecycleSearchResultOfAGenome(rGnm)
+			}
+		}
+		flushTaxa()
+
+		if opt.Verbose {
+			log.Infof("%d genome hits of %d queries summarized", nGenomes, nQueries)
+			if useTaxonomy && taxa.Missing > 0 {
+				log.Warningf("%d genomes are not found in the genome2taxid file or the taxonomy data", taxa.Missing)
+			}
+		}
+	},
+}
+
+func init() {
+	utilsCmd.AddCommand(summarizeResultsCmd)
+
+	summarizeResultsCmd.Flags().StringP("out-file", "o", "-",
+		formatFlagUsage(`Out file of per-genome summary, supports the ".gz" suffix ("-" for stdout).`))
+
+	summarizeResultsCmd.Flags().StringP("taxon-out-file", "t", "",
+		formatFlagUsage(`Out file of per-taxon summary, supports the ".gz" suffix. It needs -T/--taxdump and -G/--genome2taxid.`))
+
+	summarizeResultsCmd.Flags().StringP("query", "q", "",
+		formatFlagUsage(`Only summarize results of this query.`))
+
+	summarizeResultsCmd.Flags().StringP("buffer-size", "b", "20M",
+		formatFlagUsage(`Size of buffer, supported unit: K, M, G. You need increase the value when "bufio.Scanner: token too long" error reported`))
+
+	summarizeResultsCmd.Flags().Float64P("min-qcov-per-copy", "c", 50,
+		formatFlagUsage(`Minimum query coverage (percentage) of a HSP cluster to be counted as a copy.`))
+
+	summarizeResultsCmd.Flags().IntP("max-plasmid-len", "L", 0,
+		formatFlagUsage(`Subject sequences with length <= this value are regarded as plasmid-like (0 for disabling it). Attention: short contigs of draft assemblies would be regarded as plasmid-like too, so please only use it for complete genomes.`))
+
+	summarizeResultsCmd.Flags().StringP("plasmid-regexp", "p", "",
+		formatFlagUsage(`Subject sequences with IDs matching this regular expression are regarded as plasmid-like, e.g., "(?i)plasmid".`))
+
+	summarizeResultsCmd.Flags().StringP("taxdump", "T", "",
+		formatFlagUsage(`Directory containing taxdump files (nodes.dmp, names.dmp, etc.), needed for taxonomy-aware summary. For other non-NCBI taxonomy data, please use 'taxonkit create-taxdump' to create taxdump files.`))
+
+	summarizeResultsCmd.Flags().StringP("genome2taxid", "G", "",
+		formatFlagUsage(`Two-column tabular file for mapping genome ID to TaxId, needed for taxonomy-aware summary.`))
+
+	summarizeResultsCmd.Flags().StringP("rank", "r", "species",
+		formatFlagUsage(`Taxonomic rank to summarize at.`))
+
+	summarizeResultsCmd.SetUsageTemplate(usageTemplate(""))
+}
+
+func yesOrNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+// GenomeHitSummary is the summary of the search result of a genome.
+type GenomeHitSummary struct {
+	Clusters int
+	HSPs     int
+	Copies   int
+	Alen     int
+
+	// the best HSP cluster
+	BestSseqid   string
+	BestSlen     string
+	BestPlasmid  bool
+	BestQcov     float64
+	BestAlen     int
+	BestPident   float64
+	BestBitscore int
+	BestEvalue   float64
+}
+
+// GenomeHitSummarizer summarizes the search result of a genome.
+type GenomeHitSummarizer struct {
+	MinQcovCopy   float64
+	MaxPlasmidLen int
+	RePlasmid     *regexp.Regexp
+
+	regions [][3]int
+}
+
+// Summarize summarizes the search result of a genome.
+func (s *GenomeHitSummarizer) Summarize(rGnm *SearchResultOfAGenome) *GenomeHitSummary {
+	qlen, err := strconv.Atoi(rGnm.Qlen)
+	if err != nil {
+		checkError(fmt.Errorf("failed to parse qlen: %s", rGnm.Qlen))
+	}
+
+	r := &GenomeHitSummary{HSPs: len(rGnm.Records)}
+
+	if s.regions == nil {
+		s.regions = make([][3]int, 0, 16)
+	}
+
+	var pident, evalue, score, bestScore float64
+	var alen, bitscore, qstart, qend int
+	var cAlen, cBitscore int
+	var cPidentSum, cEvalue, cScore float64
+
+	// summarize the current HSP cluster
+	finishCluster := func(rSeq *SearchResultOfASequence) {
+		var covered int
+		for _, reg := range mergeQueryRegions(s.regions, 0) {
+			covered += reg[1] - reg[0]
+		}
+		qcov := min(float64(covered)/float64(qlen)*100, 100)
+
+		r.Clusters++
+		if qcov >= s.MinQcovCopy {
+			r.Copies++
+		}
+
+		if cScore > bestScore || r.Clusters == 1 {
+			bestScore = cScore
+			r.BestSseqid = rSeq.Sseqid
+			r.BestSlen = rSeq.Slen
+			r.BestQcov = qcov
+			r.BestAlen = cAlen
+			if cAlen > 0 {
+				r.BestPident = cPidentSum / float64(cAlen)
+			}
+			r.BestBitscore = cBitscore
+			r.BestEvalue = cEvalue
+		}
+
+		s.regions = s.regions[:0]
+		cAlen, cBitscore, cPidentSum, cScore = 0, 0, 0, 0
+	}
+
+	var rSeqPre *SearchResultOfASequence
+	for _, rSeq := range rGnm.Records {
+		if rSeqPre != nil && rSeq.Cls != rSeqPre.Cls { // a new cluster
+			finishCluster(rSeqPre)
+		}
+
+		pident, _ = strconv.ParseFloat(rSeq.Pident, 64)
+		evalue, _ = strconv.ParseFloat(rSeq.Evalue, 64)
+		bitscore, _ = strconv.Atoi(rSeq.Bitscore)
+		alen, _ = strconv.Atoi(rSeq.AlenHSP)
+		qstart, _ = strconv.Atoi(rSeq.Qstart)
+		qend, _ = strconv.Atoi(rSeq.Qend)
+
+		r.Alen += alen
+
+		if cAlen == 0 || evalue < cEvalue {
+			cEvalue = evalue
+		}
+		cAlen += alen
+		cPidentSum += pident * float64(alen)
+		if bitscore > cBitscore {
+			cBitscore = bitscore
+		}
+		score = float64(bitscore) * pident
+		if score > cScore {
+			cScore = score
+		}
+		s.regions = append(s.regions, [3]int{qstart - 1, qend, 1})
+
+		rSeqPre = rSeq
+	}
+	if rSeqPre != nil {
+		finishCluster(rSeqPre)
+	}
+
+	r.BestPlasmid = s.isPlasmid(r.BestSseqid, r.BestSlen)
+
+	return r
+}
+
+func (s *GenomeHitSummarizer) isPlasmid(sseqid string, slen string) bool {
+	if s.RePlasmid != nil && s.RePlasmid.MatchString(sseqid) {
+		return true
+	}
+	if s.MaxPlasmidLen > 0 {
+		l, err := strconv.Atoi(slen)
+		if err == nil && l <= s.MaxPlasmidLen {
+			return true
+		}
+	}
+	return false
+}
+
+// GenomeTaxa maps genome IDs to TaxIds at a given rank.
+type GenomeTaxa struct {
+	Taxonomy     *taxdump.Taxonomy
+	Genome2TaxId map[string]uint32
+	Rank         string
+
+	Missing int // the number of genomes without valid TaxIds
+
+	cache   map[uint32]uint32 // taxid -> taxid at the rank
+	missing map[string]struct{}
+}
+
+// NewGenomeTaxa creates a GenomeTaxa.
+func NewGenomeTaxa(tax *taxdump.Taxonomy, genome2taxid map[string]uint32, rank string) *GenomeTaxa {
+	return &GenomeTaxa{
+		Taxonomy:     tax,
+		Genome2TaxId: genome2taxid,
+		Rank:         rank,
+		cache:        make(map[uint32]uint32, 1024),
+		missing:      make(map[string]struct{}, 8),
+	}
+}
+
+// Taxon returns the TaxId of a genome, the TaxId and name of the taxon at the rank.
+// 0 and "unclassified" are returned if the taxon at the rank is not found.
+func (t *GenomeTaxa) Taxon(genome string) (uint32, uint32, string) {
+	taxid, ok := t.Genome2TaxId[genome]
+	if !ok {
+		if _, ok = t.missing[genome]; !ok {
+			t.missing[genome] = struct{}{}
+			t.Missing++
+		}
+		return 0, 0, "unclassified"
+	}
+
+	taxidRank, ok := t.cache[taxid]
+	if !ok {
+		lineage := t.Taxonomy.LineageTaxIds(taxid)
+		if lineage == nil {
+			if _, ok = t.missing[genome]; !ok {
+				t.missing[genome] = struct{}{}
+				t.Missing++
+			}
+		}
+		for i := len(lineage) - 1; i >= 0; i-- {
+			if t.Taxonomy.Rank(lineage[i]) == t.Rank {
+				taxidRank = lineage[i]
+				break
+			}
+		}
+		t.cache[taxid] = taxidRank
+	}
+
+	if taxidRank == 0 {
+		return taxid, 0, "unclassified"
+	}
+	return taxid, taxidRank, t.Taxonomy.Name(taxidRank)
+}
+
+// TaxonOfTaxId returns the TaxId and name of the taxon at the rank for a given TaxId.
+// 0 and "unclassified" are returned if the taxon at the rank is not found.
+func (t *GenomeTaxa) TaxonOfTaxId(taxid uint32) (uint32, string) {
+	taxidRank, ok := t.cache[taxid]
+	if !ok {
+		lineage := t.Taxonomy.LineageTaxIds(taxid)
+		for i := len(lineage) - 1; i >= 0; i-- {
+			if t.Taxonomy.Rank(lineage[i]) == t.Rank {
+				taxidRank = lineage[i]
+				break
+			}
+		}
+		t.cache[taxid] = taxidRank
+	}
+
+	if taxidRank == 0 {
+		return 0, "unclassified"
+	}
+	return taxidRank, t.Taxonomy.Name(taxidRank)
+}
+
+// TaxonSummary is the summary of genome hits of a taxon.
+type TaxonSummary struct {
+	TaxId uint32
+	Name  string
+
+	Genomes        int
+	Copies         int
+	PlasmidGenomes int
+	QcovGnmSum     float64
+	Pidents        []float64 // best_pident of genomes
+}
+
+// Add adds the summary of a genome.
+func (ts *TaxonSummary) Add(qcovGnm string, s *GenomeHitSummary) {
+	ts.Genomes++
+	ts.Copies += s.Copies
+	if s.BestPlasmid {
+		ts.PlasmidGenomes++
+	}
+	qcov, _ := strconv.ParseFloat(qcovGnm, 64)
+	ts.QcovGnmSum += qcov
+	ts.Pidents = append(ts.Pidents, s.BestPident)
+}
+
+// Write outputs the summary in a row.
+func (ts *TaxonSummary) Write(outfh *bufio.Writer, query string, qlen string, rank string) {
+	sort.Float64s(ts.Pidents)
+	mean, stdev := MeanStdev(ts.Pidents)
+	fmt.Fprintf(outfh, "%s\t%s\t%d\t%s\t%s\t%d\t%d\t%d\t%.3f\t%.3f\t%.3f\t%.3f\t%.3f\t%.3f\t%.3f\t%.3f\n",
+		query, qlen, ts.TaxId, rank, ts.Name,
+		ts.Genomes, ts.Copies, ts.PlasmidGenomes, ts.QcovGnmSum/float64(ts.Genomes),
+		ts.Pidents[0], getPercentile(0.25, ts.Pidents), getPercentile(0.5, ts.Pidents),
+		getPercentile(0.75, ts.Pidents), ts.Pidents[len(ts.Pidents)-1],
+		mean, stdev)
+}
@@ -0,0 +1,771 @@
+// Copyright © 2023-2026 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shenwei356/LexicMap/lexicmap/cmd/genome"
+	"github.com/shenwei356/bio/seq"
+	"github.com/shenwei356/bio/seqio/fastx"
+	"github.com/shenwei356/xopen"
+	"github.com/spf13/cobra"
+)
+
+var typingCmd = &cobra.Command{
+	Use:   "typing",
+	Short: "Allele typing (MLST/cgMLST) of all genomes in the index",
+	Long: `Allele typing (MLST/cgMLST) of all genomes in the index
+
+Input:
+  - A typing scheme with one (gzipped) FASTA file of alleles per locus,
+    via positional parameters and/or a file list via the flag -X/--infile-list.
+    The locus name is the file name without extensions, e.g., "adk" for adk.fasta.
+    The allele number is extracted from the sequence ID with -r/--allele-id-regexp,
+    e.g., "7" from "adk_7".
+  - An optional profile table (-p/--profile) for assigning sequence types (STs),
+    which is tab-delimited with a header row. The first column is the ST,
+    and other columns with locus names are used, e.g.,
+        ST  adk  fumC  gyrB  icd  mdh  purA  recA
+        1   1    1     1     1    1    1     1
+
+How:
+  1. The representative allele (the first one by default) of each locus is searched
+     against the index, and the best HSP in each genome is used.
+  2. The full-length region of the locus is extracted from the genome,
+     anchored at the aligned start of the representative allele.
+  3. Exact allele matches are searched among alleles of all lengths in the scheme.
+     If not found, the allele is flagged as:
+       NOVEL,   the locus is complete but the allele is not in the scheme.
+       PARTIAL, the query coverage of the HSP is < -Q/--min-qcov-complete.
+       EDGE,    the locus is truncated by the end of a contig.
+       -,       the locus is not found, i.e., the query coverage of the HSP is < -q/--min-qcov.
+
+Output:
+  - A genome × locus allele profile table, with the ST column if -p/--profile is given.
+    STs of genomes with unknown profiles or non-exact alleles are shown as "-".
+  - Optional details of calls (--details), with 9 columns:
+      genome, locus, allele, sseqid, sstart, send, sstr, qcovHSP, pident
+  - Optional novel allele sequences (--novel-alleles) in FASTA format,
+    with sequence IDs in the format of "locus|genome|sseqid:begin-end:strand".
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		opt := getOptions(cmd)
+		seq.ValidateSeq = false
+
+		var fhLog *os.File
+		if opt.Log2File {
+			fhLog = addLog(opt.LogFile, opt.Verbose)
+		}
+
+		outputLog := opt.Verbose || opt.Log2File
+
+		timeStart := time.Now()
+		defer func() {
+			if outputLog {
+				log.Info()
+				log.Infof("elapsed time: %s", time.Since(timeStart))
+				log.Info()
+			}
+			if opt.Log2File {
+				fhLog.Close()
+			}
+		}()
+
+		var err error
+
+		// ---------------------------------------------------------------
+
+		dbDir := getFlagString(cmd, "index")
+		if dbDir == "" {
+			checkError(fmt.Errorf("flag -d/--index needed"))
+		}
+		outFile := getFlagString(cmd, "out-file")
+		fileProfile := getFlagString(cmd, "profile")
+		fileDetails := getFlagString(cmd, "details")
+		fileNovel := getFlagString(cmd, "novel-alleles")
+
+		reAlleleIDStr := getFlagString(cmd, "allele-id-regexp")
+		if !regexp.MustCompile(`\(.+\)`).MatchString(reAlleleIDStr) {
+			checkError(fmt.Errorf(`value of -r/--allele-id-regexp must contain "(" and ")" to capture the allele number`))
+		}
+		reAlleleID, err := regexp.Compile(reAlleleIDStr)
+		if err != nil {
+			checkError(fmt.Errorf("invalid value of -r/--allele-id-regexp: %s", err))
+		}
+
+		minIdent := getFlagNonNegativeFloat64(cmd, "align-min-match-pident")
+		if minIdent < 60 || minIdent > 100 {
+			checkError(fmt.Errorf("the value of flag -i/--align-min-match-pident (%f) should be in range of [60, 100]", minIdent))
+		}
+		minQcov := getFlagNonNegativeFloat64(cmd, "min-qcov")
+		if minQcov > 100 {
+			checkError(fmt.Errorf("the value of flag -q/--min-qcov (%f) should be in range of [0, 100]", minQcov))
+		}
+		minQcovComplete := getFlagNonNegativeFloat64(cmd, "min-qcov-complete")
+		if minQcovComplete > 100 || minQcovComplete < minQcov {
+			checkError(fmt.Errorf("the value of flag -Q/--min-qcov-complete (%f) should be in range of [%f, 100]", minQcovComplete, minQcov))
+		}
+
+		maxOpenFiles := getFlagPositiveInt(cmd, "max-open-files")
+		inMemorySearch := getFlagBool(cmd, "load-whole-seeds")
+		maxQueryConcurrency := getFlagNonNegativeInt(cmd, "max-query-conc")
+		if maxQueryConcurrency == 0 {
+			maxQueryConcurrency = opt.NumCPUs
+		}
+
+		files := getFileListFromArgsAndFile(cmd, args, true, "infile-list", true)
+		for _, file := range files {
+			if isStdin(file) {
+				checkError(fmt.Errorf("stdin not supported, please give allele files of the typing scheme"))
+			}
+		}
+
+		// ---------------------------------------------------------------
+		// scheme
+
+		if outputLog {
+			log.Infof("reading typing scheme from %d files ...", len(files))
+		}
+
+		loci := make([]*TypingLocus, 0, len(files))
+		locusIdx := make(map[string]int, len(files))
+		var nAlleles int
+		for _, file := range files {
+			locus, err := readTypingLocus(file, reAlleleID)
+			checkError(err)
+
+			if _, ok := locusIdx[locus.Name]; ok {
+				checkError(fmt.Errorf("duplicated locus name: %s", locus.Name))
+			}
+			locusIdx[locus.Name] = len(loci)
+			loci = append(loci, locus)
+			nAlleles += len(locus.Alleles)
+		}
+		if outputLog {
+			log.Infof("  %d alleles of %d loci loaded", nAlleles, len(loci))
+		}
+
+		// profiles
+		var profiles map[string]string
+		var profileLoci []int
+		if fileProfile != "" {
+			profiles, profileLoci, err = readTypingProfiles(fileProfile, locusIdx)
+			checkError(err)
+			if outputLog {
+				log.Infof("  %d profiles of %d loci loaded", len(profiles), len(profileLoci))
+			}
+		}
+
+		// ---------------------------------------------------------------
+		// index
+
+		if outputLog {
+			log.Info()
+			log.Infof("loading index: %s", dbDir)
+		}
+
+		sopt := &IndexSearchingOptions{
+			NumCPUs:      opt.NumCPUs,
+			Verbose:      opt.Verbose,
+			Log2File:     opt.Log2File,
+			MaxOpenFiles: maxOpenFiles,
+
+			MaxSeedSearchingConcurrency: max(maxQueryConcurrency/2, 2),
+
+			MinPrefix:       15,
+			MinSinglePrefix: 17,
+			InMemorySearch:  inMemorySearch,
+
+			MaxGap:      50,
+			MaxDistance: 1000,
+
+			ExtendLength:  1000,
+			ExtendLength2: 50,
+
+			MinQueryAlignedFractionInAGenome: minQcov,
+			MaxEvalue:                        10,
+		}
+
+		idx, err := NewIndexSearcher(dbDir, sopt)
+		checkError(err)
+		defer func() {
+			checkError(idx.Close())
+		}()
+
+		minAlignLen := 50
+		idx.SetSeqCompareOptions(&SeqComparatorOptions{
+			K:         uint8(31),
+			MinPrefix: 11,
+
+			Chaining2Options: Chaining2Options{
+				MaxGap:      20,
+				MinScore:    int(float64(minAlignLen) * minIdent / 100),
+				MinAlignLen: minAlignLen,
+				MinIdentity: minIdent,
+				BandBase:    100,
+				BandCount:   50,
+
+				HeuristicKmerPidentThreshold: 15,
+			},
+
+			MinAlignedFraction: minQcov,
+			MinIdentity:        minIdent,
+		})
+
+		name2idx, err := readGenomeMapName2Idx(filepath.Join(dbDir, FileGenomeIndex))
+		if err != nil {
+			checkError(fmt.Errorf("failed to read genomes index mapping file: %s", err))
+		}
+		genomes := make([]string, 0, len(name2idx))
+		for name := range name2idx {
+			genomes = append(genomes, name)
+		}
+		slices.Sort(genomes)
+
+		if outputLog {
+			log.Infof("index loaded in %s", time.Since(timeStart))
+			log.Info()
+		}
+
+		// ---------------------------------------------------------------
+		// typing
+
+		if outputLog {
+			log.Infof("typing %d genomes with %d loci ...", len(genomes), len(loci))
+		}
+
+		// genome -> calls of all loci
+		calls := make(map[string][]*TypingCall, len(genomes))
+		for _, name := range genomes {
+			calls[name] = make([]*TypingCall, len(loci))
+		}
+		var mu sync.Mutex
+
+		id2name := idx.BatchGenomeIndex2GenomeID
+
+		var wg sync.WaitGroup
+		tokens := make(chan int, maxQueryConcurrency)
+		var nDone int
+		for i, locus := range loci {
+			tokens <- 1
+			wg.Add(1)
+
+			go func(i int, locus *TypingLocus) {
+				defer func() {
+					<-tokens
+					wg.Done()
+				}()
+
+				query := poolQuery.Get().(*Query)
+				query.Reset()
+				query.seqID = append(query.seqID, locus.RepID...)
+				query.seq = append(query.seq, locus.Rep...)
+
+				if len(query.seq) >= idx.k {
+					var err error
+					query.result, err = idx.Search(query, nil, false)
+					checkError(err)
+				}
+
+				if query.result != nil {
+					for _, r := range *query.result {
+						name := string(id2name[r.BatchGenomeIndex])
+
+						sd, c := typingBestHSP(r)
+						if c == nil || c.AlignedFraction < minQcov {
+							continue
+						}
+
+						call, err := locus.Call(idx, name2idx[name], name, sd, c, minQcovComplete)
+						checkError(err)
+
+						mu.Lock()
+						// a genome might be split into multiple chunks, keep the better one
+						if pre := calls[name][i]; pre == nil || call.BitScore > pre.BitScore {
+							calls[name][i] = call
+						}
+						mu.Unlock()
+					}
+
+					idx.RecycleSearchResults(query.result)
+				}
+				poolQuery.Put(query)
+
+				mu.Lock()
+				nDone++
+				if opt.Verbose && (nDone&15 == 0 || nDone == len(loci)) {
+					fmt.Fprintf(os.Stderr, "\rprocessed loci: %d/%d", nDone, len(loci))
+				}
+				mu.Unlock()
+			}(i, locus)
+		}
+		wg.Wait()
+		if opt.Verbose {
+			fmt.Fprintln(os.Stderr)
+		}
+
+		// ---------------------------------------------------------------
+		// output
+
+		outfh, gw, w, err := outStream(outFile, strings.HasSuffix(outFile, ".gz"), opt.CompressionLevel)
+		checkError(err)
+		defer func() {
+			outfh.Flush()
+			if gw != nil {
+				gw.Close()
+			}
+			w.Close()
+		}()
+
+		outfh.WriteString("genome")
+		if profiles != nil {
+			outfh.WriteString("\tST")
+		}
+		for _, locus := range loci {
+			outfh.WriteString("\t")
+			outfh.WriteString(locus.Name)
+		}
+		outfh.WriteString("\n")
+
+		key := make([]string, len(profileLoci))
+		var st string
+		var ok bool
+		var nTyped int
+		for _, name := range genomes {
+			outfh.WriteString(name)
+
+			if profiles != nil {
+				for j, i := range profileLoci {
+					if calls[name][i] == nil {
+						key[j] = TypingNotFound
+					} else {
+						key[j] = calls[name][i].Allele
+					}
+				}
+				if st, ok = profiles[strings.Join(key, "\t")]; ok {
+					nTyped++
+				} else {
+					st = TypingNotFound
+				}
+				outfh.WriteString("\t")
+				outfh.WriteString(st)
+			}
+
+			for _, call := range calls[name] {
+				outfh.WriteString("\t")
+				if call == nil {
+					outfh.WriteString(TypingNotFound)
+				} else {
+					outfh.WriteString(call.Allele)
+				}
+			}
+			outfh.WriteString("\n")
+		}
+
+		if outputLog {
+			log.Infof("allele profiles of %d genomes saved to: %s", len(genomes), outFile)
+			if profiles != nil {
+				log.Infof("  %d genomes are assigned with STs", nTyped)
+			}
+		}
+
+		if fileDetails != "" {
+			dfh, dgw, dw, err := outStream(fileDetails, strings.HasSuffix(fileDetails, ".gz"), opt.CompressionLevel)
+			checkError(err)
+
+			fmt.Fprintf(dfh, "genome\tlocus\tallele\tsseqid\tsstart\tsend\tsstr\tqcovHSP\tpident\n")
+			for _, name := range genomes {
+				for i, call := range calls[name] {
+					if call == nil {
+						continue
+					}
+					fmt.Fprintf(dfh, "%s\t%s\t%s\t%s\t%d\t%d\t%c\t%.3f\t%.3f\n",
+						name, loci[i].Name, call.Allele, call.SeqID, call.Start, call.End,
+						call.Strand, call.Qcov, call.Pident)
+				}
+			}
+
+			dfh.Flush()
+			if dgw != nil {
+				dgw.Close()
+			}
+			dw.Close()
+
+			if outputLog {
+				log.Infof("details of calls saved to: %s", fileDetails)
+			}
+		}
+
+		if fileNovel != "" {
+			nfh, ngw, nw, err := outStream(fileNovel, strings.HasSuffix(fileNovel, ".gz"), opt.CompressionLevel)
+			checkError(err)
+
+			var n int
+			for _, name := range genomes {
+				for i, call := range calls[name] {
+					if call == nil || call.Allele != TypingNovel {
+						continue
+					}
+					fmt.Fprintf(nfh, ">%s|%s|%s:%d-%d:%c\n%s\n",
+						loci[i].Name, name, call.SeqID, call.Start, call.End, call.Strand, call.Seq)
+					n++
+				}
+			}
+
+			nfh.Flush()
+			if ngw != nil {
+				ngw.Close()
+			}
+			nw.Close()
+
+			if outputLog {
+				log.Infof("%d novel alleles saved to: %s", n, fileNovel)
+			}
+		}
+	},
+}
+
+func init() {
+	utilsCmd.AddCommand(typingCmd)
+
+	typingCmd.Flags().StringP("index", "d", "",
+		formatFlagUsage(`Index directory created by "lexicmap index".`))
+
+	typingCmd.Flags().StringP("out-file", "o", "-",
+		formatFlagUsage(`Out file of allele profiles, supports the ".gz" suffix ("-" for stdout).`))
+
+	typingCmd.Flags().StringP("profile", "p", "",
+		formatFlagUsage(`Profile table for assigning sequence types, with the first column being the ST.`))
+
+	typingCmd.Flags().StringP("allele-id-regexp", "r", `[_\-]([^_\-]+)$`,
+		formatFlagUsage(`Regular expression for extracting the allele number from the sequence ID of an allele. If not matched, the whole sequence ID is used.`))
+
+	typingCmd.Flags().StringP("details", "", "",
+		formatFlagUsage(`Out file of the details of all calls.`))
+
+	typingCmd.Flags().StringP("novel-alleles", "", "",
+		formatFlagUsage(`Out file of novel allele sequences in FASTA format.`))
+
+	typingCmd.Flags().Float64P("align-min-match-pident", "i", 80,
+		formatFlagUsage(`Minimum base identity (percentage) in a HSP segment.`))
+
+	typingCmd.Flags().Float64P("min-qcov", "q", 50,
+		formatFlagUsage(`Minimum query coverage (percentage) of the best HSP for a locus to be considered found.`))
+
+	typingCmd.Flags().Float64P("min-qcov-complete", "Q", 90,
+		formatFlagUsage(`Minimum query coverage (percentage) of the best HSP for a novel allele. Loci with lower coverage are flagged as PARTIAL.`))
+
+	typingCmd.Flags().IntP("max-open-files", "", 1024,
+		formatFlagUsage(`Maximum opened files. It mainly affects candidate subsequence extraction. Increase this value if you have hundreds of genome batches, and do not forgot to set a bigger "ulimit -n" in shell if the value is > 1024.`))
+
+	typingCmd.Flags().IntP("max-query-conc", "J", 8,
+		formatFlagUsage(`Maximum number of concurrent loci to search.`))
+
+	typingCmd.Flags().BoolP("load-whole-seeds", "w", false,
+		formatFlagUsage(`Load the whole seed data into memory for faster seed matching. It will consume a lot of RAM.`))
+
+	typingCmd.SetUsageTemplate(usageTemplate("-d <index path> [locus.fasta[.gz] ...] [-p profiles.tsv] [-o profile.tsv]"))
+}
+
+// Flags of non-exact allele calls.
+const (
+	TypingNotFound = "-"
+	TypingNovel    = "NOVEL"
+	TypingPartial  = "PARTIAL"
+	TypingEdge     = "EDGE"
+)
+
+// TypingLocus represents a locus in a typing scheme.
+type TypingLocus struct {
+	Name string
+
+	RepID string // ID of the representative allele
+	Rep   []byte // sequence of the representative allele
+
+	Alleles map[string]string // allele sequence -> allele number
+	Lens    []int             // distinct allele lengths
+	MaxLen  int
+}
+
+// TypingCall is an allele call of a locus in a genome.
+type TypingCall struct {
+	Allele string // allele number or a flag
+
+	SeqID  string
+	Start  int // 1-based
+	End    int // 1-based
+	Strand byte
+
+	Qcov     float64
+	Pident   float64
+	BitScore int
+
+	Seq []byte // sequence of a novel allele
+}
+
+// readTypingLocus reads alleles of a locus from a FASTA file.
+func readTypingLocus(file string, reAlleleID *regexp.Regexp) (*TypingLocus, error) {
+	name, _, _ := filepathTrimExtension(filepath.Base(file), nil)
+
+	locus := &TypingLocus{
+		Name:    name,
+		Alleles: make(map[string]string, 64),
+		Lens:    make([]int, 0, 8),
+	}
+
+	fastxReader, err := fastx.NewReader(nil, file, "")
+	if err != nil {
+		return nil, err
+	}
+	defer fastxReader.Close()
+
+	var record *fastx.Record
+	var id string
+	var found []string
+	for {
+		record, err = fastxReader.Read()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, fmt.Errorf("%s: %s", file, err)
+		}
+
+		id = string(record.ID)
+		found = reAlleleID.FindStringSubmatch(id)
+		if len(found) > 1 {
+			id = found[1]
+		}
+
+		s := []byte(strings.ToUpper(string(record.Seq.Seq)))
+		if _, ok := locus.Alleles[string(s)]; ok {
+			continue
+		}
+		locus.Alleles[string(s)] = id
+
+		if locus.Rep == nil {
+			locus.RepID = string(record.ID)
+			locus.Rep = s
+		}
+
+		if !slices.Contains(locus.Lens, len(s)) {
+			locus.Lens = append(locus.Lens, len(s))
+		}
+		if len(s) > locus.MaxLen {
+			locus.MaxLen = len(s)
+		}
+	}
+
+	if locus.Rep == nil {
+		return nil, fmt.Errorf("no alleles found in file: %s", file)
+	}
+
+	return locus, nil
+}
+
+// readTypingProfiles reads a profile table, and returns a map of profiles
+// (allele numbers of loci joined with tabs) to STs, and indexes of loci
+// in the profile table.
+func readTypingProfiles(file string, locusIdx map[string]int) (map[string]string, []int, error) {
+	fh, err := xopen.Ropen(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer fh.Close()
+
+	profiles := make(map[string]string, 1024)
+	var loci []int
+	var cols []int // columns of loci
+
+	scanner := bufio.NewScanner(fh)
+	scanner.Buffer(make([]byte, 1<<20), 1<<30)
+	var line string
+	var items []string
+	var key []string
+	headerLine := true
+	for scanner.Scan() {
+		line = strings.TrimRight(scanner.Text(), "\r\n")
+		if line == "" {
+			continue
+		}
+		items = strings.Split(line, "\t")
+
+		if headerLine {
+			headerLine = false
+
+			for j, name := range items[1:] {
+				if i, ok := locusIdx[name]; ok {
+					loci = append(loci, i)
+					cols = append(cols, j+1)
+				}
+			}
+			if len(loci) == 0 {
+				return nil, nil, fmt.Errorf("no loci in the scheme found in the header row of profile file: %s", file)
+			}
+			key = make([]string, len(cols))
+			continue
+		}
+
+		for j, c := range cols {
+			if c >= len(items) {
+				return nil, nil, fmt.Errorf("invalid profile, too few columns: %s", line)
+			}
+			key[j] = items[c]
+		}
+		profiles[strings.Join(key, "\t")] = items[0]
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return profiles, loci, nil
+}
+
+// typingBestHSP returns the HSP with the highest bit score in a genome.
+func typingBestHSP(r *SearchResult) (*SimilarityDetail, *Chain2Result) {
+	var best *Chain2Result
+	var bestSD *SimilarityDetail
+	for _, sd := range *r.SimilarityDetails {
+		for _, c := range *sd.Similarity.Chains {
+			if c == nil {
+				continue
+			}
+			if best == nil || c.BitScore > best.BitScore {
+				best, bestSD = c, sd
+			}
+		}
+	}
+	return bestSD, best
+}
+
+// Call extracts the full-length region of the locus with the help of the HSP
+// of the representative allele, and assigns the allele number.
+func (locus *TypingLocus) Call(idx *Index, batchIDAndRefIDs *[]uint64, name string,
+	sd *SimilarityDetail, c *Chain2Result, minQcovComplete float64) (*TypingCall, error) {
+
+	call := &TypingCall{
+		SeqID:    string(sd.SeqID),
+		Qcov:     c.AlignedFraction,
+		Pident:   c.PIdent,
+		BitScore: c.BitScore,
+	}
+
+	qlen := len(locus.Rep)
+	// the expected length of the locus in the genome
+	novelLen := c.TEnd - c.TBegin + 1 + c.QBegin + (qlen - 1 - c.QEnd)
+	want := max(locus.MaxLen, novelLen)
+
+	// 0-based positions of the region to extract
+	var start, end int
+	if sd.RC {
+		call.Strand = '-'
+		end = c.TEnd + c.QBegin
+		start = end - want + 1
+		if end >= sd.SeqLen {
+			call.Allele = TypingEdge
+			call.Start, call.End = c.TBegin+1, c.TEnd+1
+			return call, nil
+		}
+	} else {
+		call.Strand = '+'
+		start = c.TBegin - c.QBegin
+		end = start + want - 1
+		if start < 0 {
+			call.Allele = TypingEdge
+			call.Start, call.End = c.TBegin+1, c.TEnd+1
+			return call, nil
+		}
+	}
+	start = max(start, 0)
+
+	tSeq, _, err := idx.SubSeq2(batchIDAndRefIDs, sd.SeqID, start, end)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract subsequence of %s from %s:%d-%d: %s", locus.Name, name, start+1, end+1, err)
+	}
+	s, err := seq.NewSeq(seq.DNAredundant, []byte(string(tSeq.Seq)))
+	genome.RecycleGenome(tSeq)
+	if err != nil {
+		return nil, err
+	}
+	if sd.RC {
+		s.RevComInplace()
+	}
+	available := len(s.Seq)
+
+	// exact matches of all allele lengths, the one closest to the expected length is chosen
+	var allele string
+	var ok bool
+	var L, d, bestD int
+	for _, L = range locus.Lens {
+		if L > available {
+			continue
+		}
+		if allele, ok = locus.Alleles[string(s.Seq[:L])]; !ok {
+			continue
+		}
+		d = L - novelLen
+		if d < 0 {
+			d = -d
+		}
+		if call.Allele == "" || d < bestD {
+			call.Allele, bestD = allele, d
+			if sd.RC {
+				call.Start, call.End = end-L+2, end+1
+			} else {
+				call.Start, call.End = start+1, start+L
+			}
+		}
+	}
+	if call.Allele != "" {
+		return call, nil
+	}
+
+	// not found
+	call.Start, call.End = c.TBegin+1, c.TEnd+1
+	if novelLen > available { // reaching the end of the contig
+		call.Allele = TypingEdge
+		return call, nil
+	}
+	if c.AlignedFraction < minQcovComplete {
+		call.Allele = TypingPartial
+		return call, nil
+	}
+
+	call.Allele = TypingNovel
+	call.Seq = s.Seq[:min(novelLen, available)]
+	if sd.RC {
+		call.Start, call.End = end-len(call.Seq)+2, end+1
+	} else {
+		call.Start, call.End = start+1, start+len(call.Seq)
+	}
+	return call, nil
+}
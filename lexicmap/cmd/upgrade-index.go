@@ -0,0 +1,504 @@
+// Copyright © 2023-2026 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shenwei356/LexicMap/lexicmap/cmd/kv"
+	"github.com/shenwei356/bio/seq"
+	"github.com/shenwei356/util/pathutil"
+	"github.com/spf13/cobra"
+)
+
+var upgradeIndexCmd = &cobra.Command{
+	Use:   "upgrade-index",
+	Short: "Upgrade an index created by an older version of LexicMap",
+	Long: `Upgrade an index created by an older version of LexicMap
+
+This command detects the index version in info.toml, and applies the chain of required
+transformations, either in place (--in-place) or into a new directory (-O/--out-dir).
+Please check the index format changelog (INDEX_FORMAT_CHANGELOG.tsv) for details.
+
+Transformations:
+
+  Index version   Transformation
+  <3.0            None. A full rebuild is unavoidable, as the seed data format, seed desert
+                  filling, and contig intervals were changed in 3.0 (LexicMap v0.4.0).
+  3.0             Reindexing seeds with the default partitions (--partitions) since 3.1.
+  <=3.2           Rewriting seeds with 3-byte seed positions for indexes with <= 512 genome batches,
+                  and counting the total bases, which is used for computing E-values.
+                  The index version is updated to 3.3 after these steps.
+
+  Seeds changes in later versions can't be applied without recomputing seeds from the
+  genome sequences, i.e., rebuilding the index. They are optional, because upgraded and
+  old 3.x indexes are still supported by "lexicmap search":
+  3.3             Denser seeds.
+  3.4             Fixed filling the seed desert region behind the last seed of a genome.
+  3.5             A small part of seeds are changed after fixing the LexicHash computation.
+                  Indexes <3.5 are searched with the backward-compatible masking.
+
+Attention:
+  1. Making a copy of the index before the in-place upgrading is recommended.
+  2. Please use --dry-run to check the transformations.
+  3. The manifest of file checksums (manifest.tsv) is recreated.
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		opt := getOptions(cmd)
+		seq.ValidateSeq = false
+
+		var fhLog *os.File
+		if opt.Log2File {
+			fhLog = addLog(opt.LogFile, opt.Verbose)
+		}
+
+		outputLog := opt.Verbose || opt.Log2File
+
+		timeStart := time.Now()
+		defer func() {
+			if outputLog {
+				log.Info()
+				log.Infof("elapsed time: %s", time.Since(timeStart))
+				log.Info()
+			}
+			if opt.Log2File {
+				fhLog.Close()
+			}
+		}()
+
+		// ---------------------------------------------------------------
+
+		dbDir := getFlagString(cmd, "index")
+		if dbDir == "" {
+			checkError(fmt.Errorf("flag -d/--index needed"))
+		}
+		dbDir = filepath.Clean(dbDir)
+
+		outDir := getFlagString(cmd, "out-dir")
+		inPlace := getFlagBool(cmd, "in-place")
+		force := getFlagBool(cmd, "force")
+		dryRun := getFlagBool(cmd, "dry-run")
+
+		partitions := getFlagPositiveInt(cmd, "partitions")
+		changePartitions := cmd.Flags().Lookup("partitions").Changed
+
+		if !dryRun {
+			if outDir == "" && !inPlace {
+				checkError(fmt.Errorf("one of the flags -O/--out-dir and --in-place is needed"))
+			}
+			if outDir != "" && inPlace {
+				checkError(fmt.Errorf("flags -O/--out-dir and --in-place are incompatible"))
+			}
+		}
+		if outDir != "" {
+			outDir = filepath.Clean(outDir)
+			if outDir == dbDir {
+				checkError(fmt.Errorf("intput and output paths should not be the same: %s", outDir))
+			}
+		}
+
+		info, err := readIndexInfo(filepath.Join(dbDir, FileInfo))
+		if err != nil {
+			checkError(fmt.Errorf("failed to read info file: %s", err))
+		}
+
+		// ---------------------------------------------------------------
+		// plan
+
+		steps, notes, err := planIndexUpgrade(info, partitions, changePartitions)
+		if err != nil {
+			checkError(err)
+		}
+
+		if dryRun {
+			fmt.Printf("index version: %d.%d\n", info.MainVersion, info.MinorVersion)
+			if len(steps) == 0 {
+				fmt.Println("transformations: none, the index is up to date")
+			} else {
+				fmt.Println("transformations:")
+				for i, s := range steps {
+					fmt.Printf("  %d. %s: %s\n", i+1, s.Name, s.Reason)
+				}
+			}
+			if len(notes) > 0 {
+				fmt.Println("optional changes requiring a rebuild:")
+				for _, n := range notes {
+					fmt.Printf("  - %s\n", n)
+				}
+			}
+			return
+		}
+
+		if outputLog {
+			log.Infof("index version: %d.%d", info.MainVersion, info.MinorVersion)
+			for i, s := range steps {
+				log.Infof("  transformation %d/%d, %s: %s", i+1, len(steps), s.Name, s.Reason)
+			}
+			for _, n := range notes {
+				log.Infof("  optional change requiring a rebuild: %s", n)
+			}
+		}
+
+		if len(steps) == 0 {
+			if outputLog {
+				log.Infof("the index is up to date, nothing to do")
+			}
+			return
+		}
+
+		// ---------------------------------------------------------------
+		// copy the index
+
+		dir := dbDir
+		if outDir != "" {
+			makeOutDir(outDir, force, "out-dir", outputLog)
+
+			if outputLog {
+				log.Infof("copying index files to %s ...", outDir)
+			}
+			err = copyIndexDir(dbDir, info, outDir, opt.NumCPUs)
+			if err != nil {
+				checkError(fmt.Errorf("failed to copy index files: %s", err))
+			}
+			dir = outDir
+
+			// all shards are copied into the new index directory
+			info.Shards, info.ChunkShards, info.BatchShards = nil, nil, nil
+		}
+
+		// ---------------------------------------------------------------
+		// transformations
+
+		for i, s := range steps {
+			if outputLog {
+				log.Infof("[%d/%d] %s ...", i+1, len(steps), s.Name)
+			}
+			err = s.apply(dir, info, opt.NumCPUs)
+			if err != nil {
+				checkError(fmt.Errorf("failed to %s: %s", s.Name, err))
+			}
+		}
+
+		// update the index version
+		upgradeIndexVersion(info)
+		err = writeIndexInfo(filepath.Join(dir, FileInfo), info)
+		if err != nil {
+			checkError(fmt.Errorf("failed to write info file: %s", err))
+		}
+
+		// sizes and checksums of index files
+		bopt := &IndexBuildingOptions{
+			NumCPUs:   opt.NumCPUs,
+			Verbose:   opt.Verbose,
+			Log2File:  opt.Log2File,
+			Checksums: !getFlagBool(cmd, "no-checksums"),
+		}
+		checkError(saveIndexManifest(dir, bopt))
+
+		if outputLog {
+			log.Infof("index upgraded to version %d.%d: %s", info.MainVersion, info.MinorVersion, dir)
+		}
+	},
+}
+
+func init() {
+	utilsCmd.AddCommand(upgradeIndexCmd)
+
+	upgradeIndexCmd.Flags().StringP("index", "d", "",
+		formatFlagUsage(`Index directory created by "lexicmap index".`))
+
+	upgradeIndexCmd.Flags().StringP("out-dir", "O", "",
+		formatFlagUsage(`Output directory of the upgraded index. The original index is not changed.`))
+
+	upgradeIndexCmd.Flags().BoolP("in-place", "", false,
+		formatFlagUsage(`Upgrade the index in place.`))
+
+	upgradeIndexCmd.Flags().BoolP("force", "", false,
+		formatFlagUsage(`Overwrite existing output directory.`))
+
+	upgradeIndexCmd.Flags().BoolP("dry-run", "n", false,
+		formatFlagUsage(`Only show the index version and transformations to apply.`))
+
+	upgradeIndexCmd.Flags().IntP("partitions", "", 4096,
+		formatFlagUsage(`Number of partitions for indexing seeds (k-mer-value data) files. The value needs to be the power of 4. It's only used for indexes of version 3.0 by default, and seeds of other versions are also reindexed if the flag is given with a different value.`))
+
+	upgradeIndexCmd.Flags().BoolP("no-checksums", "", false,
+		formatFlagUsage(`Do not compute SHA-256 checksums of index files in the manifest file (manifest.tsv), only file sizes are recorded.`))
+
+	upgradeIndexCmd.SetUsageTemplate(usageTemplate("-d <index path> {-O <out dir> | --in-place} [-n]"))
+}
+
+// upgradeIndexMinorVersion is the highest minor version that an index can be upgraded to
+// without recomputing seeds.
+const upgradeIndexMinorVersion uint8 = 3
+
+// upgradeIndexVersion updates the minor version of an upgraded index.
+// Indexes of newer minor versions keep their versions, which decide how queries are masked.
+func upgradeIndexVersion(info *IndexInfo) {
+	info.MinorVersion = max(info.MinorVersion, upgradeIndexMinorVersion)
+}
+
+// indexUpgradeStep is a transformation in upgrading an index.
+type indexUpgradeStep struct {
+	Name   string
+	Reason string
+
+	apply func(dir string, info *IndexInfo, threads int) error
+}
+
+// planIndexUpgrade returns the transformations for upgrading an index,
+// and notes of optional seed changes requiring a rebuild.
+func planIndexUpgrade(info *IndexInfo, partitions int, changePartitions bool) ([]*indexUpgradeStep, []string, error) {
+	if info.MainVersion > MainVersion ||
+		(info.MainVersion == MainVersion && info.MinorVersion > MinorVersion) {
+		return nil, nil, fmt.Errorf("the index (version %d.%d) was created by a newer version of LexicMap, please update LexicMap",
+			info.MainVersion, info.MinorVersion)
+	}
+	if info.MainVersion < MainVersion {
+		return nil, nil, fmt.Errorf("the index (version %d.%d) can't be upgraded, "+
+			"because the seed data format, seed desert filling, and contig intervals were changed in index version %d.0 (LexicMap v0.4.0). "+
+			`please rebuild the index with "lexicmap index"`,
+			info.MainVersion, info.MinorVersion, MainVersion)
+	}
+
+	minor := info.MinorVersion
+	steps := make([]*indexUpgradeStep, 0, 4)
+
+	if !changePartitions && minor > 0 && info.Partitions > 0 {
+		partitions = info.Partitions // keep the value
+	}
+	maskPrefix, anchorPrefix := seedPrefixes(info.Masks, partitions)
+
+	if minor < 3 && info.GenomeBatches <= 512 {
+		steps = append(steps, &indexUpgradeStep{
+			Name:   "rewrite seeds",
+			Reason: fmt.Sprintf("using 3-byte seed positions for %d genome batches (<= 512) since 3.3, with %d partitions for indexing", info.GenomeBatches, partitions),
+			apply: func(dir string, info *IndexInfo, threads int) error {
+				err := forEachSeedChunk(dir, info, threads, func(file string) error {
+					return rewriteSeedChunk(file, maskPrefix, anchorPrefix, true)
+				})
+				if err != nil {
+					return err
+				}
+				info.Partitions = partitions
+				return nil
+			},
+		})
+	} else if partitions != info.Partitions {
+		steps = append(steps, &indexUpgradeStep{
+			Name:   "reindex seeds",
+			Reason: fmt.Sprintf("changing partitions for indexing seeds from %d to %d", info.Partitions, partitions),
+			apply: func(dir string, info *IndexInfo, threads int) error {
+				err := forEachSeedChunk(dir, info, threads, func(file string) error {
+					return kv.CreateKVIndex(file, partitions)
+				})
+				if err != nil {
+					return err
+				}
+				info.Partitions = partitions
+				return nil
+			},
+		})
+	}
+
+	if minor < 3 {
+		steps = append(steps, &indexUpgradeStep{
+			Name:   "recount bases",
+			Reason: "the total bases are saved in info.toml since 3.3, which are used for computing E-values",
+			apply: func(dir string, info *IndexInfo, threads int) error {
+				_, err := updateInputBases(info, dir, threads)
+				return err
+			},
+		})
+	}
+
+	notes := make([]string, 0, 3)
+	if minor < 3 {
+		notes = append(notes, "3.3, denser seeds")
+	}
+	if minor < 4 {
+		notes = append(notes, "3.4, fixed filling the seed desert region behind the last seed of a genome")
+	}
+	if minor < 5 {
+		notes = append(notes, "3.5, a small part of seeds are changed after fixing the LexicHash computation")
+	}
+
+	return steps, notes, nil
+}
+
+// forEachSeedChunk runs a function for all seed data files in parallel.
+func forEachSeedChunk(dir string, info *IndexInfo, threads int, fn func(file string) error) error {
+	layout, err := NewIndexLayout(dir, info)
+	if err != nil {
+		return err
+	}
+
+	chunks := info.Chunks
+	var wg sync.WaitGroup
+	tokens := make(chan int, threads)
+	errs := make([]error, chunks)
+	for chunk := 0; chunk < chunks; chunk++ {
+		wg.Add(1)
+		tokens <- 1
+		go func(chunk int) {
+			defer func() {
+				<-tokens
+				wg.Done()
+			}()
+			errs[chunk] = fn(layout.SeedFile(chunk))
+		}(chunk)
+	}
+	wg.Wait()
+
+	for chunk, err := range errs {
+		if err != nil {
+			return fmt.Errorf("%s: %s", chunkFile(chunk), err)
+		}
+	}
+	return nil
+}
+
+// rewriteSeedChunk rewrites a seed data file and its index file, with the seed position
+// encoding and partitions changed. New files are written to temporary files first.
+func rewriteSeedChunk(file string, maskPrefix uint8, anchorPrefix uint8, use3BytesForSeedPos bool) error {
+	rdr, err := kv.NewReader(file)
+	if err != nil {
+		return err
+	}
+	defer rdr.Close()
+
+	fileNew := file + ExtTmpDir
+	wtr, err := kv.NewWriter(rdr.K, rdr.ChunkIndex, rdr.ChunkSize, fileNew, maskPrefix, anchorPrefix, use3BytesForSeedPos)
+	if err != nil {
+		return err
+	}
+
+	var m *map[uint64]*[]uint64
+	for i := 0; i < rdr.ChunkSize; i++ {
+		m, err = rdr.ReadDataOfAMaskAsMap()
+		if err != nil {
+			return fmt.Errorf("failed to read data of mask %d: %s", rdr.ChunkIndex+i, err)
+		}
+		err = wtr.WriteDataOfAMask(*m)
+		if err != nil {
+			return fmt.Errorf("failed to write data of mask %d: %s", rdr.ChunkIndex+i, err)
+		}
+		kv.RecycleKmerData(m)
+	}
+
+	err = wtr.Close()
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(fileNew, file)
+	if err != nil {
+		return err
+	}
+	return os.Rename(fileNew+kv.KVIndexFileExt, file+kv.KVIndexFileExt)
+}
+
+// copyIndexDir copies all files of an index to another directory,
+// temporary directories are skipped.
+// Files in shard roots are also copied into the new directory.
+func copyIndexDir(src string, info *IndexInfo, dst string, threads int) error {
+	layout, err := NewIndexLayout(src, info)
+	if err != nil {
+		return err
+	}
+
+	files := make([]string, 0, 1024)
+	paths := make([]string, 0, 1024)
+	err = layout.Walk(func(p string, fpath string, d fs.DirEntry) error {
+		for _, name := range strings.Split(path.Dir(p), "/") {
+			if strings.HasSuffix(name, ExtTmpDir) {
+				return nil
+			}
+		}
+		files = append(files, p)
+		paths = append(paths, fpath)
+		return os.MkdirAll(filepath.Join(dst, path.Dir(p)), 0755)
+	})
+	if err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	tokens := make(chan int, threads)
+	errs := make([]error, len(files))
+	for i, file := range files {
+		wg.Add(1)
+		tokens <- 1
+		go func(i int, file string) {
+			defer func() {
+				<-tokens
+				wg.Done()
+			}()
+			errs[i] = copyFile(paths[i], filepath.Join(dst, file))
+		}(i, file)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return fmt.Errorf("%s: %s", files[i], err)
+		}
+	}
+	return nil
+}
+
+// copyFile copies a file.
+func copyFile(src, dst string) error {
+	ok, err := pathutil.Exists(src)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("file not found: %s", src)
+	}
+
+	fh, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer fh.Close()
+
+	outfh, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(outfh, fh)
+	if err != nil {
+		outfh.Close()
+		return err
+	}
+	return outfh.Close()
+}
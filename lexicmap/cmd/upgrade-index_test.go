@@ -0,0 +1,55 @@
+// Copyright © 2023-2026 Wei Shen <shenwei356@gmail.com>
+
+package cmd
+
+import "testing"
+
+func TestPlanIndexUpgrade(t *testing.T) {
+	// 3.5 index with changed partitions: only reindexing seeds
+	info := &IndexInfo{MainVersion: 3, MinorVersion: 5, Masks: 20000, Partitions: 4096, GenomeBatches: 10}
+	steps, notes, err := planIndexUpgrade(info, 1024, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(steps) != 1 || steps[0].Name != "reindex seeds" {
+		t.Fatalf("unexpected steps: %d", len(steps))
+	}
+	if len(notes) != 0 {
+		t.Errorf("unexpected notes: %v", notes)
+	}
+	upgradeIndexVersion(info)
+	if info.MinorVersion != 5 {
+		t.Errorf("unexpected minor version: %d, want 5", info.MinorVersion)
+	}
+
+	// 3.5 index with the same partitions: nothing to do
+	steps, _, err = planIndexUpgrade(info, 4096, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(steps) != 0 {
+		t.Errorf("unexpected steps: %d", len(steps))
+	}
+
+	// 3.0 index: rewriting seeds and recounting bases
+	info = &IndexInfo{MainVersion: 3, MinorVersion: 0, Masks: 20000, GenomeBatches: 10}
+	steps, notes, err = planIndexUpgrade(info, 4096, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(steps) != 2 || steps[0].Name != "rewrite seeds" || steps[1].Name != "recount bases" {
+		t.Fatalf("unexpected steps: %d", len(steps))
+	}
+	if len(notes) != 3 {
+		t.Errorf("unexpected notes: %v", notes)
+	}
+	upgradeIndexVersion(info)
+	if info.MinorVersion != upgradeIndexMinorVersion {
+		t.Errorf("unexpected minor version: %d, want %d", info.MinorVersion, upgradeIndexMinorVersion)
+	}
+
+	// indexes of older main versions can't be upgraded
+	if _, _, err = planIndexUpgrade(&IndexInfo{MainVersion: 2}, 4096, false); err == nil {
+		t.Errorf("an error expected for index version 2.0")
+	}
+}
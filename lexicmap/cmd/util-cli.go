@@ -159,6 +159,19 @@ func getFlagCommaSeparatedInts(cmd *cobra.Command, flag string) []int {
 	return fields
 }
 
+func getFlagCommaSeparatedFloat64s(cmd *cobra.Command, flag string) []float64 {
+	filedsStrList := getFlagCommaSeparatedStrings(cmd, flag)
+	fields := make([]float64, len(filedsStrList))
+	for i, value := range filedsStrList {
+		v, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			checkError(fmt.Errorf("value of flag --%s should be comma separated numbers", flag))
+		}
+		fields[i] = v
+	}
+	return fields
+}
+
 func getFlagRune(cmd *cobra.Command, flag string) rune {
 	value, err := cmd.Flags().GetString(flag)
 	checkError(err)
@@ -0,0 +1,214 @@
+// Copyright © 2023-2026 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package util
+
+import "slices"
+
+var dustBase2bit = func() (t [256]uint8) {
+	for i := range t {
+		t[i] = 4
+	}
+	t['A'], t['C'], t['G'], t['T'] = 0, 1, 2, 3
+	t['a'], t['c'], t['g'], t['t'] = 0, 1, 2, 3
+	return t
+}()
+
+// dustInvalid is the code of 3-mers containing bases other than ACGT.
+const dustInvalid = 64
+
+// DustRegions finds low-complexity regions in a DNA sequence with a DUST-style algorithm,
+// and appends them as 0-based closed intervals to regions, which are then sorted and merged.
+//
+// A window of the given length is low-complexity if the score of 3-mers,
+// sum(c_t * (c_t - 1) / 2) / (l - 1), is bigger than level / 10, where c_t is the
+// count of 3-mer t and l is the number of 3-mers. Overlapping low-complexity windows are
+// merged into runs, and for windows moved by half of the window size in each run,
+// only the sub-intervals with the highest scores are masked, so flanking bases are kept.
+// The default values in DUST are 64 for the window and 20 for the level.
+func DustRegions(s []byte, window int, level int, regions [][2]int) [][2]int {
+	if len(s) < 4 || window < 4 {
+		return regions
+	}
+	window = min(window, len(s))
+
+	// 3-mer codes
+	trips := make([]uint8, len(s)-2)
+	var a, b, c uint8
+	for i := range trips {
+		a, b, c = dustBase2bit[s[i]], dustBase2bit[s[i+1]], dustBase2bit[s[i+2]]
+		if a > 3 || b > 3 || c > 3 {
+			trips[i] = dustInvalid
+		} else {
+			trips[i] = a<<4 | b<<2 | c
+		}
+	}
+
+	var counts [dustInvalid + 1]int
+	var sum, l int // sum of c_t * (c_t - 1) / 2, and the number of valid 3-mers
+	add := func(t uint8) {
+		if t != dustInvalid {
+			sum += counts[t]
+			counts[t]++
+			l++
+		}
+	}
+	remove := func(t uint8) {
+		if t != dustInvalid {
+			counts[t]--
+			sum -= counts[t]
+			l--
+		}
+	}
+
+	w := window - 2 // number of 3-mers in a window
+	for i := 0; i < w; i++ {
+		add(trips[i])
+	}
+
+	n := len(regions)
+	runStart, runEnd := -1, -1 // 3-mers covered by a run of overlapping low-complexity windows
+	for start := 0; ; start++ {
+		end := start + w - 1 // the last 3-mer
+
+		if l > 1 && sum*10 > level*(l-1) {
+			if runStart < 0 {
+				runStart = start
+			}
+			runEnd = end
+		} else if runStart >= 0 {
+			regions = dustRun(trips, runStart, runEnd, w, regions)
+			runStart = -1
+		}
+
+		if end+1 >= len(trips) {
+			break
+		}
+		remove(trips[start])
+		add(trips[end+1])
+	}
+	if runStart >= 0 {
+		regions = dustRun(trips, runStart, runEnd, w, regions)
+	}
+
+	if len(regions) > n {
+		return MergeRegions(regions)
+	}
+	return regions
+}
+
+// dustRun appends the highest-scoring sub-intervals of windows of w 3-mers in a run of
+// overlapping low-complexity windows, which covers 3-mers [start, end].
+// Like DUST, windows are moved by half of the window size, rather than one base,
+// so the time is linear to the length of the run.
+func dustRun(trips []uint8, start, end, w int, regions [][2]int) [][2]int {
+	step := max(w>>1, 1)
+	var a, b int
+	for s := start; ; s += step {
+		if s+w-1 >= end { // the last window ends at the end of the run
+			a, b = dustCore(trips, end-w+1, end)
+			return append(regions, [2]int{a, b + 2})
+		}
+		a, b = dustCore(trips, s, s+w-1)
+		regions = append(regions, [2]int{a, b + 2})
+	}
+}
+
+// dustCore returns the sub-range of 3-mers [start, end] with the highest score,
+// preferring longer ones for equal scores.
+func dustCore(trips []uint8, start, end int) (int, int) {
+	var counts [dustInvalid + 1]int
+	var t uint8
+	var sum, l int
+	bStart, bEnd, bSum, bL := start, end, 0, 0
+	for a := start; a < end; a++ {
+		if trips[a] == dustInvalid {
+			continue
+		}
+		clear(counts[:])
+		sum, l = 0, 0
+		for b := a; b <= end; b++ {
+			t = trips[b]
+			if t == dustInvalid {
+				continue
+			}
+			sum += counts[t]
+			counts[t]++
+			l++
+			if l < 2 {
+				continue
+			}
+			// sum/(l-1) vs bSum/(bL-1)
+			if bL == 0 || sum*(bL-1) > bSum*(l-1) ||
+				(sum*(bL-1) == bSum*(l-1) && b-a > bEnd-bStart) {
+				bStart, bEnd, bSum, bL = a, b, sum, l
+			}
+		}
+	}
+	return bStart, bEnd
+}
+
+// LowerCaseRegions appends regions of lowercase bases (soft-masked) in a sequence
+// as 0-based closed intervals to regions.
+func LowerCaseRegions(s []byte, regions [][2]int) [][2]int {
+	start := -1
+	for i, b := range s {
+		if b >= 'a' && b <= 'z' {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			regions = append(regions, [2]int{start, i - 1})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		regions = append(regions, [2]int{start, len(s) - 1})
+	}
+	return regions
+}
+
+// MergeRegions sorts 0-based closed intervals and merges overlapping or adjacent ones in place.
+func MergeRegions(regions [][2]int) [][2]int {
+	if len(regions) < 2 {
+		return regions
+	}
+	slices.SortFunc(regions, func(a, b [2]int) int {
+		if a[0] != b[0] {
+			return a[0] - b[0]
+		}
+		return a[1] - b[1]
+	})
+
+	j := 0
+	for _, r := range regions[1:] {
+		if r[0] <= regions[j][1]+1 {
+			if r[1] > regions[j][1] {
+				regions[j][1] = r[1]
+			}
+			continue
+		}
+		j++
+		regions[j] = r
+	}
+	return regions[:j+1]
+}
@@ -0,0 +1,113 @@
+// Copyright © 2023-2026 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package util
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func randomSeq(rng *rand.Rand, n int) []byte {
+	s := make([]byte, n)
+	for i := range s {
+		s[i] = "ACGT"[rng.Intn(4)]
+	}
+	return s
+}
+
+func TestDustRegions(t *testing.T) {
+	rng := rand.New(rand.NewSource(11))
+
+	// random sequences should not be masked
+	for i := 0; i < 10; i++ {
+		s := randomSeq(rng, 2000)
+		if regions := DustRegions(s, 64, 20, nil); len(regions) > 0 {
+			t.Errorf("random sequence should not be masked: %v", regions)
+		}
+	}
+
+	// low-complexity regions
+	left, right := randomSeq(rng, 200), randomSeq(rng, 200)
+	for _, repeat := range [][]byte{
+		bytes.Repeat([]byte("A"), 40),
+		bytes.Repeat([]byte("AC"), 30),
+		bytes.Repeat([]byte("ACG"), 20),
+	} {
+		s := make([]byte, 0, 500)
+		s = append(s, left...)
+		s = append(s, repeat...)
+		s = append(s, right...)
+
+		regions := DustRegions(s, 64, 20, nil)
+		if len(regions) != 1 {
+			t.Errorf("one region expected for %s: %v", repeat[:6], regions)
+			continue
+		}
+		r := regions[0]
+		a, b := len(left), len(left)+len(repeat)-1
+		if r[0] > a+2 || r[1] < b-2 || r[0] < a-5 || r[1] > b+5 {
+			t.Errorf("unexpected region for %s: %v, expected: about [%d, %d]", repeat[:6], r, a, b)
+		}
+	}
+
+	// long low-complexity regions are masked as a whole
+	s := append(append(append([]byte{}, left...), bytes.Repeat([]byte("AGT"), 20000)...), right...)
+	if regions := DustRegions(s, 64, 20, nil); len(regions) != 1 ||
+		regions[0][0] > len(left) || regions[0][1] < len(left)+60000-3 {
+		t.Errorf("unexpected regions for a long repeat: %v", regions)
+	}
+
+	// short sequences and invalid bases
+	if regions := DustRegions([]byte("AAAAAAAAAAAAAAAAAAAA"), 64, 20, nil); len(regions) != 1 ||
+		regions[0] != [2]int{0, 19} {
+		t.Errorf("unexpected regions for a short homopolymer: %v", regions)
+	}
+	if regions := DustRegions(bytes.Repeat([]byte("N"), 100), 64, 20, nil); len(regions) > 0 {
+		t.Errorf("N's should not be masked: %v", regions)
+	}
+}
+
+func TestLowerCaseRegions(t *testing.T) {
+	regions := LowerCaseRegions([]byte("acgTTGCAggcaTTg"), nil)
+	expected := [][2]int{{0, 2}, {8, 11}, {14, 14}}
+	if len(regions) != len(expected) {
+		t.Fatalf("unexpected regions: %v, expected: %v", regions, expected)
+	}
+	for i, r := range regions {
+		if r != expected[i] {
+			t.Errorf("unexpected regions: %v, expected: %v", regions, expected)
+		}
+	}
+}
+
+func TestMergeRegions(t *testing.T) {
+	regions := MergeRegions([][2]int{{10, 20}, {0, 5}, {6, 8}, {15, 30}, {40, 50}, {18, 19}})
+	expected := [][2]int{{0, 8}, {10, 30}, {40, 50}}
+	if len(regions) != len(expected) {
+		t.Fatalf("unexpected regions: %v, expected: %v", regions, expected)
+	}
+	for i, r := range regions {
+		if r != expected[i] {
+			t.Errorf("unexpected regions: %v, expected: %v", regions, expected)
+		}
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright © 2023-2026 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package util
+
+import (
+	"errors"
+	"io"
+	"os"
+)
+
+// ErrMmapClosed means the memory-mapped file is closed.
+var ErrMmapClosed = errors.New("mmap: closed")
+
+// MmapFile is a read-only memory-mapped file.
+// ReadAt() uses positional reads and can be called by any number of goroutines
+// concurrently, without extra file handlers.
+type MmapFile struct {
+	data   []byte
+	closed bool
+}
+
+// OpenMmap maps a file into memory in read-only mode.
+// The file handler is closed right after mapping.
+func OpenMmap(file string) (*MmapFile, error) {
+	fh, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	info, err := fh.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	size := info.Size()
+	if size == 0 {
+		return &MmapFile{data: []byte{}}, nil
+	}
+	if int64(int(size)) != size {
+		return nil, errors.New("mmap: file is too large: " + file)
+	}
+
+	data, err := mmap(fh, int(size))
+	if err != nil {
+		return nil, err
+	}
+	return &MmapFile{data: data}, nil
+}
+
+// Len returns the size of the file.
+func (m *MmapFile) Len() int {
+	return len(m.data)
+}
+
+// Bytes returns the mapped data, which should not be modified
+// or used after calling Close().
+func (m *MmapFile) Bytes() []byte {
+	return m.data
+}
+
+// ReadAt implements the io.ReaderAt interface.
+func (m *MmapFile) ReadAt(p []byte, off int64) (int, error) {
+	if m.closed {
+		return 0, ErrMmapClosed
+	}
+	if off < 0 {
+		return 0, errors.New("mmap: negative offset")
+	}
+	if off >= int64(len(m.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, m.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// Close unmaps the file.
+func (m *MmapFile) Close() error {
+	if m.closed {
+		return nil
+	}
+	m.closed = true
+	if len(m.data) == 0 {
+		return nil
+	}
+	data := m.data
+	m.data = nil
+	return munmap(data)
+}
@@ -0,0 +1,85 @@
+// Copyright © 2023-2026 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package util
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMmap(t *testing.T) {
+	dir := t.TempDir()
+
+	data := []byte("ACGTACGTACGTNNNNACGT")
+	file := filepath.Join(dir, "t.bin")
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := OpenMmap(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Len() != len(data) {
+		t.Fatalf("length mismatch: %d != %d", m.Len(), len(data))
+	}
+
+	buf := make([]byte, 8)
+	for off := 0; off < len(data); off++ {
+		n, err := m.ReadAt(buf, int64(off))
+		if off+len(buf) > len(data) {
+			if err != io.EOF {
+				t.Fatalf("offset %d: io.EOF expected, got: %v", off, err)
+			}
+		} else if err != nil {
+			t.Fatalf("offset %d: %s", off, err)
+		}
+		if !bytes.Equal(buf[:n], data[off:off+n]) {
+			t.Fatalf("offset %d: expected: %s, result: %s", off, data[off:off+n], buf[:n])
+		}
+	}
+
+	if err = m.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = m.ReadAt(buf, 0); err != ErrMmapClosed {
+		t.Fatalf("ErrMmapClosed expected, got: %v", err)
+	}
+
+	// empty file
+	fileEmpty := filepath.Join(dir, "empty.bin")
+	if err := os.WriteFile(fileEmpty, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	m, err = OpenMmap(fileEmpty)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = m.ReadAt(buf, 0); err != io.EOF {
+		t.Fatalf("io.EOF expected, got: %v", err)
+	}
+	if err = m.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,59 @@
+// Copyright © 2023-2026 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+//go:build windows
+
+package util
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+func mmap(fh *os.File, size int) ([]byte, error) {
+	h, err := syscall.CreateFileMapping(syscall.Handle(fh.Fd()), nil, syscall.PAGE_READONLY,
+		uint32(uint64(size)>>32), uint32(size), nil)
+	if err != nil {
+		return nil, os.NewSyscallError("CreateFileMapping", err)
+	}
+	// the mapping object can be closed right after creating the view
+	defer syscall.CloseHandle(h)
+
+	addr, err := syscall.MapViewOfFile(h, syscall.FILE_MAP_READ, 0, 0, uintptr(size))
+	if err != nil {
+		return nil, os.NewSyscallError("MapViewOfFile", err)
+	}
+
+	// build the slice header directly, as converting addr to unsafe.Pointer is not allowed by go vet
+	var data []byte
+	h2 := (*struct {
+		data uintptr
+		len  int
+		cap  int
+	})(unsafe.Pointer(&data))
+	h2.data, h2.len, h2.cap = addr, size, size
+	return data, nil
+}
+
+func munmap(data []byte) error {
+	return os.NewSyscallError("UnmapViewOfFile",
+		syscall.UnmapViewOfFile(uintptr(unsafe.Pointer(&data[0]))))
+}
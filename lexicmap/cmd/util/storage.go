@@ -0,0 +1,204 @@
+// Copyright © 2023-2026 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package util
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync"
+)
+
+// File is a read-only file of index data, supporting positional reads.
+// ReadAt() can be called by any number of goroutines concurrently.
+type File interface {
+	io.ReaderAt
+	io.Closer
+
+	// Size returns the size of the file.
+	Size() int64
+}
+
+// Storage is a backend for reading index files, e.g., the local file system,
+// or a HTTP server supporting range requests (including S3-compatible object storage).
+type Storage interface {
+	// Open opens a file for reading.
+	Open(name string) (File, error)
+}
+
+// fileVersion returns the version of a file, e.g., the ETag or the last modification time
+// of a remote file, or an empty string if it's unknown.
+func fileVersion(f File) string {
+	if v, ok := f.(interface{ Version() string }); ok {
+		return v.Version()
+	}
+	return ""
+}
+
+// NewFileReader returns a reader of a File, which supports Read() and Seek().
+func NewFileReader(f File) *io.SectionReader {
+	return io.NewSectionReader(f, 0, f.Size())
+}
+
+// ------------------------------------------------------------------------
+
+// LocalStorage reads files in the local file system.
+type LocalStorage struct{}
+
+// localFile is a local file with the size.
+type localFile struct {
+	*os.File
+	size int64
+}
+
+func (f *localFile) Size() int64 { return f.size }
+
+// Open opens a local file.
+func (LocalStorage) Open(name string) (File, error) {
+	fh, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := fh.Stat()
+	if err != nil {
+		fh.Close()
+		return nil, err
+	}
+	return &localFile{File: fh, size: fi.Size()}, nil
+}
+
+// ------------------------------------------------------------------------
+
+// URLs of remote files, where "//" might be replaced with "/" by filepath.Join().
+var reRemote = regexp.MustCompile(`^(https?):/+`)
+
+// IsRemote tells if a path is a URL of a remote file, i.e., starting with "http://" or "https://".
+// Paths created by filepath.Join() with a URL, e.g., "http:/host/db.lmi/info.toml",
+// are also recognized.
+func IsRemote(name string) bool {
+	return reRemote.MatchString(name)
+}
+
+// NormalizeURL restores the "//" after the scheme of a URL, which might be
+// replaced with "/" by filepath.Join(), and converts path separators to "/".
+func NormalizeURL(name string) string {
+	name = filepath.ToSlash(name)
+	return reRemote.ReplaceAllString(name, "$1://")
+}
+
+var mu sync.RWMutex
+var localStorage Storage = LocalStorage{}
+var remoteStorage Storage = NewHTTPStorage(nil, DefaultCacheBlockSize)
+var fetchDir string
+
+// SetRemoteStorage sets the storage backend for remote files,
+// the default one is a HTTPStorage reading in blocks of DefaultCacheBlockSize, without a local cache.
+// fetchDir is the directory for saving remote files which are read as a whole
+// with FetchFile(), the system temporary directory is used if it's empty.
+func SetRemoteStorage(s Storage, _fetchDir string) {
+	mu.Lock()
+	remoteStorage = s
+	fetchDir = _fetchDir
+	mu.Unlock()
+}
+
+// OpenFile opens a local file, or a remote file with the remote storage backend.
+func OpenFile(name string) (File, error) {
+	if IsRemote(name) {
+		mu.RLock()
+		s := remoteStorage
+		mu.RUnlock()
+		return s.Open(NormalizeURL(name))
+	}
+	return localStorage.Open(name)
+}
+
+// FetchFile returns the local path of a file. Remote files are downloaded
+// into the fetch directory, for readers which need a local file.
+// It's only used for small files, e.g., info.toml and masks.bin of an index.
+//
+// Downloaded files are named with the hash of the URL, size and version (ETag or
+// last modification time) of remote files, so they are reused only when the remote
+// files are not changed. Files without version information are always downloaded again.
+func FetchFile(name string) (string, error) {
+	if !IsRemote(name) {
+		return name, nil
+	}
+	name = NormalizeURL(name)
+
+	mu.RLock()
+	dir := fetchDir
+	mu.RUnlock()
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "lexicmap-fetch")
+	}
+
+	f, err := OpenFile(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	version := fileVersion(f)
+	h := sha256.Sum256([]byte(name + "\t" + strconv.FormatInt(f.Size(), 10) + "\t" + version))
+	file := filepath.Join(dir, hex.EncodeToString(h[:8])+"-"+filepath.Base(name))
+
+	if version != "" {
+		if _, err = os.Stat(file); err == nil {
+			return file, nil
+		}
+	}
+
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	err = writeFileAtomically(file, NewFileReader(f))
+	if err != nil {
+		return "", err
+	}
+	return file, nil
+}
+
+// writeFileAtomically writes data to a temporary file and renames it to the target one,
+// so concurrent writers and readers would not see incomplete files.
+func writeFileAtomically(file string, r io.Reader) error {
+	fh, err := os.CreateTemp(filepath.Dir(file), "."+filepath.Base(file)+".*")
+	if err != nil {
+		return err
+	}
+	tmp := fh.Name()
+
+	_, err = io.Copy(fh, r)
+	if err != nil {
+		fh.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err = fh.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, file)
+}
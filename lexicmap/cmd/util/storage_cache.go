@@ -0,0 +1,234 @@
+// Copyright © 2023-2026 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package util
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+// DefaultCacheBlockSize is the default block size of CachedStorage.
+const DefaultCacheBlockSize = 1 << 20
+
+// DefaultMemoryBlocks is the default number of recently used blocks kept in memory
+// by a CachedStorage or a HTTPStorage.
+const DefaultMemoryBlocks = 64
+
+// CachedStorage caches blocks of files of another storage, e.g., a HTTPStorage,
+// in a local directory. Blocks are saved in files named with the block numbers,
+// in a subdirectory for each file, named with the hash of the file path, size and version,
+// so the directory can be shared by multiple processes and reused in later runs.
+// The directory could be safely deleted when no processes are using it.
+//
+// Recently used blocks are also kept in memory, so small reads in the same block
+// do not read the block file again.
+type CachedStorage struct {
+	Storage   Storage
+	Dir       string
+	BlockSize int64
+
+	mem *blockLRU
+}
+
+// NewCachedStorage creates a CachedStorage, the directory is created if it does not exist.
+func NewCachedStorage(s Storage, dir string, blockSize int64) (*CachedStorage, error) {
+	if blockSize <= 0 {
+		return nil, fmt.Errorf("cache: invalid block size: %d", blockSize)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &CachedStorage{Storage: s, Dir: dir, BlockSize: blockSize,
+		mem: newBlockLRU(DefaultMemoryBlocks)}, nil
+}
+
+// cachedFile is a file with blocks cached in a local directory.
+type cachedFile struct {
+	*blockFile
+	f   File
+	dir string
+}
+
+// Open opens a file, blocks are read from the cache directory if existed.
+func (s *CachedStorage) Open(name string) (File, error) {
+	f, err := s.Storage.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	h := sha256.Sum256([]byte(name + "\t" + strconv.FormatInt(f.Size(), 10) + "\t" + fileVersion(f)))
+	dir := filepath.Join(s.Dir, hex.EncodeToString(h[:16]))
+
+	cf := &cachedFile{f: f, dir: dir}
+	cf.blockFile = &blockFile{id: dir, size: f.Size(), blockSize: s.BlockSize, mem: s.mem, read: cf.readBlock}
+	return cf, nil
+}
+
+func (f *cachedFile) Close() error { return f.f.Close() }
+
+// Version returns the version of the underlying file.
+func (f *cachedFile) Version() string { return fileVersion(f.f) }
+
+// readBlock reads the i-th block from the cache directory,
+// a missing or incomplete block is read from the storage and cached.
+// Blocks not fully read from the storage are not cached.
+func (f *cachedFile) readBlock(i int64) ([]byte, error) {
+	start := i * f.blockSize
+	size := min(f.blockSize, f.size-start)
+
+	file := filepath.Join(f.dir, "block_"+strconv.FormatInt(i, 10))
+	data, err := os.ReadFile(file)
+	if err == nil && int64(len(data)) == size {
+		return data, nil
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	data = make([]byte, size)
+	n, err := f.f.ReadAt(data, start)
+	if n < len(data) {
+		if err == nil || err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	if err = os.MkdirAll(f.dir, 0755); err != nil {
+		return nil, err
+	}
+	return data, writeFileAtomically(file, bytes.NewReader(data))
+}
+
+// ------------------------------------------------------------------------
+
+// blockFile reads a file in the unit of aligned blocks,
+// and recently used blocks are kept in a shared in-memory LRU cache.
+type blockFile struct {
+	id        string // identifier of the file in the memory cache
+	size      int64
+	blockSize int64
+	mem       *blockLRU
+
+	read func(i int64) ([]byte, error) // reading the i-th block
+}
+
+func (f *blockFile) Size() int64 { return f.size }
+
+// ReadAt reads data from blocks.
+func (f *blockFile) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("cache: negative offset")
+	}
+	if off >= f.size {
+		return 0, io.EOF
+	}
+
+	var n int
+	var block []byte
+	var err error
+	for n < len(p) && off < f.size {
+		i := off / f.blockSize
+		block, err = f.block(i)
+		if err != nil {
+			return n, err
+		}
+		m := copy(p[n:], block[off-i*f.blockSize:])
+		n += m
+		off += int64(m)
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// block returns the data of the i-th block, from the memory cache if possible.
+func (f *blockFile) block(i int64) ([]byte, error) {
+	key := blockKey{id: f.id, i: i}
+	if data, ok := f.mem.get(key); ok {
+		return data, nil
+	}
+
+	data, err := f.read(i)
+	if err != nil {
+		return nil, err
+	}
+	f.mem.add(key, data)
+	return data, nil
+}
+
+type blockKey struct {
+	id string
+	i  int64
+}
+
+type blockEntry struct {
+	key  blockKey
+	data []byte
+}
+
+// blockLRU is a concurrency-safe LRU cache of blocks with a maximum number of blocks.
+type blockLRU struct {
+	mu    sync.Mutex
+	max   int
+	ll    *list.List
+	items map[blockKey]*list.Element
+}
+
+func newBlockLRU(max int) *blockLRU {
+	return &blockLRU{max: max, ll: list.New(), items: make(map[blockKey]*list.Element, max)}
+}
+
+func (c *blockLRU) get(key blockKey) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.ll.MoveToFront(e)
+	return e.Value.(*blockEntry).data, true
+}
+
+func (c *blockLRU) add(key blockKey, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.items[key]; ok { // added by another goroutine
+		return
+	}
+	c.items[key] = c.ll.PushFront(&blockEntry{key: key, data: data})
+
+	var e *list.Element
+	for c.ll.Len() > c.max {
+		e = c.ll.Back()
+		c.ll.Remove(e)
+		delete(c.items, e.Value.(*blockEntry).key)
+	}
+}
@@ -0,0 +1,177 @@
+// Copyright © 2023-2026 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package util
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// HTTPStorage reads remote files with HTTP range requests, which are supported by
+// most HTTP file servers and S3-compatible object storage services.
+//
+// With a positive BlockSize, reads are aligned to blocks of the size, and recently used
+// blocks are kept in memory, so small reads in the same block do not send new requests.
+type HTTPStorage struct {
+	Client    *http.Client
+	BlockSize int64
+
+	mem *blockLRU
+}
+
+// NewHTTPStorage creates a HTTPStorage, a default client is used if client is nil.
+// blockSize could be 0 for reading the exact ranges.
+func NewHTTPStorage(client *http.Client, blockSize int64) *HTTPStorage {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Minute}
+	}
+	s := &HTTPStorage{Client: client, BlockSize: blockSize}
+	if blockSize > 0 {
+		s.mem = newBlockLRU(DefaultMemoryBlocks)
+	}
+	return s
+}
+
+// httpFile is a remote file read with range requests.
+type httpFile struct {
+	client  *http.Client
+	url     string
+	size    int64
+	version string
+
+	blocks *blockFile // reading in blocks, optional
+}
+
+// Open checks the existence, size and version of a remote file with a HEAD request.
+func (s *HTTPStorage) Open(url string) (File, error) {
+	resp, err := s.Client.Head(url)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, &fs.PathError{Op: "open", Path: url, Err: fs.ErrNotExist}
+	case resp.StatusCode != http.StatusOK:
+		return nil, &fs.PathError{Op: "open", Path: url, Err: fmt.Errorf("unexpected HTTP status: %s", resp.Status)}
+	case resp.ContentLength < 0:
+		return nil, &fs.PathError{Op: "open", Path: url, Err: fmt.Errorf("unknown file size")}
+	}
+
+	f := &httpFile{client: s.Client, url: url, size: resp.ContentLength}
+
+	// the ETag or the last modification time, used for invalidating cached data
+	etag, lastModified := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	if etag != "" || lastModified != "" {
+		f.version = etag + "\t" + lastModified
+	}
+
+	if s.BlockSize > 0 {
+		f.blocks = &blockFile{
+			id:        url + "\t" + strconv.FormatInt(f.size, 10) + "\t" + f.version,
+			size:      f.size,
+			blockSize: s.BlockSize,
+			mem:       s.mem,
+			read:      f.readBlock,
+		}
+	}
+	return f, nil
+}
+
+func (f *httpFile) Size() int64 { return f.size }
+
+func (f *httpFile) Close() error { return nil }
+
+// Version returns the ETag and the last modification time of the file,
+// or an empty string if the server provides neither of them.
+func (f *httpFile) Version() string { return f.version }
+
+// ReadAt reads len(p) bytes from the offset, in blocks if a block size is given.
+func (f *httpFile) ReadAt(p []byte, off int64) (int, error) {
+	if f.blocks != nil {
+		return f.blocks.ReadAt(p, off)
+	}
+	return f.readRange(p, off)
+}
+
+// readBlock reads the i-th block with a range request.
+func (f *httpFile) readBlock(i int64) ([]byte, error) {
+	start := i * f.blocks.blockSize
+	data := make([]byte, min(f.blocks.blockSize, f.size-start))
+	n, err := f.readRange(data, start)
+	if n < len(data) {
+		if err == nil || err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return data, nil
+}
+
+// readRange reads len(p) bytes from the offset with a range request.
+func (f *httpFile) readRange(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("http: negative offset")
+	}
+	if off >= f.size {
+		return 0, io.EOF
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	end := min(off+int64(len(p)), f.size) // exclusive
+
+	req, err := http.NewRequest(http.MethodGet, f.url, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", off, end-1))
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK: // the server ignores the range and returns the whole file
+		if _, err = io.CopyN(io.Discard, resp.Body, off); err != nil {
+			return 0, err
+		}
+	default:
+		return 0, &fs.PathError{Op: "read", Path: f.url, Err: fmt.Errorf("unexpected HTTP status: %s", resp.Status)}
+	}
+
+	n, err := io.ReadFull(resp.Body, p[:end-off])
+	if err != nil {
+		return n, err
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
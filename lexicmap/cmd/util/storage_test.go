@@ -0,0 +1,282 @@
+// Copyright © 2023-2026 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package util
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func checkStorageFile(t *testing.T, f File, data []byte) {
+	if f.Size() != int64(len(data)) {
+		t.Fatalf("size mismatch: %d != %d", f.Size(), len(data))
+	}
+
+	for _, size := range []int{1, 7, 64, len(data) + 10} {
+		buf := make([]byte, size)
+		for off := 0; off < len(data); off += 13 {
+			n, err := f.ReadAt(buf, int64(off))
+			if off+size > len(data) {
+				if err != io.EOF {
+					t.Fatalf("offset %d, size %d: io.EOF expected, got: %v", off, size, err)
+				}
+			} else if err != nil {
+				t.Fatalf("offset %d, size %d: %s", off, size, err)
+			}
+			if !bytes.Equal(buf[:n], data[off:min(off+size, len(data))]) {
+				t.Fatalf("offset %d, size %d: expected: %s, result: %s", off, size, data[off:off+n], buf[:n])
+			}
+		}
+	}
+
+	_, err := f.ReadAt(make([]byte, 1), int64(len(data)))
+	if err != io.EOF {
+		t.Fatalf("io.EOF expected for reading at the end, got: %v", err)
+	}
+
+	// sequential reading
+	r := NewFileReader(f)
+	r.Seek(10, io.SeekStart)
+	buf, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf, data[10:]) {
+		t.Fatalf("sequential reading: expected: %s, result: %s", data[10:], buf)
+	}
+}
+
+// shortStorage returns files with fewer data than the sizes, like a truncated response.
+type shortStorage struct{ data []byte }
+
+type shortFile struct{ data []byte }
+
+func (s shortStorage) Open(name string) (File, error) { return shortFile(s), nil }
+
+func (f shortFile) ReadAt(p []byte, off int64) (int, error) {
+	if off >= int64(len(f.data)) {
+		return 0, io.EOF
+	}
+	n := copy(p, f.data[off:])
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+func (f shortFile) Close() error { return nil }
+
+func (f shortFile) Size() int64 { return int64(len(f.data)) + 10 }
+
+func TestCachedStorageShortRead(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewCachedStorage(shortStorage{data: bytes.Repeat([]byte("ACGT"), 25)}, dir, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := s.Open("http://localhost/db.lmi/info.toml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	buf := make([]byte, 10)
+	if _, err = f.ReadAt(buf, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = f.ReadAt(buf, 100); err != io.ErrUnexpectedEOF {
+		t.Fatalf("io.ErrUnexpectedEOF expected for a short read, got: %v", err)
+	}
+
+	// only the complete block is cached
+	blocks, err := filepath.Glob(filepath.Join(dir, "*", "block_*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 1 || filepath.Base(blocks[0]) != "block_0" {
+		t.Fatalf("unexpected cached blocks: %v", blocks)
+	}
+}
+
+func TestStorage(t *testing.T) {
+	dir := t.TempDir()
+
+	data := bytes.Repeat([]byte("ACGTACGTACGTNNNNACGT"), 50)
+	if err := os.MkdirAll(filepath.Join(dir, "db.lmi", "seeds"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "db.lmi", "seeds", "chunk_000.bin")
+	if err := os.WriteFile(file, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var nGets atomic.Int64 // number of GET requests
+	fileServer := http.FileServer(http.Dir(dir))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			nGets.Add(1)
+		}
+		fileServer.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	// paths
+
+	url := filepath.Join(server.URL, "db.lmi", "seeds", "chunk_000.bin")
+	if !IsRemote(url) || IsRemote(file) {
+		t.Fatalf("failed to recognize URLs: %s, %s", url, file)
+	}
+	if NormalizeURL(url) != server.URL+"/db.lmi/seeds/chunk_000.bin" {
+		t.Fatalf("failed to normalize URL: %s", url)
+	}
+
+	// local
+
+	f, err := OpenFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkStorageFile(t, f, data)
+	f.Close()
+
+	// http
+
+	f, err = OpenFile(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkStorageFile(t, f, data)
+	f.Close()
+
+	// http, reading exact ranges or in blocks
+
+	for _, blockSize := range []int64{0, 64} {
+		f, err = NewHTTPStorage(nil, blockSize).Open(NormalizeURL(url))
+		if err != nil {
+			t.Fatal(err)
+		}
+		nGets.Store(0)
+		checkStorageFile(t, f, data)
+		f.Close()
+
+		if blockSize > 0 && nGets.Load() != (int64(len(data))+blockSize-1)/blockSize {
+			t.Fatalf("block size %d: blocks should be read only once: %d requests", blockSize, nGets.Load())
+		}
+	}
+
+	_, err = OpenFile(url + ".idx")
+	if !os.IsNotExist(err) {
+		t.Fatalf("not-exist error expected, got: %v", err)
+	}
+
+	// cache
+
+	dirCache := filepath.Join(dir, "cache")
+	s, err := NewCachedStorage(NewHTTPStorage(nil, 0), dirCache, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetRemoteStorage(s, filepath.Join(dir, "fetch"))
+	defer SetRemoteStorage(NewHTTPStorage(nil, DefaultCacheBlockSize), "")
+
+	f, err = OpenFile(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkStorageFile(t, f, data)
+
+	blocks, err := filepath.Glob(filepath.Join(dirCache, "*", "block_*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != (len(data)+63)/64 {
+		t.Fatalf("number of cached blocks mismatch: %d != %d", len(blocks), (len(data)+63)/64)
+	}
+
+	// reading from cached blocks, after the remote file is changed, but with the same size.
+	data2 := bytes.Repeat([]byte("N"), len(data))
+	if err = os.WriteFile(file, data2, 0644); err != nil {
+		t.Fatal(err)
+	}
+	checkStorageFile(t, f, data)
+	f.Close()
+
+	// fetching, the remote file has been changed after creating cached blocks,
+	// with a different modification time.
+
+	mtime := time.Now().Add(-time.Hour)
+	if err = os.Chtimes(file, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+
+	fileLocal, err := FetchFile(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if IsRemote(fileLocal) {
+		t.Fatalf("local file expected: %s", fileLocal)
+	}
+	buf, err := os.ReadFile(fileLocal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf, data2) {
+		t.Fatalf("fetched data mismatch")
+	}
+
+	// fetched files are reused if the remote file is not changed.
+
+	fileLocal2, err := FetchFile(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fileLocal2 != fileLocal {
+		t.Fatalf("fetched file should be reused: %s != %s", fileLocal2, fileLocal)
+	}
+
+	// and they are fetched again after the remote file is changed.
+
+	if err = os.WriteFile(file, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	mtime = mtime.Add(time.Minute)
+	if err = os.Chtimes(file, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	fileLocal, err = FetchFile(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, err = os.ReadFile(fileLocal)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf, data) {
+		t.Fatalf("fetched data of the changed remote file mismatch")
+	}
+}
@@ -0,0 +1,436 @@
+// Copyright © 2023-2026 Wei Shen <shenwei356@gmail.com>
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shenwei356/LexicMap/lexicmap/cmd/annotation"
+	"github.com/shenwei356/LexicMap/lexicmap/cmd/genome"
+	"github.com/shenwei356/LexicMap/lexicmap/cmd/kv"
+	"github.com/shenwei356/LexicMap/lexicmap/cmd/seedposition"
+	"github.com/shenwei356/lexichash"
+	"github.com/shenwei356/util/pathutil"
+	"github.com/spf13/cobra"
+)
+
+var verifyIndexCmd = &cobra.Command{
+	Use:   "verify-index",
+	Short: "Verify the integrity of an index",
+	Long: `Verify the integrity of an index
+
+Checks:
+  1. Presence of all files, according to the number of seed chunks and genome batches in info.toml.
+  2. Headers (magic numbers, versions, and metadata) of all binary files:
+       masks.bin:            the number of masks and k-mer size are consistent with info.toml.
+       genomes.map.bin:      the number of genomes is consistent with info.toml.
+       seeds/chunk_*.bin:    k-mer size, and the mask range are consistent with the .idx file.
+       genomes/batch_*:      the batch id and the last genome record of genome data files.
+  3. Sizes and SHA-256 checksums of files recorded in the manifest file (manifest.tsv),
+     which is created by "lexicmap index" since v0.10.0. Checksums are recorded by default,
+     unless the flag --no-checksums is given in "lexicmap index". They are computed in
+     parallel (-j/--threads), and they are not checked in the quick mode (--quick).
+
+Output (tab-delimited, only problematic files are reported by default, use -a/--all to report all):
+  1. file,    path relative to the index directory.
+  2. status,  ok, missing, broken, size-mismatch, checksum-mismatch, or unlisted.
+  3. message, details of the problem.
+
+  A non-zero exit status is returned if any problem is found. Files absent
+  in the manifest (unlisted) are reported but not treated as problems.
+
+Tips:
+  - The manifest is updated by "lexicmap utils reindex-seeds", "lexicmap utils remerge",
+    and "lexicmap utils edit-genome-ids".
+
+`,
+	Run: func(cmd *cobra.Command, args []string) {
+		opt := getOptions(cmd)
+
+		dbDir := getFlagString(cmd, "index")
+		if dbDir == "" {
+			checkError(fmt.Errorf("flag -d/--index needed"))
+		}
+		outFile := getFlagString(cmd, "out-file")
+		quick := getFlagBool(cmd, "quick")
+		reportAll := getFlagBool(cmd, "all")
+
+		timeStart := time.Now()
+		defer func() {
+			if opt.Verbose {
+				log.Info()
+				log.Infof("elapsed time: %s", time.Since(timeStart))
+				log.Info()
+			}
+		}()
+
+		// ---------------------------------------------------------------
+
+		info, err := readIndexInfo(filepath.Join(dbDir, FileInfo))
+		if err != nil {
+			checkError(fmt.Errorf("failed to read info file: %s", err))
+		}
+
+		var manifest map[string]*IndexFileRecord
+		fileManifest := filepath.Join(dbDir, FileManifest)
+		ok, err := pathutil.Exists(fileManifest)
+		if err != nil {
+			checkError(fmt.Errorf("failed to check manifest file: %s", err))
+		}
+		if ok {
+			records, err := readIndexManifest(fileManifest)
+			if err != nil {
+				checkError(fmt.Errorf("failed to read manifest file: %s", err))
+			}
+			manifest = make(map[string]*IndexFileRecord, len(records))
+			for _, r := range records {
+				manifest[r.File] = r
+			}
+		} else {
+			log.Warningf("manifest file not found, sizes and checksums are not checked: %s", fileManifest)
+		}
+
+		layout, err := NewIndexLayout(dbDir, info)
+		checkError(err)
+		checkError(layout.CheckRoots())
+
+		checker := &IndexVerifier{layout: layout, info: info, manifest: manifest, quick: quick}
+		results := checker.Verify(opt.NumCPUs)
+
+		// ---------------------------------------------------------------
+
+		outfh, gw, w, err := outStream(outFile, strings.HasSuffix(outFile, ".gz"), opt.CompressionLevel)
+		checkError(err)
+
+		var nProblems, nUnlisted int
+		fmt.Fprintf(outfh, "file\tstatus\tmessage\n")
+		for _, r := range results {
+			switch r.Status {
+			case "ok":
+				if !reportAll {
+					continue
+				}
+			case "unlisted":
+				nUnlisted++
+			default:
+				nProblems++
+			}
+			fmt.Fprintf(outfh, "%s\t%s\t%s\n", r.File, r.Status, r.Message)
+		}
+
+		outfh.Flush()
+		if gw != nil {
+			gw.Close()
+		}
+		w.Close()
+
+		if opt.Verbose {
+			log.Infof("%d files checked, %d unlisted in the manifest", len(results), nUnlisted)
+		}
+		if nProblems > 0 {
+			checkError(fmt.Errorf("%d problems found in the index: %s", nProblems, dbDir))
+		}
+		if opt.Verbose {
+			log.Infof("no problems found in the index: %s", dbDir)
+		}
+	},
+}
+
+func init() {
+	utilsCmd.AddCommand(verifyIndexCmd)
+
+	verifyIndexCmd.Flags().StringP("index", "d", "",
+		formatFlagUsage(`Index directory created by "lexicmap index".`))
+
+	verifyIndexCmd.Flags().StringP("out-file", "o", "-",
+		formatFlagUsage(`Out file, supports the ".gz" suffix ("-" for stdout).`))
+
+	verifyIndexCmd.Flags().BoolP("quick", "", false,
+		formatFlagUsage(`Quick mode, only checking presence, sizes, and headers of files, without computing checksums.`))
+
+	verifyIndexCmd.Flags().BoolP("all", "a", false,
+		formatFlagUsage(`Report all files, including those without problems.`))
+
+	verifyIndexCmd.SetUsageTemplate(usageTemplate("-d <index path> [-o out.tsv]"))
+}
+
+// IndexFileStatus is the verification result of an index file.
+type IndexFileStatus struct {
+	File    string
+	Status  string
+	Message string
+}
+
+// IndexVerifier checks the integrity of an index.
+type IndexVerifier struct {
+	layout   *IndexLayout
+	info     *IndexInfo
+	manifest map[string]*IndexFileRecord // nil for indexes without a manifest file
+	quick    bool
+}
+
+// indexFileCheck is a file to check, with an optional function to check the header.
+type indexFileCheck struct {
+	file     string // relative path
+	optional bool   // do not report it if it's absent in both the directory and the manifest
+	header   func(file string) error
+}
+
+// Verify checks all files in parallel, and returns results sorted by file paths.
+func (v *IndexVerifier) Verify(threads int) []*IndexFileStatus {
+	if threads < 1 {
+		threads = 1
+	}
+	checks := v.files()
+
+	results := make([]*IndexFileStatus, len(checks))
+	var wg sync.WaitGroup
+	tokens := make(chan int, threads)
+	for i, c := range checks {
+		wg.Add(1)
+		tokens <- 1
+		go func(i int, c *indexFileCheck) {
+			defer func() {
+				wg.Done()
+				<-tokens
+			}()
+			results[i] = v.check(c)
+		}(i, c)
+	}
+	wg.Wait()
+
+	// absent optional files
+	results = slices.DeleteFunc(results, func(r *IndexFileStatus) bool { return r == nil })
+
+	slices.SortFunc(results, func(a, b *IndexFileStatus) int {
+		return strings.Compare(a.File, b.File)
+	})
+	return results
+}
+
+// files returns all files to check.
+func (v *IndexVerifier) files() []*indexFileCheck {
+	info := v.info
+	checks := make([]*indexFileCheck, 0, info.Chunks*2+info.GenomeBatches*4+3)
+	listed := make(map[string]struct{}, info.Chunks*2+info.GenomeBatches*4+3)
+	add := func(c *indexFileCheck) {
+		listed[c.file] = struct{}{}
+		checks = append(checks, c)
+	}
+
+	add(&indexFileCheck{file: FileMasks, header: v.checkMasks})
+	add(&indexFileCheck{file: FileGenomeIndex, header: v.checkGenomeMap})
+	add(&indexFileCheck{file: FileGenomeChunks, optional: true, header: func(file string) error {
+		_, err := readGenomeChunksLists(file)
+		return err
+	}})
+
+	var file string
+	for chunk := 0; chunk < info.Chunks; chunk++ {
+		file = path.Join(DirSeeds, chunkFile(chunk))
+		add(&indexFileCheck{file: file, header: v.checkSeedData})
+		add(&indexFileCheck{file: file + kv.KVIndexFileExt, header: v.checkSeedIndex})
+	}
+
+	for batch := 0; batch < info.GenomeBatches; batch++ {
+		file = path.Join(DirGenomes, batchDir(batch), FileGenomes)
+		add(&indexFileCheck{file: file, header: func(file string) error {
+			_, _, err := genome.ReadDataHeader(file)
+			return err
+		}})
+		add(&indexFileCheck{file: file + genome.GenomeIndexFileExt, header: v.genomeBatchChecker(batch)})
+
+		file = path.Join(DirGenomes, batchDir(batch), FileSeedPositions)
+		add(&indexFileCheck{file: file, optional: true})
+		add(&indexFileCheck{file: file + seedposition.PositionsIndexFileExt, optional: true, header: v.checkSeedPositions})
+
+		file = path.Join(DirGenomes, batchDir(batch), FileAnnotations)
+		add(&indexFileCheck{file: file, optional: true})
+		add(&indexFileCheck{file: file + annotation.AnnotationsIndexFileExt, optional: true, header: v.checkAnnotations})
+	}
+
+	// other files in the manifest
+	for f := range v.manifest {
+		if _, ok := listed[f]; !ok {
+			add(&indexFileCheck{file: f})
+		}
+	}
+
+	return checks
+}
+
+// check checks the presence, size, header, and checksum of a file.
+func (v *IndexVerifier) check(c *indexFileCheck) *IndexFileStatus {
+	r := &IndexFileStatus{File: c.file, Status: "ok"}
+	file := v.layout.File(c.file)
+
+	var record *IndexFileRecord
+	var inManifest bool
+	if v.manifest != nil {
+		record, inManifest = v.manifest[c.file]
+	}
+
+	fi, err := os.Stat(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			if c.optional && !inManifest {
+				return nil
+			}
+			r.Status, r.Message = "missing", "file not found"
+			return r
+		}
+		r.Status, r.Message = "broken", err.Error()
+		return r
+	}
+
+	if inManifest && fi.Size() != record.Size {
+		r.Status = "size-mismatch"
+		r.Message = fmt.Sprintf("expected %d bytes, found %d bytes", record.Size, fi.Size())
+		return r
+	}
+
+	if c.header != nil {
+		if err = c.header(file); err != nil {
+			r.Status, r.Message = "broken", err.Error()
+			return r
+		}
+	}
+
+	if v.manifest != nil && !inManifest {
+		r.Status, r.Message = "unlisted", "file not found in the manifest"
+		return r
+	}
+
+	if !v.quick && inManifest && record.HasChecksum() {
+		checksum, _, err := fileChecksum(file)
+		if err != nil {
+			r.Status, r.Message = "broken", err.Error()
+			return r
+		}
+		if checksum != record.Checksum {
+			r.Status = "checksum-mismatch"
+			r.Message = fmt.Sprintf("expected %s, found %s", record.Checksum, checksum)
+			return r
+		}
+	}
+
+	return r
+}
+
+func (v *IndexVerifier) checkMasks(file string) error {
+	lh, err := lexichash.NewFromFile(file)
+	if err != nil {
+		return err
+	}
+	if len(lh.Masks) != v.info.Masks {
+		return fmt.Errorf("%d masks found, while %d expected in the info file", len(lh.Masks), v.info.Masks)
+	}
+	if lh.K != int(v.info.K) {
+		return fmt.Errorf("k-mer size %d found, while %d expected in the info file", lh.K, v.info.K)
+	}
+	return nil
+}
+
+func (v *IndexVerifier) checkGenomeMap(file string) error {
+	m, err := readGenomeMapIdx2Name(file)
+	if err != nil {
+		return err
+	}
+	if len(m) != v.info.Genomes {
+		return fmt.Errorf("%d genomes found, while %d expected in the info file", len(m), v.info.Genomes)
+	}
+	return nil
+}
+
+func (v *IndexVerifier) checkSeedData(file string) error {
+	k, _, _, _, err := kv.ReadKVDataHeader(file)
+	if err != nil {
+		return err
+	}
+	if k != v.info.K {
+		return fmt.Errorf("k-mer size %d found, while %d expected in the info file", k, v.info.K)
+	}
+	return nil
+}
+
+func (v *IndexVerifier) checkSeedIndex(file string) error {
+	k, iFirstMask, nMasks, _, _, err := kv.ReadKVIndexInfo(file)
+	if err != nil {
+		return err
+	}
+	k2, iFirstMask2, nMasks2, _, err := kv.ReadKVDataHeader(strings.TrimSuffix(file, kv.KVIndexFileExt))
+	if err != nil {
+		return fmt.Errorf("failed to read the data file: %s", err)
+	}
+	if k != k2 || iFirstMask != iFirstMask2 || nMasks != nMasks2 {
+		return fmt.Errorf("inconsistent with the data file: k %d vs %d, first mask %d vs %d, masks %d vs %d",
+			k, k2, iFirstMask, iFirstMask2, nMasks, nMasks2)
+	}
+	return nil
+}
+
+// genomeBatchChecker checks the batch id and reads the last genome record of a genome batch.
+func (v *IndexVerifier) genomeBatchChecker(batch int) func(file string) error {
+	return func(file string) error {
+		rdr, err := genome.NewReader(strings.TrimSuffix(file, genome.GenomeIndexFileExt))
+		if err != nil {
+			return err
+		}
+		defer rdr.Close()
+
+		if int(rdr.Batch()) != batch {
+			return fmt.Errorf("batch id %d found, while %d expected", rdr.Batch(), batch)
+		}
+		if rdr.NumGenomes() == 0 {
+			return nil
+		}
+		g, err := rdr.GenomeInfo(rdr.NumGenomes() - 1)
+		if err != nil {
+			return fmt.Errorf("failed to read the last genome: %s", err)
+		}
+		genome.RecycleGenome(g)
+		return nil
+	}
+}
+
+func (v *IndexVerifier) checkSeedPositions(file string) error {
+	rdr, err := seedposition.NewReader(strings.TrimSuffix(file, seedposition.PositionsIndexFileExt))
+	if err != nil {
+		return err
+	}
+	return rdr.Close()
+}
+
+// checkAnnotations checks the headers of an annotation file and its index file.
+func (v *IndexVerifier) checkAnnotations(file string) error {
+	rdr, err := annotation.NewReader(strings.TrimSuffix(file, annotation.AnnotationsIndexFileExt))
+	if err != nil {
+		return err
+	}
+	return rdr.Close()
+}